@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/dlukt/dnsctl/internal/audit"
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/dnssec"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/internal/rrset"
+	"github.com/dlukt/dnsctl/internal/ssh"
+	"github.com/dlukt/dnsctl/internal/zone"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/spf13/cobra"
+)
+
+// configError marks failures to load or validate the config file
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string {
+	return "failed to load config: " + e.err.Error()
+}
+
+func (e *configError) Unwrap() error {
+	return e.err
+}
+
+// usageError marks errors in the command line itself: unknown commands,
+// wrong argument counts and bad or missing flags
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+// markUsageErrors makes cobra's argument and flag errors in the tree below
+// cmd usageErrors. Required flags and flag groups are checked along with
+// the arguments, since cobra reports them unwrapped after the pre-run hooks.
+func markUsageErrors(cmd *cobra.Command) {
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return &usageError{err: err}
+	})
+	markArgErrors(cmd)
+}
+
+// markArgErrors wraps the argument validators of the runnable commands
+// below cmd
+func markArgErrors(cmd *cobra.Command) {
+	if cmd.Runnable() {
+		args := cmd.Args
+		cmd.Args = func(cmd *cobra.Command, a []string) error {
+			if args != nil {
+				if err := args(cmd, a); err != nil {
+					return &usageError{err: err}
+				}
+			}
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return &usageError{err: err}
+			}
+			if err := cmd.ValidateFlagGroups(); err != nil {
+				return &usageError{err: err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markArgErrors(sub)
+	}
+}
+
+// exitError carries the exit code of a failed operation whose error result
+// has already been written to stdout
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return "operation failed"
+}
+
+// exitCode classifies an error into the exit codes of spec 7.2
+func exitCode(err error) int {
+	if err == nil {
+		return audit.ExitSuccess
+	}
+
+	// Validation errors: bad name/type/ttl/rdata
+	var nameErr *zone.NameError
+	var optionErr *zone.OptionError
+	var validationErr *rrset.ValidationError
+	var parseErr *ssh.ParseError
+	if errors.As(err, &nameErr) || errors.As(err, &optionErr) ||
+		errors.As(err, &validationErr) || errors.As(err, &parseErr) || errors.Is(err, bind.ErrAmbiguousKey) {
+		return audit.ExitValidationError
+	}
+
+	// Conflict/unsafe: policy violations and concurrent modification
+	var policyErr *rrset.PolicyError
+	var notAllowedErr *ssh.NotAllowedError
+	var labelErr *zone.LabelConflictError
+	if errors.As(err, &policyErr) || errors.As(err, &notAllowedErr) || errors.As(err, &labelErr) ||
+		errors.Is(err, lock.ErrLocked) || errors.Is(err, zone.ErrSeveralCatalogs) {
+		return audit.ExitConflictUnsafe
+	}
+	var rcodeErr *update.RcodeError
+	if errors.As(err, &rcodeErr) && rcodeErr.PrerequisiteFailed() {
+		return audit.ExitConflictUnsafe
+	}
+
+	// Precondition failures: BIND/rndc/config missing
+	var cfgErr *configError
+	if errors.As(err, &cfgErr) || errors.Is(err, bind.ErrRNDCUnavailable) || errors.Is(err, ssh.ErrNoCommand) ||
+		errors.Is(err, zone.ErrNoSecondaries) || errors.Is(err, zone.ErrNotMember) || errors.Is(err, zone.ErrNoParent) ||
+		errors.Is(err, bind.ErrNoDNSSECPolicy) || errors.Is(err, dnssec.ErrUnsigned) || errors.Is(err, bind.ErrKeyNotFound) {
+		return audit.ExitPreconditionFail
+	}
+
+	// Everything else is a runtime failure (rndc failure, update refused, IO error)
+	return audit.ExitRuntimeFailure
+}
+
+// fail reports a failed operation: it logs the error, writes the audit entry
+// and the JSON error result, and returns an error carrying the exit code
+func fail(logger *audit.Logger, op string, err error) error {
+	return failWithCode(logger, op, exitCode(err), err)
+}
+
+// failWithCode is fail with an explicit exit code
+func failWithCode(logger *audit.Logger, op string, code int, err error) error {
+	logger.Error(err.Error())
+	result := audit.NewErrorResult(op, logger.RequestID(), code, err.Error(), "")
+	logger.WriteAudit(result)
+	if outErr := result.Output(); outErr != nil {
+		logger.Error(outErr.Error())
+		return &exitError{code: audit.ExitInternalError}
+	}
+
+	return &exitError{code: code}
+}
+
+// commandExitCode maps an error returned by the cobra command tree to an exit code.
+// Operations report their failures through fail; the other errors come from
+// loading the config or from the command line (see usageError).
+func commandExitCode(err error) int {
+	var exitErr *exitError
+	var cfgErr *configError
+	var usageErr *usageError
+	switch {
+	case err == nil:
+		return audit.ExitSuccess
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.As(err, &cfgErr):
+		return audit.ExitPreconditionFail
+	case errors.As(err, &usageErr):
+		return audit.ExitValidationError
+	default:
+		return audit.ExitRuntimeFailure
+	}
+}
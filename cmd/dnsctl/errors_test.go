@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/audit"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/internal/zone"
+)
+
+// TestExitCode tests the classification of operation errors into exit codes
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"success", nil, audit.ExitSuccess},
+		{"option", &zone.OptionError{Option: "label", Err: errors.New("bad")}, audit.ExitValidationError},
+		{"label conflict", &zone.LabelConflictError{Label: "a", Zone: "b.", Existing: "c."}, audit.ExitConflictUnsafe},
+		{"locked", fmt.Errorf("failed to acquire zone lock: %w", lock.ErrLocked), audit.ExitConflictUnsafe},
+		{"several catalogs", fmt.Errorf("example.com.: %w: a. and b.", zone.ErrSeveralCatalogs), audit.ExitConflictUnsafe},
+		{"not a member", fmt.Errorf("example.com.: %w", zone.ErrNotMember), audit.ExitPreconditionFail},
+		{"other", errors.New("connection refused"), audit.ExitRuntimeFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
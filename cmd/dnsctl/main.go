@@ -1,23 +1,51 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/dlukt/dnsctl/internal/acme"
 	"github.com/dlukt/dnsctl/internal/audit"
 	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/dnssec"
+	"github.com/dlukt/dnsctl/internal/doctor"
+	"github.com/dlukt/dnsctl/internal/rrset"
+	"github.com/dlukt/dnsctl/internal/ssh"
 	"github.com/dlukt/dnsctl/internal/zone"
 	"github.com/spf13/cobra"
 )
 
+const defaultConfigPath = "/etc/dnsctl/config.yaml"
+
 var (
 	cfgFile string
 	verbose bool
 	version = "dev"
+
+	// wrapActor is the SSH actor of a command dispatched by --ssh-wrap
+	wrapActor string
 )
 
 func main() {
+	rootCmd := newRootCmd(defaultConfigPath)
+
+	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitError
+		if !errors.As(err, &exitErr) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(commandExitCode(err))
+	}
+}
+
+// newRootCmd builds the dnsctl command tree. SSH-wrapped commands are
+// dispatched in-process through a fresh tree built with the operator's config path.
+func newRootCmd(defaultConfig string) *cobra.Command {
+	var sshWrap bool
+
 	rootCmd := &cobra.Command{
 		Use:   "dnsctl",
 		Short: "BIND 9 DNS control tool for catalog zones",
@@ -26,45 +54,93 @@ func main() {
 Automates zone lifecycle and record management using catalog zones.
 Runs on a hidden primary BIND server via SSH.`,
 		Version: version,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !sshWrap {
+				return cmd.Help()
+			}
+			return runSSHWrap()
+		},
 	}
 
-	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "/etc/dnsctl/config.yaml", "config file path")
+	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", defaultConfig, "config file path")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 
+	// SSH callers must not choose the config (and with it the TSIG key and rndc binary)
+	_ = rootCmd.PersistentFlags().SetAnnotation("config", ssh.OperatorOnlyAnnotation, []string{"true"})
+
+	// SSH forced-command mode: dnsctl --ssh-wrap (spec 8.1)
+	rootCmd.Flags().BoolVar(&sshWrap, "ssh-wrap", false, "SSH forced-command wrapper mode")
+	_ = rootCmd.Flags().MarkHidden("ssh-wrap")
+
+	// Operations write their own JSON error results; see fail
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+
 	// Add subcommands
 	rootCmd.AddCommand(doctorCmd())
 	rootCmd.AddCommand(versionCmd())
 	rootCmd.AddCommand(zoneCmd())
+	rootCmd.AddCommand(catalogCmd())
+	rootCmd.AddCommand(dnssecCmd())
 	rootCmd.AddCommand(rrsetCmd())
 	rootCmd.AddCommand(acmeCmd())
-	rootCmd.AddCommand(sshWrapCmd())
 
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
-	}
+	// Command line errors exit with the validation code; see commandExitCode
+	markUsageErrors(rootCmd)
+
+	return rootCmd
 }
 
 // loadConfig loads the configuration
 func loadConfig() (*config.Config, *audit.Logger, error) {
 	cfg, err := config.Load(cfgFile)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to load config: %w", err)
+		return nil, nil, &configError{err: err}
 	}
 
 	logger := audit.NewLogger(os.Stderr, cfg.Logging.AuditJSONL, cfg.Logging.IncludeActor)
 	if verbose {
 		logger.SetVerbose(true)
 	}
+	if wrapActor != "" {
+		logger.WithActor(wrapActor)
+	}
 
 	return cfg, logger, nil
 }
 
+// outputJSON writes an operation-specific result as indented JSON to stdout
+func outputJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// doctorResult is the doctor output: the standard result plus per-check outcomes
+type doctorResult struct {
+	*audit.Result
+	DryRun bool           `json:"dry_run,omitempty"`
+	Checks []doctor.Check `json:"checks"`
+}
+
 // doctorCmd implements the doctor command
 func doctorCmd() *cobra.Command {
+	var fix, dryRun bool
+
 	cmd := &cobra.Command{
 		Use:   "doctor",
 		Short: "Run BIND precondition checks",
-		Long:  "Checks that BIND is properly configured for dnsctl operations.",
+		Long: `Checks that BIND is properly configured for dnsctl operations.
+
+With --fix, safe remediations are applied before the checks run: missing
+zones and lock directories are created, TSIG secret file permissions are
+tightened, a missing catalog version record is added and catalog PTRs are
+re-added for zones named has loaded but the catalog lacks. --dry-run lists
+the fixes without applying them.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, logger, err := loadConfig()
 			if err != nil {
@@ -74,29 +150,51 @@ func doctorCmd() *cobra.Command {
 
 			logger.WithOp("doctor")
 
-			// TODO: Implement doctor checks using namedzone library
-			// For now, just output a simple check
-			result := audit.NewResult("doctor", logger.RequestID())
-			result.AddChange("config_loaded")
+			checker := doctor.NewChecker(cfg)
+			result := &doctorResult{
+				Result: audit.NewResult("doctor", logger.RequestID()),
+				DryRun: dryRun,
+			}
+
+			if fix || dryRun {
+				if err := checker.Fix(dryRun, &result.Changes); err != nil {
+					logger.Warn(fmt.Sprintf("fix failed: %v", err))
+					result.AddWarning(fmt.Sprintf("fix failed: %v", err))
+				}
+			}
 
-			// Check config paths
-			if _, err := os.Stat(cfg.Bind.RNDCPath); err != nil {
-				result.AddWarning(fmt.Sprintf("rndc not found: %s", cfg.Bind.RNDCPath))
-			} else {
-				result.AddChange("rndc_found")
+			checks := checker.Run()
+			result.Checks = checks
+			for _, check := range checks {
+				if check.Status == doctor.StatusWarn {
+					result.AddWarning(fmt.Sprintf("%s: %s", check.Name, check.Message))
+				}
 			}
 
-			if _, err := os.Stat(cfg.Bind.RNDCConf); err != nil {
-				result.AddWarning(fmt.Sprintf("rndc.conf not found: %s", cfg.Bind.RNDCConf))
-			} else {
-				result.AddChange("rndc_conf_found")
+			if failed := doctor.Failed(checks); failed > 0 {
+				result.OK = false
+				result.Error = &audit.Error{
+					Code:    audit.ExitPreconditionFail,
+					Message: fmt.Sprintf("%d of %d checks failed", failed, len(checks)),
+				}
+				logger.Error(result.Error.Message)
+				logger.WriteAudit(result.Result)
+				if err := outputJSON(result); err != nil {
+					return &exitError{code: audit.ExitInternalError}
+				}
+				return &exitError{code: audit.ExitPreconditionFail}
 			}
 
-			logger.WriteAudit(result)
-			return result.Output()
+			logger.WriteAudit(result.Result)
+			return outputJSON(result)
 		},
 	}
 
+	cmd.Flags().BoolVar(&fix, "fix", false, "apply safe remediations before checking")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "list the remediations --fix would apply without applying them")
+	// Fixes chown and chmod local files, which is not for SSH callers
+	_ = cmd.Flags().SetAnnotation("fix", ssh.OperatorOnlyAnnotation, []string{"true"})
+
 	return cmd
 }
 
@@ -124,18 +222,53 @@ func zoneCmd() *cobra.Command {
 
 	cmd.AddCommand(zoneCreateCmd())
 	cmd.AddCommand(zoneDeleteCmd())
+	cmd.AddCommand(zoneDelegateCmd())
 	cmd.AddCommand(zoneStatusCmd())
 	cmd.AddCommand(zoneListCmd())
+	cmd.AddCommand(zonePropagationCmd())
+	cmd.AddCommand(zoneCatalogSetCmd())
+	cmd.AddCommand(zoneMoveCatalogCmd())
+	cmd.AddCommand(zoneSetDNSSECPolicyCmd())
+	cmd.AddCommand(zoneVerifyCmd())
 
 	return cmd
 }
 
 // zoneCreateCmd implements zone create
 func zoneCreateCmd() *cobra.Command {
+	var opts zone.CreateOptions
+	var properties []string
+
 	cmd := &cobra.Command{
 		Use:   "create <zone>",
 		Short: "Create a new authoritative primary zone",
-		Args:  cobra.ExactArgs(1),
+		Long: `Creates a primary zone in named and adds it to the catalog zone.
+
+The catalog member label defaults to the zone's sha1-wire label. --label
+chooses another one: random, uuid or a literal DNS label; freely chosen labels
+are recorded in the catalog, which requires catalog schema version 2. Creating an existing zone with a new --label
+moves its catalog entry, which makes the secondaries reset the zone. A label
+that already belongs to another zone is refused with exit code 5.
+
+With catalog.schema_version 2, --catalog-group sets the member's group
+property and --property key=value sets custom properties below the ext label
+(<key>.ext.<label>.zones.<catalog>), so secondaries can apply different
+templates. For an existing member they are updated in place.
+
+The zone is added to the catalog named by --catalog, or else to the one the
+catalog.rules of the config select by zone suffix. An existing member stays in
+its catalog; use zone move-catalog to move it.
+
+--dnssec-policy selects the zone's dnssec-policy instead of
+zones.dnssec_policy: a policy defined in named.conf, one of named's built-in
+policies (default, insecure) or none for an unsigned zone. An undefined policy
+is refused with exit code 2.
+
+--delegate also delegates the zone from its closest enclosing zone that is a
+catalog member, as zone delegate does; without one the zone is not created and
+the exit code is 3. If only the delegation fails, the zone stays and zone
+delegate can be run again.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, logger, err := loadConfig()
 			if err != nil {
@@ -145,15 +278,15 @@ func zoneCreateCmd() *cobra.Command {
 
 			logger.WithOp("zone_create").WithZone(args[0])
 
+			if opts.Properties, err = zone.ParseProperties(properties); err != nil {
+				return fail(logger, "zone_create", err)
+			}
+
 			creator := zone.NewCreator(cfg)
 			var changes []string
 
-			if err := creator.CreateZone(args[0], &changes); err != nil {
-				logger.Error(err.Error())
-				result := audit.NewErrorResult("zone_create", logger.RequestID(),
-					audit.ExitRuntimeFailure, err.Error(), "")
-				logger.WriteAudit(result)
-				return result.Output()
+			if err := creator.CreateZone(args[0], opts, &changes); err != nil {
+				return fail(logger, "zone_create", err)
 			}
 
 			result := audit.NewResult("zone_create", logger.RequestID())
@@ -164,6 +297,13 @@ func zoneCreateCmd() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringVar(&opts.Catalog, "catalog", "", "catalog to add the zone to (default: selected by catalog.rules)")
+	cmd.Flags().StringVar(&opts.Label, "label", "", "catalog member label: sha1-wire, random, uuid or a literal label")
+	cmd.Flags().StringVar(&opts.Group, "catalog-group", "", "catalog group property (schema v2)")
+	cmd.Flags().StringArrayVar(&properties, "property", nil, "custom catalog property as key=value (schema v2, repeatable)")
+	cmd.Flags().StringVar(&opts.DNSSECPolicy, "dnssec-policy", "", "dnssec-policy of the zone, or none (default: zones.dnssec_policy)")
+	cmd.Flags().BoolVar(&opts.Delegate, "delegate", false, "add NS, glue and DS records for the zone to its managed parent")
+
 	return cmd
 }
 
@@ -172,7 +312,10 @@ func zoneDeleteCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "delete <zone>",
 		Short: "Delete a zone",
-		Args:  cobra.ExactArgs(1),
+		Long: `Removes a zone from its catalog zone and from named, and deletes its zone
+files. If its closest enclosing zone that is a catalog member delegates it,
+the NS, DS and glue records are removed from that zone first.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, logger, err := loadConfig()
 			if err != nil {
@@ -186,11 +329,7 @@ func zoneDeleteCmd() *cobra.Command {
 			var changes []string
 
 			if err := deleter.DeleteZone(args[0], &changes); err != nil {
-				logger.Error(err.Error())
-				result := audit.NewErrorResult("zone_delete", logger.RequestID(),
-					audit.ExitRuntimeFailure, err.Error(), "")
-				logger.WriteAudit(result)
-				return result.Output()
+				return fail(logger, "zone_delete", err)
 			}
 
 			result := audit.NewResult("zone_delete", logger.RequestID())
@@ -204,6 +343,49 @@ func zoneDeleteCmd() *cobra.Command {
 	return cmd
 }
 
+// zoneDelegateCmd implements zone delegate
+func zoneDelegateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delegate <zone>",
+		Short: "Create or refresh the delegation of a zone in its managed parent",
+		Long: `Delegates a zone from its closest enclosing zone that is a catalog member,
+holding the locks of both zones. The parent gets the zone's apex NS records,
+glue A and AAAA records for nameservers below the zone, and DS records for the
+zone's CDS records, all with RFC 2136 updates. A CDS record with algorithm 0
+removes the DS records; without CDS records the parent's DS records are kept.
+Nameservers below the zone without an address are reported as glue_missing.
+
+Run it after a KSK rollover, or periodically, to keep the DS records in the
+parent in sync with the CDS records named publishes. Without a managed parent
+the exit code is 3.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("zone_delegate").WithZone(args[0])
+
+			delegator := zone.NewDelegator(cfg)
+			var changes []string
+
+			if err := delegator.Delegate(args[0], &changes); err != nil {
+				return fail(logger, "zone_delegate", err)
+			}
+
+			result := audit.NewResult("zone_delegate", logger.RequestID())
+			result.Zone = args[0]
+			result.Changes = changes
+			logger.WriteAudit(result)
+			return result.Output()
+		},
+	}
+
+	return cmd
+}
+
 // zoneStatusCmd implements zone status
 func zoneStatusCmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -222,15 +404,9 @@ func zoneStatusCmd() *cobra.Command {
 			checker := zone.NewStatusChecker(cfg)
 			status, err := checker.ZoneStatus(args[0])
 			if err != nil {
-				logger.Error(err.Error())
-				result := audit.NewErrorResult("zone_status", logger.RequestID(),
-					audit.ExitRuntimeFailure, err.Error(), "")
-				logger.WriteAudit(result)
-				return result.Output()
+				return fail(logger, "zone_status", err)
 			}
 
-			// Output status as JSON
-			// For simplicity, using audit.Result - could have a dedicated StatusResult
 			result := audit.NewResult("zone_status", logger.RequestID())
 			result.Zone = args[0]
 			if status.Exists {
@@ -239,40 +415,359 @@ func zoneStatusCmd() *cobra.Command {
 			if status.InCatalog {
 				result.AddChange("in_catalog")
 			}
+			for _, secondary := range status.Lagging() {
+				if secondary.Error != "" {
+					result.AddWarning(fmt.Sprintf("secondary %s: %s", secondary.Server, secondary.Error))
+					continue
+				}
+				result.AddWarning(fmt.Sprintf("secondary %s serial %d is behind primary serial %d",
+					secondary.Server, secondary.Serial, status.SOASerial))
+			}
+			logger.WriteAudit(result)
 
+			return outputJSON(status)
+		},
+	}
+
+	return cmd
+}
+
+// zoneCatalogSetCmd implements zone catalog-set
+func zoneCatalogSetCmd() *cobra.Command {
+	var change zone.PropertyChange
+	var properties []string
+
+	cmd := &cobra.Command{
+		Use:   "catalog-set <zone>",
+		Short: "Change the catalog group and properties of a member zone",
+		Long: `Changes the schema v2 properties of a catalog member zone in one update:
+the group property (--catalog-group, --clear-group) and custom properties
+below the ext label (--property key=value, --remove-property key).
+Requires catalog.schema_version 2; a zone that is not a catalog member is
+refused with exit code 3.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("zone_catalog_set").WithZone(args[0])
+
+			if change.Set, err = zone.ParseProperties(properties); err != nil {
+				return fail(logger, "zone_catalog_set", err)
+			}
+
+			setter := zone.NewPropertySetter(cfg)
+			var changes []string
+
+			if err := setter.SetProperties(args[0], change, &changes); err != nil {
+				return fail(logger, "zone_catalog_set", err)
+			}
+
+			result := audit.NewResult("zone_catalog_set", logger.RequestID())
+			result.Zone = args[0]
+			result.Changes = changes
 			logger.WriteAudit(result)
+			return result.Output()
+		},
+	}
 
-			// Output the status
-			fmt.Printf(`{
-  "zone": "%s",
-  "exists": %t,
-  "loaded": %t,
-  "is_primary": %t,
-  "in_catalog": %t,
-  "catalog_label": "%s",
-  "zone_file_path": "%s",
-  "dnssec_enabled": %t
-}`, status.Zone, status.Exists, status.Loaded, status.IsPrimary,
-				status.InCatalog, status.CatalogLabel, status.ZoneFilePath,
-				status.DNSSECEnabled)
+	cmd.Flags().StringVar(&change.Group, "catalog-group", "", "set the catalog group property")
+	cmd.Flags().BoolVar(&change.ClearGroup, "clear-group", false, "remove the catalog group property")
+	cmd.Flags().StringArrayVar(&properties, "property", nil, "set a custom property as key=value (repeatable)")
+	cmd.Flags().StringArrayVar(&change.Remove, "remove-property", nil, "remove a custom property by key (repeatable)")
+
+	return cmd
+}
+
+// zoneSetDNSSECPolicyCmd implements zone set-dnssec-policy
+func zoneSetDNSSECPolicyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-dnssec-policy <zone> <policy>",
+		Short: "Change the dnssec-policy of a zone",
+		Long: `Changes the dnssec-policy of an existing zone in every view with rndc
+modzone, keeping the rest of its configuration. The policy must be defined in
+named.conf or be one of named's built-in policies (default, insecure, none).
+
+Unsigning a zone whose parent still has a DS record for it breaks validation:
+the resolver is asked for the DS and a warning is returned if one exists. Use
+insecure to unsign such a zone safely and none once the DS is gone.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("zone_set_dnssec_policy").WithZone(args[0])
+
+			setter := zone.NewDNSSECPolicySetter(cfg)
+			var changes []string
+
+			warnings, err := setter.SetDNSSECPolicy(args[0], args[1], &changes)
+			if err != nil {
+				return fail(logger, "zone_set_dnssec_policy", err)
+			}
+
+			result := audit.NewResult("zone_set_dnssec_policy", logger.RequestID())
+			result.Zone = args[0]
+			result.Changes = changes
+			for _, warning := range warnings {
+				result.AddWarning(warning)
+			}
+			logger.WriteAudit(result)
+			return result.Output()
+		},
+	}
+
+	return cmd
+}
+
+// verifyResult is the zone verify output: the standard result plus the
+// verification of the signed zone
+type verifyResult struct {
+	*audit.Result
+	*dnssec.Verification
+}
+
+// zoneVerifyCmd implements zone verify
+func zoneVerifyCmd() *cobra.Command {
+	var opts dnssec.VerifyOptions
+
+	cmd := &cobra.Command{
+		Use:   "verify <zone>",
+		Short: "Verify the signatures and denial chain of a signed zone",
+		Long: `Transfers the signed zone from named and checks it as a validating resolver
+would: every authoritative RRset must have a signature by a DNSKEY of the
+zone that verifies and is within its validity window, the NSEC or NSEC3 chain
+must cover every name (including empty non-terminals for NSEC3), and a DS
+record in the parent, looked up through the configured resolver, must match a
+key that signs the DNSKEY RRset.
+
+Each problem is listed in "issues" with a severity. Valid signatures that
+expire within --expiry-warning are listed in "expiring" and reported as a
+warning, as are a missing or unmatched parent DS. Exits with code 5 if any
+issue is an error and 3 if the zone is not signed.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("zone_verify").WithZone(args[0])
+
+			manager := dnssec.NewManager(cfg)
+			verification, err := manager.Verify(args[0], opts)
+			if err != nil {
+				return fail(logger, "zone_verify", err)
+			}
+
+			result := &verifyResult{
+				Result:       audit.NewResult("zone_verify", logger.RequestID()),
+				Verification: verification,
+			}
+			result.Zone = args[0]
+
+			errorCount := 0
+			for _, issue := range verification.Issues {
+				if issue.Severity == dnssec.SeverityError {
+					errorCount++
+					continue
+				}
+				result.AddWarning(fmt.Sprintf("%s: %s", issue.Kind, issue.Detail))
+			}
+
+			code := audit.ExitSuccess
+			if !verification.Valid {
+				code = audit.ExitConflictUnsafe
+				result.OK = false
+				result.Error = &audit.Error{Code: code, Message: fmt.Sprintf("zone failed DNSSEC verification with %d errors", errorCount)}
+				logger.Error(result.Error.Message)
+			}
+
+			logger.WriteAudit(result.Result)
+			if err := outputJSON(result); err != nil {
+				return &exitError{code: audit.ExitInternalError}
+			}
+			if code != audit.ExitSuccess {
+				return &exitError{code: code}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&opts.ExpiryWarning, "expiry-warning", dnssec.DefaultExpiryWarning, "report signatures expiring within this time")
+
+	return cmd
+}
+
+// zoneMoveCatalogCmd implements zone move-catalog
+func zoneMoveCatalogCmd() *cobra.Command {
+	var opts zone.MoveOptions
+
+	cmd := &cobra.Command{
+		Use:   "move-catalog <zone> <new-catalog>",
+		Short: "Move a member zone to another catalog zone",
+		Long: `Moves a member zone to another catalog (given by name or zone name)
+without making the secondaries drop it, using the RFC 9432 change of
+ownership (coo) property: coo is pointed at the new catalog, the member is
+added there under the same label, and it is removed from the old catalog once
+every configured secondary has loaded both catalogs. If a secondary does not
+catch up within --timeout the command fails and can be run again to resume.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("zone_move_catalog").WithZone(args[0])
+
+			mover := zone.NewCatalogMover(cfg)
+			var changes []string
+
+			err = mover.MoveCatalog(args[0], args[1], opts, &changes)
+			if err != nil && len(changes) == 0 {
+				return fail(logger, "zone_move_catalog", err)
+			}
+
+			// A move interrupted after its first steps reports what it did
+			result := audit.NewResult("zone_move_catalog", logger.RequestID())
+			result.Zone = args[0]
+			result.Changes = changes
+			if err != nil {
+				code := exitCode(err)
+				result.OK = false
+				result.Error = &audit.Error{Code: code, Message: err.Error()}
+				logger.Error(err.Error())
+				logger.WriteAudit(result)
+				if outErr := result.Output(); outErr != nil {
+					return &exitError{code: audit.ExitInternalError}
+				}
+				return &exitError{code: code}
+			}
+			logger.WriteAudit(result)
+			return result.Output()
+		},
+	}
+
+	cmd.Flags().DurationVar(&opts.Timeout, "timeout", 5*time.Minute, "how long to wait for the secondaries to load each catalog change")
+
+	return cmd
+}
+
+// propagationResult is the zone propagation output: the standard result plus
+// the per-secondary state of the catalog and its members
+type propagationResult struct {
+	*audit.Result
+	*zone.Propagation
+}
+
+// zonePropagationCmd implements zone propagation
+func zonePropagationCmd() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "propagation [zone]",
+		Short: "Compare zone serials on the secondaries with the primary",
+		Long: `Queries each configured secondary for the SOA serial of a zone (or, with
+--all, of every catalog member) and of the catalog zone itself, and compares
+it with the primary.
+
+Secondaries are reported per zone as in_sync, lagging, missing (in the catalog
+but not served) or unexpected (served but not in the catalog). With --all,
+zones in a secondary's copy of the catalog that the primary's catalog no
+longer lists are checked as well. Exits with code 5 if anything diverged and
+4 if a secondary could not be queried.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if all == (len(args) == 1) {
+				return &usageError{err: errors.New("specify either a zone or --all")}
+			}
+
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("zone_propagation")
+			if !all {
+				logger.WithZone(args[0])
+			}
+
+			checker := zone.NewPropagationChecker(cfg)
+			var propagation *zone.Propagation
+			if all {
+				propagation, err = checker.CheckAll()
+			} else {
+				propagation, err = checker.CheckZone(args[0])
+			}
+			if err != nil {
+				return fail(logger, "zone_propagation", err)
+			}
+
+			result := &propagationResult{
+				Result:      audit.NewResult("zone_propagation", logger.RequestID()),
+				Propagation: propagation,
+			}
+			if !all {
+				result.Zone = args[0]
+			}
+			for _, warning := range propagation.Warnings {
+				result.AddWarning(warning)
+			}
+
+			code := audit.ExitSuccess
+			switch {
+			case propagation.Diverged:
+				code = audit.ExitConflictUnsafe
+				result.Error = &audit.Error{Code: code, Message: "secondaries have diverged from the primary"}
+			case propagation.Failed():
+				code = audit.ExitRuntimeFailure
+				result.Error = &audit.Error{Code: code, Message: "one or more secondaries could not be queried"}
+			}
+			if code != audit.ExitSuccess {
+				result.OK = false
+				logger.Error(result.Error.Message)
+			}
 
+			logger.WriteAudit(result.Result)
+			if err := outputJSON(result); err != nil {
+				return &exitError{code: audit.ExitInternalError}
+			}
+			if code != audit.ExitSuccess {
+				return &exitError{code: code}
+			}
 			return nil
 		},
 	}
 
+	cmd.Flags().BoolVar(&all, "all", false, "check every catalog member zone")
+
 	return cmd
 }
 
 // zoneListCmd implements zone list
 func zoneListCmd() *cobra.Command {
-	var limit int
+	var opts zone.ListOptions
 
 	cmd := &cobra.Command{
 		Use:   "list",
-		Short: "List zones",
-		Args:  cobra.NoArgs,
+		Short: "List catalog member zones",
+		Long: `Lists member zones by transferring the catalog zones (AXFR), or only
+the one named by --catalog.
+
+Each member's catalog label is cross-checked against its sha1-wire label.`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, logger, err := loadConfig()
+			cfg, logger, err := loadConfig()
 			if err != nil {
 				return err
 			}
@@ -280,21 +775,360 @@ func zoneListCmd() *cobra.Command {
 
 			logger.WithOp("zone_list")
 
-			// TODO: Implement zone listing from zones directory
-			// For now, return a placeholder
+			lister := zone.NewLister(cfg)
+			list, err := lister.ListZones(opts)
+			if err != nil {
+				return fail(logger, "zone_list", err)
+			}
+
 			result := audit.NewResult("zone_list", logger.RequestID())
+			for _, member := range list.Zones {
+				if !member.LabelValid {
+					result.AddWarning(fmt.Sprintf("catalog label %s does not match sha1-wire label of %s",
+						member.Label, member.Zone))
+				}
+			}
 			logger.WriteAudit(result)
 
-			fmt.Println(`{
-  "zones": [],
-  "count": 0
-}`)
+			return outputJSON(list)
+		},
+	}
 
-			return nil
+	cmd.Flags().IntVarP(&opts.Limit, "limit", "n", 100, "maximum number of zones to return (0 for all)")
+	cmd.Flags().IntVar(&opts.Offset, "offset", 0, "number of zones to skip")
+	cmd.Flags().StringVarP(&opts.Filter, "filter", "f", "", "glob pattern to filter zone names (e.g. '*.example.com')")
+	cmd.Flags().StringVar(&opts.Sort, "sort", "name", "sort order: name or label")
+	cmd.Flags().StringVar(&opts.Catalog, "catalog", "", "list only the members of this catalog")
+
+	return cmd
+}
+
+// catalogCmd implements catalog commands
+func catalogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "catalog",
+		Short: "Catalog zone maintenance",
+	}
+
+	cmd.AddCommand(catalogInitCmd())
+	cmd.AddCommand(catalogReconcileCmd())
+
+	return cmd
+}
+
+// catalogInitCmd implements catalog init
+func catalogInitCmd() *cobra.Command {
+	var catalog string
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create the catalog zones",
+		Long: `Creates each configured catalog zone (or only the one named by --catalog)
+that named does not serve yet: writes its zone file under zones.dir with the
+SOA and NS invalid. records and the version TXT record of its schema version,
+adds it with rndc addzone (to the first view) so that only the TSIG key may
+update it, and checks that named answers for it.
+
+Catalog zones that already exist are left as they are; a missing version
+record is added, a version other than the configured one is an error.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("catalog_init")
+
+			initializer := zone.NewCatalogInitializer(cfg)
+			var changes []string
+
+			if err := initializer.InitCatalogs(catalog, &changes); err != nil {
+				return fail(logger, "catalog_init", err)
+			}
+
+			result := audit.NewResult("catalog_init", logger.RequestID())
+			result.Changes = changes
+			logger.WriteAudit(result)
+			return result.Output()
+		},
+	}
+
+	cmd.Flags().StringVar(&catalog, "catalog", "", "create only this catalog (name or zone)")
+
+	return cmd
+}
+
+// reconcileResult is the catalog reconcile output: the standard result plus
+// the inconsistencies found
+type reconcileResult struct {
+	*audit.Result
+	*zone.ReconcileResult
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// catalogReconcileCmd implements catalog reconcile
+func catalogReconcileCmd() *cobra.Command {
+	var apply bool
+
+	cmd := &cobra.Command{
+		Use:   "reconcile",
+		Short: "Find and fix inconsistencies between the catalog and named",
+		Long: `Compares the catalog zone's member PTRs with the zones named serves and the
+zone files under zones.dir, and reports:
+
+  orphan_ptr      a catalog member named does not serve
+  missing_ptr     a zone with a zone file that named serves but the catalog lacks
+  label_mismatch  a member whose label is not its sha1-wire label
+  duplicate_ptr   several PTRs at one member label
+
+By default nothing is changed and "changes" lists the fixes --apply would
+make: orphan PTRs and duplicates are removed, mismatched members are moved to
+their sha1-wire label and missing members are added.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("catalog_reconcile")
+
+			result := &reconcileResult{
+				Result: audit.NewResult("catalog_reconcile", logger.RequestID()),
+				DryRun: !apply,
+			}
+
+			reconciler := zone.NewReconciler(cfg)
+			reconciled, err := reconciler.Reconcile(apply, &result.Changes)
+			if err != nil {
+				return fail(logger, "catalog_reconcile", err)
+			}
+			result.ReconcileResult = reconciled
+
+			for _, issue := range reconciled.Issues {
+				if !issue.Fixed {
+					result.AddWarning(fmt.Sprintf("%s: %s: %s", issue.Kind, issue.Zone, issue.Detail))
+				}
+			}
+
+			logger.WriteAudit(result.Result)
+			return outputJSON(result)
+		},
+	}
+
+	cmd.Flags().BoolVar(&apply, "apply", false, "fix the inconsistencies found (default is a dry run)")
+
+	return cmd
+}
+
+// dnssecCmd implements dnssec commands
+func dnssecCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dnssec",
+		Short: "DNSSEC key state, DS records and key operations",
+	}
+
+	cmd.AddCommand(dnssecStatusCmd())
+	cmd.AddCommand(dnssecDSCmd())
+	cmd.AddCommand(dnssecRolloverCmd())
+	cmd.AddCommand(dnssecCheckDSCmd())
+
+	return cmd
+}
+
+// dnssecStatusCmd implements dnssec status
+func dnssecStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status <zone>",
+		Short: "Show the DNSSEC keys of a zone",
+		Long: `Reports the keys of a zone's dnssec-policy as named sees them (rndc dnssec
+-status): each key's tag, algorithm, role (KSK, ZSK or CSK), whether it is
+published and signing, its key states and its next rollover. A zone without a
+dnssec-policy exits with code 3.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("dnssec_status").WithZone(args[0])
+
+			manager := dnssec.NewManager(cfg)
+			status, err := manager.KeyStatus(args[0])
+			if err != nil {
+				return fail(logger, "dnssec_status", err)
+			}
+
+			result := audit.NewResult("dnssec_status", logger.RequestID())
+			result.Zone = args[0]
+			logger.WriteAudit(result)
+
+			return outputJSON(status)
+		},
+	}
+
+	return cmd
+}
+
+// dnssecDSCmd implements dnssec ds
+func dnssecDSCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "ds <zone>",
+		Short: "Export the DS records of a zone for its parent",
+		Long: `Queries the zone's DNSKEY, CDS and CDNSKEY records on the primary and prints
+SHA-256 and SHA-384 DS records for each key signing key, without reading key
+files. Each key notes whether the zone signals it in CDS and CDNSKEY.
+
+--format json (the default) prints the records in their parts and in zone
+file format; --format registrar prints the key tag, algorithm, digest type
+and digest of each DS record, and the DNSKEY data, as registrar forms ask for
+them. A zone without DNSKEY records exits with code 3.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("dnssec_ds").WithZone(args[0])
+
+			if format != "json" && format != "registrar" {
+				return fail(logger, "dnssec_ds", &zone.OptionError{
+					Option: "format", Err: fmt.Errorf("expected json or registrar, got %q", format),
+				})
+			}
+
+			manager := dnssec.NewManager(cfg)
+			export, err := manager.ExportDS(args[0])
+			if err != nil {
+				return fail(logger, "dnssec_ds", err)
+			}
+
+			result := audit.NewResult("dnssec_ds", logger.RequestID())
+			result.Zone = args[0]
+			for _, warning := range export.Warnings {
+				result.AddWarning(warning)
+			}
+			logger.WriteAudit(result)
+
+			if format == "registrar" {
+				fmt.Print(export.Registrar())
+				return nil
+			}
+			return outputJSON(export)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "json", "output format: json or registrar")
+
+	return cmd
+}
+
+// keyOperationResult is the output of a DNSSEC key operation: the standard
+// result plus named's response
+type keyOperationResult struct {
+	*audit.Result
+	*dnssec.KeyOperation
+}
+
+// dnssecRolloverCmd implements dnssec rollover
+func dnssecRolloverCmd() *cobra.Command {
+	var key uint16
+
+	cmd := &cobra.Command{
+		Use:   "rollover <zone>",
+		Short: "Start the rollover of a DNSSEC key now",
+		Long: `Makes named roll the key with tag --key over now instead of when its
+dnssec-policy lifetime ends (rndc dnssec -rollover). named introduces the
+successor as the policy prescribes; for a KSK or CSK the new DS must then be
+published in the parent and confirmed with dnssec checkds.
+
+Privileged: in SSH wrap mode only the actors listed in ssh.privileged_actors
+may run it.`,
+		Args:        cobra.ExactArgs(1),
+		Annotations: map[string]string{ssh.PrivilegedAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("dnssec_rollover").WithZone(args[0])
+
+			result := &keyOperationResult{Result: audit.NewResult("dnssec_rollover", logger.RequestID())}
+			result.Zone = args[0]
+
+			manager := dnssec.NewManager(cfg)
+			if result.KeyOperation, err = manager.Rollover(args[0], key, &result.Changes); err != nil {
+				return fail(logger, "dnssec_rollover", err)
+			}
+
+			logger.Info(result.Message)
+			logger.WriteAudit(result.Result)
+			return outputJSON(result)
 		},
 	}
 
-	cmd.Flags().IntVarP(&limit, "limit", "n", 100, "maximum number of zones to return")
+	cmd.Flags().Uint16Var(&key, "key", 0, "tag of the key to roll over")
+	_ = cmd.MarkFlagRequired("key")
+
+	return cmd
+}
+
+// dnssecCheckDSCmd implements dnssec checkds
+func dnssecCheckDSCmd() *cobra.Command {
+	var key uint16
+
+	cmd := &cobra.Command{
+		Use:   "checkds <zone> published|withdrawn",
+		Short: "Confirm that a DS record was published in or withdrawn from the parent",
+		Long: `Tells named that the parent zone now has (published) or no longer has
+(withdrawn) the DS record of a key signing key (rndc dnssec -checkds), so a
+KSK rollover can move on. --key selects the key by tag; without it named picks
+the zone's key signing key, and refuses with exit code 2 if there are several.
+
+Privileged: in SSH wrap mode only the actors listed in ssh.privileged_actors
+may run it.`,
+		Args:        cobra.ExactArgs(2),
+		Annotations: map[string]string{ssh.PrivilegedAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			defer logger.Close()
+
+			logger.WithOp("dnssec_checkds").WithZone(args[0])
+
+			result := &keyOperationResult{Result: audit.NewResult("dnssec_checkds", logger.RequestID())}
+			result.Zone = args[0]
+
+			var keyTag *uint16
+			if cmd.Flags().Changed("key") {
+				keyTag = &key
+			}
+
+			manager := dnssec.NewManager(cfg)
+			if result.KeyOperation, err = manager.CheckDS(args[0], args[1], keyTag, &result.Changes); err != nil {
+				return fail(logger, "dnssec_checkds", err)
+			}
+
+			logger.Info(result.Message)
+			logger.WriteAudit(result.Result)
+			return outputJSON(result)
+		},
+	}
+
+	cmd.Flags().Uint16Var(&key, "key", 0, "tag of the key signing key (default: the zone's only one)")
 
 	return cmd
 }
@@ -322,7 +1156,7 @@ func rrsetUpsertCmd() *cobra.Command {
 		Short: "Create or replace an RRset",
 		Args:  cobra.MinimumNArgs(4),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, logger, err := loadConfig()
+			cfg, logger, err := loadConfig()
 			if err != nil {
 				return err
 			}
@@ -333,31 +1167,24 @@ func rrsetUpsertCmd() *cobra.Command {
 			rrType := args[2]
 			rdata := args[3:]
 
-			logger.WithOp("rrset_upsert").WithZone(zoneInput)
-
-			// Import rrset package
-			manager := &struct {
-				Upsert func(string, string, string, uint32, []string) (interface{}, error)
-			}{
-				Upsert: func(z, o, t string, ttl uint32, rd []string) (interface{}, error) {
-					// This would call rrset.Manager.Upsert
-					// For now, placeholder
-					return nil, fmt.Errorf("not yet implemented")
-				},
-			}
+			logger.WithOp("rrset_upsert").WithZone(zoneInput).
+				WithRRset(ownerInput, rrType, ttl, rdata)
 
-			result, err := manager.Upsert(zoneInput, ownerInput, rrType, ttl, rdata)
+			manager := rrset.NewManager(cfg)
+			upsertResult, err := manager.Upsert(zoneInput, ownerInput, rrType, ttl, rdata)
 			if err != nil {
-				logger.Error(err.Error())
-				errResult := audit.NewErrorResult("rrset_upsert", logger.RequestID(),
-					audit.ExitRuntimeFailure, err.Error(), "")
-				logger.WriteAudit(errResult)
-				return errResult.Output()
+				return fail(logger, "rrset_upsert", err)
 			}
 
-			// Output result
-			fmt.Println(result)
-			return nil
+			// Record the normalized RRset that was actually written
+			logger.WithRRset(upsertResult.Owner, upsertResult.Type, upsertResult.TTL, upsertResult.RData)
+
+			result := audit.NewResult("rrset_upsert", logger.RequestID())
+			result.Zone = zoneInput
+			result.AddChange("rrset_replaced")
+			logger.WriteAudit(result)
+
+			return outputJSON(upsertResult)
 		},
 	}
 
@@ -373,18 +1200,29 @@ func rrsetDeleteCmd() *cobra.Command {
 		Short: "Delete an RRset",
 		Args:  cobra.ExactArgs(3),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, logger, err := loadConfig()
+			cfg, logger, err := loadConfig()
 			if err != nil {
 				return err
 			}
 			defer logger.Close()
 
-			logger.WithOp("rrset_delete").WithZone(args[0])
+			logger.WithOp("rrset_delete").WithZone(args[0]).
+				WithRRset(args[1], args[2], 0, nil)
+
+			manager := rrset.NewManager(cfg)
+			deleteResult, err := manager.Delete(args[0], args[1], args[2])
+			if err != nil {
+				return fail(logger, "rrset_delete", err)
+			}
+
+			logger.WithRRset(deleteResult.Owner, deleteResult.Type, 0, nil)
 
-			// TODO: Implement rrset delete
 			result := audit.NewResult("rrset_delete", logger.RequestID())
+			result.Zone = args[0]
+			result.AddChange("rrset_deleted")
 			logger.WriteAudit(result)
-			return result.Output()
+
+			return outputJSON(deleteResult)
 		},
 	}
 
@@ -398,18 +1236,28 @@ func rrsetGetCmd() *cobra.Command {
 		Short: "Get an RRset",
 		Args:  cobra.ExactArgs(3),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, logger, err := loadConfig()
+			cfg, logger, err := loadConfig()
 			if err != nil {
 				return err
 			}
 			defer logger.Close()
 
-			logger.WithOp("rrset_get").WithZone(args[0])
+			logger.WithOp("rrset_get").WithZone(args[0]).
+				WithRRset(args[1], args[2], 0, nil)
+
+			manager := rrset.NewManager(cfg)
+			getResult, err := manager.Get(args[0], args[1], args[2])
+			if err != nil {
+				return fail(logger, "rrset_get", err)
+			}
+
+			logger.WithRRset(getResult.Owner, getResult.Type, getResult.TTL, getResult.RData)
 
-			// TODO: Implement rrset get
 			result := audit.NewResult("rrset_get", logger.RequestID())
+			result.Zone = args[0]
 			logger.WriteAudit(result)
-			return result.Output()
+
+			return outputJSON(getResult)
 		},
 	}
 
@@ -449,11 +1297,7 @@ func acmePresentCmd() *cobra.Command {
 			handler := acme.NewACMEHandler(cfg)
 			result, err := handler.Present(args[0], args[1], args[2], ttl)
 			if err != nil {
-				logger.Error(err.Error())
-				errResult := audit.NewErrorResult("acme_present", logger.RequestID(),
-					audit.ExitRuntimeFailure, err.Error(), "")
-				logger.WriteAudit(errResult)
-				return errResult.Output()
+				return fail(logger, "acme_present", err)
 			}
 
 			// Output result
@@ -491,11 +1335,7 @@ func acmeCleanupCmd() *cobra.Command {
 
 			handler := acme.NewACMEHandler(cfg)
 			if err := handler.Cleanup(args[0], args[1], args[2]); err != nil {
-				logger.Error(err.Error())
-				errResult := audit.NewErrorResult("acme_cleanup", logger.RequestID(),
-					audit.ExitRuntimeFailure, err.Error(), "")
-				logger.WriteAudit(errResult)
-				return errResult.Output()
+				return fail(logger, "acme_cleanup", err)
 			}
 
 			result := audit.NewResult("acme_cleanup", logger.RequestID())
@@ -508,23 +1348,52 @@ func acmeCleanupCmd() *cobra.Command {
 	return cmd
 }
 
-// sshWrapCmd implements SSH wrapper mode
-func sshWrapCmd() *cobra.Command {
-	cmd := &cobra.Command{
-		Use:    "--ssh-wrap",
-		Short:  "SSH forced-command wrapper mode",
-		Hidden: true,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			logger := audit.NewLogger(os.Stderr, "", true)
+// runSSHWrap implements SSH forced-command mode: it validates
+// SSH_ORIGINAL_COMMAND and runs it through the command tree in-process
+func runSSHWrap() error {
+	if wrapActor != "" {
+		return &usageError{err: errors.New("nested --ssh-wrap is not allowed")}
+	}
 
-			// Import ssh package
-			// This would call ssh.WrapHandler.Handle()
-			// For now, placeholder
-			result := audit.NewResult("ssh_wrap", logger.RequestID())
-			logger.WriteAudit(result)
-			return result.Output()
-		},
+	cfg, logger, err := loadConfig()
+	if err != nil {
+		return err
 	}
+	defer logger.Close()
 
-	return cmd
+	logger.WithOp("ssh_wrap")
+
+	// The allowlist is derived from the same tree the command runs in
+	inner := newRootCmd(cfgFile)
+	allowlist, err := ssh.NewAllowlist(inner, cfg.SSH.AllowedCommands)
+	if err != nil {
+		return &configError{err: err}
+	}
+	allowlist.WithPrivilegedActors(cfg.SSH.PrivilegedActors)
+
+	handler := ssh.NewWrapHandler(logger).WithAllowlist(allowlist)
+
+	err = handler.Handle(func(args []string) error {
+		wrapActor = handler.Actor()
+		if wrapActor == "" {
+			wrapActor = "ssh"
+		}
+
+		inner.SetArgs(args)
+
+		err := inner.Execute()
+		var exitErr *exitError
+		if err == nil || errors.As(err, &exitErr) {
+			return err
+		}
+
+		// Config and usage errors have not produced a JSON result yet
+		return failWithCode(logger, "ssh_wrap", commandExitCode(err), err)
+	})
+
+	var exitErr *exitError
+	if err == nil || errors.As(err, &exitErr) {
+		return err
+	}
+	return fail(logger, "ssh_wrap", err)
 }
@@ -17,6 +17,7 @@ type Logger struct {
 	actor     string
 	op        string
 	zone      string
+	rrset     *RRsetRecord
 	out       io.Writer
 	auditFile *os.File
 	verbose   bool
@@ -61,6 +62,17 @@ func (l *Logger) WithZone(zone string) *Logger {
 	return l
 }
 
+// WithRRset sets the RRset an operation acts on, recorded in the audit log
+func (l *Logger) WithRRset(owner, rrType string, ttl uint32, rdata []string) *Logger {
+	l.rrset = &RRsetRecord{
+		Owner: owner,
+		Type:  rrType,
+		TTL:   ttl,
+		RData: rdata,
+	}
+	return l
+}
+
 // WithActor sets the actor for logging context
 func (l *Logger) WithActor(actor string) *Logger {
 	l.actor = actor
@@ -138,22 +150,24 @@ func (l *Logger) WriteAudit(result *Result) {
 	}
 
 	entry := struct {
-		Time      string   `json:"time"`
-		RequestID string   `json:"request_id"`
-		Op        string   `json:"op"`
-		Zone      string   `json:"zone,omitempty"`
-		Actor     string   `json:"actor,omitempty"`
-		OK        bool     `json:"ok"`
-		Changes   []string `json:"changes,omitempty"`
-		Warnings  []string `json:"warnings,omitempty"`
-		Error     *Error   `json:"error,omitempty"`
-		Duration  int64    `json:"duration_ms,omitempty"`
+		Time      string       `json:"time"`
+		RequestID string       `json:"request_id"`
+		Op        string       `json:"op"`
+		Zone      string       `json:"zone,omitempty"`
+		Actor     string       `json:"actor,omitempty"`
+		RRset     *RRsetRecord `json:"rrset,omitempty"`
+		OK        bool         `json:"ok"`
+		Changes   []string     `json:"changes,omitempty"`
+		Warnings  []string     `json:"warnings,omitempty"`
+		Error     *Error       `json:"error,omitempty"`
+		Duration  int64        `json:"duration_ms,omitempty"`
 	}{
 		Time:      time.Now().UTC().Format(time.RFC3339),
 		RequestID: l.requestID,
 		Op:        l.op,
 		Zone:      l.zone,
 		Actor:     l.actor,
+		RRset:     l.rrset,
 		OK:        result.OK,
 		Changes:   result.Changes,
 		Warnings:  result.Warnings,
@@ -187,6 +201,14 @@ type Result struct {
 	Error     *Error   `json:"error,omitempty"`
 }
 
+// RRsetRecord describes the RRset an operation acted on (audit log only)
+type RRsetRecord struct {
+	Owner string   `json:"owner"`
+	Type  string   `json:"type"`
+	TTL   uint32   `json:"ttl,omitempty"`
+	RData []string `json:"rdata,omitempty"`
+}
+
 // Error represents an error in the JSON output
 type Error struct {
 	Code    int    `json:"code"`
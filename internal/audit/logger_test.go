@@ -379,3 +379,41 @@ func TestLoggerJSONFormat(t *testing.T) {
 		}
 	}
 }
+
+// TestLoggerWriteAuditRRset tests that the RRset context is recorded in the audit log
+func TestLoggerWriteAuditRRset(t *testing.T) {
+	tmpDir := t.TempDir()
+	auditPath := filepath.Join(tmpDir, "audit.jsonl")
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, auditPath, false)
+	logger.WithOp("rrset_upsert").WithZone("example.com.").
+		WithRRset("www.example.com.", "A", 300, []string{"192.0.2.1", "192.0.2.2"})
+
+	logger.WriteAudit(NewResult("rrset_upsert", logger.RequestID()))
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Failed to close logger: %v", err)
+	}
+
+	content, err := os.ReadFile(auditPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit file: %v", err)
+	}
+
+	var entry struct {
+		RRset *RRsetRecord `json:"rrset"`
+	}
+	if err := json.Unmarshal(content, &entry); err != nil {
+		t.Fatalf("Audit entry is not valid JSON: %v", err)
+	}
+
+	if entry.RRset == nil {
+		t.Fatal("Audit entry should contain rrset")
+	}
+	if entry.RRset.Owner != "www.example.com." || entry.RRset.Type != "A" || entry.RRset.TTL != 300 {
+		t.Errorf("Audit rrset = %+v, want www.example.com. A 300", entry.RRset)
+	}
+	if len(entry.RRset.RData) != 2 || entry.RRset.RData[1] != "192.0.2.2" {
+		t.Errorf("Audit rrset rdata = %v, want two values", entry.RRset.RData)
+	}
+}
@@ -0,0 +1,315 @@
+package bind
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// This file implements the ISC control channel (isccc) message format used
+// by rndc. A message is a 4-byte length, a 4-byte version (1) and a table.
+// A table is a sequence of entries: a 1-byte key length, the key, a 1-byte
+// value type, a 4-byte value length and the value. The first entry is the
+// _auth table holding an HMAC over the encoding of the remaining entries.
+
+// ccVersion is the only control channel protocol version
+const ccVersion = 1
+
+// Value types
+const (
+	ccTypeBinary = 0x01
+	ccTypeTable  = 0x02
+	ccTypeList   = 0x03
+)
+
+// ccMaxMessage bounds the size of a message read from the wire
+const ccMaxMessage = 16 * 1024 * 1024
+
+// Signature lengths: HMAC-MD5 signatures are base64 truncated to 22 bytes,
+// other algorithms carry an algorithm byte and a zero-padded 88-byte base64
+const (
+	hmd5Length = 22
+	hshaLength = 88
+)
+
+// errBadAuth means a message signature did not verify
+var errBadAuth = errors.New("bad auth")
+
+// ccAlgorithm is an rndc key algorithm
+type ccAlgorithm struct {
+	code uint8 // Algorithm code carried in hsha signatures
+	hash func() hash.Hash
+}
+
+// ccAlgorithms maps rndc.conf algorithm names to their control channel codes
+var ccAlgorithms = map[string]ccAlgorithm{
+	"hmac-md5":    {157, md5.New},
+	"hmac-sha1":   {161, sha1.New},
+	"hmac-sha224": {162, sha256.New224},
+	"hmac-sha256": {163, sha256.New},
+	"hmac-sha384": {164, sha512.New384},
+	"hmac-sha512": {165, sha512.New},
+}
+
+// lookupCCAlgorithm returns the control channel algorithm for an rndc.conf name
+func lookupCCAlgorithm(name string) (ccAlgorithm, error) {
+	alg, ok := ccAlgorithms[strings.TrimSuffix(strings.ToLower(name), ".")]
+	if !ok {
+		return ccAlgorithm{}, fmt.Errorf("unsupported rndc key algorithm %q", name)
+	}
+	return alg, nil
+}
+
+// ccEntry is a table entry; value is a []byte or a ccTable
+type ccEntry struct {
+	key   string
+	value interface{}
+}
+
+// ccTable is an ordered control channel table
+type ccTable []ccEntry
+
+// get returns the value for a key, or nil
+func (t ccTable) get(key string) interface{} {
+	for _, e := range t {
+		if e.key == key {
+			return e.value
+		}
+	}
+	return nil
+}
+
+// table returns the subtable for a key, or nil
+func (t ccTable) table(key string) ccTable {
+	sub, _ := t.get(key).(ccTable)
+	return sub
+}
+
+// str returns the binary value for a key as a string
+func (t ccTable) str(key string) (string, bool) {
+	b, ok := t.get(key).([]byte)
+	return string(b), ok
+}
+
+// uint32 returns a decimal value for a key
+func (t ccTable) uint32(key string) (uint32, bool) {
+	s, ok := t.str(key)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	return uint32(v), err == nil
+}
+
+// set replaces or appends a value
+func (t *ccTable) set(key string, value interface{}) {
+	for i := range *t {
+		if (*t)[i].key == key {
+			(*t)[i].value = value
+			return
+		}
+	}
+	*t = append(*t, ccEntry{key: key, value: value})
+}
+
+// setString sets a binary value from a string
+func (t *ccTable) setString(key, value string) {
+	t.set(key, []byte(value))
+}
+
+// setUint32 sets a decimal value, as isccc_cc_defineuint32 does
+func (t *ccTable) setUint32(key string, value uint32) {
+	t.setString(key, strconv.FormatUint(uint64(value), 10))
+}
+
+// appendTable appends the encoding of a table's entries
+func appendTable(b []byte, t ccTable) ([]byte, error) {
+	for _, e := range t {
+		if len(e.key) == 0 || len(e.key) > 255 {
+			return nil, fmt.Errorf("invalid table key %q", e.key)
+		}
+		b = append(b, byte(len(e.key)))
+		b = append(b, e.key...)
+
+		var err error
+		if b, err = appendValue(b, e.value); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// appendValue appends a typed, length-prefixed value
+func appendValue(b []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		b = append(b, ccTypeBinary)
+		b = binary.BigEndian.AppendUint32(b, uint32(len(v)))
+		return append(b, v...), nil
+	case ccTable:
+		b = append(b, ccTypeTable)
+		start := len(b)
+		b = append(b, 0, 0, 0, 0)
+		b, err := appendTable(b, v)
+		if err != nil {
+			return nil, err
+		}
+		binary.BigEndian.PutUint32(b[start:], uint32(len(b)-start-4))
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+// parseTable decodes a table's entries
+func parseTable(data []byte) (ccTable, error) {
+	var t ccTable
+	for len(data) > 0 {
+		key, value, rest, err := parseEntry(data)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, ccEntry{key: key, value: value})
+		data = rest
+	}
+	return t, nil
+}
+
+// parseEntry decodes one table entry and returns the remaining data
+func parseEntry(data []byte) (string, interface{}, []byte, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0])+5 {
+		return "", nil, nil, fmt.Errorf("truncated table entry")
+	}
+	keyLen := int(data[0])
+	key := string(data[1 : 1+keyLen])
+	data = data[1+keyLen:]
+
+	valueType := data[0]
+	valueLen := binary.BigEndian.Uint32(data[1:5])
+	data = data[5:]
+	if uint64(valueLen) > uint64(len(data)) {
+		return "", nil, nil, fmt.Errorf("truncated value for %q", key)
+	}
+	raw := data[:valueLen]
+	rest := data[valueLen:]
+
+	switch valueType {
+	case ccTypeBinary:
+		return key, append([]byte(nil), raw...), rest, nil
+	case ccTypeTable:
+		sub, err := parseTable(raw)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return key, sub, rest, nil
+	case ccTypeList:
+		// Lists are not used by rndc commands; keep the raw encoding
+		return key, append([]byte(nil), raw...), rest, nil
+	default:
+		return "", nil, nil, fmt.Errorf("unknown value type %d for %q", valueType, key)
+	}
+}
+
+// ccSign computes the _auth signature value over the signed part of a message
+func ccSign(alg ccAlgorithm, secret, signed []byte) []byte {
+	mac := hmac.New(alg.hash, secret)
+	mac.Write(signed)
+	b64 := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if alg.code == ccAlgorithms["hmac-md5"].code {
+		return []byte(b64[:hmd5Length])
+	}
+	sig := make([]byte, 1+hshaLength)
+	sig[0] = alg.code
+	copy(sig[1:], b64)
+	return sig
+}
+
+// encodeMessage signs and encodes a message, including the length prefix.
+// Any _auth entry in msg is replaced.
+func encodeMessage(msg ccTable, alg ccAlgorithm, secret []byte) ([]byte, error) {
+	var body ccTable
+	for _, e := range msg {
+		if e.key != "_auth" {
+			body = append(body, e)
+		}
+	}
+	signed, err := appendTable(nil, body)
+	if err != nil {
+		return nil, err
+	}
+
+	authKey := "hsha"
+	if alg.code == ccAlgorithms["hmac-md5"].code {
+		authKey = "hmd5"
+	}
+	auth, err := appendTable(nil, ccTable{{key: "_auth", value: ccTable{{key: authKey, value: ccSign(alg, secret, signed)}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 8, 8+len(auth)+len(signed))
+	binary.BigEndian.PutUint32(out[0:4], uint32(4+len(auth)+len(signed)))
+	binary.BigEndian.PutUint32(out[4:8], ccVersion)
+	out = append(out, auth...)
+	return append(out, signed...), nil
+}
+
+// decodeMessage decodes and verifies a message without its length prefix
+func decodeMessage(data []byte, alg ccAlgorithm, secret []byte) (ccTable, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("truncated message")
+	}
+	if v := binary.BigEndian.Uint32(data[0:4]); v != ccVersion {
+		return nil, fmt.Errorf("unsupported control channel version %d", v)
+	}
+	data = data[4:]
+
+	key, authValue, signed, err := parseEntry(data)
+	if err != nil {
+		return nil, err
+	}
+	auth, ok := authValue.(ccTable)
+	if key != "_auth" || !ok {
+		return nil, fmt.Errorf("%w: message is not signed", errBadAuth)
+	}
+
+	want := ccSign(alg, secret, signed)
+	got, _ := auth.get("hmd5").([]byte)
+	if len(want) != hmd5Length {
+		got, _ = auth.get("hsha").([]byte)
+	}
+	if !hmac.Equal(got, want) {
+		return nil, errBadAuth
+	}
+
+	return parseTable(signed)
+}
+
+// readMessage reads one length-prefixed message and returns it without the prefix
+func readMessage(r io.Reader) ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	if length > ccMaxMessage {
+		return nil, fmt.Errorf("message too large (%d bytes)", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
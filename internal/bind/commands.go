@@ -0,0 +1,284 @@
+package bind
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RNDC controls named over its control channel. RNDCClient runs the rndc
+// binary; NativeClient speaks the control channel protocol itself.
+type RNDC interface {
+	AddZone(zone string, zoneConfig string) error
+	DelZone(zone string, clean bool) error
+	ModZone(zone string, zoneConfig string) error
+	ZoneStatus(zone string) (bool, bool, error)
+	ZoneState(zone string) (*ZoneState, error)
+	ShowZone(zone string) (string, error)
+	IsZonePrimary(zone string) (bool, error)
+	Reload(zone string) error
+	Reconfig() error
+	Status() (string, error)
+	DNSSECStatus(zone string) (*DNSSECStatus, error)
+	DNSSECRollover(zone string, key uint16) (string, error)
+	DNSSECCheckDS(zone, state string, key *uint16) (string, error)
+}
+
+// Client implementations accepted by bind.rndc_client
+const (
+	ClientExec   = "exec"
+	ClientNative = "native"
+)
+
+// NewRNDC returns the rndc client selected by name: ClientNative for the
+// built-in protocol client, anything else for the rndc binary
+func NewRNDC(client, rndcPath, rndcConf, view string) RNDC {
+	if client == ClientNative {
+		return NewNativeClient(rndcConf, view)
+	}
+	return NewRNDCClient(rndcPath, rndcConf, view)
+}
+
+// zoneArgs returns the zone argument of a zone command followed, for a
+// non-default view, by the class and view rndc expects after it
+func zoneArgs(zone, view string) []string {
+	if view == "" {
+		return []string{zone}
+	}
+	return []string{zone, "IN", view}
+}
+
+// runFunc runs one rndc command and returns its text output, the error text
+// reported on failure, and an error if the command failed
+type runFunc func(args ...string) (string, string, error)
+
+// The functions below implement the rndc commands on top of a runFunc so the
+// exec and native clients interpret named's responses identically.
+
+// errorText returns the error text of a failed command, falling back to the error
+func errorText(errText string, err error) string {
+	if errText == "" {
+		return err.Error()
+	}
+	return errText
+}
+
+// isNotFound reports whether named's error text means the zone does not exist
+func isNotFound(msg string) bool {
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "no such zone")
+}
+
+func addZone(run runFunc, view, zone string, zoneConfig string) error {
+	if zoneConfig == "" {
+		return fmt.Errorf("zone config cannot be empty")
+	}
+
+	args := append([]string{"addzone"}, zoneArgs(zone, view)...)
+	_, errText, err := run(append(args, zoneConfig)...)
+	if err != nil {
+		if strings.Contains(errorText(errText, err), "already exists") {
+			return fmt.Errorf("%w: %w", ErrZoneExists, err)
+		}
+		return fmt.Errorf("failed to add zone: %w", err)
+	}
+
+	return nil
+}
+
+func delZone(run runFunc, view, zone string, clean bool) error {
+	args := []string{"delzone"}
+	if clean {
+		args = append(args, "-clean")
+	}
+	args = append(args, zoneArgs(zone, view)...)
+
+	_, errText, err := run(args...)
+	if err != nil {
+		if isNotFound(errorText(errText, err)) {
+			return fmt.Errorf("%w: %w", ErrZoneNotFound, err)
+		}
+		return fmt.Errorf("failed to delete zone: %w", err)
+	}
+
+	return nil
+}
+
+func modZone(run runFunc, view, zone string, zoneConfig string) error {
+	if zoneConfig == "" {
+		return fmt.Errorf("zone config cannot be empty")
+	}
+
+	args := append([]string{"modzone"}, zoneArgs(zone, view)...)
+	_, errText, err := run(append(args, zoneConfig)...)
+	if err != nil {
+		if isNotFound(errorText(errText, err)) {
+			return fmt.Errorf("%w: %w", ErrZoneNotFound, err)
+		}
+		return fmt.Errorf("failed to modify zone: %w", err)
+	}
+
+	return nil
+}
+
+func zoneStatus(run runFunc, view, zone string) (bool, bool, error) {
+	state, err := zoneState(run, view, zone)
+	if err != nil {
+		if errors.Is(err, ErrZoneNotFound) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	return true, state.Loaded, nil
+}
+
+func zoneState(run runFunc, view, zone string) (*ZoneState, error) {
+	text, errText, err := run(append([]string{"zonestatus"}, zoneArgs(zone, view)...)...)
+	if err != nil {
+		if isNotFound(errorText(errText, err)) {
+			return nil, fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+		}
+		return nil, fmt.Errorf("failed to get zone status: %w", err)
+	}
+
+	return ParseZoneStatus(text), nil
+}
+
+func showZone(run runFunc, view, zone string) (string, error) {
+	text, errText, err := run(append([]string{"showzone"}, zoneArgs(zone, view)...)...)
+	if err != nil {
+		if isNotFound(errorText(errText, err)) {
+			return "", ErrZoneNotFound
+		}
+		return "", fmt.Errorf("failed to show zone: %w", err)
+	}
+
+	return text, nil
+}
+
+func dnssecStatus(run runFunc, view, zone string) (*DNSSECStatus, error) {
+	text, errText, err := run(append([]string{"dnssec", "-status"}, zoneArgs(zone, view)...)...)
+	if err != nil {
+		msg := errorText(errText, err)
+		switch {
+		case isNotFound(msg):
+			return nil, fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+		case isNoPolicy(msg):
+			return nil, fmt.Errorf("%w: %s", ErrNoDNSSECPolicy, zone)
+		}
+		return nil, fmt.Errorf("failed to get dnssec status: %w", err)
+	}
+
+	return ParseDNSSECStatus(text), nil
+}
+
+// DS states rndc dnssec -checkds accepts
+const (
+	DSPublished = "published"
+	DSWithdrawn = "withdrawn"
+)
+
+func dnssecRollover(run runFunc, view, zone string, key uint16) (string, error) {
+	args := []string{"dnssec", "-rollover", "-key", strconv.Itoa(int(key))}
+	text, errText, err := run(append(args, zoneArgs(zone, view)...)...)
+	if err != nil {
+		if keyErr := dnssecKeyError(text, errorText(errText, err), zone); keyErr != nil {
+			return "", keyErr
+		}
+		return "", fmt.Errorf("failed to schedule rollover: %w", err)
+	}
+
+	return strings.TrimSpace(text), nil
+}
+
+func dnssecCheckDS(run runFunc, view, zone, state string, key *uint16) (string, error) {
+	if state != DSPublished && state != DSWithdrawn {
+		return "", fmt.Errorf("invalid DS state %q", state)
+	}
+
+	args := []string{"dnssec", "-checkds"}
+	if key != nil {
+		args = append(args, "-key", strconv.Itoa(int(*key)))
+	}
+	args = append(args, state)
+	text, errText, err := run(append(args, zoneArgs(zone, view)...)...)
+	if err != nil {
+		if keyErr := dnssecKeyError(text, errorText(errText, err), zone); keyErr != nil {
+			return "", keyErr
+		}
+		return "", fmt.Errorf("failed to mark DS as %s: %w", state, err)
+	}
+
+	return strings.TrimSpace(text), nil
+}
+
+// dnssecKeyError maps named's errors for rndc dnssec key operations, or
+// returns nil for other failures. named explains key errors in the command
+// text and reports them as "not found" too, so key errors are checked first.
+func dnssecKeyError(text, errText, zone string) error {
+	detail := strings.TrimSpace(text)
+	if detail == "" {
+		detail = errText
+	}
+	msg := strings.ToLower(text + " " + errText)
+
+	switch {
+	case strings.Contains(msg, "multiple possible keys"):
+		return fmt.Errorf("%w: %s", ErrAmbiguousKey, detail)
+	case !strings.Contains(msg, "zone") &&
+		(strings.Contains(msg, "no matching") || strings.Contains(msg, "key") && isNotFound(msg)):
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, detail)
+	case isNoPolicy(msg):
+		return fmt.Errorf("%w: %s", ErrNoDNSSECPolicy, zone)
+	case isNotFound(msg):
+		return fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+	}
+	return nil
+}
+
+// isNoPolicy reports whether named's error text means the zone is not
+// signed with a dnssec-policy
+func isNoPolicy(msg string) bool {
+	return strings.Contains(msg, "does not have dnssec-policy") || strings.Contains(msg, "not using dnssec-policy")
+}
+
+func isZonePrimary(run runFunc, view, zone string) (bool, error) {
+	output, err := showZone(run, view, zone)
+	if err != nil {
+		return false, err
+	}
+
+	config := ParseZoneConfig(output)
+	zoneType := config["type"]
+	return zoneType == "primary" || zoneType == "master", nil
+}
+
+func reload(run runFunc, view, zone string) error {
+	_, errText, err := run(append([]string{"reload"}, zoneArgs(zone, view)...)...)
+	if err != nil {
+		return fmt.Errorf("failed to reload zone: %w (stderr: %s)", err, errText)
+	}
+	return nil
+}
+
+func reconfig(run runFunc) error {
+	_, errText, err := run("reconfig")
+	if err != nil {
+		return fmt.Errorf("failed to reconfig: %w (stderr: %s)", err, errText)
+	}
+	return nil
+}
+
+func status(run runFunc) (string, error) {
+	text, errText, err := run("status")
+	if err != nil {
+		return "", fmt.Errorf("failed to get status: %w (stderr: %s)", err, errText)
+	}
+	return text, nil
+}
+
+// Both clients implement RNDC
+var (
+	_ RNDC = (*RNDCClient)(nil)
+	_ RNDC = (*NativeClient)(nil)
+)
@@ -0,0 +1,167 @@
+package bind
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNSSECStatus is the parsed output of rndc dnssec -status
+type DNSSECStatus struct {
+	Policy      string      `json:"policy"`
+	CurrentTime *time.Time  `json:"current_time,omitempty"`
+	Keys        []DNSSECKey `json:"keys"`
+
+	// Earliest rollover scheduled for any key
+	NextRollover *time.Time `json:"next_rollover,omitempty"`
+}
+
+// DNSSECKey is the state of one key of a zone's dnssec-policy
+type DNSSECKey struct {
+	Tag       uint16 `json:"tag"`
+	Algorithm string `json:"algorithm"`
+	Role      string `json:"role"` // KSK, ZSK or CSK
+
+	Published        bool       `json:"published"`
+	PublishedSince   *time.Time `json:"published_since,omitempty"`
+	KeySigning       bool       `json:"key_signing"`
+	KeySigningSince  *time.Time `json:"key_signing_since,omitempty"`
+	ZoneSigning      bool       `json:"zone_signing"`
+	ZoneSigningSince *time.Time `json:"zone_signing_since,omitempty"`
+
+	// Rollover state as named words it, e.g. "No rollover scheduled", and
+	// the time of the next rollover if one is scheduled or due
+	Rollover     string     `json:"rollover,omitempty"`
+	NextRollover *time.Time `json:"next_rollover,omitempty"`
+
+	// Key states by record kind: goal, dnskey, ds, zone_rrsig, key_rrsig
+	States map[string]string `json:"states,omitempty"`
+}
+
+// rolloverPrefixes are the rollover lines named prints that end in the
+// time of the next rollover
+var rolloverPrefixes = []string{
+	"Next rollover scheduled on ",
+	"Rollover is due since ",
+}
+
+// ParseDNSSECStatus parses rndc dnssec -status output. Unknown lines are
+// ignored and unparseable values are left unset.
+func ParseDNSSECStatus(output string) *DNSSECStatus {
+	status := &DNSSECStatus{Keys: []DNSSECKey{}}
+	var key *DNSSECKey
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		// Key state lines: "- dnskey:         omnipresent"
+		if state, ok := strings.CutPrefix(line, "- "); ok {
+			if key == nil {
+				continue
+			}
+			name, value, ok := strings.Cut(state, ":")
+			if !ok {
+				continue
+			}
+			if key.States == nil {
+				key.States = make(map[string]string)
+			}
+			name = strings.ReplaceAll(strings.TrimSpace(name), " ", "_")
+			key.States[name] = strings.TrimSpace(value)
+			continue
+		}
+
+		name, value, _ := strings.Cut(line, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+
+		switch name {
+		case "dnssec-policy":
+			status.Policy = value
+		case "current time":
+			status.CurrentTime = parseKeyTime(value)
+		case "key":
+			status.Keys = append(status.Keys, parseKeyLine(value))
+			key = &status.Keys[len(status.Keys)-1]
+		case "published":
+			if key != nil {
+				key.Published, key.PublishedSince = parseKeyFlag(value)
+			}
+		case "key signing":
+			if key != nil {
+				key.KeySigning, key.KeySigningSince = parseKeyFlag(value)
+			}
+		case "zone signing":
+			if key != nil {
+				key.ZoneSigning, key.ZoneSigningSince = parseKeyFlag(value)
+			}
+		default:
+			// Any other line of a key is its rollover state, e.g. "No
+			// rollover scheduled" or "Next rollover scheduled on <time>"
+			if key != nil {
+				key.Rollover = line
+				key.NextRollover = parseRollover(line)
+			}
+		}
+	}
+
+	for _, k := range status.Keys {
+		if k.NextRollover != nil && (status.NextRollover == nil || k.NextRollover.Before(*status.NextRollover)) {
+			status.NextRollover = k.NextRollover
+		}
+	}
+
+	return status
+}
+
+// parseKeyLine parses the value of a key line: "12345 (ECDSAP256SHA256), KSK"
+func parseKeyLine(value string) DNSSECKey {
+	var key DNSSECKey
+
+	head, role, _ := strings.Cut(value, ",")
+	key.Role = strings.TrimSpace(role)
+
+	tag, algorithm, _ := strings.Cut(strings.TrimSpace(head), " ")
+	if n, err := strconv.ParseUint(tag, 10, 16); err == nil {
+		key.Tag = uint16(n)
+	}
+	key.Algorithm = strings.Trim(strings.TrimSpace(algorithm), "()")
+
+	return key
+}
+
+// parseKeyFlag parses a key timing value: "yes - since <time>" or "no"
+func parseKeyFlag(value string) (bool, *time.Time) {
+	flag, rest, _ := strings.Cut(value, " - ")
+	if !isConfTrue(strings.TrimSpace(flag)) {
+		return false, nil
+	}
+	if since, ok := strings.CutPrefix(strings.TrimSpace(rest), "since "); ok {
+		return true, parseKeyTime(since)
+	}
+	return true, nil
+}
+
+// parseRollover returns the time of a scheduled or due rollover line
+func parseRollover(line string) *time.Time {
+	for _, prefix := range rolloverPrefixes {
+		if value, ok := strings.CutPrefix(line, prefix); ok {
+			return parseKeyTime(value)
+		}
+	}
+	return nil
+}
+
+// parseKeyTime parses the ctime-style timestamps rndc dnssec prints in
+// named's local time, e.g. "Mon Jan  1 00:00:00 2024"
+func parseKeyTime(value string) *time.Time {
+	t, err := time.ParseInLocation(time.ANSIC, strings.TrimSpace(value), time.Local)
+	if err != nil {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,119 @@
+package bind
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// keyTime returns a time as rndc dnssec prints it, in named's local time
+func keyTime(year int, month time.Month, day, hour, min, sec int) *time.Time {
+	t := time.Date(year, month, day, hour, min, sec, 0, time.Local).UTC()
+	return &t
+}
+
+// TestParseDNSSECStatus tests parsing rndc dnssec -status output
+func TestParseDNSSECStatus(t *testing.T) {
+	t.Run("KSK and ZSK", func(t *testing.T) {
+		output := `dnssec-policy: default
+current time:  Mon Jan  1 12:00:00 2024
+
+key: 12345 (ECDSAP256SHA256), KSK
+  published:      yes - since Sun Dec 31 10:00:00 2023
+  key signing:    yes - since Sun Dec 31 10:00:00 2023
+
+  No rollover scheduled
+  - goal:           omnipresent
+  - dnskey:         omnipresent
+  - ds:             rumoured
+  - key rrsig:      omnipresent
+
+key: 54321 (ECDSAP256SHA256), ZSK
+  published:      yes - since Sun Dec 31 10:00:00 2023
+  zone signing:   yes - since Sun Dec 31 10:00:00 2023
+
+  Next rollover scheduled on Sat Mar 30 10:00:00 2024
+  - goal:           omnipresent
+  - dnskey:         omnipresent
+  - zone rrsig:     omnipresent
+`
+		got := ParseDNSSECStatus(output)
+
+		since := keyTime(2023, time.December, 31, 10, 0, 0)
+		rollover := keyTime(2024, time.March, 30, 10, 0, 0)
+		want := &DNSSECStatus{
+			Policy:      "default",
+			CurrentTime: keyTime(2024, time.January, 1, 12, 0, 0),
+			Keys: []DNSSECKey{
+				{
+					Tag:             12345,
+					Algorithm:       "ECDSAP256SHA256",
+					Role:            "KSK",
+					Published:       true,
+					PublishedSince:  since,
+					KeySigning:      true,
+					KeySigningSince: since,
+					Rollover:        "No rollover scheduled",
+					States: map[string]string{
+						"goal": "omnipresent", "dnskey": "omnipresent", "ds": "rumoured", "key_rrsig": "omnipresent",
+					},
+				},
+				{
+					Tag:              54321,
+					Algorithm:        "ECDSAP256SHA256",
+					Role:             "ZSK",
+					Published:        true,
+					PublishedSince:   since,
+					ZoneSigning:      true,
+					ZoneSigningSince: since,
+					Rollover:         "Next rollover scheduled on Sat Mar 30 10:00:00 2024",
+					NextRollover:     rollover,
+					States: map[string]string{
+						"goal": "omnipresent", "dnskey": "omnipresent", "zone_rrsig": "omnipresent",
+					},
+				},
+			},
+			NextRollover: rollover,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseDNSSECStatus() =\n%+v\nwant\n%+v", got, want)
+		}
+	})
+
+	t.Run("CSK being introduced", func(t *testing.T) {
+		output := `dnssec-policy: fast
+current time:  Mon Jan  1 12:00:00 2024
+
+key: 7 (ED25519), CSK
+  published:      no
+  key signing:    no
+  zone signing:   no
+
+  Rollover is due since Mon Jan  1 11:00:00 2024
+  - goal:           omnipresent
+  - dnskey:         hidden
+`
+		got := ParseDNSSECStatus(output)
+
+		if len(got.Keys) != 1 {
+			t.Fatalf("Keys = %+v, want one key", got.Keys)
+		}
+		key := got.Keys[0]
+		if key.Tag != 7 || key.Role != "CSK" || key.Algorithm != "ED25519" {
+			t.Errorf("key = %+v", key)
+		}
+		if key.Published || key.KeySigning || key.ZoneSigning || key.PublishedSince != nil {
+			t.Errorf("key = %+v, want nothing published", key)
+		}
+		if due := keyTime(2024, time.January, 1, 11, 0, 0); !reflect.DeepEqual(got.NextRollover, due) {
+			t.Errorf("NextRollover = %v, want %v", got.NextRollover, due)
+		}
+	})
+
+	t.Run("no keys", func(t *testing.T) {
+		got := ParseDNSSECStatus("dnssec-policy: insecure\ncurrent time:  Mon Jan  1 12:00:00 2024\n")
+		if got.Policy != "insecure" || len(got.Keys) != 0 || got.NextRollover != nil {
+			t.Errorf("ParseDNSSECStatus() = %+v", got)
+		}
+	})
+}
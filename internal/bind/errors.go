@@ -0,0 +1,23 @@
+package bind
+
+import "errors"
+
+// Errors returned by RNDCClient, wrapped with the rndc output where available
+var (
+	// ErrRNDCUnavailable means the rndc binary could not be started
+	ErrRNDCUnavailable = errors.New("rndc unavailable")
+	// ErrTimeout means an rndc command did not complete within the timeout
+	ErrTimeout = errors.New("rndc command timed out")
+	// ErrZoneExists means named already serves the zone
+	ErrZoneExists = errors.New("zone already exists")
+	// ErrZoneNotFound means named does not serve the zone
+	ErrZoneNotFound = errors.New("zone not found")
+	// ErrNoDNSSECPolicy means the zone is not signed with a dnssec-policy
+	ErrNoDNSSECPolicy = errors.New("zone has no dnssec-policy")
+	// ErrKeyNotFound means the zone's dnssec-policy has no key matching a
+	// key operation
+	ErrKeyNotFound = errors.New("no matching DNSSEC key")
+	// ErrAmbiguousKey means a key operation matches several keys and needs
+	// a key tag
+	ErrAmbiguousKey = errors.New("several DNSSEC keys match")
+)
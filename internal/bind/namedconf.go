@@ -0,0 +1,224 @@
+package bind
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxIncludeDepth bounds include nesting to guard against include loops
+const maxIncludeDepth = 16
+
+// NamedConf is a tokenized named.conf with include statements expanded.
+// It supports the lookups dnsctl needs; it is not a full configuration parser.
+type NamedConf struct {
+	tokens []string
+}
+
+// ReadNamedConf reads and tokenizes a named.conf file, following includes.
+// Relative include paths are resolved against the including file's directory.
+func ReadNamedConf(path string) (*NamedConf, error) {
+	tokens, err := readConfTokens(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &NamedConf{tokens: tokens}, nil
+}
+
+// ParseNamedConf tokenizes named.conf content. Include statements are kept
+// as-is and not followed.
+func ParseNamedConf(content string) *NamedConf {
+	return &NamedConf{tokens: tokenizeConf(content)}
+}
+
+// readConfTokens tokenizes a file and splices in the tokens of included files
+func readConfTokens(path string, depth int) ([]string, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("include nesting too deep at %s", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read named.conf: %w", err)
+	}
+
+	var out []string
+	tokens := tokenizeConf(string(data))
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i] == "include" && i+2 < len(tokens) && tokens[i+2] == ";" {
+			incPath := unquote(tokens[i+1])
+			if !filepath.IsAbs(incPath) {
+				incPath = filepath.Join(filepath.Dir(path), incPath)
+			}
+			included, err := readConfTokens(incPath, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, included...)
+			i += 2
+			continue
+		}
+		out = append(out, tokens[i])
+	}
+
+	return out, nil
+}
+
+// tokenizeConf splits named.conf syntax into words, quoted strings, braces
+// and semicolons, dropping //, # and /* */ comments
+func tokenizeConf(content string) []string {
+	var tokens []string
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for i := 0; i < len(content); i++ {
+		ch := content[i]
+		switch {
+		case ch == '#' || (ch == '/' && i+1 < len(content) && content[i+1] == '/'):
+			flush()
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+		case ch == '/' && i+1 < len(content) && content[i+1] == '*':
+			flush()
+			end := strings.Index(content[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 3
+		case ch == '"':
+			flush()
+			end := strings.IndexByte(content[i+1:], '"')
+			if end < 0 {
+				return append(tokens, content[i:])
+			}
+			tokens = append(tokens, content[i:i+end+2])
+			i += end + 1
+		case ch == '{' || ch == '}' || ch == ';':
+			flush()
+			tokens = append(tokens, string(ch))
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			flush()
+		default:
+			word.WriteByte(ch)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// unquote strips surrounding double quotes from a token
+func unquote(token string) string {
+	if len(token) >= 2 && token[0] == '"' && token[len(token)-1] == '"' {
+		return token[1 : len(token)-1]
+	}
+	return token
+}
+
+// OptionValues returns the values of every "<name> <value>;" statement,
+// wherever it appears (options, view or zone blocks)
+func (c *NamedConf) OptionValues(name string) []string {
+	var values []string
+	for i := 0; i+2 < len(c.tokens); i++ {
+		if c.tokens[i] == name && c.tokens[i+2] == ";" && !isConfPunct(c.tokens[i+1]) {
+			values = append(values, unquote(c.tokens[i+1]))
+		}
+	}
+	return values
+}
+
+// AllowNewZones reports whether allow-new-zones is enabled anywhere in the config
+func (c *NamedConf) AllowNewZones() bool {
+	for _, v := range c.OptionValues("allow-new-zones") {
+		if isConfTrue(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// isConfPunct reports whether a token is a brace or semicolon
+func isConfPunct(token string) bool {
+	return token == "{" || token == "}" || token == ";"
+}
+
+// isConfTrue reports whether a named.conf boolean is true
+func isConfTrue(v string) bool {
+	switch strings.ToLower(v) {
+	case "yes", "true", "1":
+		return true
+	}
+	return false
+}
+
+// Key is a key statement, as written by tsig-keygen
+type Key struct {
+	Name      string // Key name as written, e.g. "dnsctl-updater"
+	Algorithm string // BIND algorithm name, e.g. "hmac-sha256"
+	Secret    string // Base64 secret
+}
+
+// Keys returns the top-level key statements. Key references inside
+// allow-update and similar address lists are not key statements and are
+// skipped.
+func (c *NamedConf) Keys() []Key {
+	var keys []Key
+	for i := 0; i+2 < len(c.tokens); i++ {
+		if c.tokens[i] != "key" || c.tokens[i+2] != "{" || isConfPunct(c.tokens[i+1]) {
+			continue
+		}
+
+		key := Key{Name: unquote(c.tokens[i+1])}
+		depth := 0
+		j := i + 2
+		for ; j < len(c.tokens); j++ {
+			switch c.tokens[j] {
+			case "{":
+				depth++
+				continue
+			case "}":
+				depth--
+			}
+			if depth == 0 {
+				break
+			}
+			if depth == 1 && j+2 < len(c.tokens) && c.tokens[j+2] == ";" {
+				switch c.tokens[j] {
+				case "algorithm":
+					key.Algorithm = unquote(c.tokens[j+1])
+				case "secret":
+					key.Secret = unquote(c.tokens[j+1])
+				}
+			}
+		}
+
+		keys = append(keys, key)
+		i = j
+	}
+	return keys
+}
+
+// BuiltinDNSSECPolicies are the dnssec-policy names named knows without a
+// dnssec-policy statement
+var BuiltinDNSSECPolicies = []string{"default", "insecure", "none"}
+
+// DNSSECPolicies returns the names of the dnssec-policy statements. The
+// dnssec-policy options that select a policy for a zone are not statements
+// and are skipped.
+func (c *NamedConf) DNSSECPolicies() []string {
+	var names []string
+	for i := 0; i+2 < len(c.tokens); i++ {
+		if c.tokens[i] == "dnssec-policy" && c.tokens[i+2] == "{" && !isConfPunct(c.tokens[i+1]) {
+			names = append(names, unquote(c.tokens[i+1]))
+		}
+	}
+	return names
+}
@@ -0,0 +1,126 @@
+package bind
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestTokenizeConf tests named.conf tokenization and comment stripping
+func TestTokenizeConf(t *testing.T) {
+	content := `// leading comment
+options {
+	directory "/var/cache/bind"; # hash comment
+	/* block
+	   comment */ allow-new-zones yes;
+};`
+
+	got := tokenizeConf(content)
+	want := []string{
+		"options", "{",
+		"directory", `"/var/cache/bind"`, ";",
+		"allow-new-zones", "yes", ";",
+		"}", ";",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenizeConf() = %q, want %q", got, want)
+	}
+}
+
+// TestAllowNewZones tests detection of allow-new-zones
+func TestAllowNewZones(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"enabled", `options { allow-new-zones yes; };`, true},
+		{"enabled true", `options { allow-new-zones true; };`, true},
+		{"in view", `view "internal" { allow-new-zones yes; };`, true},
+		{"disabled", `options { allow-new-zones no; };`, false},
+		{"absent", `options { directory "/var/cache/bind"; };`, false},
+		{"commented out", `options { // allow-new-zones yes;
+		};`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseNamedConf(tt.content).AllowNewZones(); got != tt.want {
+				t.Errorf("AllowNewZones() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestReadNamedConfIncludes tests that include statements are followed
+func TestReadNamedConfIncludes(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "named.conf")
+	options := filepath.Join(dir, "named.conf.options")
+
+	if err := os.WriteFile(main, []byte(`include "named.conf.options";`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(options, []byte(`options { allow-new-zones yes; };`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := ReadNamedConf(main)
+	if err != nil {
+		t.Fatalf("ReadNamedConf() error = %v", err)
+	}
+	if !conf.AllowNewZones() {
+		t.Error("AllowNewZones() = false, want true from included file")
+	}
+
+	// An include loop must fail rather than recurse forever
+	if err := os.WriteFile(options, []byte(`include "named.conf";`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadNamedConf(main); err == nil {
+		t.Error("ReadNamedConf() with include loop returned nil error")
+	}
+}
+
+// TestKeys tests parsing key statements such as tsig-keygen output
+func TestKeys(t *testing.T) {
+	content := `key "dnsctl-updater" {
+	algorithm hmac-sha256;
+	secret "c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz";
+};
+zone "catalog.example" {
+	allow-update { key "dnsctl-updater"; };
+};
+key other. { algorithm hmac-sha512; secret "b3RoZXI="; };`
+
+	got := ParseNamedConf(content).Keys()
+	want := []Key{
+		{Name: "dnsctl-updater", Algorithm: "hmac-sha256", Secret: "c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz"},
+		{Name: "other.", Algorithm: "hmac-sha512", Secret: "b3RoZXI="},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys() = %+v, want %+v", got, want)
+	}
+
+	if keys := ParseNamedConf("c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz").Keys(); len(keys) != 0 {
+		t.Errorf("Keys() on a raw secret = %+v, want none", keys)
+	}
+}
+
+// TestDNSSECPolicies tests that dnssec-policy statements are found and
+// the options selecting a policy are not
+func TestDNSSECPolicies(t *testing.T) {
+	content := `dnssec-policy "standard" {
+	keys { csk lifetime unlimited algorithm ecdsap256sha256; };
+};
+dnssec-policy fast { signatures-validity 1d; };
+options { dnssec-policy default; };
+zone "example.com" { type primary; dnssec-policy standard; };`
+
+	got := ParseNamedConf(content).DNSSECPolicies()
+	want := []string{"standard", "fast"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DNSSECPolicies() = %v, want %v", got, want)
+	}
+}
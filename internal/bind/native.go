@@ -0,0 +1,294 @@
+package bind
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultRNDCPort is the control channel port rndc uses when rndc.conf sets none
+const defaultRNDCPort = 953
+
+// NativeClient talks to named's control channel directly instead of running
+// the rndc binary. The server address and key are read from rndc.conf.
+type NativeClient struct {
+	rndcConf string
+	view     string
+	timeout  time.Duration
+	serial   uint32
+}
+
+// NewNativeClient creates a control channel client configured by rndc.conf
+func NewNativeClient(rndcConf, view string) *NativeClient {
+	var seed [4]byte
+	_, _ = rand.Read(seed[:])
+
+	return &NativeClient{
+		rndcConf: rndcConf,
+		view:     view,
+		timeout:  30 * time.Second,
+		serial:   binary.BigEndian.Uint32(seed[:]),
+	}
+}
+
+// SetTimeout sets the timeout for a whole command, including connecting
+func (n *NativeClient) SetTimeout(d time.Duration) {
+	n.timeout = d
+}
+
+// Response is the result of a control channel command
+type Response struct {
+	Result uint32 // ISC result code; 0 on success
+	Err    string // Error text reported by named, empty on success
+	Text   string // Command output
+}
+
+// rndcSettings are the rndc.conf settings needed to reach named
+type rndcSettings struct {
+	addr      string
+	keyName   string
+	algorithm ccAlgorithm
+	secret    []byte
+}
+
+// loadRNDCSettings reads the default server, port and key from rndc.conf.
+// A bare rndc.key file works as well: the server defaults to 127.0.0.1.
+func loadRNDCSettings(path string) (*rndcSettings, error) {
+	conf, err := ReadNamedConf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := conf.Keys()
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key statement in %s", path)
+	}
+	key := keys[0]
+	if names := conf.OptionValues("default-key"); len(names) > 0 {
+		found := false
+		for _, k := range keys {
+			if k.Name == names[0] {
+				key, found = k, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("default-key %s is not defined in %s", names[0], path)
+		}
+	} else if len(keys) > 1 {
+		return nil, fmt.Errorf("%s defines %d keys but no default-key", path, len(keys))
+	}
+
+	alg, err := lookupCCAlgorithm(key.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", key.Name, err)
+	}
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: invalid secret: %w", key.Name, err)
+	}
+
+	host := "127.0.0.1"
+	if servers := conf.OptionValues("default-server"); len(servers) > 0 {
+		host = servers[0]
+	}
+	port := defaultRNDCPort
+	if ports := conf.OptionValues("default-port"); len(ports) > 0 {
+		if port, err = strconv.Atoi(ports[0]); err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("invalid default-port %q in %s", ports[0], path)
+		}
+	}
+
+	return &rndcSettings{
+		addr:      net.JoinHostPort(host, strconv.Itoa(port)),
+		keyName:   key.Name,
+		algorithm: alg,
+		secret:    secret,
+	}, nil
+}
+
+// Command sends one command, e.g. Command("zonestatus", "example.com"), and
+// returns named's structured response. A command that named rejects is not
+// an error here: it is reported in Response.Err.
+func (n *NativeClient) Command(args ...string) (*Response, error) {
+	settings, err := loadRNDCSettings(n.rndcConf)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRNDCUnavailable, err)
+	}
+
+	// One deadline covers connecting and both exchanges
+	deadline := time.Now().Add(n.timeout)
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.Dial("tcp", settings.addr)
+	if err != nil {
+		return nil, n.netError(fmt.Errorf("%w: failed to connect to %s: %w", ErrRNDCUnavailable, settings.addr, err))
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(deadline)
+
+	// The first exchange only establishes the nonce for the connection
+	reply, err := n.exchange(conn, settings, "null", 0)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ok := reply.table("_ctrl").uint32("_nonce")
+	if !ok {
+		return nil, fmt.Errorf("rndc: no nonce in response from %s", settings.addr)
+	}
+
+	reply, err = n.exchange(conn, settings, strings.Join(args, " "), nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	data := reply.table("_data")
+	if data == nil {
+		return nil, fmt.Errorf("rndc: missing data section in response")
+	}
+	resp := &Response{}
+	resp.Result, _ = data.uint32("result")
+	resp.Err, _ = data.str("err")
+	resp.Text, _ = data.str("text")
+	if resp.Err != "" && resp.Result == 0 {
+		// Older servers report failures only through err
+		resp.Result = ^uint32(0)
+	}
+
+	return resp, nil
+}
+
+// exchange sends one request on the connection and returns the verified reply
+func (n *NativeClient) exchange(conn net.Conn, settings *rndcSettings, command string, nonce uint32) (ccTable, error) {
+	now := uint32(time.Now().Unix())
+	n.serial++
+
+	ctrl := ccTable{}
+	ctrl.setUint32("_ser", n.serial)
+	ctrl.setUint32("_tim", now)
+	ctrl.setUint32("_exp", now+60)
+	if nonce != 0 {
+		ctrl.setUint32("_nonce", nonce)
+	}
+	data := ccTable{}
+	data.setString("type", command)
+
+	msg, err := encodeMessage(ccTable{{key: "_ctrl", value: ctrl}, {key: "_data", value: data}},
+		settings.algorithm, settings.secret)
+	if err != nil {
+		return nil, fmt.Errorf("rndc: failed to encode request: %w", err)
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, n.netError(fmt.Errorf("rndc: failed to send request: %w", err))
+	}
+
+	raw, err := readMessage(conn)
+	if err != nil {
+		return nil, n.netError(fmt.Errorf("rndc: failed to read response: %w", err))
+	}
+
+	reply, err := decodeMessage(raw, settings.algorithm, settings.secret)
+	if err != nil {
+		if errors.Is(err, errBadAuth) {
+			return nil, fmt.Errorf("rndc: response signature did not verify with key %s", settings.keyName)
+		}
+		return nil, fmt.Errorf("rndc: invalid response: %w", err)
+	}
+	return reply, nil
+}
+
+// netError maps network timeouts to ErrTimeout
+func (n *NativeClient) netError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%w after %v: %w", ErrTimeout, n.timeout, err)
+	}
+	return err
+}
+
+// run adapts Command to the runFunc shared with RNDCClient
+func (n *NativeClient) run(args ...string) (string, string, error) {
+	resp, err := n.Command(args...)
+	if err != nil {
+		return "", "", err
+	}
+	if resp.Err != "" {
+		errText := strings.TrimSpace(resp.Err + "\n" + resp.Text)
+		return resp.Text, errText, fmt.Errorf("'%s' failed: %s", args[0], errText)
+	}
+	return resp.Text, "", nil
+}
+
+// AddZone adds a new zone with addzone
+func (n *NativeClient) AddZone(zone string, zoneConfig string) error {
+	return addZone(n.run, n.view, zone, zoneConfig)
+}
+
+// DelZone removes a zone with delzone, removing its file if clean is true
+func (n *NativeClient) DelZone(zone string, clean bool) error {
+	return delZone(n.run, n.view, zone, clean)
+}
+
+// ModZone replaces the configuration of a zone
+func (n *NativeClient) ModZone(zone string, zoneConfig string) error {
+	return modZone(n.run, n.view, zone, zoneConfig)
+}
+
+// ZoneStatus returns whether a zone exists and is loaded
+func (n *NativeClient) ZoneStatus(zone string) (bool, bool, error) {
+	return zoneStatus(n.run, n.view, zone)
+}
+
+// ZoneState returns the parsed zonestatus output for a zone
+func (n *NativeClient) ZoneState(zone string) (*ZoneState, error) {
+	return zoneState(n.run, n.view, zone)
+}
+
+// ShowZone returns the configuration of a zone
+func (n *NativeClient) ShowZone(zone string) (string, error) {
+	return showZone(n.run, n.view, zone)
+}
+
+// IsZonePrimary checks if a zone is configured as a primary
+func (n *NativeClient) IsZonePrimary(zone string) (bool, error) {
+	return isZonePrimary(n.run, n.view, zone)
+}
+
+// Reload reloads a zone
+func (n *NativeClient) Reload(zone string) error {
+	return reload(n.run, n.view, zone)
+}
+
+// Reconfig reloads the configuration
+func (n *NativeClient) Reconfig() error {
+	return reconfig(n.run)
+}
+
+// Status returns the status of the server
+func (n *NativeClient) Status() (string, error) {
+	return status(n.run)
+}
+
+// DNSSECStatus returns the parsed rndc dnssec -status output for a zone
+func (n *NativeClient) DNSSECStatus(zone string) (*DNSSECStatus, error) {
+	return dnssecStatus(n.run, n.view, zone)
+}
+
+// DNSSECRollover schedules the rollover of a key of the zone's
+// dnssec-policy (rndc dnssec -rollover) and returns named's response
+func (n *NativeClient) DNSSECRollover(zone string, key uint16) (string, error) {
+	return dnssecRollover(n.run, n.view, zone, key)
+}
+
+// DNSSECCheckDS tells named that the DS of a key signing key is published
+// in or withdrawn from the parent (rndc dnssec -checkds). A nil key lets
+// named pick the zone's only key signing key.
+func (n *NativeClient) DNSSECCheckDS(zone, state string, key *uint16) (string, error) {
+	return dnssecCheckDS(n.run, n.view, zone, state, key)
+}
@@ -0,0 +1,418 @@
+package bind
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testRNDCSecret is the base64 rndc key secret used by the fake server
+const testRNDCSecret = "cm5kYy1rZXktZm9yLWRuc2N0bC10ZXN0cw=="
+
+// fakeRNDC is an in-process control channel server. handler returns the
+// text and error text for a command; an empty error text means success.
+type fakeRNDC struct {
+	alg     ccAlgorithm
+	secret  []byte
+	handler func(command string) (text, errText string)
+
+	mu       sync.Mutex
+	commands []string
+}
+
+// startFakeRNDC starts a fake named control channel and returns an rndc.conf path for it
+func startFakeRNDC(t *testing.T, algorithm string, handler func(command string) (string, string)) (*fakeRNDC, string) {
+	t.Helper()
+
+	alg, err := lookupCCAlgorithm(algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := base64.StdEncoding.DecodeString(testRNDCSecret)
+	f := &fakeRNDC{alg: alg, secret: secret, handler: handler}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return f, writeRNDCConf(t, algorithm, testRNDCSecret, host, port)
+}
+
+// writeRNDCConf writes an rndc.conf for the given key and server
+func writeRNDCConf(t *testing.T, algorithm, secret, host, port string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "rndc.conf")
+	content := fmt.Sprintf(`key "rndc-key" {
+	algorithm %s;
+	secret "%s";
+};
+options {
+	default-key "rndc-key";
+	default-server %s;
+	default-port %s;
+};
+`, algorithm, secret, host, port)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serve handles one connection the way named's control channel does: the
+// first request establishes a nonce, later requests must carry it
+func (f *fakeRNDC) serve(conn net.Conn) {
+	defer conn.Close()
+
+	var nonce uint32
+	for {
+		raw, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+		req, err := decodeMessage(raw, f.alg, f.secret)
+		if err != nil {
+			return
+		}
+
+		ctrl := req.table("_ctrl")
+		command, _ := req.table("_data").str("type")
+
+		data := ccTable{}
+		data.setString("type", command)
+		if nonce == 0 {
+			nonce = 0x5eed
+		} else {
+			if got, _ := ctrl.uint32("_nonce"); got != nonce {
+				return
+			}
+			f.mu.Lock()
+			f.commands = append(f.commands, command)
+			f.mu.Unlock()
+
+			text, errText := f.handler(command)
+			if errText != "" {
+				data.setUint32("result", 23)
+				data.setString("err", errText)
+			} else {
+				data.setUint32("result", 0)
+			}
+			if text != "" {
+				data.setString("text", text)
+			}
+		}
+
+		now := uint32(time.Now().Unix())
+		replyCtrl := ccTable{}
+		serial, _ := ctrl.str("_ser")
+		replyCtrl.setString("_ser", serial)
+		replyCtrl.setUint32("_tim", now)
+		replyCtrl.setUint32("_exp", now+60)
+		replyCtrl.setString("_rpl", "1")
+		replyCtrl.setUint32("_nonce", nonce)
+
+		msg, err := encodeMessage(ccTable{{key: "_ctrl", value: replyCtrl}, {key: "_data", value: data}}, f.alg, f.secret)
+		if err != nil {
+			return
+		}
+		if _, err := conn.Write(msg); err != nil {
+			return
+		}
+	}
+}
+
+// Commands returns the commands the server has executed
+func (f *fakeRNDC) Commands() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+// TestCCMessageRoundTrip tests signing, encoding and verifying messages
+func TestCCMessageRoundTrip(t *testing.T) {
+	secret := []byte("secret")
+
+	for _, name := range []string{"hmac-md5", "hmac-sha256", "hmac-sha512"} {
+		t.Run(name, func(t *testing.T) {
+			alg, _ := lookupCCAlgorithm(name)
+
+			data := ccTable{}
+			data.setString("type", "zonestatus example.com")
+			msg, err := encodeMessage(ccTable{{key: "_data", value: data}}, alg, secret)
+			if err != nil {
+				t.Fatalf("encodeMessage() error = %v", err)
+			}
+
+			decoded, err := decodeMessage(msg[4:], alg, secret)
+			if err != nil {
+				t.Fatalf("decodeMessage() error = %v", err)
+			}
+			if got, _ := decoded.table("_data").str("type"); got != "zonestatus example.com" {
+				t.Errorf("decoded type = %q", got)
+			}
+
+			if _, err := decodeMessage(msg[4:], alg, []byte("other")); !errors.Is(err, errBadAuth) {
+				t.Errorf("decodeMessage() with wrong secret error = %v, want errBadAuth", err)
+			}
+
+			tampered := append([]byte(nil), msg...)
+			tampered[len(tampered)-1] ^= 0xff
+			if _, err := decodeMessage(tampered[4:], alg, secret); !errors.Is(err, errBadAuth) {
+				t.Errorf("decodeMessage() of tampered message error = %v, want errBadAuth", err)
+			}
+		})
+	}
+}
+
+// TestCCSignLength tests the signature layout of each algorithm family
+func TestCCSignLength(t *testing.T) {
+	md5, _ := lookupCCAlgorithm("hmac-md5")
+	if sig := ccSign(md5, []byte("k"), []byte("data")); len(sig) != hmd5Length {
+		t.Errorf("hmac-md5 signature length = %d, want %d", len(sig), hmd5Length)
+	}
+
+	sha256, _ := lookupCCAlgorithm("hmac-sha256")
+	sig := ccSign(sha256, []byte("k"), []byte("data"))
+	if len(sig) != 1+hshaLength || sig[0] != 163 {
+		t.Errorf("hmac-sha256 signature length = %d, algorithm = %d", len(sig), sig[0])
+	}
+}
+
+// TestLoadRNDCSettings tests reading the server and key from rndc.conf
+func TestLoadRNDCSettings(t *testing.T) {
+	path := writeRNDCConf(t, "hmac-sha256", testRNDCSecret, "192.0.2.1", "9953")
+
+	settings, err := loadRNDCSettings(path)
+	if err != nil {
+		t.Fatalf("loadRNDCSettings() error = %v", err)
+	}
+	if settings.addr != "192.0.2.1:9953" {
+		t.Errorf("addr = %q, want 192.0.2.1:9953", settings.addr)
+	}
+	if settings.keyName != "rndc-key" {
+		t.Errorf("keyName = %q, want rndc-key", settings.keyName)
+	}
+
+	// A bare rndc.key uses the default server
+	keyPath := filepath.Join(t.TempDir(), "rndc.key")
+	content := `key "rndc-key" { algorithm hmac-sha256; secret "` + testRNDCSecret + `"; };`
+	if err := os.WriteFile(keyPath, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	settings, err = loadRNDCSettings(keyPath)
+	if err != nil {
+		t.Fatalf("loadRNDCSettings(rndc.key) error = %v", err)
+	}
+	if settings.addr != "127.0.0.1:953" {
+		t.Errorf("addr = %q, want 127.0.0.1:953", settings.addr)
+	}
+}
+
+// TestNativeClient tests the native client against a fake control channel
+func TestNativeClient(t *testing.T) {
+	server, conf := startFakeRNDC(t, "hmac-sha256", func(command string) (string, string) {
+		switch {
+		case command == "status":
+			return "version: BIND 9.18.0\nserver is up and running", ""
+		case command == "zonestatus example.com":
+			return "name: example.com\ntype: primary\nstatus: loaded", ""
+		case strings.HasPrefix(command, "zonestatus "):
+			return "no matching zone 'missing.example' in any view", "not found"
+		case strings.HasPrefix(command, "addzone "):
+			return "", "already exists"
+		}
+		return "", "unknown command"
+	})
+
+	client := NewNativeClient(conf, "")
+	client.SetTimeout(2 * time.Second)
+
+	out, err := client.Status()
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if !strings.Contains(out, "server is up and running") {
+		t.Errorf("Status() = %q", out)
+	}
+
+	exists, loaded, err := client.ZoneStatus("example.com")
+	if err != nil || !exists || !loaded {
+		t.Errorf("ZoneStatus(example.com) = %v, %v, %v; want true, true, nil", exists, loaded, err)
+	}
+
+	exists, _, err = client.ZoneStatus("missing.example")
+	if err != nil || exists {
+		t.Errorf("ZoneStatus(missing.example) = %v, %v; want false, nil", exists, err)
+	}
+
+	if err := client.AddZone("example.com", "{ type primary; };"); !errors.Is(err, ErrZoneExists) {
+		t.Errorf("AddZone() error = %v, want ErrZoneExists", err)
+	}
+
+	resp, err := client.Command("zonestatus", "missing.example")
+	if err != nil {
+		t.Fatalf("Command() error = %v", err)
+	}
+	if resp.Err != "not found" || resp.Result == 0 {
+		t.Errorf("Command() = %+v, want structured not found", resp)
+	}
+
+	want := []string{"status", "zonestatus example.com", "zonestatus missing.example",
+		"addzone example.com { type primary; };", "zonestatus missing.example"}
+	if got := server.Commands(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("server commands = %q, want %q", got, want)
+	}
+
+	// A view is sent as the trailing class/view arguments
+	viewClient := NewNativeClient(conf, "internal")
+	viewClient.SetTimeout(2 * time.Second)
+	_, _, _ = viewClient.ZoneStatus("example.com")
+	if got := server.Commands(); got[len(got)-1] != "zonestatus example.com IN internal" {
+		t.Errorf("view command = %q, want zonestatus example.com IN internal", got[len(got)-1])
+	}
+}
+
+// TestDNSSECKeyOperations tests the rndc dnssec -rollover and -checkds
+// arguments and the mapping of named's key errors
+func TestDNSSECKeyOperations(t *testing.T) {
+	server, conf := startFakeRNDC(t, "hmac-sha256", func(command string) (string, string) {
+		switch command {
+		case "dnssec -rollover -key 12345 example.com":
+			return "Key 12345: Rollover scheduled", ""
+		case "dnssec -rollover -key 1 example.com":
+			return "Error: no matching key found", "not found"
+		case "dnssec -checkds -key 12345 published example.com":
+			return "KSK 12345: Marked DS as published since 01-Jan-2024 00:00:00.000", ""
+		case "dnssec -checkds withdrawn example.com":
+			return "", "Error: multiple possible keys found, retry command with -key id"
+		case "dnssec -checkds published missing.example":
+			return "no matching zone 'missing.example' in any view", "not found"
+		case "dnssec -rollover -key 12345 unsigned.example":
+			return "", "zone 'unsigned.example' does not have dnssec-policy"
+		}
+		return "", "unknown command"
+	})
+
+	client := NewNativeClient(conf, "")
+	client.SetTimeout(2 * time.Second)
+
+	out, err := client.DNSSECRollover("example.com", 12345)
+	if err != nil || out != "Key 12345: Rollover scheduled" {
+		t.Errorf("DNSSECRollover() = %q, %v", out, err)
+	}
+	if _, err := client.DNSSECRollover("example.com", 1); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("DNSSECRollover() of an unknown key error = %v, want ErrKeyNotFound", err)
+	}
+	if _, err := client.DNSSECRollover("unsigned.example", 12345); !errors.Is(err, ErrNoDNSSECPolicy) {
+		t.Errorf("DNSSECRollover() of an unsigned zone error = %v, want ErrNoDNSSECPolicy", err)
+	}
+
+	key := uint16(12345)
+	out, err = client.DNSSECCheckDS("example.com", DSPublished, &key)
+	if err != nil || !strings.HasPrefix(out, "KSK 12345: Marked DS as published") {
+		t.Errorf("DNSSECCheckDS() = %q, %v", out, err)
+	}
+	if _, err := client.DNSSECCheckDS("example.com", DSWithdrawn, nil); !errors.Is(err, ErrAmbiguousKey) {
+		t.Errorf("DNSSECCheckDS() without a key error = %v, want ErrAmbiguousKey", err)
+	}
+	if _, err := client.DNSSECCheckDS("missing.example", DSPublished, nil); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("DNSSECCheckDS() of a missing zone error = %v, want ErrZoneNotFound", err)
+	}
+	if _, err := client.DNSSECCheckDS("example.com", "seen", nil); err == nil {
+		t.Error("DNSSECCheckDS() with an invalid state returned nil error")
+	}
+
+	if n := len(server.Commands()); n != 6 {
+		t.Errorf("sent %d commands, want 6", n)
+	}
+}
+
+// TestNativeClientErrors tests authentication, connection and timeout failures
+func TestNativeClientErrors(t *testing.T) {
+	t.Run("wrong key", func(t *testing.T) {
+		_, conf := startFakeRNDC(t, "hmac-sha256", func(string) (string, string) { return "", "" })
+		host, port := fakeAddr(t, conf)
+		wrong := writeRNDCConf(t, "hmac-sha256", base64.StdEncoding.EncodeToString([]byte("wrong")), host, port)
+
+		client := NewNativeClient(wrong, "")
+		client.SetTimeout(time.Second)
+		if _, err := client.Status(); err == nil {
+			t.Error("Status() with wrong key returned nil error")
+		}
+	})
+
+	t.Run("connection refused", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		host, port, _ := net.SplitHostPort(listener.Addr().String())
+		listener.Close()
+
+		client := NewNativeClient(writeRNDCConf(t, "hmac-sha256", testRNDCSecret, host, port), "")
+		client.SetTimeout(time.Second)
+		if _, err := client.Status(); !errors.Is(err, ErrRNDCUnavailable) {
+			t.Errorf("Status() error = %v, want ErrRNDCUnavailable", err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				defer conn.Close()
+				time.Sleep(time.Second)
+			}
+		}()
+		host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+		client := NewNativeClient(writeRNDCConf(t, "hmac-sha256", testRNDCSecret, host, port), "")
+		client.SetTimeout(100 * time.Millisecond)
+		if _, err := client.Status(); !errors.Is(err, ErrTimeout) {
+			t.Errorf("Status() error = %v, want ErrTimeout", err)
+		}
+	})
+
+	t.Run("missing rndc.conf", func(t *testing.T) {
+		client := NewNativeClient(filepath.Join(t.TempDir(), "missing.conf"), "")
+		if _, err := client.Status(); !errors.Is(err, ErrRNDCUnavailable) {
+			t.Errorf("Status() error = %v, want ErrRNDCUnavailable", err)
+		}
+	})
+}
+
+// fakeAddr returns the server host and port configured in an rndc.conf
+func fakeAddr(t *testing.T, conf string) (string, string) {
+	t.Helper()
+	settings, err := loadRNDCSettings(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(settings.addr)
+	return host, port
+}
@@ -1,4 +1,4 @@
-// Package bind provides an interface to BIND's rndc command for zone management.
+// Package bind provides an interface to BIND's rndc control channel for zone management.
 package bind
 
 import (
@@ -11,7 +11,7 @@ import (
 )
 
 // zoneBlockPattern matches the start of a BIND zone configuration block
-var zoneBlockPattern = regexp.MustCompile(`^zone\s+["']?[\w.-]+["']?\s*\{`)
+var zoneBlockPattern = regexp.MustCompile(`(?m)^\s*zone\s+["']?[\w.-]+["']?\s*\{`)
 
 // RNDCClient provides an interface to BIND's RNDC command
 type RNDCClient struct {
@@ -38,11 +38,9 @@ func (r *RNDCClient) SetTimeout(d time.Duration) {
 
 // run executes an RNDC command and returns the output
 func (r *RNDCClient) run(args ...string) (string, string, error) {
-	cmdArgs := []string{"-c", r.rndcConf}
-	if r.view != "" {
-		cmdArgs = append(cmdArgs, "-y", r.view)
-	}
-	cmdArgs = append(cmdArgs, args...)
+	// The view is passed to zone commands as their trailing class/view
+	// arguments; -y would select a key, not a view
+	cmdArgs := append([]string{"-c", r.rndcConf}, args...)
 
 	cmd := exec.Command(r.rndcPath, cmdArgs...)
 
@@ -52,7 +50,7 @@ func (r *RNDCClient) run(args ...string) (string, string, error) {
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
-		return "", "", fmt.Errorf("failed to start rndc: %w", err)
+		return "", "", fmt.Errorf("%w: failed to start rndc: %w", ErrRNDCUnavailable, err)
 	}
 
 	// Wait for completion with timeout
@@ -64,7 +62,7 @@ func (r *RNDCClient) run(args ...string) (string, string, error) {
 	select {
 	case <-time.After(r.timeout):
 		_ = cmd.Process.Kill()
-		return "", "", fmt.Errorf("rndc command timed out after %v", r.timeout)
+		return "", "", fmt.Errorf("%w after %v", ErrTimeout, r.timeout)
 	case err := <-done:
 		stdoutStr := stdout.String()
 		stderrStr := stderr.String()
@@ -76,158 +74,108 @@ func (r *RNDCClient) run(args ...string) (string, string, error) {
 }
 
 // AddZone adds a new zone to BIND using rndc addzone
-// The zoneConfig should be a BIND config block (without the outer quotes)
+// The zoneConfig should be a braced BIND config block (without the outer quotes)
 func (r *RNDCClient) AddZone(zone string, zoneConfig string) error {
-	if zoneConfig == "" {
-		return fmt.Errorf("zone config cannot be empty")
-	}
-
-	_, stderr, err := r.run("addzone", zone, zoneConfig)
-	if err != nil {
-		// Check for common error messages
-		errMsg := stderr
-		if errMsg == "" {
-			errMsg = err.Error()
-		}
-		if strings.Contains(errMsg, "already exists") {
-			return fmt.Errorf("zone already exists: %w", err)
-		}
-		return fmt.Errorf("failed to add zone: %w", err)
-	}
-
-	return nil
+	return addZone(r.run, r.view, zone, zoneConfig)
 }
 
 // DelZone removes a zone from BIND using rndc delzone
 // If clean is true, uses -clean flag (removes zone file)
 func (r *RNDCClient) DelZone(zone string, clean bool) error {
-	args := []string{"delzone"}
-	if clean {
-		args = append(args, "-clean")
-	}
-	args = append(args, zone)
-
-	_, stderr, err := r.run(args...)
-	if err != nil {
-		errMsg := stderr
-		if errMsg == "" {
-			errMsg = err.Error()
-		}
-		if strings.Contains(errMsg, "not found") || strings.Contains(errMsg, "no such zone") {
-			return fmt.Errorf("zone not found: %w", err)
-		}
-		return fmt.Errorf("failed to delete zone: %w", err)
-	}
+	return delZone(r.run, r.view, zone, clean)
+}
 
-	return nil
+// ModZone replaces the configuration of a zone using rndc modzone
+// The zoneConfig should be a braced BIND config block, as for AddZone
+func (r *RNDCClient) ModZone(zone string, zoneConfig string) error {
+	return modZone(r.run, r.view, zone, zoneConfig)
 }
 
 // ZoneStatus checks if a zone is loaded and returns its status
 // Returns (exists, loaded, error)
 func (r *RNDCClient) ZoneStatus(zone string) (bool, bool, error) {
-	stdout, stderr, err := r.run("zonestatus", zone)
-	if err != nil {
-		errMsg := stderr
-		if errMsg == "" {
-			errMsg = err.Error()
-		}
-		// Zone doesn't exist
-		if strings.Contains(errMsg, "not found") || strings.Contains(errMsg, "no such zone") {
-			return false, false, nil
-		}
-		return false, false, fmt.Errorf("failed to get zone status: %w", err)
-	}
-
-	// Parse output to check if zone is loaded
-	loaded := false
-	lines := strings.Split(stdout, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "status:") {
-			status := strings.TrimPrefix(line, "status:")
-			status = strings.TrimSpace(status)
-			if strings.EqualFold(status, "loaded") {
-				loaded = true
-			}
-		}
-	}
+	return zoneStatus(r.run, r.view, zone)
+}
 
-	return true, loaded, nil
+// ZoneState returns the parsed rndc zonestatus output for a zone
+func (r *RNDCClient) ZoneState(zone string) (*ZoneState, error) {
+	return zoneState(r.run, r.view, zone)
 }
 
 // ShowZone displays the configuration of a zone
 func (r *RNDCClient) ShowZone(zone string) (string, error) {
-	stdout, stderr, err := r.run("showzone", zone)
-	if err != nil {
-		errMsg := stderr
-		if errMsg == "" {
-			errMsg = err.Error()
-		}
-		if strings.Contains(errMsg, "not found") || strings.Contains(errMsg, "no such zone") {
-			return "", fmt.Errorf("zone not found")
-		}
-		return "", fmt.Errorf("failed to show zone: %w", err)
-	}
-
-	return stdout, nil
+	return showZone(r.run, r.view, zone)
 }
 
 // Reload reloads a zone
 func (r *RNDCClient) Reload(zone string) error {
-	_, stderr, err := r.run("reload", zone)
-	if err != nil {
-		return fmt.Errorf("failed to reload zone: %w (stderr: %s)", err, stderr)
-	}
-	return nil
+	return reload(r.run, r.view, zone)
 }
 
 // Reconfig reloads the configuration
 func (r *RNDCClient) Reconfig() error {
-	_, stderr, err := r.run("reconfig")
-	if err != nil {
-		return fmt.Errorf("failed to reconfig: %w (stderr: %s)", err, stderr)
-	}
-	return nil
+	return reconfig(r.run)
 }
 
 // Status returns the status of the BIND server
 func (r *RNDCClient) Status() (string, error) {
-	stdout, stderr, err := r.run("status")
-	if err != nil {
-		return "", fmt.Errorf("failed to get status: %w (stderr: %s)", err, stderr)
-	}
-	return stdout, nil
+	return status(r.run)
 }
 
-// ParseZoneConfig parses the zone configuration from rndc showzone output
-// Returns the configuration as a map of directives
-func ParseZoneConfig(output string) map[string]string {
-	config := make(map[string]string)
-	lines := strings.Split(output, "\n")
+// DNSSECStatus returns the parsed rndc dnssec -status output for a zone
+func (r *RNDCClient) DNSSECStatus(zone string) (*DNSSECStatus, error) {
+	return dnssecStatus(r.run, r.view, zone)
+}
 
-	inZone := false
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
+// DNSSECRollover schedules the rollover of a key of the zone's
+// dnssec-policy (rndc dnssec -rollover) and returns named's response
+func (r *RNDCClient) DNSSECRollover(zone string, key uint16) (string, error) {
+	return dnssecRollover(r.run, r.view, zone, key)
+}
 
-		// Look for zone "example.com" { pattern
-		if zoneBlockPattern.MatchString(line) {
-			inZone = true
-			continue
-		}
+// DNSSECCheckDS tells named that the DS of a key signing key is published
+// in or withdrawn from the parent (rndc dnssec -checkds). A nil key lets
+// named pick the zone's only key signing key.
+func (r *RNDCClient) DNSSECCheckDS(zone, state string, key *uint16) (string, error) {
+	return dnssecCheckDS(r.run, r.view, zone, state, key)
+}
 
-		if inZone {
-			if line == "}" {
-				break
+// ParseZoneConfig parses the zone configuration from rndc showzone output,
+// which named prints on a single line. Returns the options of the first zone
+// block as a map of directives to their first value; an option taking a
+// block, like primaries, maps to "{".
+func ParseZoneConfig(output string) map[string]string {
+	config := make(map[string]string)
+	loc := zoneBlockPattern.FindStringIndex(output)
+	if loc == nil {
+		return config
+	}
+
+	// Split the block into statements at the semicolons of its own level,
+	// skipping nested blocks and quoted strings
+	var statement strings.Builder
+	depth, quoted := 1, false
+	for _, c := range output[loc[1]:] {
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return config
 			}
-
-			// Parse directives like "type primary;"
-			parts := strings.Fields(line)
-			if len(parts) >= 2 {
-				key := strings.TrimSuffix(parts[0], ";")
-				value := strings.TrimSuffix(parts[1], ";")
-				config[key] = value
+		case c == ';' && depth == 1:
+			// Parse directives like "type primary"
+			if parts := strings.Fields(statement.String()); len(parts) >= 2 {
+				config[parts[0]] = parts[1]
 			}
+			statement.Reset()
+			continue
 		}
+		statement.WriteRune(c)
 	}
 
 	return config
@@ -235,12 +183,5 @@ func ParseZoneConfig(output string) map[string]string {
 
 // IsZonePrimary checks if a zone is configured as a primary (master)
 func (r *RNDCClient) IsZonePrimary(zone string) (bool, error) {
-	output, err := r.ShowZone(zone)
-	if err != nil {
-		return false, err
-	}
-
-	config := ParseZoneConfig(output)
-	zoneType := config["type"]
-	return zoneType == "primary" || zoneType == "master", nil
+	return isZonePrimary(r.run, r.view, zone)
 }
@@ -1,6 +1,10 @@
 package bind
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -145,6 +149,24 @@ func TestParseZoneConfig(t *testing.T) {
 			output: "some other output without zone block",
 			want:   map[string]string{},
 		},
+		{
+			name:   "single line as named prints it",
+			output: `zone "example.com" { type primary; file "/var/lib/bind/zones/example.com.db"; allow-update { key "dnsctl."; }; };`,
+			want: map[string]string{
+				"type":         "primary",
+				"file":         "\"/var/lib/bind/zones/example.com.db\"",
+				"allow-update": "{",
+			},
+		},
+		{
+			name:   "single line secondary",
+			output: `zone "example.com" { type secondary; primaries { 192.0.2.1; }; file "db.example.com"; };`,
+			want: map[string]string{
+				"type":      "secondary",
+				"primaries": "{",
+				"file":      "\"db.example.com\"",
+			},
+		},
 		{
 			name: "zone with quoted name",
 			output: `zone 'example.com' {
@@ -241,3 +263,76 @@ func TestIsZonePrimaryLogic(t *testing.T) {
 		})
 	}
 }
+
+// TestMissingRNDCBinary tests that a missing rndc binary is reported as ErrRNDCUnavailable
+func TestMissingRNDCBinary(t *testing.T) {
+	client := NewRNDCClient("/nonexistent/sbin/rndc", "/etc/rndc.conf", "")
+
+	if _, err := client.Status(); !errors.Is(err, ErrRNDCUnavailable) {
+		t.Errorf("Status() error = %v, want ErrRNDCUnavailable", err)
+	}
+	if _, _, err := client.ZoneStatus("example.com."); !errors.Is(err, ErrRNDCUnavailable) {
+		t.Errorf("ZoneStatus() error = %v, want ErrRNDCUnavailable", err)
+	}
+}
+
+// TestRNDCClientViewArgs tests that the view is passed as the trailing
+// class/view argument of zone commands rather than as -y
+func TestRNDCClientViewArgs(t *testing.T) {
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "rndc")
+	content := "#!/bin/sh\nprintf '%s|' \"$@\" >> " + argsFile + "\necho >> " + argsFile + "\necho 'status: loaded'\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewRNDCClient(script, "/etc/rndc.conf", "internal")
+	if _, _, err := client.ZoneStatus("example.com"); err != nil {
+		t.Fatalf("ZoneStatus() error = %v", err)
+	}
+	if err := client.AddZone("example.com", "{ type primary; };"); err != nil {
+		t.Fatalf("AddZone() error = %v", err)
+	}
+	if err := client.ModZone("example.com", "{ type primary; };"); err != nil {
+		t.Fatalf("ModZone() error = %v", err)
+	}
+	if err := client.DelZone("example.com", true); err != nil {
+		t.Fatalf("DelZone() error = %v", err)
+	}
+	if err := client.Reload("example.com"); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if _, err := client.DNSSECStatus("example.com"); err != nil {
+		t.Fatalf("DNSSECStatus() error = %v", err)
+	}
+	if _, err := client.DNSSECRollover("example.com", 12345); err != nil {
+		t.Fatalf("DNSSECRollover() error = %v", err)
+	}
+	if _, err := client.DNSSECCheckDS("example.com", DSPublished, nil); err != nil {
+		t.Fatalf("DNSSECCheckDS() error = %v", err)
+	}
+	if _, err := client.Status(); err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+
+	data, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		"-c|/etc/rndc.conf|zonestatus|example.com|IN|internal|",
+		"-c|/etc/rndc.conf|addzone|example.com|IN|internal|{ type primary; };|",
+		"-c|/etc/rndc.conf|modzone|example.com|IN|internal|{ type primary; };|",
+		"-c|/etc/rndc.conf|delzone|-clean|example.com|IN|internal|",
+		"-c|/etc/rndc.conf|reload|example.com|IN|internal|",
+		"-c|/etc/rndc.conf|dnssec|-status|example.com|IN|internal|",
+		"-c|/etc/rndc.conf|dnssec|-rollover|-key|12345|example.com|IN|internal|",
+		"-c|/etc/rndc.conf|dnssec|-checkds|published|example.com|IN|internal|",
+		"-c|/etc/rndc.conf|status|",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("rndc invocations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,117 @@
+package bind
+
+import (
+	"fmt"
+	"strings"
+)
+
+// zoneConfigBody returns the tokens of the braced block of rndc showzone
+// output, e.g. `zone "example.com" { type primary; };`, without the braces
+func zoneConfigBody(showzone string) ([]string, error) {
+	tokens := tokenizeConf(showzone)
+
+	start := -1
+	for i, token := range tokens {
+		if token == "{" {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("no zone configuration block in %q", showzone)
+	}
+
+	depth := 0
+	for i := start; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return tokens[start+1 : i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unterminated zone configuration block in %q", showzone)
+}
+
+// optionIndex returns the index of the "<name> <value> ;" statement at the
+// top level of a block body, or -1
+func optionIndex(body []string, name string) int {
+	depth := 0
+	for i, token := range body {
+		switch token {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		default:
+			if depth == 0 && token == name && i+2 < len(body) && body[i+2] == ";" && !isConfPunct(body[i+1]) &&
+				(i == 0 || body[i-1] == ";") {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// ZoneOption returns the value of a simple option, such as dnssec-policy,
+// in rndc showzone output, or "" if the zone does not set it
+func ZoneOption(showzone, name string) string {
+	body, err := zoneConfigBody(showzone)
+	if err != nil {
+		return ""
+	}
+	if i := optionIndex(body, name); i >= 0 {
+		return unquote(body[i+1])
+	}
+	return ""
+}
+
+// ZoneConfigBlock returns the zone configuration of rndc showzone output as
+// the braced block rndc modzone takes
+func ZoneConfigBlock(showzone string) (string, error) {
+	body, err := zoneConfigBody(showzone)
+	if err != nil {
+		return "", err
+	}
+	return formatConfBlock(body), nil
+}
+
+// SetZoneOption returns the zone configuration of rndc showzone output as
+// the braced block rndc modzone takes, with a simple option set to value.
+// An empty value removes the option.
+func SetZoneOption(showzone, name, value string) (string, error) {
+	body, err := zoneConfigBody(showzone)
+	if err != nil {
+		return "", err
+	}
+	body = append([]string(nil), body...)
+
+	if i := optionIndex(body, name); i >= 0 {
+		if value == "" {
+			body = append(body[:i], body[i+3:]...)
+		} else {
+			body[i+1] = value
+		}
+	} else if value != "" {
+		body = append(body, name, value, ";")
+	}
+
+	return formatConfBlock(body), nil
+}
+
+// formatConfBlock joins the tokens of a block body into "{ ... };"
+func formatConfBlock(body []string) string {
+	var b strings.Builder
+	b.WriteString("{")
+	for _, token := range body {
+		if token != ";" {
+			b.WriteString(" ")
+		}
+		b.WriteString(token)
+	}
+	b.WriteString(" };")
+	return b.String()
+}
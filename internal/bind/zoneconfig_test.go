@@ -0,0 +1,79 @@
+package bind
+
+import "testing"
+
+const testShowZone = `zone "example.com" { type primary; file "/var/lib/dnsctl/zones/example.com.zone"; ` +
+	`update-policy { grant "dnsctl." zonesub ANY; }; dnssec-policy "default"; inline-signing yes; };`
+
+// TestZoneOption tests reading top-level options from rndc showzone output
+func TestZoneOption(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"type", "primary"},
+		{"file", "/var/lib/dnsctl/zones/example.com.zone"},
+		{"dnssec-policy", "default"},
+		{"inline-signing", "yes"},
+		{"grant", ""},
+		{"notify", ""},
+	}
+	for _, tt := range tests {
+		if got := ZoneOption(testShowZone, tt.name); got != tt.want {
+			t.Errorf("ZoneOption(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if got := ZoneOption("zone example.com;", "type"); got != "" {
+		t.Errorf("ZoneOption() without a block = %q, want empty", got)
+	}
+}
+
+// TestSetZoneOption tests replacing, adding and removing options
+func TestSetZoneOption(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{
+			"dnssec-policy", "none",
+			`{ type primary; file "/var/lib/dnsctl/zones/example.com.zone"; update-policy { grant "dnsctl." zonesub ANY; }; ` +
+				`dnssec-policy none; inline-signing yes; };`,
+		},
+		{
+			"inline-signing", "",
+			`{ type primary; file "/var/lib/dnsctl/zones/example.com.zone"; update-policy { grant "dnsctl." zonesub ANY; }; ` +
+				`dnssec-policy "default"; };`,
+		},
+		{
+			"notify", "yes",
+			`{ type primary; file "/var/lib/dnsctl/zones/example.com.zone"; update-policy { grant "dnsctl." zonesub ANY; }; ` +
+				`dnssec-policy "default"; inline-signing yes; notify yes; };`,
+		},
+	}
+	for _, tt := range tests {
+		got, err := SetZoneOption(testShowZone, tt.name, tt.value)
+		if err != nil {
+			t.Fatalf("SetZoneOption(%q) error = %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("SetZoneOption(%q, %q) =\n%s\nwant\n%s", tt.name, tt.value, got, tt.want)
+		}
+	}
+
+	if _, err := SetZoneOption(`zone "example.com" { type primary;`, "notify", "yes"); err == nil {
+		t.Error("SetZoneOption() of an unterminated block returned nil error")
+	}
+}
+
+// TestZoneConfigBlock tests that showzone output becomes a modzone block
+func TestZoneConfigBlock(t *testing.T) {
+	got, err := ZoneConfigBlock(`zone "example.com" { type primary; file "a b.zone"; };`)
+	if err != nil {
+		t.Fatalf("ZoneConfigBlock() error = %v", err)
+	}
+	if want := `{ type primary; file "a b.zone"; };`; got != want {
+		t.Errorf("ZoneConfigBlock() = %q, want %q", got, want)
+	}
+}
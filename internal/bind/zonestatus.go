@@ -0,0 +1,111 @@
+package bind
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ZoneState is the parsed output of rndc zonestatus
+type ZoneState struct {
+	Name           string     `json:"name"`
+	Type           string     `json:"type,omitempty"`
+	Files          []string   `json:"files,omitempty"`
+	Loaded         bool       `json:"loaded"`
+	Serial         uint32     `json:"serial,omitempty"`
+	SignedSerial   uint32     `json:"signed_serial,omitempty"`
+	Nodes          int        `json:"nodes,omitempty"`
+	LastLoaded     *time.Time `json:"last_loaded,omitempty"`
+	NextRefresh    *time.Time `json:"next_refresh,omitempty"`
+	Expires        *time.Time `json:"expires,omitempty"`
+	Secure         bool       `json:"secure"`
+	InlineSigning  bool       `json:"inline_signing"`
+	KeyMaintenance string     `json:"key_maintenance,omitempty"`
+	NextKeyEvent   *time.Time `json:"next_key_event,omitempty"`
+	NextResignNode string     `json:"next_resign_node,omitempty"`
+	NextResignTime *time.Time `json:"next_resign_time,omitempty"`
+	Dynamic        bool       `json:"dynamic"`
+	Frozen         bool       `json:"frozen"`
+	Reconfigurable bool       `json:"reconfigurable"`
+}
+
+// ParseZoneStatus parses rndc zonestatus output. Unknown lines are ignored
+// and unparseable values are left unset.
+func ParseZoneStatus(output string) *ZoneState {
+	state := &ZoneState{}
+
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "name":
+			state.Name = value
+		case "type":
+			state.Type = value
+		case "files":
+			for _, file := range strings.Split(value, ",") {
+				if file = strings.TrimSpace(file); file != "" {
+					state.Files = append(state.Files, file)
+				}
+			}
+		case "serial":
+			// named only reports a serial for loaded zones
+			if serial, err := strconv.ParseUint(value, 10, 32); err == nil {
+				state.Serial = uint32(serial)
+				state.Loaded = true
+			}
+		case "signed serial":
+			if serial, err := strconv.ParseUint(value, 10, 32); err == nil {
+				state.SignedSerial = uint32(serial)
+			}
+		case "nodes":
+			state.Nodes, _ = strconv.Atoi(value)
+		case "last loaded":
+			state.LastLoaded = parseStatusTime(value)
+			state.Loaded = state.Loaded || state.LastLoaded != nil
+		case "next refresh":
+			state.NextRefresh = parseStatusTime(value)
+		case "expires":
+			state.Expires = parseStatusTime(value)
+		case "secure":
+			state.Secure = isConfTrue(value)
+		case "inline signing":
+			state.InlineSigning = isConfTrue(value)
+		case "key maintenance":
+			state.KeyMaintenance = value
+		case "next key event":
+			state.NextKeyEvent = parseStatusTime(value)
+		case "next resign node":
+			state.NextResignNode = value
+		case "next resign time":
+			state.NextResignTime = parseStatusTime(value)
+		case "dynamic":
+			state.Dynamic = isConfTrue(value)
+		case "frozen":
+			state.Frozen = isConfTrue(value)
+		case "reconfigurable via modzone":
+			state.Reconfigurable = isConfTrue(value)
+		case "status":
+			// Not printed by current named; kept for older output
+			state.Loaded = state.Loaded || strings.EqualFold(value, "loaded")
+		}
+	}
+
+	return state
+}
+
+// parseStatusTime parses the HTTP-style timestamps named prints, e.g.
+// "Mon, 01 Jan 2024 00:00:00 GMT"
+func parseStatusTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC1123, value)
+	if err != nil {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,97 @@
+package bind
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestParseZoneStatus tests parsing rndc zonestatus output
+func TestParseZoneStatus(t *testing.T) {
+	t.Run("signed primary", func(t *testing.T) {
+		output := `name: example.com
+type: primary
+files: /var/lib/dnsctl/zones/example.com.zone, /var/lib/dnsctl/zones/include.db
+serial: 2024010101
+signed serial: 2024010105
+nodes: 12
+last loaded: Mon, 01 Jan 2024 00:00:00 GMT
+secure: yes
+inline signing: yes
+key maintenance: automatic
+next key event: Mon, 01 Jan 2024 01:30:00 GMT
+next resign node: www.example.com/NSEC
+next resign time: Tue, 02 Jan 2024 02:00:00 GMT
+dynamic: yes
+frozen: no
+reconfigurable via modzone: yes
+`
+		got := ParseZoneStatus(output)
+
+		lastLoaded := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		nextKeyEvent := time.Date(2024, 1, 1, 1, 30, 0, 0, time.UTC)
+		nextResign := time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC)
+		want := &ZoneState{
+			Name:           "example.com",
+			Type:           "primary",
+			Files:          []string{"/var/lib/dnsctl/zones/example.com.zone", "/var/lib/dnsctl/zones/include.db"},
+			Loaded:         true,
+			Serial:         2024010101,
+			SignedSerial:   2024010105,
+			Nodes:          12,
+			LastLoaded:     &lastLoaded,
+			Secure:         true,
+			InlineSigning:  true,
+			KeyMaintenance: "automatic",
+			NextKeyEvent:   &nextKeyEvent,
+			NextResignNode: "www.example.com/NSEC",
+			NextResignTime: &nextResign,
+			Dynamic:        true,
+			Frozen:         false,
+			Reconfigurable: true,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseZoneStatus() =\n%+v\nwant\n%+v", got, want)
+		}
+	})
+
+	t.Run("secondary", func(t *testing.T) {
+		output := `name: example.org
+type: secondary
+files: example.org.db
+serial: 7
+nodes: 3
+last loaded: Mon, 01 Jan 2024 00:00:00 GMT
+next refresh: Mon, 01 Jan 2024 01:00:00 GMT
+expires: Mon, 08 Jan 2024 00:00:00 GMT
+secure: no
+dynamic: no
+reconfigurable via modzone: no
+`
+		got := ParseZoneStatus(output)
+		if got.Type != "secondary" || got.Serial != 7 || !got.Loaded {
+			t.Errorf("ParseZoneStatus() = %+v", got)
+		}
+		if got.NextRefresh == nil || got.Expires == nil || got.Expires.Day() != 8 {
+			t.Errorf("NextRefresh = %v, Expires = %v", got.NextRefresh, got.Expires)
+		}
+		if got.Secure || got.Dynamic || got.Reconfigurable {
+			t.Errorf("flags = secure %v dynamic %v reconfigurable %v, want all false",
+				got.Secure, got.Dynamic, got.Reconfigurable)
+		}
+	})
+
+	t.Run("not loaded", func(t *testing.T) {
+		got := ParseZoneStatus("name: broken.example\ntype: primary\nfiles: broken.example.db\n")
+		if got.Loaded || got.Serial != 0 {
+			t.Errorf("ParseZoneStatus() = %+v, want not loaded", got)
+		}
+	})
+
+	t.Run("unparseable values", func(t *testing.T) {
+		got := ParseZoneStatus("serial: soon\nlast loaded: yesterday\nnodes: many\n")
+		if got.Loaded || got.LastLoaded != nil || got.Nodes != 0 {
+			t.Errorf("ParseZoneStatus() = %+v, want values left unset", got)
+		}
+	})
+}
@@ -3,10 +3,15 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/miekg/dns"
 	"gopkg.in/yaml.v3"
 )
 
@@ -19,6 +24,15 @@ type Config struct {
 	Policy  PolicyConfig  `yaml:"policy"`
 	Locking LockingConfig `yaml:"locking"`
 	Logging LoggingConfig `yaml:"logging"`
+	SSH     SSHConfig     `yaml:"ssh"`
+
+	// Secondary servers (host or host:port) whose serials zone status reports
+	Secondaries []string `yaml:"secondaries"`
+
+	// Validating resolver (host or host:port) for lookups outside the
+	// primary, such as DS records in parent zones; empty uses the first
+	// nameserver of /etc/resolv.conf
+	Resolver string `yaml:"resolver"`
 
 	// Path to the config file itself (for resolving relative paths)
 	configPath string
@@ -26,12 +40,15 @@ type Config struct {
 
 // BindConfig contains BIND-specific configuration (spec 6.1)
 type BindConfig struct {
-	RNDCPath  string `yaml:"rndc_path"`  // Path to rndc binary
-	RNDCConf  string `yaml:"rndc_conf"`  // Path to rndc.conf
-	View      string `yaml:"view"`       // Empty means default view
-	DNSAddr   string `yaml:"dns_addr"`   // DNS server address for updates
-	DNSPort   int    `yaml:"dns_port"`   // DNS server port
-	TCPUpdates bool  `yaml:"tcp_updates"` // Use TCP for updates by default
+	RNDCPath   string   `yaml:"rndc_path"`   // Path to rndc binary
+	RNDCConf   string   `yaml:"rndc_conf"`   // Path to rndc.conf
+	RNDCClient string   `yaml:"rndc_client"` // exec (run rndc_path) | native (built-in protocol client)
+	NamedConf  string   `yaml:"named_conf"`  // Path to named.conf (read-only, for doctor checks)
+	View       string   `yaml:"view"`        // Empty means default view
+	Views      []string `yaml:"views"`       // Provision zones into each of these views (split-horizon)
+	DNSAddr    string   `yaml:"dns_addr"`    // DNS server address for updates
+	DNSPort    int      `yaml:"dns_port"`    // DNS server port
+	TCPUpdates bool     `yaml:"tcp_updates"` // Use TCP for updates by default
 }
 
 // CatalogConfig contains catalog zone configuration
@@ -39,19 +56,52 @@ type CatalogConfig struct {
 	Zone           string `yaml:"zone"`            // FQDN with trailing dot
 	SchemaVersion  int    `yaml:"schema_version"`  // 1 or 2
 	LabelAlgorithm string `yaml:"label_algorithm"` // sha1-wire
+	TTL            uint32 `yaml:"ttl"`             // TTL of the records dnsctl adds to the catalog
+
+	// Further catalog zones, addressed by name; zone is the default catalog
+	Catalogs []NamedCatalog `yaml:"catalogs"`
+
+	// Rules assigning new zones to a catalog; the longest matching suffix
+	// wins and zones no rule matches go to the default catalog
+	Rules []CatalogRule `yaml:"rules"`
+}
+
+// DefaultCatalogName is the name of the catalog set by catalog.zone
+const DefaultCatalogName = "default"
+
+// NamedCatalog is an additional catalog zone
+type NamedCatalog struct {
+	Name          string `yaml:"name"`           // Name used to select the catalog, e.g. "customers"
+	Zone          string `yaml:"zone"`           // FQDN with trailing dot
+	SchemaVersion int    `yaml:"schema_version"` // 1 or 2; 0 uses catalog.schema_version
+	TTL           uint32 `yaml:"ttl"`            // 0 uses catalog.ttl
+}
+
+// CatalogRule assigns the zones at or below a suffix to a named catalog
+type CatalogRule struct {
+	Suffix  string `yaml:"suffix"`  // e.g. "customers.example.net"
+	Catalog string `yaml:"catalog"` // Catalog name
+}
+
+// Catalog is a catalog zone with its settings resolved
+type Catalog struct {
+	Name          string
+	Zone          string
+	SchemaVersion int
+	TTL           uint32
 }
 
 // ZonesConfig contains zone management configuration
 type ZonesConfig struct {
-	Dir             string `yaml:"dir"`              // Zone file directory
-	FileExtension   string `yaml:"file_extension"`   // Zone file extension (e.g., "zone")
-	FileOwner       string `yaml:"file_owner"`       // Zone file owner (e.g., "bind")
-	FileGroup       string `yaml:"file_group"`       // Zone file group (e.g., "bind")
-	DefaultNotify   bool   `yaml:"default_notify"`   // Default notify setting
-	DNSSECPolicy    string `yaml:"dnssec_policy"`    // DNSSEC policy (e.g., "default")
-	InlineSigning   bool   `yaml:"inline_signing"`   // Enable inline signing
-	UpdateMode      string `yaml:"update_mode"`      // allow-update | update-policy
-	TSIGKeyName     string `yaml:"tsig_key_name"`    // TSIG key name as used in BIND
+	Dir               string `yaml:"dir"`                 // Zone file directory
+	FileExtension     string `yaml:"file_extension"`      // Zone file extension (e.g., "zone")
+	FileOwner         string `yaml:"file_owner"`          // Zone file owner (e.g., "bind")
+	FileGroup         string `yaml:"file_group"`          // Zone file group (e.g., "bind")
+	DefaultNotify     bool   `yaml:"default_notify"`      // Default notify setting
+	DNSSECPolicy      string `yaml:"dnssec_policy"`       // DNSSEC policy (e.g., "default")
+	InlineSigning     bool   `yaml:"inline_signing"`      // Enable inline signing
+	UpdateMode        string `yaml:"update_mode"`         // allow-update | update-policy
+	TSIGKeyName       string `yaml:"tsig_key_name"`       // TSIG key name as used in BIND
 	UpdatePolicyGrant string `yaml:"update_policy_grant"` // For update-policy mode (e.g., "zonesub ANY")
 }
 
@@ -67,11 +117,11 @@ type TSIGConfig struct {
 
 // PolicyConfig contains policy enforcement settings
 type PolicyConfig struct {
-	AllowedRRtypes    []string `yaml:"allowed_rrtypes"`    // Allowed RR types
+	AllowedRRtypes    []string `yaml:"allowed_rrtypes"`     // Allowed RR types
 	DisallowApexCNAME bool     `yaml:"disallow_apex_cname"` // Reject CNAME at apex
 	DisallowNSUpdates bool     `yaml:"disallow_ns_updates"` // Reject NS updates
-	MaxTTL            int      `yaml:"max_ttl"`            // Maximum TTL
-	MinTTL            int      `yaml:"min_ttl"`            // Minimum TTL
+	MaxTTL            int      `yaml:"max_ttl"`             // Maximum TTL
+	MinTTL            int      `yaml:"min_ttl"`             // Minimum TTL
 }
 
 // LockingConfig contains locking configuration
@@ -81,16 +131,29 @@ type LockingConfig struct {
 
 // LoggingConfig contains logging configuration
 type LoggingConfig struct {
-	AuditJSONL  string `yaml:"audit_jsonl"`   // Optional JSONL audit log path
+	AuditJSONL   string `yaml:"audit_jsonl"`   // Optional JSONL audit log path
 	IncludeActor bool   `yaml:"include_actor"` // Include actor in logs
 }
 
+// SSHConfig contains SSH forced-command mode settings (spec 8.1)
+type SSHConfig struct {
+	// Command paths exposed via --ssh-wrap, e.g. "zone status" or "rrset".
+	// An entry allows the command and all commands below it; empty allows all.
+	AllowedCommands []string `yaml:"allowed_commands"`
+
+	// SSH actors ($USER of the forced command) allowed to run privileged
+	// commands such as dnssec rollover; empty allows them to nobody
+	PrivilegedActors []string `yaml:"privileged_actors"`
+}
+
 // DefaultConfig returns a config with sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
 		Bind: BindConfig{
 			RNDCPath:   "/usr/sbin/rndc",
 			RNDCConf:   "/etc/bind/rndc.conf",
+			RNDCClient: bind.ClientExec,
+			NamedConf:  "/etc/bind/named.conf",
 			View:       "",
 			DNSAddr:    "127.0.0.1",
 			DNSPort:    53,
@@ -99,16 +162,17 @@ func DefaultConfig() *Config {
 		Catalog: CatalogConfig{
 			SchemaVersion:  2,
 			LabelAlgorithm: "sha1-wire",
+			TTL:            60,
 		},
 		Zones: ZonesConfig{
-			Dir:             "/var/lib/dnsctl/zones",
-			FileExtension:   "zone",
-			FileOwner:       "bind",
-			FileGroup:       "bind",
-			DefaultNotify:   true,
-			DNSSECPolicy:    "default",
-			InlineSigning:   true,
-			UpdateMode:      "allow-update",
+			Dir:               "/var/lib/dnsctl/zones",
+			FileExtension:     "zone",
+			FileOwner:         "bind",
+			FileGroup:         "bind",
+			DefaultNotify:     true,
+			DNSSECPolicy:      "default",
+			InlineSigning:     true,
+			UpdateMode:        "allow-update",
 			UpdatePolicyGrant: "zonesub ANY",
 		},
 		TSIG: TSIGConfig{
@@ -150,7 +214,9 @@ func Load(path string) (*Config, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to read TSIG secret file: %w", err)
 		}
-		cfg.TSIG.Secret = strings.TrimSpace(string(secret))
+		if err := cfg.loadTSIGSecret(string(secret)); err != nil {
+			return nil, fmt.Errorf("failed to load TSIG secret file: %w", err)
+		}
 	}
 
 	// Validate configuration
@@ -158,6 +224,9 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
 
+	// Use the FQDN algorithm name miekg/dns expects
+	cfg.TSIG.Algorithm, _ = TSIGAlgorithm(cfg.TSIG.Algorithm)
+
 	return cfg, nil
 }
 
@@ -170,6 +239,9 @@ func (c *Config) Validate() error {
 	if c.Bind.RNDCConf == "" {
 		return fmt.Errorf("bind.rndc_conf is required")
 	}
+	if c.Bind.RNDCClient != bind.ClientExec && c.Bind.RNDCClient != bind.ClientNative {
+		return fmt.Errorf("bind.rndc_client must be '%s' or '%s'", bind.ClientExec, bind.ClientNative)
+	}
 	if c.Bind.DNSAddr == "" {
 		return fmt.Errorf("bind.dns_addr is required")
 	}
@@ -177,6 +249,20 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("bind.dns_port must be between 1 and 65535")
 	}
 
+	if c.Bind.View != "" && len(c.Bind.Views) > 0 {
+		return fmt.Errorf("bind.view and bind.views are mutually exclusive")
+	}
+	seenViews := make(map[string]bool)
+	for _, view := range c.Bind.Views {
+		if strings.TrimSpace(view) == "" || strings.ContainsAny(view, "/ \t") {
+			return fmt.Errorf("bind.views contains an invalid view name %q", view)
+		}
+		if seenViews[view] {
+			return fmt.Errorf("bind.views lists view %q more than once", view)
+		}
+		seenViews[view] = true
+	}
+
 	// Validate catalog config
 	if c.Catalog.Zone == "" {
 		return fmt.Errorf("catalog.zone is required")
@@ -190,6 +276,35 @@ func (c *Config) Validate() error {
 	if c.Catalog.LabelAlgorithm != "sha1-wire" {
 		return fmt.Errorf("catalog.label_algorithm must be 'sha1-wire'")
 	}
+	if c.Catalog.TTL == 0 {
+		return fmt.Errorf("catalog.ttl must be positive")
+	}
+	seenCatalogs := map[string]bool{DefaultCatalogName: true, strings.ToLower(c.Catalog.Zone): true}
+	for _, catalog := range c.Catalog.Catalogs {
+		if catalog.Name == "" {
+			return fmt.Errorf("catalog.catalogs: every catalog needs a name")
+		}
+		if !strings.HasSuffix(catalog.Zone, ".") {
+			return fmt.Errorf("catalog.catalogs: zone of %q must end with a trailing dot", catalog.Name)
+		}
+		if catalog.SchemaVersion != 0 && catalog.SchemaVersion != 1 && catalog.SchemaVersion != 2 {
+			return fmt.Errorf("catalog.catalogs: schema_version of %q must be 1 or 2", catalog.Name)
+		}
+		for _, key := range []string{catalog.Name, strings.ToLower(catalog.Zone)} {
+			if seenCatalogs[key] {
+				return fmt.Errorf("catalog.catalogs: %q is used more than once", key)
+			}
+			seenCatalogs[key] = true
+		}
+	}
+	for _, rule := range c.Catalog.Rules {
+		if strings.Trim(rule.Suffix, ".") == "" {
+			return fmt.Errorf("catalog.rules: every rule needs a suffix")
+		}
+		if _, err := c.FindCatalog(rule.Catalog); err != nil {
+			return fmt.Errorf("catalog.rules: suffix %q: %w", rule.Suffix, err)
+		}
+	}
 
 	// Validate zones config
 	if c.Zones.Dir == "" {
@@ -209,6 +324,9 @@ func (c *Config) Validate() error {
 	if c.TSIG.Algorithm == "" {
 		return fmt.Errorf("tsig.algorithm is required")
 	}
+	if _, err := TSIGAlgorithm(c.TSIG.Algorithm); err != nil {
+		return fmt.Errorf("tsig.algorithm: %w", err)
+	}
 	if c.TSIG.Secret == "" {
 		return fmt.Errorf("tsig.secret is required (loaded from secret_file)")
 	}
@@ -226,6 +344,30 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("locking.dir is required")
 	}
 
+	// Validate secondaries
+	for _, secondary := range c.Secondaries {
+		if _, err := secondaryAddr(secondary); err != nil {
+			return fmt.Errorf("secondaries: %w", err)
+		}
+	}
+	if c.Resolver != "" {
+		if _, err := secondaryAddr(c.Resolver); err != nil {
+			return fmt.Errorf("resolver: invalid address %q", c.Resolver)
+		}
+	}
+
+	// Validate SSH config (entries are checked against the command tree at runtime)
+	for _, cmd := range c.SSH.AllowedCommands {
+		if strings.TrimSpace(cmd) == "" {
+			return fmt.Errorf("ssh.allowed_commands must not contain empty entries")
+		}
+	}
+	for _, actor := range c.SSH.PrivilegedActors {
+		if strings.TrimSpace(actor) == "" {
+			return fmt.Errorf("ssh.privileged_actors must not contain empty entries")
+		}
+	}
+
 	return nil
 }
 
@@ -236,6 +378,137 @@ func (c *Config) ZoneFilePath(zone string) string {
 	return filepath.Join(c.Zones.Dir, zoneName+"."+c.Zones.FileExtension)
 }
 
+// ZoneViews returns the views zones are provisioned into: bind.views if set,
+// otherwise the single bind.view ("" meaning the default view)
+func (c *Config) ZoneViews() []string {
+	if len(c.Bind.Views) > 0 {
+		return c.Bind.Views
+	}
+	return []string{c.Bind.View}
+}
+
+// ZoneFilePathInView returns the zone file path for a zone in a view. With
+// bind.views each view keeps its zone files in a subdirectory of zones.dir,
+// so split-horizon zones of the same name do not collide.
+func (c *Config) ZoneFilePathInView(zone, view string) string {
+	if len(c.Bind.Views) == 0 || view == "" {
+		return c.ZoneFilePath(zone)
+	}
+	zoneName := strings.TrimSuffix(zone, ".")
+	return filepath.Join(c.Zones.Dir, view, zoneName+"."+c.Zones.FileExtension)
+}
+
+// SecondaryAddrs returns the secondaries as host:port addresses, with the
+// port defaulting to 53
+func (c *Config) SecondaryAddrs() []string {
+	addrs := make([]string, 0, len(c.Secondaries))
+	for _, secondary := range c.Secondaries {
+		if addr, err := secondaryAddr(secondary); err == nil {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// resolvConf is the resolver configuration used when no resolver is configured
+var resolvConf = "/etc/resolv.conf"
+
+// ResolverAddr returns the resolver as a host:port address
+func (c *Config) ResolverAddr() (string, error) {
+	if c.Resolver != "" {
+		addr, err := secondaryAddr(c.Resolver)
+		if err != nil {
+			return "", fmt.Errorf("invalid resolver %q", c.Resolver)
+		}
+		return addr, nil
+	}
+
+	conf, err := dns.ClientConfigFromFile(resolvConf)
+	if err != nil {
+		return "", fmt.Errorf("no resolver configured and %s unusable: %w", resolvConf, err)
+	}
+	if len(conf.Servers) == 0 {
+		return "", fmt.Errorf("no resolver configured and no nameserver in %s", resolvConf)
+	}
+	return net.JoinHostPort(conf.Servers[0], conf.Port), nil
+}
+
+// secondaryAddr parses a secondary entry of the form host, host:port or
+// [ipv6]:port
+func secondaryAddr(secondary string) (string, error) {
+	if strings.TrimSpace(secondary) == "" {
+		return "", fmt.Errorf("empty secondary entry")
+	}
+	host, port, err := net.SplitHostPort(secondary)
+	if err != nil {
+		// No port given; a bare IPv6 address has colons but no brackets
+		host, port = strings.Trim(secondary, "[]"), "53"
+	}
+	if host == "" || strings.ContainsAny(host, " \t/") {
+		return "", fmt.Errorf("invalid secondary %q", secondary)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return "", fmt.Errorf("invalid port in secondary %q", secondary)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// Catalogs returns every catalog zone with its settings, the default
+// catalog first
+func (c *Config) Catalogs() []Catalog {
+	catalogs := []Catalog{{
+		Name:          DefaultCatalogName,
+		Zone:          c.Catalog.Zone,
+		SchemaVersion: c.Catalog.SchemaVersion,
+		TTL:           c.Catalog.TTL,
+	}}
+	for _, named := range c.Catalog.Catalogs {
+		catalog := Catalog{Name: named.Name, Zone: named.Zone, SchemaVersion: named.SchemaVersion, TTL: named.TTL}
+		if catalog.SchemaVersion == 0 {
+			catalog.SchemaVersion = c.Catalog.SchemaVersion
+		}
+		if catalog.TTL == 0 {
+			catalog.TTL = c.Catalog.TTL
+		}
+		catalogs = append(catalogs, catalog)
+	}
+	return catalogs
+}
+
+// FindCatalog returns the catalog with the given name or zone name
+func (c *Config) FindCatalog(name string) (Catalog, error) {
+	for _, catalog := range c.Catalogs() {
+		if name == catalog.Name || strings.EqualFold(strings.TrimSuffix(name, "."), strings.TrimSuffix(catalog.Zone, ".")) {
+			return catalog, nil
+		}
+	}
+	return Catalog{}, fmt.Errorf("unknown catalog %q", name)
+}
+
+// SelectCatalog returns the catalog a new zone belongs to: the named one if
+// name is set, otherwise the one of the rule with the longest suffix
+// matching the zone, otherwise the default catalog
+func (c *Config) SelectCatalog(zone, name string) (Catalog, error) {
+	if name != "" {
+		return c.FindCatalog(name)
+	}
+
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	selected, longest := DefaultCatalogName, -1
+	for _, rule := range c.Catalog.Rules {
+		suffix := strings.ToLower(strings.Trim(rule.Suffix, "."))
+		if (zone == suffix || strings.HasSuffix(zone, "."+suffix)) && len(suffix) > longest {
+			selected, longest = rule.Catalog, len(suffix)
+		}
+	}
+	return c.FindCatalog(selected)
+}
+
+// CatalogLockFilePath returns the path to a catalog zone's lock file
+func (c *Config) CatalogLockFilePath(catalogZone string) string {
+	return lock.CatalogLockPath(c.Locking.Dir, catalogZone)
+}
+
 // LockFilePath returns the path to a zone lock file
 func (c *Config) LockFilePath(zone string) string {
 	// Remove trailing dot for filename
@@ -249,6 +522,9 @@ func (c *Config) EnsureDirs() error {
 		c.Zones.Dir,
 		c.Locking.Dir,
 	}
+	for _, view := range c.Bind.Views {
+		dirs = append(dirs, filepath.Join(c.Zones.Dir, view))
+	}
 
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -3,7 +3,10 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/dlukt/dnsctl/internal/lock"
 )
 
 // TestDefaultConfig tests that DefaultConfig returns sensible defaults
@@ -174,6 +177,42 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "unknown rndc_client",
+			modifier: func(c *Config) {
+				c.Bind.RNDCClient = "ssh"
+			},
+			wantErr: true,
+		},
+		{
+			name: "split-horizon views",
+			modifier: func(c *Config) {
+				c.Bind.Views = []string{"internal", "external"}
+			},
+			wantErr: false,
+		},
+		{
+			name: "view and views together",
+			modifier: func(c *Config) {
+				c.Bind.View = "internal"
+				c.Bind.Views = []string{"internal", "external"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate view",
+			modifier: func(c *Config) {
+				c.Bind.Views = []string{"internal", "internal"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "view with path separator",
+			modifier: func(c *Config) {
+				c.Bind.Views = []string{"../etc"}
+			},
+			wantErr: true,
+		},
 		{
 			name: "empty rndc_conf",
 			modifier: func(c *Config) {
@@ -273,6 +312,119 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "secondaries",
+			modifier: func(c *Config) {
+				c.Secondaries = []string{"192.0.2.53", "ns2.example.net:5353", "2001:db8::53", "[2001:db8::54]:53"}
+			},
+			wantErr: false,
+		},
+		{
+			name: "secondary with invalid port",
+			modifier: func(c *Config) {
+				c.Secondaries = []string{"192.0.2.53:dns"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty secondary",
+			modifier: func(c *Config) {
+				c.Secondaries = []string{""}
+			},
+			wantErr: true,
+		},
+		{
+			name: "named catalogs",
+			modifier: func(c *Config) {
+				c.Catalog.Catalogs = []NamedCatalog{{Name: "customers", Zone: "customers.catalog.example."}}
+			},
+			wantErr: false,
+		},
+		{
+			name: "named catalog without trailing dot",
+			modifier: func(c *Config) {
+				c.Catalog.Catalogs = []NamedCatalog{{Name: "customers", Zone: "customers.catalog.example"}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "named catalog reusing the default name",
+			modifier: func(c *Config) {
+				c.Catalog.Catalogs = []NamedCatalog{{Name: DefaultCatalogName, Zone: "customers.catalog.example."}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "named catalog reusing the default zone",
+			modifier: func(c *Config) {
+				c.Catalog.Catalogs = []NamedCatalog{{Name: "customers", Zone: c.Catalog.Zone}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "catalog rule",
+			modifier: func(c *Config) {
+				c.Catalog.Catalogs = []NamedCatalog{{Name: "customers", Zone: "customers.catalog.example."}}
+				c.Catalog.Rules = []CatalogRule{{Suffix: "customers.example.net", Catalog: "customers"}}
+			},
+			wantErr: false,
+		},
+		{
+			name: "catalog rule for an unknown catalog",
+			modifier: func(c *Config) {
+				c.Catalog.Rules = []CatalogRule{{Suffix: "customers.example.net", Catalog: "customers"}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "named catalog with invalid schema version",
+			modifier: func(c *Config) {
+				c.Catalog.Catalogs = []NamedCatalog{{Name: "customers", Zone: "customers.catalog.example.", SchemaVersion: 3}}
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero catalog ttl",
+			modifier: func(c *Config) {
+				c.Catalog.TTL = 0
+			},
+			wantErr: true,
+		},
+		{
+			name: "resolver",
+			modifier: func(c *Config) {
+				c.Resolver = "[2001:db8::53]:53"
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid resolver port",
+			modifier: func(c *Config) {
+				c.Resolver = "192.0.2.53:99999"
+			},
+			wantErr: true,
+		},
+		{
+			name: "ssh allowed commands",
+			modifier: func(c *Config) {
+				c.SSH.AllowedCommands = []string{"zone status", "rrset"}
+			},
+			wantErr: false,
+		},
+		{
+			name: "empty ssh privileged actor",
+			modifier: func(c *Config) {
+				c.SSH.PrivilegedActors = []string{"keyadmin", ""}
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty ssh allowed command",
+			modifier: func(c *Config) {
+				c.SSH.AllowedCommands = []string{"zone status", " "}
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -386,6 +538,154 @@ func TestZoneFilePath(t *testing.T) {
 	}
 }
 
+// TestZoneViews tests view selection and per-view zone file paths
+func TestZoneViews(t *testing.T) {
+	cfg := &Config{
+		Zones: ZonesConfig{
+			Dir:           "/var/lib/bind/zones",
+			FileExtension: "db",
+		},
+	}
+
+	if got := cfg.ZoneViews(); len(got) != 1 || got[0] != "" {
+		t.Errorf("ZoneViews() = %q, want the default view", got)
+	}
+
+	cfg.Bind.View = "internal"
+	if got := cfg.ZoneViews(); len(got) != 1 || got[0] != "internal" {
+		t.Errorf("ZoneViews() = %q, want [internal]", got)
+	}
+	// A single bind.view keeps the flat layout
+	if got := cfg.ZoneFilePathInView("example.com.", "internal"); got != "/var/lib/bind/zones/example.com.db" {
+		t.Errorf("ZoneFilePathInView() with bind.view = %q", got)
+	}
+
+	cfg.Bind.View = ""
+	cfg.Bind.Views = []string{"internal", "external"}
+	if got := cfg.ZoneViews(); len(got) != 2 || got[1] != "external" {
+		t.Errorf("ZoneViews() = %q, want [internal external]", got)
+	}
+	if got := cfg.ZoneFilePathInView("example.com.", "external"); got != "/var/lib/bind/zones/external/example.com.db" {
+		t.Errorf("ZoneFilePathInView() with bind.views = %q", got)
+	}
+}
+
+// TestSecondaryAddrs tests that secondaries get the default DNS port
+func TestSecondaryAddrs(t *testing.T) {
+	cfg := &Config{
+		Secondaries: []string{"192.0.2.53", "ns2.example.net:5353", "2001:db8::53", "[2001:db8::54]:53"},
+	}
+
+	got := cfg.SecondaryAddrs()
+	want := []string{"192.0.2.53:53", "ns2.example.net:5353", "[2001:db8::53]:53", "[2001:db8::54]:53"}
+	if len(got) != len(want) {
+		t.Fatalf("SecondaryAddrs() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("SecondaryAddrs()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// TestResolverAddr tests the configured resolver and the resolv.conf fallback
+func TestResolverAddr(t *testing.T) {
+	cfg := &Config{Resolver: "192.0.2.53"}
+	if got, err := cfg.ResolverAddr(); err != nil || got != "192.0.2.53:53" {
+		t.Errorf("ResolverAddr() = %q, %v, want 192.0.2.53:53", got, err)
+	}
+
+	dir := t.TempDir()
+	saved := resolvConf
+	t.Cleanup(func() { resolvConf = saved })
+	resolvConf = filepath.Join(dir, "resolv.conf")
+	if err := os.WriteFile(resolvConf, []byte("search example.com\nnameserver 2001:db8::53\nnameserver 192.0.2.1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Resolver = ""
+	if got, err := cfg.ResolverAddr(); err != nil || got != "[2001:db8::53]:53" {
+		t.Errorf("ResolverAddr() from resolv.conf = %q, %v, want [2001:db8::53]:53", got, err)
+	}
+
+	if err := os.WriteFile(resolvConf, []byte("search example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.ResolverAddr(); err == nil {
+		t.Error("ResolverAddr() without nameservers returned nil error")
+	}
+}
+
+// TestFindCatalog tests selecting a catalog by name or zone, and the
+// settings named catalogs inherit
+func TestFindCatalog(t *testing.T) {
+	cfg := &Config{Catalog: CatalogConfig{
+		Zone:          "catalog.example.",
+		SchemaVersion: 2,
+		TTL:           60,
+		Catalogs: []NamedCatalog{
+			{Name: "customers", Zone: "customers.catalog.example.", SchemaVersion: 1, TTL: 300},
+			{Name: "internal", Zone: "internal.catalog.example."},
+		},
+	}}
+
+	for name, want := range map[string]string{
+		"default":                    "catalog.example.",
+		"catalog.example":            "catalog.example.",
+		"customers":                  "customers.catalog.example.",
+		"Customers.Catalog.Example.": "customers.catalog.example.",
+	} {
+		got, err := cfg.FindCatalog(name)
+		if err != nil || got.Zone != want {
+			t.Errorf("FindCatalog(%q) = %+v, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := cfg.FindCatalog("unknown"); err == nil {
+		t.Error("FindCatalog(unknown) succeeded")
+	}
+
+	want := []Catalog{
+		{Name: DefaultCatalogName, Zone: "catalog.example.", SchemaVersion: 2, TTL: 60},
+		{Name: "customers", Zone: "customers.catalog.example.", SchemaVersion: 1, TTL: 300},
+		{Name: "internal", Zone: "internal.catalog.example.", SchemaVersion: 2, TTL: 60},
+	}
+	if got := cfg.Catalogs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Catalogs() = %+v, want %+v", got, want)
+	}
+}
+
+// TestSelectCatalog tests the catalog selection rules
+func TestSelectCatalog(t *testing.T) {
+	cfg := &Config{Catalog: CatalogConfig{
+		Zone: "catalog.example.",
+		Catalogs: []NamedCatalog{
+			{Name: "customers", Zone: "customers.catalog.example."},
+			{Name: "vip", Zone: "vip.catalog.example."},
+		},
+		Rules: []CatalogRule{
+			{Suffix: "customers.example.net", Catalog: "customers"},
+			{Suffix: "vip.customers.example.net.", Catalog: "vip"},
+		},
+	}}
+
+	tests := []struct {
+		zone, name, want string
+	}{
+		{"example.com.", "", "catalog.example."},
+		{"customers.example.net.", "", "customers.catalog.example."},
+		{"a.customers.example.net.", "", "customers.catalog.example."},
+		{"a.vip.customers.example.net.", "", "vip.catalog.example."},
+		{"xcustomers.example.net.", "", "catalog.example."},
+		{"a.customers.example.net.", "default", "catalog.example."},
+	}
+	for _, tt := range tests {
+		got, err := cfg.SelectCatalog(tt.zone, tt.name)
+		if err != nil || got.Zone != tt.want {
+			t.Errorf("SelectCatalog(%q, %q) = %q, %v, want %q", tt.zone, tt.name, got.Zone, err, tt.want)
+		}
+	}
+}
+
 // TestLockFilePath tests lock file path generation
 func TestLockFilePath(t *testing.T) {
 	cfg := &Config{
@@ -413,6 +713,20 @@ func TestLockFilePath(t *testing.T) {
 	}
 }
 
+// TestCatalogLockFilePath tests that the catalog lock path is the one the
+// lock package derives
+func TestCatalogLockFilePath(t *testing.T) {
+	cfg := &Config{Locking: LockingConfig{Dir: "/var/lock/dnsctl"}}
+
+	got := cfg.CatalogLockFilePath("catalog.example.")
+	if want := "/var/lock/dnsctl/catalog--catalog.example.lock"; got != want {
+		t.Errorf("CatalogLockFilePath() = %q, want %q", got, want)
+	}
+	if got != lock.CatalogLockPath(cfg.Locking.Dir, "catalog.example.") {
+		t.Errorf("CatalogLockFilePath() = %q, differs from lock.CatalogLockPath", got)
+	}
+}
+
 // TestEnsureDirs tests directory creation
 func TestEnsureDirs(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/miekg/dns"
+)
+
+// tsigAlgorithms maps BIND algorithm names to the FQDN form miekg/dns expects
+var tsigAlgorithms = map[string]string{
+	"hmac-md5":                 dns.HmacMD5,
+	"hmac-md5.sig-alg.reg.int": dns.HmacMD5,
+	"hmac-sha1":                dns.HmacSHA1,
+	"hmac-sha224":              dns.HmacSHA224,
+	"hmac-sha256":              dns.HmacSHA256,
+	"hmac-sha384":              dns.HmacSHA384,
+	"hmac-sha512":              dns.HmacSHA512,
+}
+
+// TSIGAlgorithm maps a TSIG algorithm name in BIND form (hmac-sha256) or
+// FQDN form (hmac-sha256.) to the FQDN form used by miekg/dns
+func TSIGAlgorithm(name string) (string, error) {
+	alg, ok := tsigAlgorithms[strings.TrimSuffix(strings.ToLower(name), ".")]
+	if !ok {
+		return "", fmt.Errorf("unsupported TSIG algorithm %q", name)
+	}
+	return alg, nil
+}
+
+// loadTSIGSecret sets the TSIG secret from the contents of tsig.secret_file.
+// The file is either a BIND key statement as written by tsig-keygen or a raw
+// base64 secret. A key statement's name and algorithm must agree with
+// tsig.name and tsig.algorithm; an empty tsig.name is taken from the file.
+func (c *Config) loadTSIGSecret(content string) error {
+	keys := bind.ParseNamedConf(content).Keys()
+	if len(keys) == 0 {
+		if strings.ContainsAny(content, "{};") {
+			return fmt.Errorf("TSIG secret file has no key statement")
+		}
+		c.TSIG.Secret = strings.TrimSpace(content)
+		return nil
+	}
+
+	key, err := c.selectTSIGKey(keys)
+	if err != nil {
+		return err
+	}
+	if key.Secret == "" {
+		return fmt.Errorf("key %s in TSIG secret file has no secret", key.Name)
+	}
+
+	if key.Algorithm != "" {
+		fileAlg, err := TSIGAlgorithm(key.Algorithm)
+		if err != nil {
+			return fmt.Errorf("key %s: %w", key.Name, err)
+		}
+		cfgAlg, err := TSIGAlgorithm(c.TSIG.Algorithm)
+		if err != nil {
+			return fmt.Errorf("tsig.algorithm: %w", err)
+		}
+		if fileAlg != cfgAlg {
+			return fmt.Errorf("tsig.algorithm %s does not match key %s algorithm %s",
+				c.TSIG.Algorithm, key.Name, key.Algorithm)
+		}
+	}
+
+	if c.TSIG.Name == "" {
+		c.TSIG.Name = dns.Fqdn(key.Name)
+	}
+	c.TSIG.Secret = key.Secret
+	return nil
+}
+
+// selectTSIGKey picks the key named by tsig.name, or the only key if tsig.name is empty
+func (c *Config) selectTSIGKey(keys []bind.Key) (bind.Key, error) {
+	if c.TSIG.Name == "" {
+		if len(keys) != 1 {
+			return bind.Key{}, fmt.Errorf("TSIG secret file has %d keys, set tsig.name to choose one", len(keys))
+		}
+		return keys[0], nil
+	}
+
+	want := dns.CanonicalName(c.TSIG.Name)
+	var names []string
+	for _, key := range keys {
+		if dns.CanonicalName(key.Name) == want {
+			return key, nil
+		}
+		names = append(names, key.Name)
+	}
+	return bind.Key{}, fmt.Errorf("tsig.name %s does not match key %s in TSIG secret file",
+		c.TSIG.Name, strings.Join(names, ", "))
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// testKeyFile is tsig-keygen output for dnsctl-updater
+const testKeyFile = `key "dnsctl-updater" {
+	algorithm hmac-sha256;
+	secret "c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz";
+};
+`
+
+// TestTSIGAlgorithm tests mapping BIND algorithm names to the miekg/dns form
+func TestTSIGAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"hmac-sha256", dns.HmacSHA256, false},
+		{"hmac-sha256.", dns.HmacSHA256, false},
+		{"HMAC-SHA512", dns.HmacSHA512, false},
+		{"hmac-sha1", dns.HmacSHA1, false},
+		{"hmac-md5", dns.HmacMD5, false},
+		{"hmac-sha3", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TSIGAlgorithm(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TSIGAlgorithm(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("TSIGAlgorithm(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLoadTSIGSecret tests loading key statements and raw secrets
+func TestLoadTSIGSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		tsigName   string
+		algorithm  string
+		wantName   string
+		wantSecret string
+		wantErr    string
+	}{
+		{
+			name:       "key statement",
+			content:    testKeyFile,
+			tsigName:   "dnsctl-updater.",
+			algorithm:  "hmac-sha256",
+			wantName:   "dnsctl-updater.",
+			wantSecret: "c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz",
+		},
+		{
+			name:       "name taken from key statement",
+			content:    testKeyFile,
+			algorithm:  "hmac-sha256.",
+			wantName:   "dnsctl-updater.",
+			wantSecret: "c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz",
+		},
+		{
+			name:       "raw secret",
+			content:    "c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz\n",
+			tsigName:   "dnsctl-updater.",
+			algorithm:  "hmac-sha256",
+			wantName:   "dnsctl-updater.",
+			wantSecret: "c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz",
+		},
+		{
+			name:      "name mismatch",
+			content:   testKeyFile,
+			tsigName:  "other-key.",
+			algorithm: "hmac-sha256",
+			wantErr:   "does not match key",
+		},
+		{
+			name:      "algorithm mismatch",
+			content:   testKeyFile,
+			tsigName:  "dnsctl-updater.",
+			algorithm: "hmac-sha512",
+			wantErr:   "does not match key dnsctl-updater algorithm",
+		},
+		{
+			name:      "malformed key file",
+			content:   `key "dnsctl-updater" algorithm hmac-sha256;`,
+			tsigName:  "dnsctl-updater.",
+			algorithm: "hmac-sha256",
+			wantErr:   "no key statement",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.TSIG.Name = tt.tsigName
+			cfg.TSIG.Algorithm = tt.algorithm
+
+			err := cfg.loadTSIGSecret(tt.content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadTSIGSecret() error = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadTSIGSecret() error = %v", err)
+			}
+			if cfg.TSIG.Name != tt.wantName {
+				t.Errorf("TSIG.Name = %q, want %q", cfg.TSIG.Name, tt.wantName)
+			}
+			if cfg.TSIG.Secret != tt.wantSecret {
+				t.Errorf("TSIG.Secret = %q, want %q", cfg.TSIG.Secret, tt.wantSecret)
+			}
+		})
+	}
+}
+
+// TestLoadTSIGKeyFile tests that Load reads tsig-keygen output and normalizes the algorithm
+func TestLoadTSIGKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := filepath.Join(tmpDir, "tsig.secret")
+	if err := os.WriteFile(keyPath, []byte(testKeyFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	configContent := `
+catalog:
+  zone: catalog.example.com.
+tsig:
+  name: dnsctl-updater.
+  algorithm: hmac-sha256
+  secret_file: ` + keyPath + `
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.TSIG.Algorithm != dns.HmacSHA256 {
+		t.Errorf("Load().TSIG.Algorithm = %q, want %q", cfg.TSIG.Algorithm, dns.HmacSHA256)
+	}
+	if cfg.TSIG.Secret != "c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz" {
+		t.Errorf("Load().TSIG.Secret = %q", cfg.TSIG.Secret)
+	}
+}
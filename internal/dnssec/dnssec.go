@@ -0,0 +1,65 @@
+// Package dnssec reports the DNSSEC key state of signed zones, exports their
+// DS records for the parent zone, runs manual key operations and verifies
+// the signed zone data.
+package dnssec
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/zone"
+	"github.com/dlukt/dnsctl/pkg/update"
+)
+
+// ErrUnsigned means the zone publishes no DNSKEY records
+var ErrUnsigned = errors.New("zone is not signed")
+
+// Manager handles DNSSEC operations on zones signed by named's dnssec-policy.
+// Key operations go to the first view, the one dnsctl sends its updates to.
+type Manager struct {
+	cfg    *config.Config
+	rndc   bind.RNDC
+	update *update.Client
+
+	// Timeout for parent DS lookups through the resolver
+	resolverTimeout time.Duration
+}
+
+// NewManager creates a new DNSSEC manager
+func NewManager(cfg *config.Config) *Manager {
+	return &Manager{
+		cfg:  cfg,
+		rndc: bind.NewRNDC(cfg.Bind.RNDCClient, cfg.Bind.RNDCPath, cfg.Bind.RNDCConf, cfg.ZoneViews()[0]),
+		update: update.NewClient(
+			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
+			cfg.TSIG.Name,
+			cfg.TSIG.Secret,
+			cfg.TSIG.Algorithm,
+		),
+		resolverTimeout: 5 * time.Second,
+	}
+}
+
+// KeyStatus is the key state named reports for a zone
+type KeyStatus struct {
+	Zone string `json:"zone"`
+	*bind.DNSSECStatus
+}
+
+// KeyStatus returns the keys of a zone's dnssec-policy with their roles,
+// states and next rollover (rndc dnssec -status)
+func (m *Manager) KeyStatus(zoneInput string) (*KeyStatus, error) {
+	z, err := zone.NormalizeZone(zoneInput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone name: %w", err)
+	}
+
+	status, err := m.rndc.DNSSECStatus(z)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyStatus{Zone: z, DNSSECStatus: status}, nil
+}
@@ -0,0 +1,47 @@
+package dnssec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/config"
+)
+
+// fakeRNDC answers the DNSSEC commands; the other methods are not used
+type fakeRNDC struct {
+	bind.RNDC
+	status *bind.DNSSECStatus
+	err    error
+	zones  []string
+}
+
+func (f *fakeRNDC) DNSSECStatus(zone string) (*bind.DNSSECStatus, error) {
+	f.zones = append(f.zones, zone)
+	return f.status, f.err
+}
+
+// TestKeyStatus tests that the key status comes from rndc dnssec -status
+func TestKeyStatus(t *testing.T) {
+	rndc := &fakeRNDC{status: &bind.DNSSECStatus{
+		Policy: "default",
+		Keys:   []bind.DNSSECKey{{Tag: 12345, Role: "CSK"}},
+	}}
+	manager := &Manager{cfg: config.DefaultConfig(), rndc: rndc}
+
+	status, err := manager.KeyStatus("Example.COM")
+	if err != nil {
+		t.Fatalf("KeyStatus() error = %v", err)
+	}
+	if status.Zone != "example.com." || status.Policy != "default" || len(status.Keys) != 1 {
+		t.Errorf("KeyStatus() = %+v", status)
+	}
+	if len(rndc.zones) != 1 || rndc.zones[0] != "example.com." {
+		t.Errorf("rndc called for %v, want example.com.", rndc.zones)
+	}
+
+	rndc.err = bind.ErrNoDNSSECPolicy
+	if _, err := manager.KeyStatus("example.com"); !errors.Is(err, bind.ErrNoDNSSECPolicy) {
+		t.Errorf("KeyStatus() error = %v, want ErrNoDNSSECPolicy", err)
+	}
+}
@@ -0,0 +1,247 @@
+package dnssec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dlukt/dnsctl/internal/zone"
+	"github.com/miekg/dns"
+)
+
+// dsDigests are the digest types DS records are exported with
+var dsDigests = []uint8{dns.SHA256, dns.SHA384}
+
+// DSRecord is a DS record in its parts and in presentation format
+type DSRecord struct {
+	KeyTag        uint16 `json:"key_tag"`
+	Algorithm     uint8  `json:"algorithm"`
+	AlgorithmName string `json:"algorithm_name"`
+	DigestType    uint8  `json:"digest_type"`
+	DigestName    string `json:"digest_name"`
+	Digest        string `json:"digest"`
+	Record        string `json:"record"`
+}
+
+// SEPKey is a key signing key of a zone with the DS records for it
+type SEPKey struct {
+	KeyTag        uint16 `json:"key_tag"`
+	Flags         uint16 `json:"flags"`
+	Protocol      uint8  `json:"protocol"`
+	Algorithm     uint8  `json:"algorithm"`
+	AlgorithmName string `json:"algorithm_name"`
+	PublicKey     string `json:"public_key"`
+
+	// Whether the zone signals the key to the parent (RFC 7344)
+	InCDS     bool `json:"in_cds"`
+	InCDNSKEY bool `json:"in_cdnskey"`
+
+	DS []DSRecord `json:"ds"`
+}
+
+// DSExport is the DS data of a zone for its parent
+type DSExport struct {
+	Zone string   `json:"zone"`
+	Keys []SEPKey `json:"keys"`
+
+	// CDS records the zone publishes, and whether its CDS or CDNSKEY
+	// records ask the parent to remove its DS records (RFC 8078)
+	CDS       []DSRecord `json:"cds,omitempty"`
+	CDSDelete bool       `json:"cds_delete,omitempty"`
+
+	// Inconsistencies between DNSKEY, CDS and CDNSKEY
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ExportDS queries the zone's DNSKEY, CDS and CDNSKEY records and returns
+// SHA-256 and SHA-384 DS records for each key signing key. Keys the zone
+// only lists in CDNSKEY are included as well.
+func (m *Manager) ExportDS(zoneInput string) (*DSExport, error) {
+	z, err := zone.NormalizeZone(zoneInput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone name: %w", err)
+	}
+
+	dnskeys, err := m.queryKeys(z, dns.TypeDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	if len(dnskeys) == 0 {
+		return nil, fmt.Errorf("%s: %w", z, ErrUnsigned)
+	}
+	cdnskeys, err := m.queryKeys(z, dns.TypeCDNSKEY)
+	if err != nil {
+		return nil, err
+	}
+	cdsRRs, err := m.query(z, dns.TypeCDS)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &DSExport{Zone: z, Keys: []SEPKey{}}
+
+	cds := make(map[string]bool)
+	for _, rr := range cdsRRs {
+		record := rr.(*dns.CDS)
+		if record.Algorithm == 0 {
+			export.CDSDelete = true
+			continue
+		}
+		ds := record.DS
+		ds.Hdr.Rrtype = dns.TypeDS
+		export.CDS = append(export.CDS, dsRecord(&ds))
+		cds[dsKey(&ds)] = true
+	}
+
+	inCDNSKEY := make(map[string]bool)
+	signalled := cdnskeys[:0]
+	for _, key := range cdnskeys {
+		if key.Algorithm == 0 {
+			export.CDSDelete = true
+			continue
+		}
+		inCDNSKEY[key.PublicKey] = true
+		signalled = append(signalled, key)
+	}
+
+	published := make(map[string]bool)
+	for _, key := range dnskeys {
+		published[key.PublicKey] = true
+		if key.Flags&dns.SEP != 0 {
+			export.Keys = append(export.Keys, sepKey(key, inCDNSKEY[key.PublicKey], cds))
+		}
+	}
+	for _, key := range signalled {
+		if !published[key.PublicKey] {
+			export.Keys = append(export.Keys, sepKey(key, true, cds))
+			export.Warnings = append(export.Warnings,
+				fmt.Sprintf("CDNSKEY %d is not in the DNSKEY RRset", key.KeyTag()))
+		}
+	}
+
+	for _, ds := range export.CDS {
+		if !exportsDS(export.Keys, ds) {
+			export.Warnings = append(export.Warnings,
+				fmt.Sprintf("CDS %d does not match a key signing key", ds.KeyTag))
+		}
+	}
+
+	sort.Slice(export.Keys, func(i, j int) bool { return export.Keys[i].KeyTag < export.Keys[j].KeyTag })
+	return export, nil
+}
+
+// query queries the primary for an RRset at the zone apex
+func (m *Manager) query(z string, rrtype uint16) ([]dns.RR, error) {
+	response, err := m.update.Query(z, rrtype)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s %s: %w", z, dns.TypeToString[rrtype], err)
+	}
+	var rrs []dns.RR
+	for _, rr := range response.Answer {
+		if rr.Header().Rrtype == rrtype {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs, nil
+}
+
+// queryKeys queries the zone's DNSKEY or CDNSKEY RRset
+func (m *Manager) queryKeys(z string, rrtype uint16) ([]*dns.DNSKEY, error) {
+	rrs, err := m.query(z, rrtype)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*dns.DNSKEY
+	for _, rr := range rrs {
+		switch key := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, key)
+		case *dns.CDNSKEY:
+			dnskey := key.DNSKEY
+			dnskey.Hdr.Rrtype = dns.TypeDNSKEY
+			keys = append(keys, &dnskey)
+		}
+	}
+	return keys, nil
+}
+
+// sepKey returns a key signing key with its DS records
+func sepKey(key *dns.DNSKEY, inCDNSKEY bool, cds map[string]bool) SEPKey {
+	sep := SEPKey{
+		KeyTag:        key.KeyTag(),
+		Flags:         key.Flags,
+		Protocol:      key.Protocol,
+		Algorithm:     key.Algorithm,
+		AlgorithmName: dns.AlgorithmToString[key.Algorithm],
+		PublicKey:     key.PublicKey,
+		InCDNSKEY:     inCDNSKEY,
+		DS:            []DSRecord{},
+	}
+	for _, digest := range dsDigests {
+		ds := key.ToDS(digest)
+		if ds == nil {
+			continue
+		}
+		sep.DS = append(sep.DS, dsRecord(ds))
+		sep.InCDS = sep.InCDS || cds[dsKey(ds)]
+	}
+	return sep
+}
+
+// dsRecord returns a DS record in its parts
+func dsRecord(ds *dns.DS) DSRecord {
+	ds.Digest = strings.ToUpper(ds.Digest)
+	return DSRecord{
+		KeyTag:        ds.KeyTag,
+		Algorithm:     ds.Algorithm,
+		AlgorithmName: dns.AlgorithmToString[ds.Algorithm],
+		DigestType:    ds.DigestType,
+		DigestName:    dns.HashToString[ds.DigestType],
+		Digest:        ds.Digest,
+		Record:        ds.String(),
+	}
+}
+
+// dsKey identifies a DS record by its rdata
+func dsKey(ds *dns.DS) string {
+	return fmt.Sprintf("%d %d %d %s", ds.KeyTag, ds.Algorithm, ds.DigestType, strings.ToUpper(ds.Digest))
+}
+
+// exportsDS reports whether any key has the DS record
+func exportsDS(keys []SEPKey, ds DSRecord) bool {
+	for _, key := range keys {
+		for _, d := range key.DS {
+			if d.KeyTag == ds.KeyTag && d.Algorithm == ds.Algorithm &&
+				d.DigestType == ds.DigestType && d.Digest == ds.Digest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Registrar formats the DS data the way registrar web forms ask for it:
+// one block per DS record, followed by the keys for registries that take
+// DNSKEY records instead
+func (e *DSExport) Registrar() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Zone: %s\n", strings.TrimSuffix(e.Zone, "."))
+	for _, key := range e.Keys {
+		for _, ds := range key.DS {
+			fmt.Fprintf(&b, "\nKey tag:     %d\n", ds.KeyTag)
+			fmt.Fprintf(&b, "Algorithm:   %d (%s)\n", ds.Algorithm, ds.AlgorithmName)
+			fmt.Fprintf(&b, "Digest type: %d (%s)\n", ds.DigestType, ds.DigestName)
+			fmt.Fprintf(&b, "Digest:      %s\n", ds.Digest)
+		}
+	}
+	for _, key := range e.Keys {
+		fmt.Fprintf(&b, "\nDNSKEY %d\n", key.KeyTag)
+		fmt.Fprintf(&b, "Flags:       %d\n", key.Flags)
+		fmt.Fprintf(&b, "Protocol:    %d\n", key.Protocol)
+		fmt.Fprintf(&b, "Algorithm:   %d (%s)\n", key.Algorithm, key.AlgorithmName)
+		fmt.Fprintf(&b, "Public key:  %s\n", key.PublicKey)
+	}
+
+	return b.String()
+}
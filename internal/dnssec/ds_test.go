@@ -0,0 +1,113 @@
+package dnssec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// newKey generates a DNSKEY for example.com with the given flags
+func newKey(t *testing.T, flags uint16) *dns.DNSKEY {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	if _, err := key.Generate(256); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// TestExportDS tests DS records computed from the zone's keys
+func TestExportDS(t *testing.T) {
+	ksk := newKey(t, dns.ZONE|dns.SEP)
+	zsk := newKey(t, dns.ZONE)
+	cds := ksk.ToDS(dns.SHA256).ToCDS()
+	cdnskey := ksk.ToCDNSKEY()
+
+	manager := &Manager{update: update.NewClient(dnstest.NewServerRR(t, ksk, zsk, cds, cdnskey).Addr, "", "", "")}
+	export, err := manager.ExportDS("example.com")
+	if err != nil {
+		t.Fatalf("ExportDS() error = %v", err)
+	}
+
+	if len(export.Keys) != 1 {
+		t.Fatalf("Keys = %+v, want only the KSK", export.Keys)
+	}
+	key := export.Keys[0]
+	if key.KeyTag != ksk.KeyTag() || key.Flags != 257 || !key.InCDS || !key.InCDNSKEY {
+		t.Errorf("key = %+v", key)
+	}
+	if len(key.DS) != 2 || key.DS[0].DigestType != dns.SHA256 || key.DS[1].DigestType != dns.SHA384 {
+		t.Fatalf("DS = %+v, want SHA-256 and SHA-384", key.DS)
+	}
+	if want := strings.ToUpper(ksk.ToDS(dns.SHA384).Digest); key.DS[1].Digest != want {
+		t.Errorf("SHA-384 digest = %s, want %s", key.DS[1].Digest, want)
+	}
+	if !strings.HasPrefix(key.DS[0].Record, "example.com.\t3600\tIN\tDS\t") {
+		t.Errorf("record = %q", key.DS[0].Record)
+	}
+	if len(export.CDS) != 1 || export.CDSDelete || len(export.Warnings) != 0 {
+		t.Errorf("export = %+v", export)
+	}
+
+	registrar := export.Registrar()
+	for _, want := range []string{
+		"Zone: example.com\n",
+		"Digest type: 2 (SHA256)\n",
+		"Digest type: 4 (SHA384)\n",
+		"Digest:      " + key.DS[0].Digest + "\n",
+		"Public key:  " + ksk.PublicKey + "\n",
+	} {
+		if !strings.Contains(registrar, want) {
+			t.Errorf("Registrar() missing %q:\n%s", want, registrar)
+		}
+	}
+}
+
+// TestExportDSSignals tests CDS and CDNSKEY records that do not match the keys
+func TestExportDSSignals(t *testing.T) {
+	ksk := newKey(t, dns.ZONE|dns.SEP)
+	other := newKey(t, dns.ZONE|dns.SEP)
+	staleCDS := other.ToDS(dns.SHA256).ToCDS()
+	unpublished := other.ToCDNSKEY()
+
+	manager := &Manager{update: update.NewClient(dnstest.NewServerRR(t, ksk, staleCDS, unpublished).Addr, "", "", "")}
+	export, err := manager.ExportDS("example.com")
+	if err != nil {
+		t.Fatalf("ExportDS() error = %v", err)
+	}
+
+	// The key only in CDNSKEY is exported with a warning; the CDS matches it
+	if len(export.Keys) != 2 {
+		t.Errorf("Keys = %+v, want the KSK and the CDNSKEY key", export.Keys)
+	}
+	if len(export.Warnings) != 1 || !strings.Contains(export.Warnings[0], "not in the DNSKEY RRset") {
+		t.Errorf("Warnings = %v", export.Warnings)
+	}
+
+	deleteCDS, _ := dns.NewRR("example.com. 3600 IN CDS 0 0 0 00")
+	manager = &Manager{update: update.NewClient(dnstest.NewServerRR(t, ksk, deleteCDS).Addr, "", "", "")}
+	export, err = manager.ExportDS("example.com")
+	if err != nil {
+		t.Fatalf("ExportDS() error = %v", err)
+	}
+	if !export.CDSDelete || len(export.CDS) != 0 {
+		t.Errorf("export = %+v, want a delete request", export)
+	}
+}
+
+// TestExportDSUnsigned tests that a zone without DNSKEY records is refused
+func TestExportDSUnsigned(t *testing.T) {
+	manager := &Manager{update: update.NewClient(dnstest.NewServer(t).Addr, "", "", "")}
+	if _, err := manager.ExportDS("example.com"); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("ExportDS() error = %v, want ErrUnsigned", err)
+	}
+}
@@ -0,0 +1,78 @@
+package dnssec
+
+import (
+	"fmt"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/internal/zone"
+)
+
+// KeyOperation is the outcome of a manual key operation
+type KeyOperation struct {
+	Key   *uint16 `json:"key,omitempty"`   // Key tag, if one was given
+	State string  `json:"state,omitempty"` // DS state for checkds: published or withdrawn
+
+	// named's response, e.g. "Key 12345: Rollover scheduled"
+	Message string `json:"message"`
+}
+
+// Rollover makes named start the rollover of a key of the zone's
+// dnssec-policy now (rndc dnssec -rollover). The successor key is created
+// and introduced as the policy prescribes.
+func (m *Manager) Rollover(zoneInput string, key uint16, changes *[]string) (*KeyOperation, error) {
+	z, err := zone.NormalizeZone(zoneInput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone name: %w", err)
+	}
+
+	zoneLock := lock.New(m.cfg.LockFilePath(z))
+	if err := zoneLock.Acquire(); err != nil {
+		return nil, fmt.Errorf("failed to acquire zone lock: %w", err)
+	}
+	defer zoneLock.Release()
+
+	message, err := m.rndc.DNSSECRollover(z, key)
+	if err != nil {
+		return nil, err
+	}
+	*changes = append(*changes, fmt.Sprintf("dnssec_rollover_scheduled:%d", key))
+
+	return &KeyOperation{Key: &key, Message: message}, nil
+}
+
+// CheckDS tells named that the DS record of a key signing key has been
+// published in or withdrawn from the parent zone (rndc dnssec -checkds), so
+// a KSK rollover can proceed. A nil key lets named pick the zone's key
+// signing key; named refuses that with bind.ErrAmbiguousKey if there are
+// several.
+func (m *Manager) CheckDS(zoneInput, state string, key *uint16, changes *[]string) (*KeyOperation, error) {
+	z, err := zone.NormalizeZone(zoneInput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone name: %w", err)
+	}
+	if state != bind.DSPublished && state != bind.DSWithdrawn {
+		return nil, &zone.OptionError{
+			Option: "state",
+			Err:    fmt.Errorf("expected %s or %s, got %q", bind.DSPublished, bind.DSWithdrawn, state),
+		}
+	}
+
+	zoneLock := lock.New(m.cfg.LockFilePath(z))
+	if err := zoneLock.Acquire(); err != nil {
+		return nil, fmt.Errorf("failed to acquire zone lock: %w", err)
+	}
+	defer zoneLock.Release()
+
+	message, err := m.rndc.DNSSECCheckDS(z, state, key)
+	if err != nil {
+		return nil, err
+	}
+	change := "dnssec_ds_" + state
+	if key != nil {
+		change = fmt.Sprintf("%s:%d", change, *key)
+	}
+	*changes = append(*changes, change)
+
+	return &KeyOperation{Key: key, State: state, Message: message}, nil
+}
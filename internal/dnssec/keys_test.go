@@ -0,0 +1,103 @@
+package dnssec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/internal/zone"
+)
+
+// keyRNDC records the key operations sent to named
+type keyRNDC struct {
+	bind.RNDC
+	calls []string
+	err   error
+}
+
+func (f *keyRNDC) DNSSECRollover(zone string, key uint16) (string, error) {
+	f.calls = append(f.calls, "rollover "+zone)
+	return "Key 12345: Rollover scheduled", f.err
+}
+
+func (f *keyRNDC) DNSSECCheckDS(zone, state string, key *uint16) (string, error) {
+	f.calls = append(f.calls, "checkds "+state+" "+zone)
+	return "KSK 12345: Marked DS as " + state, f.err
+}
+
+// TestRollover tests scheduling a rollover under the zone lock
+func TestRollover(t *testing.T) {
+	rndc := &keyRNDC{}
+	cfg := config.DefaultConfig()
+	cfg.Locking.Dir = t.TempDir()
+	manager := &Manager{cfg: cfg, rndc: rndc}
+
+	var changes []string
+	op, err := manager.Rollover("Example.COM", 12345, &changes)
+	if err != nil {
+		t.Fatalf("Rollover() error = %v", err)
+	}
+	if op.Key == nil || *op.Key != 12345 || op.Message != "Key 12345: Rollover scheduled" {
+		t.Errorf("Rollover() = %+v", op)
+	}
+	if strings.Join(rndc.calls, ",") != "rollover example.com." {
+		t.Errorf("rndc calls = %v", rndc.calls)
+	}
+	if strings.Join(changes, ",") != "dnssec_rollover_scheduled:12345" {
+		t.Errorf("changes = %v", changes)
+	}
+
+	// A zone locked by another operation is refused
+	held := lock.New(manager.cfg.LockFilePath("example.com."))
+	if err := held.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+	if _, err := manager.Rollover("example.com", 12345, &changes); !errors.Is(err, lock.ErrLocked) {
+		t.Errorf("Rollover() of a locked zone error = %v, want ErrLocked", err)
+	}
+}
+
+// TestCheckDS tests marking DS records published and withdrawn
+func TestCheckDS(t *testing.T) {
+	rndc := &keyRNDC{}
+	cfg := config.DefaultConfig()
+	cfg.Locking.Dir = t.TempDir()
+	manager := &Manager{cfg: cfg, rndc: rndc}
+
+	var changes []string
+	key := uint16(12345)
+	op, err := manager.CheckDS("example.com", bind.DSPublished, &key, &changes)
+	if err != nil {
+		t.Fatalf("CheckDS() error = %v", err)
+	}
+	if op.State != bind.DSPublished || op.Key == nil || *op.Key != 12345 {
+		t.Errorf("CheckDS() = %+v", op)
+	}
+	if _, err := manager.CheckDS("example.com", bind.DSWithdrawn, nil, &changes); err != nil {
+		t.Fatalf("CheckDS() error = %v", err)
+	}
+	if got := strings.Join(changes, ","); got != "dnssec_ds_published:12345,dnssec_ds_withdrawn" {
+		t.Errorf("changes = %v", changes)
+	}
+
+	var optErr *zone.OptionError
+	if _, err := manager.CheckDS("example.com", "seen", nil, &changes); !errors.As(err, &optErr) {
+		t.Errorf("CheckDS() with an invalid state error = %v, want OptionError", err)
+	}
+
+	rndc.err = bind.ErrAmbiguousKey
+	changes = nil
+	if _, err := manager.CheckDS("example.com", bind.DSPublished, nil, &changes); !errors.Is(err, bind.ErrAmbiguousKey) {
+		t.Errorf("CheckDS() error = %v, want ErrAmbiguousKey", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("changes after failure = %v", changes)
+	}
+	if len(rndc.calls) != 3 {
+		t.Errorf("rndc calls = %v, want 3", rndc.calls)
+	}
+}
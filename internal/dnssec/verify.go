@@ -0,0 +1,587 @@
+package dnssec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dlukt/dnsctl/internal/zone"
+	"github.com/miekg/dns"
+)
+
+// Severities of verification issues
+const (
+	SeverityError   = "error"   // Validating resolvers fail the zone or an RRset
+	SeverityWarning = "warning" // Not broken yet, e.g. signatures about to expire
+)
+
+// Denial of existence methods of a signed zone
+const (
+	DenialNSEC  = "nsec"
+	DenialNSEC3 = "nsec3"
+	DenialNone  = "none"
+)
+
+// DefaultExpiryWarning is how close to expiry a signature is reported when
+// VerifyOptions leaves it unset. named refreshes signatures well before
+// that, so a signature this close to expiry means re-signing has stalled.
+const DefaultExpiryWarning = 72 * time.Hour
+
+// VerifyOptions controls Verify
+type VerifyOptions struct {
+	// Signatures expiring within this time are reported
+	ExpiryWarning time.Duration
+}
+
+// Issue is a problem found by Verify
+type Issue struct {
+	Severity string `json:"severity"`
+	Kind     string `json:"kind"` // e.g. missing_signature, nsec_chain_broken, ds_mismatch
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Detail   string `json:"detail"`
+}
+
+// ExpiringSignature is a valid signature that expires within the warning time
+type ExpiringSignature struct {
+	Name       string    `json:"name"`
+	Type       string    `json:"type"`
+	KeyTag     uint16    `json:"key_tag"`
+	Expiration time.Time `json:"expiration"`
+}
+
+// Verification is the result of verifying a signed zone as named serves it
+type Verification struct {
+	Serial uint32 `json:"serial"`
+	Denial string `json:"denial"` // nsec, nsec3 or none
+
+	// Authoritative RRsets and signatures checked
+	RRsets     int `json:"rrsets"`
+	Signatures int `json:"signatures"`
+
+	// Earliest expiration of a valid signature, and the valid signatures
+	// expiring within the warning time
+	EarliestExpiration *time.Time          `json:"earliest_expiration,omitempty"`
+	Expiring           []ExpiringSignature `json:"expiring,omitempty"`
+
+	// DS records the parent publishes for the zone
+	ParentDS []DSRecord `json:"parent_ds"`
+
+	Issues []Issue `json:"issues"`
+	Valid  bool    `json:"valid"` // No issue of severity error
+}
+
+// addIssue records an issue
+func (v *Verification) addIssue(severity, kind, name string, rrtype uint16, detail string) {
+	issue := Issue{Severity: severity, Kind: kind, Name: name, Detail: detail}
+	if rrtype != 0 {
+		issue.Type = dns.TypeToString[rrtype]
+	}
+	v.Issues = append(v.Issues, issue)
+}
+
+// Verify transfers a signed zone from the primary and checks it the way a
+// validating resolver would: every authoritative RRset must carry a valid
+// signature by a DNSKEY of the zone within its validity window, the NSEC
+// or NSEC3 chain must cover every name, and a DS record in the parent,
+// looked up through the configured resolver, must match a key that signs
+// the DNSKEY RRset. Problems are returned as issues rather than errors.
+func (m *Manager) Verify(zoneInput string, opts VerifyOptions) (*Verification, error) {
+	z, err := zone.NormalizeZone(zoneInput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone name: %w", err)
+	}
+	if opts.ExpiryWarning <= 0 {
+		opts.ExpiryWarning = DefaultExpiryWarning
+	}
+
+	records, err := m.update.Transfer(z)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer %s: %w", z, err)
+	}
+	data := newZoneData(z, records)
+	if len(data.rrset(z, dns.TypeDNSKEY)) == 0 {
+		return nil, fmt.Errorf("%s: %w", z, ErrUnsigned)
+	}
+
+	v := &Verification{ParentDS: []DSRecord{}, Issues: []Issue{}}
+	if soa := data.rrset(z, dns.TypeSOA); len(soa) > 0 {
+		v.Serial = soa[0].(*dns.SOA).Serial
+	}
+
+	signers := v.verifySignatures(data, time.Now(), opts.ExpiryWarning)
+	v.verifyDenial(data)
+	m.verifyParentDS(v, data, signers)
+
+	v.Valid = true
+	for _, issue := range v.Issues {
+		if issue.Severity == SeverityError {
+			v.Valid = false
+		}
+	}
+	return v, nil
+}
+
+// rrsetKey identifies an RRset; RRSIGs are keyed by the type they cover
+type rrsetKey struct {
+	name   string
+	rrtype uint16
+}
+
+// zoneData is the authoritative data of a transferred zone: glue and other
+// records below delegations are left out
+type zoneData struct {
+	zone   string
+	rrsets map[rrsetKey][]dns.RR
+	sigs   map[rrsetKey][]*dns.RRSIG
+	types  map[string]map[uint16]bool // Types at each owner name, RRSIG included
+	cuts   map[string]bool            // Delegation points
+}
+
+// newZoneData sorts the records of an AXFR into RRsets
+func newZoneData(z string, records []dns.RR) *zoneData {
+	data := &zoneData{
+		zone:   z,
+		rrsets: make(map[rrsetKey][]dns.RR),
+		sigs:   make(map[rrsetKey][]*dns.RRSIG),
+		types:  make(map[string]map[uint16]bool),
+		cuts:   make(map[string]bool),
+	}
+
+	// The transfer ends with a second copy of the SOA
+	if n := len(records); n > 1 && records[n-1].Header().Rrtype == dns.TypeSOA {
+		records = records[:n-1]
+	}
+
+	for _, rr := range records {
+		name := dns.CanonicalName(rr.Header().Name)
+		if rr.Header().Rrtype == dns.TypeNS && name != z {
+			data.cuts[name] = true
+		}
+	}
+
+	for _, rr := range records {
+		h := rr.Header()
+		name := dns.CanonicalName(h.Name)
+		if h.Class != dns.ClassINET || !dns.IsSubDomain(z, name) || !data.authoritative(name, rr) {
+			continue
+		}
+
+		if data.types[name] == nil {
+			data.types[name] = make(map[uint16]bool)
+		}
+		data.types[name][h.Rrtype] = true
+
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key := rrsetKey{name, sig.TypeCovered}
+			data.sigs[key] = append(data.sigs[key], sig)
+			continue
+		}
+		key := rrsetKey{name, h.Rrtype}
+		data.rrsets[key] = append(data.rrsets[key], rr)
+	}
+
+	return data
+}
+
+// authoritative reports whether a record is zone data rather than glue:
+// below a delegation only the NS, DS and NSEC RRsets at the cut and their
+// signatures belong to the zone
+func (d *zoneData) authoritative(name string, rr dns.RR) bool {
+	for cut := range d.cuts {
+		if name != cut && dns.IsSubDomain(cut, name) {
+			return false
+		}
+	}
+	if !d.cuts[name] {
+		return true
+	}
+	rrtype := rr.Header().Rrtype
+	if sig, ok := rr.(*dns.RRSIG); ok {
+		rrtype = sig.TypeCovered
+	}
+	return rrtype == dns.TypeNS || rrtype == dns.TypeDS || rrtype == dns.TypeNSEC
+}
+
+// rrset returns an RRset of the zone
+func (d *zoneData) rrset(name string, rrtype uint16) []dns.RR {
+	return d.rrsets[rrsetKey{dns.CanonicalName(name), rrtype}]
+}
+
+// keys returns the DNSKEY RRset at the apex
+func (d *zoneData) keys() []*dns.DNSKEY {
+	var keys []*dns.DNSKEY
+	for _, rr := range d.rrset(d.zone, dns.TypeDNSKEY) {
+		keys = append(keys, rr.(*dns.DNSKEY))
+	}
+	return keys
+}
+
+// sortedKeys returns the RRset keys in canonical order
+func (d *zoneData) sortedKeys() []rrsetKey {
+	keys := make([]rrsetKey, 0, len(d.rrsets))
+	for key := range d.rrsets {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return canonicalLess(keys[i].name, keys[j].name)
+		}
+		return keys[i].rrtype < keys[j].rrtype
+	})
+	return keys
+}
+
+// names returns the owner names in canonical order
+func (d *zoneData) names() []string {
+	names := make([]string, 0, len(d.types))
+	for name := range d.types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+	return names
+}
+
+// keyID identifies a DNSKEY by tag and algorithm, as RRSIG and DS do
+type keyID struct {
+	tag       uint16
+	algorithm uint8
+}
+
+// verifySignatures checks the signatures of every authoritative RRset and
+// returns the keys with a valid signature over the DNSKEY RRset
+func (v *Verification) verifySignatures(data *zoneData, now time.Time, expiryWarning time.Duration) map[keyID]bool {
+	keys := data.keys()
+	signers := make(map[keyID]bool)
+
+	for _, key := range data.sortedKeys() {
+		// The NS RRset at a delegation belongs to the child and is unsigned
+		if data.cuts[key.name] && key.rrtype == dns.TypeNS {
+			continue
+		}
+		v.RRsets++
+
+		rrset := data.rrsets[key]
+		sigs := data.sigs[key]
+		if len(sigs) == 0 {
+			v.addIssue(SeverityError, "missing_signature", key.name, key.rrtype, "RRset has no RRSIG")
+			continue
+		}
+
+		valid := false
+		var problems []string
+		kind := ""
+		for _, sig := range sigs {
+			v.Signatures++
+			problem, problemKind := checkSignature(sig, rrset, keys, data.zone, now)
+			if problem != "" {
+				problems = append(problems, problem)
+				if kind == "" {
+					kind = problemKind
+				}
+				continue
+			}
+
+			valid = true
+			if key.rrtype == dns.TypeDNSKEY {
+				signers[keyID{sig.KeyTag, sig.Algorithm}] = true
+			}
+			expiration := now.Add(time.Duration(int32(sig.Expiration-uint32(now.Unix()))) * time.Second).UTC()
+			if v.EarliestExpiration == nil || expiration.Before(*v.EarliestExpiration) {
+				v.EarliestExpiration = &expiration
+			}
+			if expiration.Sub(now) < expiryWarning {
+				v.Expiring = append(v.Expiring, ExpiringSignature{
+					Name:       key.name,
+					Type:       dns.TypeToString[key.rrtype],
+					KeyTag:     sig.KeyTag,
+					Expiration: expiration,
+				})
+			}
+		}
+		if !valid {
+			v.addIssue(SeverityError, kind, key.name, key.rrtype, strings.Join(problems, "; "))
+		}
+	}
+
+	if len(v.Expiring) > 0 {
+		v.addIssue(SeverityWarning, "signatures_expiring", "", 0,
+			fmt.Sprintf("%d signatures expire within %s, the first at %s; check that named is re-signing the zone",
+				len(v.Expiring), expiryWarning, v.EarliestExpiration.Format(time.RFC3339)))
+	}
+
+	return signers
+}
+
+// checkSignature checks one RRSIG over an RRset and returns a description
+// and issue kind of what is wrong with it, or "" if it is valid
+func checkSignature(sig *dns.RRSIG, rrset []dns.RR, keys []*dns.DNSKEY, z string, now time.Time) (string, string) {
+	if dns.CanonicalName(sig.SignerName) != z {
+		return fmt.Sprintf("RRSIG %d is signed by %s", sig.KeyTag, sig.SignerName), "wrong_signer"
+	}
+
+	var key *dns.DNSKEY
+	for _, k := range keys {
+		if k.KeyTag() == sig.KeyTag && k.Algorithm == sig.Algorithm && k.Flags&dns.ZONE != 0 {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return fmt.Sprintf("RRSIG %d has no matching DNSKEY", sig.KeyTag), "unknown_key"
+	}
+
+	if !sig.ValidityPeriod(now) {
+		if int32(sig.Inception-uint32(now.Unix())) > 0 {
+			return fmt.Sprintf("RRSIG %d is not valid before %s", sig.KeyTag, dns.TimeToString(sig.Inception)), "signature_not_yet_valid"
+		}
+		return fmt.Sprintf("RRSIG %d expired at %s", sig.KeyTag, dns.TimeToString(sig.Expiration)), "expired_signature"
+	}
+
+	if err := sig.Verify(key, rrset); err != nil {
+		return fmt.Sprintf("RRSIG %d does not verify: %v", sig.KeyTag, err), "bad_signature"
+	}
+	return "", ""
+}
+
+// verifyDenial checks the NSEC or NSEC3 chain
+func (v *Verification) verifyDenial(data *zoneData) {
+	if params := data.rrset(data.zone, dns.TypeNSEC3PARAM); len(params) > 0 {
+		v.Denial = DenialNSEC3
+		v.verifyNSEC3(data, params[0].(*dns.NSEC3PARAM))
+		return
+	}
+	if len(data.rrset(data.zone, dns.TypeNSEC)) > 0 {
+		v.Denial = DenialNSEC
+		v.verifyNSEC(data)
+		return
+	}
+
+	v.Denial = DenialNone
+	v.addIssue(SeverityError, "missing_denial", data.zone, 0, "the zone has neither NSEC nor NSEC3PARAM records at the apex")
+}
+
+// verifyNSEC checks that every owner name has an NSEC record listing its
+// types and pointing to the next name, the last one back to the apex
+func (v *Verification) verifyNSEC(data *zoneData) {
+	names := data.names()
+	for i, name := range names {
+		rrs := data.rrset(name, dns.TypeNSEC)
+		if len(rrs) == 0 {
+			v.addIssue(SeverityError, "nsec_missing", name, 0, "name has no NSEC record")
+			continue
+		}
+		nsec := rrs[0].(*dns.NSEC)
+
+		next := names[(i+1)%len(names)]
+		if got := dns.CanonicalName(nsec.NextDomain); got != next {
+			v.addIssue(SeverityError, "nsec_chain_broken", name, dns.TypeNSEC,
+				fmt.Sprintf("NSEC points to %s, want %s", got, next))
+		}
+		if detail := bitmapMismatch(nsec.TypeBitMap, data.types[name]); detail != "" {
+			v.addIssue(SeverityError, "nsec_bitmap_mismatch", name, dns.TypeNSEC, detail)
+		}
+	}
+}
+
+// verifyNSEC3 checks that every owner name and empty non-terminal has an
+// NSEC3 record with the zone's parameters listing its types, and that the
+// hashes form a closed chain. With opt-out, insecure delegations need none.
+func (v *Verification) verifyNSEC3(data *zoneData, param *dns.NSEC3PARAM) {
+	nsec3s := make(map[string]*dns.NSEC3)
+	optOut := false
+	for _, name := range data.names() {
+		for _, rr := range data.rrset(name, dns.TypeNSEC3) {
+			nsec3 := rr.(*dns.NSEC3)
+			if nsec3.Hash != param.Hash || nsec3.Iterations != param.Iterations ||
+				!strings.EqualFold(nsec3.Salt, param.Salt) {
+				v.addIssue(SeverityError, "nsec3_param_mismatch", name, dns.TypeNSEC3,
+					"NSEC3 parameters differ from the NSEC3PARAM record")
+				continue
+			}
+			optOut = optOut || nsec3.Flags&1 != 0
+			hash, _, _ := strings.Cut(name, ".")
+			nsec3s[strings.ToUpper(hash)] = nsec3
+		}
+	}
+
+	// Names that need an NSEC3 record, with their types (none for empty
+	// non-terminals)
+	expected := make(map[string]map[uint16]bool)
+	for name, types := range data.types {
+		if types[dns.TypeNSEC3] {
+			continue
+		}
+		if optOut && data.cuts[name] && !types[dns.TypeDS] {
+			continue
+		}
+		expected[name] = types
+		for parent := parentName(name); parent != "" && parent != data.zone && dns.IsSubDomain(data.zone, parent); parent = parentName(parent) {
+			if _, ok := expected[parent]; !ok && data.types[parent] == nil {
+				expected[parent] = map[uint16]bool{}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(expected))
+	for name := range expected {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+
+	for _, name := range names {
+		hash := dns.HashName(name, param.Hash, param.Iterations, param.Salt)
+		nsec3, ok := nsec3s[hash]
+		if !ok {
+			v.addIssue(SeverityError, "nsec3_missing", name, 0, fmt.Sprintf("no NSEC3 record for hash %s", hash))
+			continue
+		}
+		if detail := bitmapMismatch(nsec3.TypeBitMap, expected[name]); detail != "" {
+			v.addIssue(SeverityError, "nsec3_bitmap_mismatch", name, dns.TypeNSEC3, detail)
+		}
+	}
+
+	hashes := make([]string, 0, len(nsec3s))
+	for hash := range nsec3s {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	for i, hash := range hashes {
+		next := hashes[(i+1)%len(hashes)]
+		if got := strings.ToUpper(nsec3s[hash].NextDomain); got != next {
+			v.addIssue(SeverityError, "nsec3_chain_broken", hash+"."+data.zone, dns.TypeNSEC3,
+				fmt.Sprintf("NSEC3 points to %s, want %s", got, next))
+		}
+	}
+}
+
+// verifyParentDS compares the parent's DS records, looked up through the
+// resolver, with the zone's keys
+func (m *Manager) verifyParentDS(v *Verification, data *zoneData, signers map[keyID]bool) {
+	addr, err := m.cfg.ResolverAddr()
+	if err == nil {
+		var response *dns.Msg
+		response, err = zone.QueryResolver(addr, data.zone, dns.TypeDS, m.resolverTimeout)
+		if err == nil {
+			for _, rr := range response.Answer {
+				if ds, ok := rr.(*dns.DS); ok && dns.CanonicalName(ds.Hdr.Name) == data.zone {
+					v.ParentDS = append(v.ParentDS, dsRecord(ds))
+				}
+			}
+		}
+	}
+	if err != nil {
+		v.addIssue(SeverityWarning, "ds_lookup_failed", data.zone, dns.TypeDS, err.Error())
+		return
+	}
+	if len(v.ParentDS) == 0 {
+		v.addIssue(SeverityWarning, "ds_missing", data.zone, dns.TypeDS,
+			"the parent has no DS record for the zone, so resolvers treat it as insecure")
+		return
+	}
+
+	matched, signing := false, false
+	for _, ds := range v.ParentDS {
+		key := matchDS(ds, data.keys())
+		if key == nil {
+			v.addIssue(SeverityWarning, "ds_no_matching_key", data.zone, dns.TypeDS,
+				fmt.Sprintf("DS %d (digest type %d) matches no DNSKEY", ds.KeyTag, ds.DigestType))
+			continue
+		}
+		matched = true
+		signing = signing || signers[keyID{key.KeyTag(), key.Algorithm}]
+	}
+
+	switch {
+	case !matched:
+		v.addIssue(SeverityError, "ds_mismatch", data.zone, dns.TypeDS,
+			"no DS record in the parent matches a DNSKEY; validating resolvers will return SERVFAIL")
+	case !signing:
+		v.addIssue(SeverityError, "ds_key_not_signing", data.zone, dns.TypeDNSKEY,
+			"no key matching a parent DS record has a valid signature over the DNSKEY RRset")
+	}
+}
+
+// matchDS returns the DNSKEY a DS record was computed from
+func matchDS(ds DSRecord, keys []*dns.DNSKEY) *dns.DNSKEY {
+	for _, key := range keys {
+		if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm || key.Flags&dns.ZONE == 0 {
+			continue
+		}
+		if computed := key.ToDS(ds.DigestType); computed != nil && strings.EqualFold(computed.Digest, ds.Digest) {
+			return key
+		}
+	}
+	return nil
+}
+
+// bitmapMismatch compares an NSEC or NSEC3 type bitmap with the types at
+// a name and describes the difference, or returns ""
+func bitmapMismatch(bitmap []uint16, types map[uint16]bool) string {
+	listed := make(map[uint16]bool, len(bitmap))
+	var extra []string
+	for _, t := range bitmap {
+		listed[t] = true
+		if !types[t] {
+			extra = append(extra, dns.TypeToString[t])
+		}
+	}
+	var missing []string
+	for t := range types {
+		// An NSEC3 bitmap does not list the NSEC3 record itself
+		if !listed[t] && t != dns.TypeNSEC3 {
+			missing = append(missing, dns.TypeToString[t])
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return ""
+	}
+
+	sort.Strings(missing)
+	sort.Strings(extra)
+	var parts []string
+	if len(missing) > 0 {
+		parts = append(parts, "missing "+strings.Join(missing, " "))
+	}
+	if len(extra) > 0 {
+		parts = append(parts, "lists absent "+strings.Join(extra, " "))
+	}
+	return "type bitmap " + strings.Join(parts, ", ")
+}
+
+// parentName returns the name with its first label removed, or "" for the root
+func parentName(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return ""
+	}
+	return name[off:]
+}
+
+// canonicalLess orders names canonically (RFC 4034 section 6.1): by their
+// labels from the right, compared as lowercase octets
+func canonicalLess(a, b string) bool {
+	la, lb := wireLabels(a), wireLabels(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c < 0
+		}
+	}
+	return len(la) < len(lb)
+}
+
+// wireLabels returns the lowercased labels of a name as raw octets
+func wireLabels(name string) []string {
+	buf := make([]byte, 256)
+	n, err := dns.PackDomainName(dns.CanonicalName(name), buf, 0, nil, false)
+	if err != nil {
+		return dns.SplitDomainName(strings.ToLower(name))
+	}
+
+	var labels []string
+	for off := 0; off < n && buf[off] != 0; off += int(buf[off]) + 1 {
+		labels = append(labels, string(buf[off+1:off+1+int(buf[off])]))
+	}
+	return labels
+}
@@ -0,0 +1,368 @@
+package dnssec
+
+import (
+	"crypto"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// testZone builds a signed example.com. with a www name, an empty
+// non-terminal above a.b, and an insecure delegation with glue
+type testZone struct {
+	key    *dns.DNSKEY
+	signer crypto.Signer
+	data   []dns.RR
+
+	// Validity window of the signatures
+	inception, expiration time.Time
+}
+
+const (
+	testApex = "example.com."
+	testCut  = "sub.example.com."
+)
+
+func newTestZone(t *testing.T) *testZone {
+	t.Helper()
+
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: testApex, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	var data []dns.RR
+	for _, record := range []string{
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 3600 1209600 3600",
+		"example.com. 3600 IN NS ns1.example.com.",
+		"ns1.example.com. 3600 IN A 192.0.2.1",
+		"www.example.com. 300 IN A 192.0.2.10",
+		"a.b.example.com. 300 IN TXT \"deep\"",
+		"sub.example.com. 3600 IN NS ns.sub.example.com.",
+		"ns.sub.example.com. 3600 IN A 192.0.2.53",
+	} {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(data, rr)
+	}
+
+	return &testZone{
+		key:        key,
+		signer:     priv.(crypto.Signer),
+		data:       append(data, key),
+		inception:  time.Now().Add(-time.Hour),
+		expiration: time.Now().Add(14 * 24 * time.Hour),
+	}
+}
+
+// glue reports whether a test record is below the delegation
+func glue(rr dns.RR) bool {
+	return strings.HasSuffix(rr.Header().Name, "."+testCut)
+}
+
+// sign returns the zone with NSEC or NSEC3 records and signatures
+func (z *testZone) sign(t *testing.T, nsec3 bool) []dns.RR {
+	t.Helper()
+
+	records := append([]dns.RR(nil), z.data...)
+	if nsec3 {
+		records = append(records, z.nsec3Chain()...)
+	} else {
+		records = append(records, z.nsecChain()...)
+	}
+
+	// Sign each authoritative RRset; the delegation NS and glue stay unsigned
+	rrsets := make(map[rrsetKey][]dns.RR)
+	var keys []rrsetKey
+	for _, rr := range records {
+		if glue(rr) || (rr.Header().Name == testCut && rr.Header().Rrtype == dns.TypeNS) {
+			continue
+		}
+		key := rrsetKey{rr.Header().Name, rr.Header().Rrtype}
+		if rrsets[key] == nil {
+			keys = append(keys, key)
+		}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+	for _, key := range keys {
+		sig := &dns.RRSIG{
+			Hdr:        dns.RR_Header{Name: key.name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrsets[key][0].Header().Ttl},
+			Algorithm:  z.key.Algorithm,
+			Inception:  uint32(z.inception.Unix()),
+			Expiration: uint32(z.expiration.Unix()),
+			KeyTag:     z.key.KeyTag(),
+			SignerName: testApex,
+		}
+		if err := sig.Sign(z.signer, rrsets[key]); err != nil {
+			t.Fatalf("Sign(%s %s) error = %v", key.name, dns.TypeToString[key.rrtype], err)
+		}
+		records = append(records, sig)
+	}
+
+	return records
+}
+
+// ownerTypes returns the types at each authoritative owner name
+func (z *testZone) ownerTypes() map[string][]uint16 {
+	types := make(map[string][]uint16)
+	for _, rr := range z.data {
+		if !glue(rr) {
+			types[rr.Header().Name] = append(types[rr.Header().Name], rr.Header().Rrtype)
+		}
+	}
+	return types
+}
+
+// nsecChain returns the NSEC records of the zone
+func (z *testZone) nsecChain() []dns.RR {
+	types := z.ownerTypes()
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return canonicalLess(names[i], names[j]) })
+
+	var chain []dns.RR
+	for i, name := range names {
+		bitmap := append(types[name], dns.TypeNSEC, dns.TypeRRSIG)
+		sort.Slice(bitmap, func(a, b int) bool { return bitmap[a] < bitmap[b] })
+		chain = append(chain, &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: name, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 3600},
+			NextDomain: names[(i+1)%len(names)],
+			TypeBitMap: bitmap,
+		})
+	}
+	return chain
+}
+
+// nsec3Chain returns the NSEC3PARAM and NSEC3 records of the zone, including
+// one for the empty non-terminal b.example.com.
+func (z *testZone) nsec3Chain() []dns.RR {
+	types := z.ownerTypes()
+	types["b.example.com."] = nil
+
+	hashes := make(map[string][]uint16)
+	for name, t := range types {
+		var bitmap []uint16
+		if len(t) > 0 {
+			bitmap = append(bitmap, t...)
+			if name != testCut {
+				bitmap = append(bitmap, dns.TypeRRSIG)
+			}
+		}
+		if name == testApex {
+			bitmap = append(bitmap, dns.TypeNSEC3PARAM)
+		}
+		sort.Slice(bitmap, func(a, b int) bool { return bitmap[a] < bitmap[b] })
+		hashes[dns.HashName(name, dns.SHA1, 0, "")] = bitmap
+	}
+	sorted := make([]string, 0, len(hashes))
+	for hash := range hashes {
+		sorted = append(sorted, hash)
+	}
+	sort.Strings(sorted)
+
+	chain := []dns.RR{&dns.NSEC3PARAM{
+		Hdr:  dns.RR_Header{Name: testApex, Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET},
+		Hash: dns.SHA1,
+	}}
+	for i, hash := range sorted {
+		next := sorted[(i+1)%len(sorted)]
+		chain = append(chain, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: hash + "." + testApex, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 3600},
+			Hash:       dns.SHA1,
+			HashLength: 20,
+			NextDomain: next,
+			TypeBitMap: hashes[hash],
+		})
+	}
+	return chain
+}
+
+// issueKinds returns the kinds of the issues found
+func issueKinds(v *Verification) string {
+	var kinds []string
+	for _, issue := range v.Issues {
+		kinds = append(kinds, issue.Kind)
+	}
+	return strings.Join(kinds, ",")
+}
+
+// withoutRecord returns records without the first record of a type at name
+func withoutRecord(records []dns.RR, name string, rrtype uint16) []dns.RR {
+	for i, rr := range records {
+		if rr.Header().Name == name && rr.Header().Rrtype == rrtype {
+			return append(append([]dns.RR(nil), records[:i]...), records[i+1:]...)
+		}
+	}
+	return records
+}
+
+// TestVerify tests that a correctly signed NSEC and NSEC3 zone with a
+// matching parent DS verifies without issues
+func TestVerify(t *testing.T) {
+	for _, nsec3 := range []bool{false, true} {
+		z := newTestZone(t)
+		cfg := config.DefaultConfig()
+		cfg.Resolver = dnstest.NewServerRR(t, z.key.ToDS(dns.SHA256)).Addr
+		manager := &Manager{cfg: cfg, update: update.NewClient(dnstest.NewServerRR(t, z.sign(t, nsec3)...).Addr, "", "", "")}
+
+		v, err := manager.Verify("Example.COM", VerifyOptions{})
+		if err != nil {
+			t.Fatalf("Verify(nsec3=%v) error = %v", nsec3, err)
+		}
+		if !v.Valid || len(v.Issues) != 0 {
+			t.Errorf("Verify(nsec3=%v) issues = %+v, want none", nsec3, v.Issues)
+		}
+		wantDenial := DenialNSEC
+		if nsec3 {
+			wantDenial = DenialNSEC3
+		}
+		if v.Denial != wantDenial || v.Serial != 1 || len(v.ParentDS) != 1 {
+			t.Errorf("Verify(nsec3=%v) = denial %s, serial %d, parent DS %v", nsec3, v.Denial, v.Serial, v.ParentDS)
+		}
+		if v.RRsets == 0 || v.Signatures != v.RRsets || v.EarliestExpiration == nil {
+			t.Errorf("Verify(nsec3=%v) = %d RRsets, %d signatures, earliest expiration %v",
+				nsec3, v.RRsets, v.Signatures, v.EarliestExpiration)
+		}
+	}
+}
+
+// TestVerifySignatures tests missing, expired and soon expiring signatures
+func TestVerifySignatures(t *testing.T) {
+	z := newTestZone(t)
+	cfg := config.DefaultConfig()
+	cfg.Resolver = dnstest.NewServerRR(t, z.key.ToDS(dns.SHA256)).Addr
+
+	// A missing signature
+	records := withoutRecord(z.sign(t, false), "www.example.com.", dns.TypeRRSIG)
+	manager := &Manager{cfg: cfg, update: update.NewClient(dnstest.NewServerRR(t, records...).Addr, "", "", "")}
+	v, err := manager.Verify("example.com", VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if v.Valid || issueKinds(v) != "missing_signature" || v.Issues[0].Name != "www.example.com." {
+		t.Errorf("Verify() issues = %+v, want missing_signature at www", v.Issues)
+	}
+
+	// Expired signatures
+	z.inception, z.expiration = time.Now().Add(-30*24*time.Hour), time.Now().Add(-time.Hour)
+	manager = &Manager{cfg: cfg, update: update.NewClient(dnstest.NewServerRR(t, z.sign(t, false)...).Addr, "", "", "")}
+	v, err = manager.Verify("example.com", VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if v.Valid || !strings.Contains(issueKinds(v), "expired_signature") {
+		t.Errorf("Verify() issues = %v, want expired_signature", issueKinds(v))
+	}
+
+	// Signatures expiring within the warning time are valid but reported
+	z.inception, z.expiration = time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour)
+	manager = &Manager{cfg: cfg, update: update.NewClient(dnstest.NewServerRR(t, z.sign(t, false)...).Addr, "", "", "")}
+	v, err = manager.Verify("example.com", VerifyOptions{ExpiryWarning: 48 * time.Hour})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !v.Valid || issueKinds(v) != "signatures_expiring" || len(v.Expiring) != v.Signatures {
+		t.Errorf("Verify() issues = %+v, %d expiring of %d, want signatures_expiring for all",
+			v.Issues, len(v.Expiring), v.Signatures)
+	}
+}
+
+// TestVerifyDenial tests gaps in the NSEC and NSEC3 chains
+func TestVerifyDenial(t *testing.T) {
+	z := newTestZone(t)
+	cfg := config.DefaultConfig()
+	cfg.Resolver = dnstest.NewServerRR(t, z.key.ToDS(dns.SHA256)).Addr
+
+	records := withoutRecord(z.sign(t, false), "www.example.com.", dns.TypeNSEC)
+	manager := &Manager{cfg: cfg, update: update.NewClient(dnstest.NewServerRR(t, records...).Addr, "", "", "")}
+	v, err := manager.Verify("example.com", VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if v.Valid || !strings.Contains(issueKinds(v), "nsec_missing") {
+		t.Errorf("Verify() issues = %v, want nsec_missing", issueKinds(v))
+	}
+
+	// The empty non-terminal b.example.com. needs an NSEC3 record too
+	ent := dns.HashName("b.example.com.", dns.SHA1, 0, "") + "." + testApex
+	records = withoutRecord(z.sign(t, true), ent, dns.TypeNSEC3)
+	manager = &Manager{cfg: cfg, update: update.NewClient(dnstest.NewServerRR(t, records...).Addr, "", "", "")}
+	v, err = manager.Verify("example.com", VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	kinds := issueKinds(v)
+	if v.Valid || !strings.Contains(kinds, "nsec3_missing") || !strings.Contains(kinds, "nsec3_chain_broken") {
+		t.Errorf("Verify() issues = %v, want nsec3_missing and nsec3_chain_broken", kinds)
+	}
+}
+
+// TestVerifyParentDS tests comparing the zone's keys with the parent DS
+func TestVerifyParentDS(t *testing.T) {
+	z := newTestZone(t)
+	records := z.sign(t, false)
+
+	// No DS: the zone is valid but insecure
+	cfg := config.DefaultConfig()
+	cfg.Resolver = dnstest.NewServer(t).Addr
+	manager := &Manager{cfg: cfg, update: update.NewClient(dnstest.NewServerRR(t, records...).Addr, "", "", "")}
+	v, err := manager.Verify("example.com", VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if !v.Valid || issueKinds(v) != "ds_missing" {
+		t.Errorf("Verify() issues = %v, want ds_missing", issueKinds(v))
+	}
+
+	// A DS for another key breaks the chain of trust
+	other := newTestZone(t)
+	cfg.Resolver = dnstest.NewServerRR(t, other.key.ToDS(dns.SHA256)).Addr
+	v, err = manager.Verify("example.com", VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if v.Valid || issueKinds(v) != "ds_no_matching_key,ds_mismatch" {
+		t.Errorf("Verify() issues = %v, want ds_no_matching_key,ds_mismatch", issueKinds(v))
+	}
+}
+
+// TestVerifyUnsigned tests that a zone without DNSKEY records is refused
+func TestVerifyUnsigned(t *testing.T) {
+	z := newTestZone(t)
+	records := withoutRecord(z.data, testApex, dns.TypeDNSKEY)
+
+	manager := &Manager{update: update.NewClient(dnstest.NewServerRR(t, records...).Addr, "", "", "")}
+	if _, err := manager.Verify("example.com", VerifyOptions{}); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("Verify() error = %v, want ErrUnsigned", err)
+	}
+}
+
+// TestCanonicalLess tests canonical name ordering (RFC 4034 section 6.1)
+func TestCanonicalLess(t *testing.T) {
+	ordered := []string{
+		"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.",
+		"zABC.a.EXAMPLE.", "z.example.", "\\001.z.example.", "*.z.example.", "\\200.z.example.",
+	}
+	for i := 0; i+1 < len(ordered); i++ {
+		if !canonicalLess(ordered[i], ordered[i+1]) || canonicalLess(ordered[i+1], ordered[i]) {
+			t.Errorf("canonicalLess(%q, %q) ordering wrong", ordered[i], ordered[i+1])
+		}
+	}
+}
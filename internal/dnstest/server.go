@@ -0,0 +1,184 @@
+// Package dnstest provides an in-process authoritative DNS server for tests.
+package dnstest
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// Server is an authoritative DNS server answering from a fixed set of
+// records. It accepts and records updates without applying them.
+type Server struct {
+	// Addr is the host:port the server listens on for UDP and TCP
+	Addr string
+
+	records     []dns.RR
+	mu          sync.Mutex
+	updates     []*dns.Msg
+	updateRcode int
+}
+
+// NewServer starts a server answering from records in zone file format. The
+// server is shut down when the test ends.
+func NewServer(t testing.TB, records ...string) *Server {
+	t.Helper()
+
+	var rrs []dns.RR
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatalf("invalid record %q: %v", record, err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return NewServerRR(t, rrs...)
+}
+
+// NewServerRR is NewServer for parsed records
+func NewServerRR(t testing.TB, records ...dns.RR) *Server {
+	t.Helper()
+
+	s := &Server{records: records, updateRcode: dns.RcodeSuccess}
+	s.Addr = Serve(t, dns.HandlerFunc(s.serveDNS), nil)
+	return s
+}
+
+// serveDNS answers exact name and type matches, or NXDOMAIN if there are
+// none. An AXFR returns the zone's records between two copies of its SOA.
+func (s *Server) serveDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	if r.Opcode == dns.OpcodeUpdate {
+		s.mu.Lock()
+		s.updates = append(s.updates, r)
+		m.SetRcode(r, s.updateRcode)
+		s.mu.Unlock()
+		_ = w.WriteMsg(m)
+		return
+	}
+
+	m.SetReply(r)
+	q := r.Question[0]
+	if q.Qtype == dns.TypeAXFR {
+		m.Answer = axfrRecords(s.records, q.Name)
+	} else {
+		for _, rr := range s.records {
+			if strings.EqualFold(rr.Header().Name, q.Name) && rr.Header().Rrtype == q.Qtype {
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+	}
+	if len(m.Answer) == 0 {
+		m.Rcode = dns.RcodeNameError
+	}
+	_ = w.WriteMsg(m)
+}
+
+// Updates returns the update messages received so far
+func (s *Server) Updates() []*dns.Msg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*dns.Msg(nil), s.updates...)
+}
+
+// SetUpdateRcode sets the rcode of the replies to later updates
+func (s *Server) SetUpdateRcode(rcode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updateRcode = rcode
+}
+
+// HostPort returns the host and port of Addr, as bind.dns_addr and
+// bind.dns_port take them
+func (s *Server) HostPort() (string, int) {
+	host, port, _ := net.SplitHostPort(s.Addr)
+	n, _ := strconv.Atoi(port)
+	return host, n
+}
+
+// Serve starts UDP and TCP DNS servers on one port of 127.0.0.1 answering
+// with handler, and returns their address. Updates are passed to handler;
+// tsigSecret, if not nil, maps TSIG key names to their secrets. The servers
+// are shut down when the test ends.
+func Serve(t testing.TB, handler dns.Handler, tsigSecret map[string]string) string {
+	t.Helper()
+
+	// UDP and TCP share the port; retry if the TCP port is taken
+	var conn net.PacketConn
+	var listener net.Listener
+	for attempt := 0; listener == nil; attempt++ {
+		var err error
+		conn, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		listener, err = net.Listen("tcp", conn.LocalAddr().String())
+		if err != nil {
+			conn.Close()
+			if attempt == 10 {
+				t.Fatalf("failed to listen: %v", err)
+			}
+		}
+	}
+
+	for _, server := range []*dns.Server{
+		{PacketConn: conn, Handler: handler, TsigSecret: tsigSecret},
+		{Listener: listener, Handler: handler, TsigSecret: tsigSecret},
+	} {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+		// The default accept func rejects UPDATE with NOTIMP
+		server.MsgAcceptFunc = func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept }
+		go func() {
+			_ = server.ActivateAndServe()
+		}()
+		<-started
+		t.Cleanup(func() { _ = server.Shutdown() })
+	}
+
+	return conn.LocalAddr().String()
+}
+
+// axfrRecords returns the records of zone framed by its SOA, or nothing if
+// the zone has no SOA. Records of zones below it with their own SOA are left
+// out, as a primary serving both zones would.
+func axfrRecords(rrs []dns.RR, zone string) []dns.RR {
+	zone = dns.CanonicalName(zone)
+	var subzones []string
+	for _, rr := range rrs {
+		name := dns.CanonicalName(rr.Header().Name)
+		if rr.Header().Rrtype == dns.TypeSOA && name != zone && dns.IsSubDomain(zone, name) {
+			subzones = append(subzones, name)
+		}
+	}
+
+	var soa dns.RR
+	var records []dns.RR
+	for _, rr := range rrs {
+		name := dns.CanonicalName(rr.Header().Name)
+		switch {
+		case name == zone && rr.Header().Rrtype == dns.TypeSOA:
+			soa = rr
+		case dns.IsSubDomain(zone, name) && !inSubzone(subzones, name):
+			records = append(records, rr)
+		}
+	}
+	if soa == nil {
+		return nil
+	}
+	return append(append([]dns.RR{soa}, records...), soa)
+}
+
+// inSubzone reports whether name is in one of the zones
+func inSubzone(zones []string, name string) bool {
+	for _, zone := range zones {
+		if dns.IsSubDomain(zone, name) {
+			return true
+		}
+	}
+	return false
+}
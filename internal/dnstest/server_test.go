@@ -0,0 +1,63 @@
+package dnstest
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// TestServer tests the answers, transfers and recorded updates of the server
+func TestServer(t *testing.T) {
+	server := NewServer(t,
+		"example.com. 60 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 86400 60",
+		"www.example.com. 60 IN A 192.0.2.1",
+		"sub.example.com. 60 IN SOA ns1.example.com. hostmaster.example.com. 1 3600 600 86400 60",
+		"www.sub.example.com. 60 IN A 192.0.2.2",
+	)
+
+	tests := []struct {
+		name      string
+		qname     string
+		qtype     uint16
+		net       string
+		wantRcode int
+		wantCount int
+	}{
+		{"exact match", "WWW.example.com.", dns.TypeA, "udp", dns.RcodeSuccess, 1},
+		{"no match", "ftp.example.com.", dns.TypeA, "udp", dns.RcodeNameError, 0},
+		{"transfer without subzone", "example.com.", dns.TypeAXFR, "tcp", dns.RcodeSuccess, 3},
+		{"transfer of subzone", "sub.example.com.", dns.TypeAXFR, "tcp", dns.RcodeSuccess, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, tt.qtype)
+			r, _, err := (&dns.Client{Net: tt.net}).Exchange(m, server.Addr)
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+			if r.Rcode != tt.wantRcode || len(r.Answer) != tt.wantCount {
+				t.Errorf("reply rcode = %d with %d records, want %d with %d", r.Rcode, len(r.Answer), tt.wantRcode, tt.wantCount)
+			}
+		})
+	}
+
+	server.SetUpdateRcode(dns.RcodeYXDomain)
+	m := new(dns.Msg)
+	m.SetUpdate("example.com.")
+	r, _, err := (&dns.Client{Net: "tcp"}).Exchange(m, server.Addr)
+	if err != nil {
+		t.Fatalf("Exchange() of update error = %v", err)
+	}
+	if r.Rcode != dns.RcodeYXDomain {
+		t.Errorf("update rcode = %d, want %d", r.Rcode, dns.RcodeYXDomain)
+	}
+	if n := len(server.Updates()); n != 1 {
+		t.Errorf("Updates() = %d messages, want 1", n)
+	}
+
+	if host, port := server.HostPort(); host != "127.0.0.1" || port == 0 {
+		t.Errorf("HostPort() = %s, %d", host, port)
+	}
+}
@@ -0,0 +1,267 @@
+// Package doctor implements the BIND precondition checks behind dnsctl doctor.
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+// Check outcomes
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Check is the result of a single precondition check. The checks that run
+// once per catalog name the catalog zone they are for.
+type Check struct {
+	Name        string `json:"name"`
+	Catalog     string `json:"catalog,omitempty"`
+	Status      Status `json:"status"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Checker runs precondition checks against the local BIND server
+type Checker struct {
+	cfg    *config.Config
+	rndc   bind.RNDC
+	update *update.Client
+}
+
+// NewChecker creates a new doctor checker
+func NewChecker(cfg *config.Config) *Checker {
+	return &Checker{
+		cfg: cfg,
+		// Checks run against the first view zones are provisioned into
+		rndc: bind.NewRNDC(cfg.Bind.RNDCClient, cfg.Bind.RNDCPath, cfg.Bind.RNDCConf, cfg.ZoneViews()[0]),
+		update: update.NewClient(
+			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
+			cfg.TSIG.Name,
+			cfg.TSIG.Secret,
+			cfg.TSIG.Algorithm,
+		),
+	}
+}
+
+// Run executes all checks in order. The catalog checks run for every
+// catalog zone of the config.
+func (c *Checker) Run() []Check {
+	catalogs := c.cfg.Catalogs()
+
+	checks := []Check{c.CheckRNDC()}
+	for _, catalog := range catalogs {
+		checks = append(checks, c.CheckCatalogZone(catalog))
+	}
+	for _, catalog := range catalogs {
+		checks = append(checks, c.CheckCatalogUpdatable(catalog))
+	}
+	checks = append(checks,
+		c.CheckWritableDir("zones_dir", "zones.dir", c.cfg.Zones.Dir),
+		c.CheckWritableDir("locking_dir", "locking.dir", c.cfg.Locking.Dir),
+		c.CheckSecretFileMode(),
+		c.CheckAllowNewZones(),
+	)
+	for _, catalog := range catalogs {
+		checks = append(checks, c.CheckSchemaVersion(catalog))
+	}
+	return checks
+}
+
+// Failed returns the number of failed checks
+func Failed(checks []Check) int {
+	n := 0
+	for _, check := range checks {
+		if check.Status == StatusFail {
+			n++
+		}
+	}
+	return n
+}
+
+// pass, warn and fail build check results
+func pass(name, msg string) Check {
+	return Check{Name: name, Status: StatusPass, Message: msg}
+}
+
+func warn(name, msg, remediation string) Check {
+	return Check{Name: name, Status: StatusWarn, Message: msg, Remediation: remediation}
+}
+
+func fail(name, msg, remediation string) Check {
+	return Check{Name: name, Status: StatusFail, Message: msg, Remediation: remediation}
+}
+
+// CheckRNDC checks that rndc can reach named
+func (c *Checker) CheckRNDC() Check {
+	const name = "rndc_status"
+
+	if _, err := c.rndc.Status(); err != nil {
+		return fail(name, err.Error(), fmt.Sprintf(
+			"ensure named is running and its control channel accepts the key in %s",
+			c.cfg.Bind.RNDCConf))
+	}
+	return pass(name, "rndc can reach named")
+}
+
+// CheckCatalogZone checks that a catalog zone exists, is loaded and is primary
+func (c *Checker) CheckCatalogZone(cat config.Catalog) (check Check) {
+	const name = "catalog_zone"
+	catalog := cat.Zone
+	defer func() { check.Catalog = catalog }()
+
+	exists, loaded, err := c.rndc.ZoneStatus(catalog)
+	if err != nil {
+		return fail(name, err.Error(), "ensure rndc can reach named")
+	}
+	if !exists {
+		return fail(name, fmt.Sprintf("catalog zone %s does not exist", catalog),
+			"run dnsctl catalog init to create it")
+	}
+	if !loaded {
+		return fail(name, fmt.Sprintf("catalog zone %s is not loaded", catalog),
+			"check the named log for zone load errors")
+	}
+
+	primary, err := c.rndc.IsZonePrimary(catalog)
+	if err != nil {
+		return warn(name, fmt.Sprintf("could not determine zone type of %s: %v", catalog, err),
+			"verify the catalog zone is configured with 'type primary;'")
+	}
+	if !primary {
+		return fail(name, fmt.Sprintf("catalog zone %s is not a primary zone", catalog),
+			"dnsctl must run on the primary for the catalog zone")
+	}
+
+	return pass(name, fmt.Sprintf("catalog zone %s is a loaded primary zone", catalog))
+}
+
+// CheckCatalogUpdatable checks that a catalog zone accepts TSIG-signed
+// updates by sending an update that only carries a prerequisite
+func (c *Checker) CheckCatalogUpdatable(catalog config.Catalog) (check Check) {
+	const name = "catalog_updatable"
+	defer func() { check.Catalog = catalog.Zone }()
+
+	if _, err := c.update.Update(update.BuildNoopUpdate(catalog.Zone)); err != nil {
+		return fail(name, fmt.Sprintf("%s: %v", catalog.Zone, err), fmt.Sprintf(
+			"allow updates to %s with key %s (allow-update or update-policy)",
+			catalog.Zone, c.cfg.TSIG.Name))
+	}
+	return pass(name, fmt.Sprintf("catalog zone %s accepts updates signed with %s", catalog.Zone, c.cfg.TSIG.Name))
+}
+
+// CheckWritableDir checks that a directory exists and is writable
+func (c *Checker) CheckWritableDir(name, setting, dir string) Check {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fail(name, fmt.Sprintf("%s %s: %v", setting, dir, err),
+			"run dnsctl doctor --fix to create it")
+	}
+	if !info.IsDir() {
+		return fail(name, fmt.Sprintf("%s %s is not a directory", setting, dir),
+			fmt.Sprintf("point %s at a directory", setting))
+	}
+
+	probe, err := os.CreateTemp(dir, ".dnsctl-doctor-*")
+	if err != nil {
+		return fail(name, fmt.Sprintf("%s %s is not writable: %v", setting, dir, err),
+			fmt.Sprintf("grant the dnsctl user write access to %s", dir))
+	}
+	probe.Close()
+	_ = os.Remove(probe.Name())
+
+	return pass(name, fmt.Sprintf("%s %s is writable", setting, dir))
+}
+
+// CheckSecretFileMode checks that the TSIG secret file is not accessible by group or others
+func (c *Checker) CheckSecretFileMode() Check {
+	const name = "tsig_secret_mode"
+	path := c.cfg.TSIG.SecretFile
+
+	if path == "" {
+		return warn(name, "tsig.secret_file is not set", "store the TSIG secret in a file with mode 0600")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fail(name, err.Error(), "set tsig.secret_file to the TSIG key file")
+	}
+
+	mode := info.Mode().Perm()
+	if mode&0o077 != 0 {
+		return fail(name, fmt.Sprintf("%s has mode %04o", path, mode),
+			fmt.Sprintf("chmod 0600 %s, or run dnsctl doctor --fix", path))
+	}
+
+	return pass(name, fmt.Sprintf("%s has mode %04o", path, mode))
+}
+
+// CheckAllowNewZones checks that named.conf enables allow-new-zones
+func (c *Checker) CheckAllowNewZones() Check {
+	const name = "allow_new_zones"
+	path := c.cfg.Bind.NamedConf
+
+	conf, err := bind.ReadNamedConf(path)
+	if err != nil {
+		return warn(name, err.Error(), "set bind.named_conf to a readable named.conf")
+	}
+	if !conf.AllowNewZones() {
+		return fail(name, fmt.Sprintf("allow-new-zones is not enabled in %s", filepath.Base(path)),
+			"add 'allow-new-zones yes;' to the options block and run rndc reconfig")
+	}
+
+	return pass(name, "allow-new-zones is enabled")
+}
+
+// CheckSchemaVersion checks a catalog's version TXT record against the
+// schema version the config gives it
+func (c *Checker) CheckSchemaVersion(catalog config.Catalog) (check Check) {
+	const name = "catalog_schema_version"
+	defer func() { check.Catalog = catalog.Zone }()
+	owner := "version." + dns.Fqdn(catalog.Zone)
+	want := catalog.SchemaVersion
+
+	version, err := c.SchemaVersion(catalog.Zone)
+	if err != nil {
+		return fail(name, err.Error(), "ensure named answers queries for the catalog zone")
+	}
+	if version == "" {
+		return fail(name, fmt.Sprintf("%s has no TXT record", owner),
+			"run dnsctl doctor --fix to add it")
+	}
+	if version != strconv.Itoa(want) {
+		return fail(name, fmt.Sprintf("schema version of catalog %s is %s, config expects %d", catalog.Zone, version, want),
+			fmt.Sprintf("set the schema_version of catalog %s to match the catalog zone", catalog.Name))
+	}
+
+	return pass(name, fmt.Sprintf("schema version of catalog %s is %d", catalog.Zone, want))
+}
+
+// SchemaVersion returns a catalog zone's version TXT value, or "" if absent
+func (c *Checker) SchemaVersion(catalogZone string) (string, error) {
+	owner := "version." + dns.Fqdn(catalogZone)
+
+	response, err := c.update.Query(owner, dns.TypeTXT)
+	if err != nil {
+		return "", fmt.Errorf("failed to query %s: %w", owner, err)
+	}
+
+	for _, rr := range response.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			return strings.Join(txt.Txt, ""), nil
+		}
+	}
+	return "", nil
+}
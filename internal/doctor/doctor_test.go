@@ -0,0 +1,216 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/config"
+)
+
+// TestCheckWritableDir tests the directory writability check
+func TestCheckWritableDir(t *testing.T) {
+	checker := NewChecker(config.DefaultConfig())
+	dir := t.TempDir()
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		dir  string
+		want Status
+	}{
+		{"writable", dir, StatusPass},
+		{"missing", filepath.Join(dir, "missing"), StatusFail},
+		{"not a directory", file, StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := checker.CheckWritableDir("zones_dir", "zones.dir", tt.dir)
+			if check.Status != tt.want {
+				t.Errorf("CheckWritableDir() status = %s, want %s (%s)", check.Status, tt.want, check.Message)
+			}
+			if check.Status == StatusFail && check.Remediation == "" {
+				t.Error("failed check has no remediation")
+			}
+		})
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("probe file left behind: %d entries in %s", len(entries), dir)
+	}
+}
+
+// TestCheckSecretFileMode tests the TSIG secret permission check
+func TestCheckSecretFileMode(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		mode os.FileMode
+		want Status
+	}{
+		{"owner only", 0o600, StatusPass},
+		{"owner read only", 0o400, StatusPass},
+		{"group readable", 0o640, StatusFail},
+		{"world readable", 0o644, StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte("secret"), tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.TSIG.SecretFile = path
+
+			check := NewChecker(cfg).CheckSecretFileMode()
+			if check.Status != tt.want {
+				t.Errorf("CheckSecretFileMode() status = %s, want %s (%s)", check.Status, tt.want, check.Message)
+			}
+		})
+	}
+}
+
+// TestCheckAllowNewZones tests the named.conf allow-new-zones check
+func TestCheckAllowNewZones(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    Status
+	}{
+		{"enabled", "options { allow-new-zones yes; };", StatusPass},
+		{"disabled", "options { allow-new-zones no; };", StatusFail},
+		{"unreadable", "", StatusWarn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".conf")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg := config.DefaultConfig()
+			cfg.Bind.NamedConf = path
+
+			check := NewChecker(cfg).CheckAllowNewZones()
+			if check.Status != tt.want {
+				t.Errorf("CheckAllowNewZones() status = %s, want %s (%s)", check.Status, tt.want, check.Message)
+			}
+		})
+	}
+}
+
+// fakeRNDCScript writes an rndc stand-in that reports every zone as loaded
+// and answers showzone with the given output
+func fakeRNDCScript(t *testing.T, showzone string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	showzoneFile := filepath.Join(dir, "showzone")
+	if err := os.WriteFile(showzoneFile, []byte(showzone+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "rndc")
+	content := "#!/bin/sh\ncase \"$3\" in\n" +
+		"zonestatus) printf 'serial: 1\\nstatus: loaded\\n' ;;\n" +
+		"showzone) cat " + showzoneFile + " ;;\n" +
+		"esac\n"
+	if err := os.WriteFile(script, []byte(content), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+// TestCheckCatalogZone tests the catalog zone check against showzone output
+// as named prints it, on a single line
+func TestCheckCatalogZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		showzone string
+		want     Status
+	}{
+		{"primary", `zone "catalog.example" { type primary; file "/var/lib/dnsctl/zones/catalog.example.zone"; allow-update { key "dnsctl."; }; };`, StatusPass},
+		{"secondary", `zone "catalog.example" { type secondary; primaries { 192.0.2.1; }; file "catalog.example.db"; };`, StatusFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.Catalog.Zone = "catalog.example."
+			cfg.Bind.RNDCPath = fakeRNDCScript(t, tt.showzone)
+
+			check := NewChecker(cfg).CheckCatalogZone(cfg.Catalogs()[0])
+			if check.Status != tt.want {
+				t.Errorf("CheckCatalogZone() status = %s, want %s (%s)", check.Status, tt.want, check.Message)
+			}
+		})
+	}
+}
+
+// TestRunChecksEveryCatalog tests that the catalog checks run for the
+// named catalogs as well as the default one
+func TestRunChecksEveryCatalog(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Catalog.Zone = "catalog.example."
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.catalog.example."}}
+	cfg.Bind.RNDCClient = bind.ClientExec
+	cfg.Bind.RNDCPath = fakeRNDCScript(t, `zone "catalog.example" { type primary; };`)
+	cfg.Bind.DNSAddr = "127.0.0.1"
+	cfg.Bind.DNSPort = 1
+
+	ran := make(map[string]bool)
+	for _, check := range NewChecker(cfg).Run() {
+		if !strings.HasPrefix(check.Name, "catalog_") {
+			if check.Catalog != "" {
+				t.Errorf("%s is for catalog %s", check.Name, check.Catalog)
+			}
+			continue
+		}
+		key := check.Name + " " + check.Catalog
+		if ran[key] {
+			t.Errorf("%s ran twice", key)
+		}
+		ran[key] = true
+		if !strings.Contains(check.Message, check.Catalog) {
+			t.Errorf("%s message %q does not name the catalog zone", key, check.Message)
+		}
+	}
+	for _, name := range []string{"catalog_zone", "catalog_updatable", "catalog_schema_version"} {
+		for _, catalog := range []string{"catalog.example.", "customers.catalog.example."} {
+			if !ran[name+" "+catalog] {
+				t.Errorf("%s did not run for %s", name, catalog)
+			}
+		}
+	}
+}
+
+// TestFailed tests counting failed checks
+func TestFailed(t *testing.T) {
+	checks := []Check{
+		{Name: "a", Status: StatusPass},
+		{Name: "b", Status: StatusWarn},
+		{Name: "c", Status: StatusFail},
+		{Name: "d", Status: StatusFail},
+	}
+	if got := Failed(checks); got != 2 {
+		t.Errorf("Failed() = %d, want 2", got)
+	}
+}
@@ -0,0 +1,170 @@
+package doctor
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/dlukt/dnsctl/internal/zone"
+	"github.com/miekg/dns"
+)
+
+// Fix repairs the precondition failures that are safe to fix automatically.
+// Every fix (or, with dryRun, every fix that would be made) is appended to
+// changes. Fixes continue after an error; the first error is returned.
+func (c *Checker) Fix(dryRun bool, changes *[]string) error {
+	var firstErr error
+	record := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	record(c.FixDir("zones_dir", c.cfg.Zones.Dir, dryRun, changes))
+	record(c.FixDir("locking_dir", c.cfg.Locking.Dir, dryRun, changes))
+	record(c.FixSecretFileMode(dryRun, changes))
+	record(c.FixSchemaVersion(dryRun, changes))
+	record(c.FixCatalogMembers(dryRun, changes))
+
+	return firstErr
+}
+
+// FixDir creates a missing directory owned by the configured zone file owner and group
+func (c *Checker) FixDir(name, dir string, dryRun bool, changes *[]string) error {
+	if _, err := os.Stat(dir); err == nil || !os.IsNotExist(err) {
+		return nil
+	}
+
+	change := name + "_created"
+	if dryRun {
+		*changes = append(*changes, change)
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	*changes = append(*changes, change)
+
+	if c.cfg.Zones.FileOwner == "" && c.cfg.Zones.FileGroup == "" {
+		return nil
+	}
+	if err := chownPath(dir, c.cfg.Zones.FileOwner, c.cfg.Zones.FileGroup); err != nil {
+		return err
+	}
+	*changes = append(*changes, name+"_owner_set")
+
+	return nil
+}
+
+// FixSecretFileMode removes group and other permissions from the TSIG secret file
+func (c *Checker) FixSecretFileMode(dryRun bool, changes *[]string) error {
+	path := c.cfg.TSIG.SecretFile
+	if path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		// A missing secret file cannot be fixed automatically
+		return nil
+	}
+
+	mode := info.Mode().Perm()
+	if mode&0o077 == 0 {
+		return nil
+	}
+
+	if !dryRun {
+		if err := os.Chmod(path, mode&0o700); err != nil {
+			return fmt.Errorf("failed to chmod %s: %w", path, err)
+		}
+	}
+	*changes = append(*changes, "tsig_secret_mode_fixed")
+
+	return nil
+}
+
+// FixSchemaVersion adds the version TXT record to each catalog zone that is
+// missing it, with the catalog's schema version and TTL. A version that
+// differs from the config is left alone: changing the schema of a live
+// catalog is not a safe automatic fix.
+func (c *Checker) FixSchemaVersion(dryRun bool, changes *[]string) error {
+	for _, catalog := range c.cfg.Catalogs() {
+		version, err := c.SchemaVersion(catalog.Zone)
+		if err != nil {
+			return err
+		}
+		if version != "" {
+			continue
+		}
+
+		if !dryRun {
+			msg := BuildVersionUpdate(catalog.Zone, catalog.SchemaVersion, catalog.TTL)
+			if _, err := c.update.Update(msg); err != nil {
+				return fmt.Errorf("failed to add catalog version to %s: %w", catalog.Zone, err)
+			}
+		}
+		*changes = append(*changes, "catalog_version_added:"+strings.TrimSuffix(catalog.Zone, "."))
+	}
+
+	return nil
+}
+
+// FixCatalogMembers re-adds catalog PTRs for zones that have a zone file in
+// zones.dir and are loaded by named but are missing from every catalog, as
+// catalog reconcile does. The catalog zones themselves are never added.
+func (c *Checker) FixCatalogMembers(dryRun bool, changes *[]string) error {
+	_, err := zone.NewReconciler(c.cfg).AddMissing(!dryRun, changes)
+	return err
+}
+
+// BuildVersionUpdate builds an update adding the catalog version TXT record.
+// The prerequisite that the owner does not exist keeps it from clobbering a
+// version record added concurrently.
+func BuildVersionUpdate(catalogZone string, version int, ttl uint32) *dns.Msg {
+	catalogZone = dns.Fqdn(catalogZone)
+	owner := "version." + catalogZone
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(catalogZone)
+	msg.NameNotUsed([]dns.RR{&dns.RR_Header{Name: owner}})
+	msg.Insert([]dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   owner,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Txt: []string{strconv.Itoa(version)},
+	}})
+
+	return msg
+}
+
+// chownPath sets the owner and group of a path by name
+func chownPath(path, owner, group string) error {
+	uid, gid := -1, -1
+
+	if owner != "" {
+		u, err := user.Lookup(owner)
+		if err != nil {
+			return fmt.Errorf("failed to look up user %s: %w", owner, err)
+		}
+		uid, _ = strconv.Atoi(u.Uid)
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return fmt.Errorf("failed to look up group %s: %w", group, err)
+		}
+		gid, _ = strconv.Atoi(g.Gid)
+	}
+
+	if err := os.Chown(path, uid, gid); err != nil {
+		return fmt.Errorf("failed to chown %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package doctor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/miekg/dns"
+)
+
+// testConfig returns a config whose directories live under a temp dir
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Zones.Dir = filepath.Join(dir, "zones")
+	cfg.Locking.Dir = filepath.Join(dir, "locks")
+	cfg.Zones.FileOwner = ""
+	cfg.Zones.FileGroup = ""
+	return cfg
+}
+
+// TestFixDir tests creating missing directories, with and without dry-run
+func TestFixDir(t *testing.T) {
+	cfg := testConfig(t)
+	checker := NewChecker(cfg)
+
+	var changes []string
+	if err := checker.FixDir("zones_dir", cfg.Zones.Dir, true, &changes); err != nil {
+		t.Fatalf("FixDir(dry-run) error = %v", err)
+	}
+	if !reflect.DeepEqual(changes, []string{"zones_dir_created"}) {
+		t.Errorf("FixDir(dry-run) changes = %v", changes)
+	}
+	if _, err := os.Stat(cfg.Zones.Dir); !os.IsNotExist(err) {
+		t.Error("FixDir(dry-run) created the directory")
+	}
+
+	changes = nil
+	if err := checker.FixDir("zones_dir", cfg.Zones.Dir, false, &changes); err != nil {
+		t.Fatalf("FixDir() error = %v", err)
+	}
+	if !reflect.DeepEqual(changes, []string{"zones_dir_created"}) {
+		t.Errorf("FixDir() changes = %v", changes)
+	}
+	if info, err := os.Stat(cfg.Zones.Dir); err != nil || !info.IsDir() {
+		t.Errorf("FixDir() did not create %s", cfg.Zones.Dir)
+	}
+
+	// Already present: nothing to do
+	changes = nil
+	if err := checker.FixDir("zones_dir", cfg.Zones.Dir, false, &changes); err != nil {
+		t.Fatalf("FixDir() second run error = %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("FixDir() second run changes = %v, want none", changes)
+	}
+}
+
+// TestFixSecretFileMode tests tightening TSIG secret permissions
+func TestFixSecretFileMode(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.TSIG.SecretFile = filepath.Join(t.TempDir(), "tsig.secret")
+	if err := os.WriteFile(cfg.TSIG.SecretFile, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(cfg.TSIG.SecretFile, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	checker := NewChecker(cfg)
+
+	var changes []string
+	if err := checker.FixSecretFileMode(true, &changes); err != nil {
+		t.Fatalf("FixSecretFileMode(dry-run) error = %v", err)
+	}
+	if info, _ := os.Stat(cfg.TSIG.SecretFile); info.Mode().Perm() != 0o644 {
+		t.Errorf("FixSecretFileMode(dry-run) changed mode to %04o", info.Mode().Perm())
+	}
+
+	changes = nil
+	if err := checker.FixSecretFileMode(false, &changes); err != nil {
+		t.Fatalf("FixSecretFileMode() error = %v", err)
+	}
+	if !reflect.DeepEqual(changes, []string{"tsig_secret_mode_fixed"}) {
+		t.Errorf("FixSecretFileMode() changes = %v", changes)
+	}
+	if info, _ := os.Stat(cfg.TSIG.SecretFile); info.Mode().Perm() != 0o600 {
+		t.Errorf("FixSecretFileMode() mode = %04o, want 0600", info.Mode().Perm())
+	}
+	if check := checker.CheckSecretFileMode(); check.Status != StatusPass {
+		t.Errorf("CheckSecretFileMode() after fix = %s (%s)", check.Status, check.Message)
+	}
+}
+
+// TestBuildVersionUpdate tests the catalog version TXT update
+func TestBuildVersionUpdate(t *testing.T) {
+	msg := BuildVersionUpdate("catalog.example", 2, 60)
+
+	if len(msg.Answer) != 1 || msg.Answer[0].Header().Class != dns.ClassNONE {
+		t.Errorf("prerequisite = %v, want name-not-in-use", msg.Answer)
+	}
+	if len(msg.Ns) != 1 {
+		t.Fatalf("update section has %d records, want 1", len(msg.Ns))
+	}
+	txt, ok := msg.Ns[0].(*dns.TXT)
+	if !ok {
+		t.Fatalf("update record is %T, want *dns.TXT", msg.Ns[0])
+	}
+	if txt.Hdr.Name != "version.catalog.example." || !reflect.DeepEqual(txt.Txt, []string{"2"}) {
+		t.Errorf("update record = %s", txt)
+	}
+}
+
+// TestFixSchemaVersionCatalogs tests that the version record is added to
+// each catalog that lacks it, with that catalog's schema version and TTL
+func TestFixSchemaVersionCatalogs(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Catalog.Zone = "catalog.example."
+	cfg.Catalog.SchemaVersion = 2
+	cfg.Catalog.Catalogs = []config.NamedCatalog{
+		{Name: "customers", Zone: "customers.catalog.example.", SchemaVersion: 1, TTL: 300},
+	}
+	server := dnstest.NewServer(t, `version.catalog.example. 60 IN TXT "2"`)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = server.HostPort()
+	checker := NewChecker(cfg)
+
+	var changes []string
+	if err := checker.FixSchemaVersion(false, &changes); err != nil {
+		t.Fatalf("FixSchemaVersion() error = %v", err)
+	}
+	if !reflect.DeepEqual(changes, []string{"catalog_version_added:customers.catalog.example"}) {
+		t.Errorf("FixSchemaVersion() changes = %v", changes)
+	}
+
+	sent := server.Updates()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d updates, want 1", len(sent))
+	}
+	txt, ok := sent[0].Ns[0].(*dns.TXT)
+	if !ok || txt.Hdr.Name != "version.customers.catalog.example." || txt.Hdr.Ttl != 300 ||
+		!reflect.DeepEqual(txt.Txt, []string{"1"}) {
+		t.Errorf("update record = %v, want version 1 with TTL 300 in customers.catalog.example.", sent[0].Ns[0])
+	}
+}
@@ -1,13 +1,23 @@
 package lock
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 )
 
+// Errors returned by Acquire
+var (
+	// ErrLocked means another process holds a conflicting lock
+	ErrLocked = errors.New("lock is held by another process")
+	// ErrAlreadyHeld means this Lock has already been acquired
+	ErrAlreadyHeld = errors.New("lock already held")
+)
+
 // Lock provides advisory file locking using flock semantics
 type Lock struct {
 	path     string
@@ -40,7 +50,7 @@ func (l *Lock) Acquire() error {
 	defer l.mu.Unlock()
 
 	if l.held {
-		return fmt.Errorf("lock already held")
+		return ErrAlreadyHeld
 	}
 
 	// Ensure parent directory exists
@@ -67,6 +77,9 @@ func (l *Lock) Acquire() error {
 
 	if err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB); err != nil {
 		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return fmt.Errorf("failed to acquire lock: %w", ErrLocked)
+		}
 		return fmt.Errorf("failed to acquire lock: %w", err)
 	}
 
@@ -126,7 +139,7 @@ func ZoneLockPath(lockDir, zone string) string {
 	return filepath.Join(lockDir, "zone--"+zoneName+".lock")
 }
 
-// CatalogLockPath returns the lock file path for the catalog zone
-func CatalogLockPath(lockDir string) string {
-	return filepath.Join(lockDir, "catalog.lock")
+// CatalogLockPath returns the lock file path for a catalog zone
+func CatalogLockPath(lockDir, catalogZone string) string {
+	return filepath.Join(lockDir, "catalog--"+strings.TrimSuffix(catalogZone, ".")+".lock")
 }
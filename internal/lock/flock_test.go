@@ -1,6 +1,7 @@
 package lock
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -243,3 +244,25 @@ func BenchmarkLockAcquire(b *testing.B) {
 		lock.Release()
 	}
 }
+
+// TestAcquireConflict tests that a conflicting lock is reported as ErrLocked
+func TestAcquireConflict(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "conflict.lock")
+
+	first := New(lockPath)
+	if err := first.Acquire(); err != nil {
+		t.Fatalf("First acquire failed: %v", err)
+	}
+	defer first.Release()
+
+	// flock locks are per open file description, so a second Lock conflicts
+	second := New(lockPath)
+	err := second.Acquire()
+	if !errors.Is(err, ErrLocked) {
+		t.Errorf("Second Acquire() error = %v, want ErrLocked", err)
+	}
+
+	if err := first.Acquire(); !errors.Is(err, ErrAlreadyHeld) {
+		t.Errorf("Repeated Acquire() error = %v, want ErrAlreadyHeld", err)
+	}
+}
@@ -34,7 +34,10 @@ func (m *Manager) Delete(zoneInput, ownerInput, rrType string) (*DeleteResult, e
 		rrTypeUpper = dns.TypeToString[typeNum]
 	}
 	if !m.cfg.IsAllowedRRType(rrTypeUpper) {
-		return nil, fmt.Errorf("RR type %s is not allowed", rrTypeUpper)
+		return nil, &PolicyError{
+			Rule: "allowed_rrtypes",
+			Err:  fmt.Errorf("RR type %s is not allowed", rrTypeUpper),
+		}
 	}
 
 	// Validate policy
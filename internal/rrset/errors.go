@@ -0,0 +1,33 @@
+package rrset
+
+// ValidationError reports invalid RRset input (type, TTL or RDATA)
+type ValidationError struct {
+	Field string // "type", "ttl" or "rdata"
+	Err   error  // Underlying validation failure
+}
+
+// Error returns the underlying validation message
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying validation failure
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// PolicyError reports an RRset change rejected by the configured policy (spec 15)
+type PolicyError struct {
+	Rule string // Policy setting that rejected the change
+	Err  error  // Description of the violation
+}
+
+// Error returns the policy violation message
+func (e *PolicyError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the description of the violation
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
@@ -42,7 +42,10 @@ func (m *Manager) Get(zoneInput, ownerInput, rrType string) (*GetResult, error)
 	rrTypeUpper := strings.ToUpper(rrType)
 	typeNum := dns.StringToType[rrTypeUpper]
 	if typeNum == 0 {
-		return nil, fmt.Errorf("unknown RR type: %s", rrTypeUpper)
+		return nil, &ValidationError{
+			Field: "type",
+			Err:   fmt.Errorf("unknown RR type: %s", rrTypeUpper),
+		}
 	}
 
 	// Perform standard DNS query against local named (spec 12.4)
@@ -1,6 +1,7 @@
 package rrset
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/dlukt/dnsctl/internal/config"
@@ -144,6 +145,12 @@ func TestValidatePolicy(t *testing.T) {
 					t.Errorf("ValidatePolicy error = %v, expected to contain %q", err, tt.errMsg)
 				}
 			}
+			if tt.wantErr {
+				var policyErr *PolicyError
+				if !errors.As(err, &policyErr) {
+					t.Errorf("ValidatePolicy error = %T, want *PolicyError", err)
+				}
+			}
 		})
 	}
 }
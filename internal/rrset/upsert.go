@@ -53,7 +53,7 @@ func (m *Manager) Upsert(zoneInput, ownerInput, rrType string, ttl uint32, rdata
 
 	// Validate TTL
 	if err := m.cfg.ValidateTTL(ttl); err != nil {
-		return nil, fmt.Errorf("invalid TTL: %w", err)
+		return nil, fmt.Errorf("invalid TTL: %w", &ValidationError{Field: "ttl", Err: err})
 	}
 
 	// Validate RR type
@@ -62,7 +62,10 @@ func (m *Manager) Upsert(zoneInput, ownerInput, rrType string, ttl uint32, rdata
 		rrTypeUpper = rrType
 	}
 	if !m.cfg.IsAllowedRRType(rrTypeUpper) {
-		return nil, fmt.Errorf("RR type %s is not allowed", rrTypeUpper)
+		return nil, &PolicyError{
+			Rule: "allowed_rrtypes",
+			Err:  fmt.Errorf("RR type %s is not allowed", rrTypeUpper),
+		}
 	}
 
 	// Create validator
@@ -70,7 +73,7 @@ func (m *Manager) Upsert(zoneInput, ownerInput, rrType string, ttl uint32, rdata
 
 	// Validate RDATA
 	if err := validator.ValidateRDATA(rrTypeUpper, rdata); err != nil {
-		return nil, fmt.Errorf("invalid RDATA: %w", err)
+		return nil, fmt.Errorf("invalid RDATA: %w", &ValidationError{Field: "rdata", Err: err})
 	}
 
 	// Validate policy
@@ -90,7 +93,7 @@ func (m *Manager) Upsert(zoneInput, ownerInput, rrType string, ttl uint32, rdata
 	for _, rd := range rdata {
 		rr, err := BuildRR(owner, rrTypeUpper, ttl, rd)
 		if err != nil {
-			return nil, fmt.Errorf("failed to build RR: %w", err)
+			return nil, fmt.Errorf("failed to build RR: %w", &ValidationError{Field: "rdata", Err: err})
 		}
 		rrs = append(rrs, rr)
 	}
@@ -220,13 +220,19 @@ func (v *Validator) ValidatePolicy(zone, owner, rrType string) error {
 	// Check apex CNAME policy (spec 15.2)
 	if v.cfg.Policy.DisallowApexCNAME && strings.ToUpper(rrType) == "CNAME" {
 		if zonepkg.IsApexOwner(owner, zone) {
-			return fmt.Errorf("CNAME at zone apex is not allowed")
+			return &PolicyError{
+				Rule: "disallow_apex_cname",
+				Err:  fmt.Errorf("CNAME at zone apex is not allowed"),
+			}
 		}
 	}
 
 	// Check NS updates policy (spec 15.3)
 	if v.cfg.Policy.DisallowNSUpdates && strings.ToUpper(rrType) == "NS" {
-		return fmt.Errorf("NS record updates are not allowed")
+		return &PolicyError{
+			Rule: "disallow_ns_updates",
+			Err:  fmt.Errorf("NS record updates are not allowed"),
+		}
 	}
 
 	return nil
@@ -0,0 +1,225 @@
+package ssh
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// OperatorOnlyAnnotation marks flags that must not be passed in SSH wrap mode,
+// such as --config, which would let a caller choose the TSIG key and rndc binary
+const OperatorOnlyAnnotation = "dnsctl_operator_only"
+
+// PrivilegedAnnotation marks commands that SSH wrap mode only runs for the
+// actors of ssh.privileged_actors, such as DNSSEC key rollovers
+const PrivilegedAnnotation = "dnsctl_privileged"
+
+// Allowlist describes the commands and flags permitted in SSH wrap mode.
+// It is derived from the cobra command tree, so it cannot drift from the CLI.
+type Allowlist struct {
+	root       *cobra.Command
+	commands   map[string]*cobra.Command // Keyed by path below the root, e.g. "zone create"
+	privileged map[string]bool           // Actors allowed to run privileged commands
+}
+
+// NewAllowlist builds an allowlist from the runnable, non-hidden commands of root.
+// If allowed is non-empty, only commands whose path equals or lies below one of
+// its entries are permitted (e.g. "zone" or "zone status"). Entries that match
+// no command are rejected so that a typo cannot silently disable a restriction.
+func NewAllowlist(root *cobra.Command, allowed []string) (*Allowlist, error) {
+	a := &Allowlist{
+		root:     root,
+		commands: make(map[string]*cobra.Command),
+	}
+
+	all := make(map[string]*cobra.Command)
+	collectCommands(root, "", all)
+
+	for _, entry := range allowed {
+		entry = strings.Join(strings.Fields(entry), " ")
+		matched := false
+		for path, cmd := range all {
+			if path == entry || strings.HasPrefix(path, entry+" ") {
+				a.commands[path] = cmd
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("ssh.allowed_commands: unknown command %q", entry)
+		}
+	}
+
+	if len(allowed) == 0 {
+		a.commands = all
+	}
+
+	return a, nil
+}
+
+// WithPrivilegedActors sets the actors allowed to run commands marked with
+// PrivilegedAnnotation
+func (a *Allowlist) WithPrivilegedActors(actors []string) *Allowlist {
+	a.privileged = make(map[string]bool, len(actors))
+	for _, actor := range actors {
+		a.privileged[actor] = true
+	}
+	return a
+}
+
+// collectCommands records the runnable, non-hidden commands below cmd by path
+func collectCommands(cmd *cobra.Command, prefix string, out map[string]*cobra.Command) {
+	for _, child := range cmd.Commands() {
+		if child.Hidden {
+			continue
+		}
+
+		path := strings.TrimSpace(prefix + " " + child.Name())
+		if child.Runnable() {
+			out[path] = child
+		}
+		collectCommands(child, path, out)
+	}
+}
+
+// Commands returns the permitted command paths in sorted order
+func (a *Allowlist) Commands() []string {
+	paths := make([]string, 0, len(a.commands))
+	for path := range a.commands {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Validate checks a parsed command line against the allowlist. The command
+// path must come first; flags are checked the way pflag will parse them.
+func (a *Allowlist) Validate(parts []string) error {
+	if len(parts) == 0 {
+		return &ParseError{Pos: 0, Msg: "empty command"}
+	}
+
+	cmd, path := a.resolve(parts)
+	if len(path) == 0 {
+		return &NotAllowedError{What: fmt.Sprintf("subcommand '%s'", parts[0])}
+	}
+
+	cmdPath := strings.Join(path, " ")
+	if _, ok := a.commands[cmdPath]; !ok {
+		return &NotAllowedError{What: fmt.Sprintf("subcommand '%s'", cmdPath)}
+	}
+
+	return validateFlags(cmd, cmdPath, parts[len(path):])
+}
+
+// Authorize checks that actor may run the command of a validated command
+// line: privileged commands need an actor listed by WithPrivilegedActors
+func (a *Allowlist) Authorize(actor string, parts []string) error {
+	cmd, path := a.resolve(parts)
+	if _, ok := cmd.Annotations[PrivilegedAnnotation]; !ok {
+		return nil
+	}
+	if actor == "" || !a.privileged[actor] {
+		return &NotAllowedError{What: fmt.Sprintf("privileged subcommand '%s' for actor '%s'", strings.Join(path, " "), actor)}
+	}
+	return nil
+}
+
+// resolve returns the command named by the leading words of parts and its
+// path below the root
+func (a *Allowlist) resolve(parts []string) (*cobra.Command, []string) {
+	cmd := a.root
+	var path []string
+	for _, word := range parts {
+		child := findChild(cmd, word)
+		if child == nil {
+			break
+		}
+		cmd = child
+		path = append(path, child.Name())
+	}
+	return cmd, path
+}
+
+// findChild returns the non-hidden subcommand of cmd named or aliased word
+func findChild(cmd *cobra.Command, word string) *cobra.Command {
+	for _, child := range cmd.Commands() {
+		if !child.Hidden && (child.Name() == word || child.HasAlias(word)) {
+			return child
+		}
+	}
+	return nil
+}
+
+// validateFlags checks every flag in args against the flags cmd defines,
+// skipping flag values and everything after a "--" terminator
+func validateFlags(cmd *cobra.Command, cmdPath string, args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			continue
+		}
+
+		// Long flag: --name or --name=value
+		if strings.HasPrefix(arg, "--") {
+			name, _, hasValue := strings.Cut(arg[2:], "=")
+			flag := lookupFlag(cmd, name)
+			if err := checkFlag(flag, "--"+name, cmdPath); err != nil {
+				return err
+			}
+			if !hasValue && flag.NoOptDefVal == "" {
+				i++ // Value is the next word
+			}
+			continue
+		}
+
+		// Shorthand cluster: -v, -vn 5, -n5 or -n=5
+		shorts := arg[1:]
+		for j := 0; j < len(shorts); j++ {
+			flag := lookupShorthand(cmd, shorts[j])
+			if err := checkFlag(flag, "-"+shorts[j:j+1], cmdPath); err != nil {
+				return err
+			}
+			if flag.NoOptDefVal == "" {
+				if j == len(shorts)-1 {
+					i++ // Value is the next word
+				}
+				break // Remainder of the cluster is the value
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkFlag rejects unknown and operator-only flags
+func checkFlag(flag *pflag.Flag, name, cmdPath string) error {
+	if flag == nil || flag.Hidden {
+		return &NotAllowedError{What: fmt.Sprintf("flag '%s' for subcommand '%s'", name, cmdPath)}
+	}
+	if _, ok := flag.Annotations[OperatorOnlyAnnotation]; ok {
+		return &NotAllowedError{What: fmt.Sprintf("operator-only flag '%s'", name)}
+	}
+	return nil
+}
+
+// lookupFlag finds a local or inherited flag by long name
+func lookupFlag(cmd *cobra.Command, name string) *pflag.Flag {
+	if flag := cmd.LocalFlags().Lookup(name); flag != nil {
+		return flag
+	}
+	return cmd.InheritedFlags().Lookup(name)
+}
+
+// lookupShorthand finds a local or inherited flag by shorthand
+func lookupShorthand(cmd *cobra.Command, c byte) *pflag.Flag {
+	if flag := cmd.LocalFlags().ShorthandLookup(string([]byte{c})); flag != nil {
+		return flag
+	}
+	return cmd.InheritedFlags().ShorthandLookup(string([]byte{c}))
+}
@@ -0,0 +1,222 @@
+package ssh
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// testRoot builds a command tree shaped like dnsctl's
+func testRoot() *cobra.Command {
+	run := func(cmd *cobra.Command, args []string) error { return nil }
+
+	root := &cobra.Command{Use: "dnsctl", RunE: run}
+	root.PersistentFlags().StringP("config", "c", "/etc/dnsctl/config.yaml", "config file path")
+	root.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
+	_ = root.PersistentFlags().SetAnnotation("config", OperatorOnlyAnnotation, []string{"true"})
+	root.Flags().Bool("ssh-wrap", false, "SSH forced-command wrapper mode")
+
+	root.AddCommand(&cobra.Command{Use: "doctor", RunE: run})
+	root.AddCommand(&cobra.Command{Use: "version", RunE: run})
+	root.AddCommand(&cobra.Command{Use: "secret", Hidden: true, RunE: run})
+
+	zone := &cobra.Command{Use: "zone"}
+	list := &cobra.Command{Use: "list", Aliases: []string{"ls"}, RunE: run}
+	list.Flags().IntP("limit", "n", 100, "")
+	list.Flags().Int("offset", 0, "")
+	list.Flags().StringP("filter", "f", "", "")
+	list.Flags().String("debug-dump", "", "")
+	_ = list.Flags().MarkHidden("debug-dump")
+	zone.AddCommand(
+		&cobra.Command{Use: "create <zone>", RunE: run},
+		&cobra.Command{Use: "delete <zone>", RunE: run},
+		&cobra.Command{Use: "status <zone>", RunE: run},
+		list,
+	)
+	root.AddCommand(zone)
+
+	rrset := &cobra.Command{Use: "rrset"}
+	upsert := &cobra.Command{Use: "upsert", RunE: run}
+	upsert.Flags().Uint32P("ttl", "t", 3600, "")
+	rrset.AddCommand(upsert, &cobra.Command{Use: "delete", RunE: run}, &cobra.Command{Use: "get", RunE: run})
+	root.AddCommand(rrset)
+
+	dnssec := &cobra.Command{Use: "dnssec"}
+	rollover := &cobra.Command{Use: "rollover <zone>", RunE: run, Annotations: map[string]string{PrivilegedAnnotation: "true"}}
+	rollover.Flags().Uint16("key", 0, "")
+	dnssec.AddCommand(&cobra.Command{Use: "status <zone>", RunE: run}, rollover)
+	root.AddCommand(dnssec)
+
+	return root
+}
+
+// testAllowlist builds an allowlist from testRoot
+func testAllowlist(t *testing.T, allowed []string) *Allowlist {
+	t.Helper()
+	a, err := NewAllowlist(testRoot(), allowed)
+	if err != nil {
+		t.Fatalf("NewAllowlist() error = %v", err)
+	}
+	return a
+}
+
+// TestNewAllowlist tests which commands are derived from the tree
+func TestNewAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "all runnable non-hidden commands",
+			want: []string{
+				"dnssec rollover", "dnssec status", "doctor", "rrset delete", "rrset get", "rrset upsert",
+				"version", "zone create", "zone delete", "zone list", "zone status",
+			},
+		},
+		{
+			name:    "restricted by config",
+			allowed: []string{"zone status", "rrset", "doctor"},
+			want:    []string{"doctor", "rrset delete", "rrset get", "rrset upsert", "zone status"},
+		},
+		{
+			name:    "extra whitespace in entry",
+			allowed: []string{"  zone   list "},
+			want:    []string{"zone list"},
+		},
+		{
+			name:    "unknown entry",
+			allowed: []string{"zone statsu"},
+			wantErr: true,
+		},
+		{
+			name:    "hidden command cannot be allowed",
+			allowed: []string{"secret"},
+			wantErr: true,
+		},
+		{
+			name:    "prefix of a command name is not a match",
+			allowed: []string{"zon"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewAllowlist(testRoot(), tt.allowed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewAllowlist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := strings.Join(a.Commands(), ","); got != strings.Join(tt.want, ",") {
+				t.Errorf("Commands() = %s, want %s", got, strings.Join(tt.want, ","))
+			}
+		})
+	}
+}
+
+// TestAllowlistValidate tests command and flag validation
+func TestAllowlistValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		parts   []string
+		wantErr bool
+		errMsg  string
+	}{
+		// Allowed commands
+		{name: "doctor", parts: []string{"doctor"}},
+		{name: "version", parts: []string{"version"}},
+		{name: "zone create", parts: []string{"zone", "create", "example.com"}},
+		{name: "alias", parts: []string{"zone", "ls"}},
+		{name: "rrset upsert", parts: []string{"rrset", "upsert", "example.com", "www", "A", "192.0.2.1"}},
+		{name: "long flag with value", parts: []string{"zone", "list", "--limit", "5"}},
+		{name: "long flag with inline value", parts: []string{"zone", "list", "--limit=5", "--offset=10"}},
+		{name: "shorthand flag", parts: []string{"rrset", "upsert", "-t", "60", "example.com", "www", "A", "192.0.2.1"}},
+		{name: "shorthand cluster with value", parts: []string{"zone", "list", "-vn5"}},
+		{name: "inherited verbose flag", parts: []string{"zone", "status", "--verbose", "example.com"}},
+		{name: "flag value looking like a flag", parts: []string{"zone", "list", "--filter", "--config"}},
+		{name: "everything after terminator is positional", parts: []string{"rrset", "upsert", "example.com", "www", "TXT", "--", "--config"}},
+
+		// Disallowed commands
+		{name: "unknown command", parts: []string{"unknown"}, wantErr: true, errMsg: "not allowed"},
+		{name: "shell command injection attempt", parts: []string{"bash", "-c", "rm -rf /"}, wantErr: true, errMsg: "not allowed"},
+		{name: "empty command parts", parts: []string{}, wantErr: true, errMsg: "empty"},
+		{name: "group without subcommand", parts: []string{"zone"}, wantErr: true, errMsg: "not allowed"},
+		{name: "hidden command", parts: []string{"secret"}, wantErr: true, errMsg: "not allowed"},
+		{name: "flag before command", parts: []string{"--config", "/tmp/evil.yaml", "zone", "list"}, wantErr: true, errMsg: "not allowed"},
+		{name: "restricted by config", allowed: []string{"zone status"}, parts: []string{"zone", "delete", "example.com"}, wantErr: true, errMsg: "not allowed"},
+
+		// Disallowed flags
+		{name: "config flag", parts: []string{"zone", "list", "--config", "/tmp/evil.yaml"}, wantErr: true, errMsg: "operator-only"},
+		{name: "config flag inline", parts: []string{"doctor", "--config=/tmp/evil.yaml"}, wantErr: true, errMsg: "operator-only"},
+		{name: "config shorthand", parts: []string{"doctor", "-c", "/tmp/evil.yaml"}, wantErr: true, errMsg: "operator-only"},
+		{name: "config shorthand in cluster", parts: []string{"doctor", "-vc/tmp/evil.yaml"}, wantErr: true, errMsg: "operator-only"},
+		{name: "ssh-wrap is a root-only flag", parts: []string{"doctor", "--ssh-wrap"}, wantErr: true, errMsg: "not allowed"},
+		{name: "flag of another command", parts: []string{"zone", "create", "--limit", "5", "example.com"}, wantErr: true, errMsg: "not allowed"},
+		{name: "hidden flag", parts: []string{"zone", "list", "--debug-dump", "x"}, wantErr: true, errMsg: "not allowed"},
+		{name: "unknown shorthand", parts: []string{"zone", "list", "-x"}, wantErr: true, errMsg: "not allowed"},
+		{name: "non-ASCII shorthand", parts: []string{"zone", "list", "-\xc3\xa9"}, wantErr: true, errMsg: "not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testAllowlist(t, tt.allowed).Validate(tt.parts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate(%q) error = %v, wantErr %v", tt.parts, err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Validate(%q) error = %v, want error containing %q", tt.parts, err, tt.errMsg)
+			}
+			var notAllowed *NotAllowedError
+			var parseErr *ParseError
+			if !errors.As(err, &notAllowed) && !errors.As(err, &parseErr) {
+				t.Errorf("Validate(%q) error = %T, want *NotAllowedError or *ParseError", tt.parts, err)
+			}
+		})
+	}
+}
+
+// TestAllowlistAuthorize tests that privileged commands are limited to the
+// privileged actors
+func TestAllowlistAuthorize(t *testing.T) {
+	a := testAllowlist(t, nil).WithPrivilegedActors([]string{"keyadmin"})
+
+	tests := []struct {
+		name    string
+		actor   string
+		parts   []string
+		wantErr bool
+	}{
+		{name: "unprivileged command", actor: "alice", parts: []string{"dnssec", "status", "example.com"}},
+		{name: "privileged actor", actor: "keyadmin", parts: []string{"dnssec", "rollover", "--key", "1", "example.com"}},
+		{name: "other actor", actor: "alice", parts: []string{"dnssec", "rollover", "--key", "1", "example.com"}, wantErr: true},
+		{name: "no actor", parts: []string{"dnssec", "rollover", "example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.Authorize(tt.actor, tt.parts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authorize(%q, %q) error = %v, wantErr %v", tt.actor, tt.parts, err, tt.wantErr)
+			}
+			var notAllowed *NotAllowedError
+			if tt.wantErr && !errors.As(err, &notAllowed) {
+				t.Errorf("Authorize() error = %T, want *NotAllowedError", err)
+			}
+		})
+	}
+
+	// Without privileged actors nobody may run them
+	if err := testAllowlist(t, nil).Authorize("keyadmin", []string{"dnssec", "rollover", "example.com"}); err == nil {
+		t.Error("Authorize() without privileged actors returned nil error")
+	}
+}
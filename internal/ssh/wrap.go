@@ -2,6 +2,7 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -9,9 +10,24 @@ import (
 	"github.com/dlukt/dnsctl/internal/audit"
 )
 
+// ErrNoCommand means sshd did not pass SSH_ORIGINAL_COMMAND
+var ErrNoCommand = errors.New("no SSH_ORIGINAL_COMMAND found")
+
+// NotAllowedError reports a subcommand or flag rejected by the SSH allowlist
+type NotAllowedError struct {
+	What string // e.g. "subcommand 'exec'"
+}
+
+// Error describes the rejected subcommand or flag
+func (e *NotAllowedError) Error() string {
+	return e.What + " is not allowed"
+}
+
 // WrapHandler handles SSH forced-command mode (--ssh-wrap)
 type WrapHandler struct {
-	logger *audit.Logger
+	logger    *audit.Logger
+	allowlist *Allowlist
+	actor     string
 }
 
 // NewWrapHandler creates a new SSH wrap handler
@@ -21,110 +37,174 @@ func NewWrapHandler(logger *audit.Logger) *WrapHandler {
 	}
 }
 
-// Allowed subcommands for SSH wrap mode
-var allowedSubcommands = map[string]bool{
-	"doctor": true,
-	"version": true,
-	"zone": true,
-	"rrset": true,
-	"acme": true,
+// WithAllowlist sets the allowlist commands are validated against
+func (h *WrapHandler) WithAllowlist(allowlist *Allowlist) *WrapHandler {
+	h.allowlist = allowlist
+	return h
 }
 
-// Allowed flags for each subcommand
-var allowedFlags = map[string]map[string]bool{
-	"zone": {
-		"create": true,
-		"delete": true,
-		"status": true,
-		"list": true,
-		"limit": true,
-	},
-	"rrset": {
-		"upsert": true,
-		"delete": true,
-		"get": true,
-		"ttl": true,
-	},
-	"acme": {
-		"present": true,
-		"cleanup": true,
-		"ttl": true,
-	},
-}
+// Dispatcher executes a validated command line, e.g. through the cobra command tree
+type Dispatcher func(args []string) error
 
-// Handle wraps the SSH command execution (spec 8.1, 17)
-func (h *WrapHandler) Handle() error {
+// Handle validates SSH_ORIGINAL_COMMAND and dispatches it (spec 8.1, 17)
+func (h *WrapHandler) Handle(dispatch Dispatcher) error {
 	// Get the original command from SSH environment
 	originalCmd := os.Getenv("SSH_ORIGINAL_COMMAND")
 	if originalCmd == "" {
-		return fmt.Errorf("no SSH_ORIGINAL_COMMAND found")
+		return ErrNoCommand
 	}
 
 	// Extract actor identity
-	actor := os.Getenv("USER")
+	h.actor = os.Getenv("USER")
 	// Could also map SSH key comment to actor here
 
-	h.logger.WithActor(actor)
+	h.logger.WithActor(h.actor)
 
 	// Parse the command
-	parts := strings.Fields(originalCmd)
-	if len(parts) == 0 {
-		return fmt.Errorf("empty command")
+	parts, err := ParseCommand(originalCmd)
+	if err != nil {
+		return err
 	}
-
-	// Validate subcommand
-	subcommand := parts[0]
-	if !allowedSubcommands[subcommand] {
-		return fmt.Errorf("subcommand '%s' is not allowed", subcommand)
+	// Validate against the allowlist
+	if h.allowlist == nil {
+		return &NotAllowedError{What: "SSH wrap mode without an allowlist"}
 	}
-
-	// Validate flags based on subcommand
-	for i := 1; i < len(parts); i++ {
-		part := parts[i]
-		if strings.HasPrefix(part, "-") {
-			flagName := strings.TrimPrefix(part, "-")
-			flagName = strings.TrimPrefix(flagName, "-")
-
-			// Check if flag is allowed for this subcommand
-			if allowed, ok := allowedFlags[subcommand]; ok {
-				if !allowed[flagName] {
-					return fmt.Errorf("flag '%s' is not allowed for subcommand '%s'", flagName, subcommand)
-				}
-			}
-		}
+	if err := h.allowlist.Validate(parts); err != nil {
+		return err
+	}
+	if err := h.allowlist.Authorize(h.actor, parts); err != nil {
+		return err
 	}
 
 	// Log the wrapped command
 	h.logger.Info(fmt.Sprintf("SSH wrapped command: %s", originalCmd))
 
 	// Execute the validated command
-	// In a real implementation, this would dispatch to the actual command handler
-	// For now, we just return success
-	return nil
+	return dispatch(parts)
+}
+
+// Actor returns the SSH actor identity determined by Handle
+func (h *WrapHandler) Actor() string {
+	return h.actor
+}
+
+// ParseError reports an SSH command line that cannot be split safely
+type ParseError struct {
+	Pos int    // Byte offset of the offending character
+	Msg string // Description of the problem
 }
 
-// ParseCommand parses a command string into components
+// Error describes the problem and its position
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid command at offset %d: %s", e.Pos, e.Msg)
+}
+
+// shellMetachars are characters a shell would interpret when unquoted.
+// Commands are never passed to a shell, so they are rejected rather than
+// silently taken literally.
+const shellMetachars = ";&|<>()`$\n\r"
+
+// ParseCommand splits a command string into words using POSIX shell quoting
+// rules: single quotes preserve everything literally, double quotes allow
+// backslash escapes of $ ` " \ and backslash outside quotes escapes any
+// character. Unquoted shell metacharacters, $ and ` inside double quotes,
+// and unterminated quotes are rejected.
 func ParseCommand(cmd string) ([]string, error) {
 	if cmd == "" {
-		return nil, fmt.Errorf("empty command")
+		return nil, &ParseError{Pos: 0, Msg: "empty command"}
 	}
 
-	// Simple parsing - split on whitespace
-	// A more robust implementation would handle quoted strings
-	parts := strings.Fields(cmd)
-	return parts, nil
-}
+	words := []string{}
+	var word strings.Builder
+	inWord := false
 
-// ValidateCommand validates a command against the allowlist
-func ValidateCommand(parts []string) error {
-	if len(parts) == 0 {
-		return fmt.Errorf("empty command")
+	for i := 0; i < len(cmd); i++ {
+		ch := cmd[i]
+
+		switch {
+		case ch == 0:
+			return nil, &ParseError{Pos: i, Msg: "NUL byte"}
+
+		case ch == ' ' || ch == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+
+		case ch == '\\':
+			if i+1 >= len(cmd) {
+				return nil, &ParseError{Pos: i, Msg: "trailing backslash"}
+			}
+			i++
+			if cmd[i] == 0 {
+				return nil, &ParseError{Pos: i, Msg: "NUL byte"}
+			}
+			word.WriteByte(cmd[i])
+			inWord = true
+
+		case ch == '\'':
+			end := strings.IndexByte(cmd[i+1:], '\'')
+			if end < 0 {
+				return nil, &ParseError{Pos: i, Msg: "unterminated single quote"}
+			}
+			quoted := cmd[i+1 : i+1+end]
+			if j := strings.IndexByte(quoted, 0); j >= 0 {
+				return nil, &ParseError{Pos: i + 1 + j, Msg: "NUL byte"}
+			}
+			word.WriteString(quoted)
+			i += end + 1
+			inWord = true
+
+		case ch == '"':
+			next, err := parseDoubleQuoted(cmd, i+1, &word)
+			if err != nil {
+				return nil, err
+			}
+			i = next
+			inWord = true
+
+		case strings.IndexByte(shellMetachars, ch) >= 0:
+			return nil, &ParseError{Pos: i, Msg: fmt.Sprintf("shell metacharacter %q is not allowed", ch)}
+
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+
+	if inWord {
+		words = append(words, word.String())
 	}
 
-	subcommand := parts[0]
-	if !allowedSubcommands[subcommand] {
-		return fmt.Errorf("subcommand '%s' is not allowed", subcommand)
+	return words, nil
+}
+
+// parseDoubleQuoted consumes a double-quoted string starting after the
+// opening quote and returns the offset of the closing quote
+func parseDoubleQuoted(cmd string, start int, word *strings.Builder) (int, error) {
+	for i := start; i < len(cmd); i++ {
+		ch := cmd[i]
+
+		switch ch {
+		case '"':
+			return i, nil
+		case 0:
+			return 0, &ParseError{Pos: i, Msg: "NUL byte"}
+		case '$', '`':
+			return 0, &ParseError{Pos: i, Msg: fmt.Sprintf("shell metacharacter %q is not allowed", ch)}
+		case '\\':
+			// Inside double quotes a backslash only escapes $ ` " \
+			if i+1 < len(cmd) && strings.IndexByte("$`\"\\", cmd[i+1]) >= 0 {
+				i++
+				word.WriteByte(cmd[i])
+				continue
+			}
+			word.WriteByte(ch)
+		default:
+			word.WriteByte(ch)
+		}
 	}
 
-	return nil
+	return 0, &ParseError{Pos: start - 1, Msg: "unterminated double quote"}
 }
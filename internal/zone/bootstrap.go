@@ -0,0 +1,189 @@
+package zone
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// CatalogInitializer creates the catalog zones themselves
+type CatalogInitializer struct {
+	cfg    *config.Config
+	views  []viewRNDC
+	update *update.Client
+}
+
+// NewCatalogInitializer creates a new catalog initializer
+func NewCatalogInitializer(cfg *config.Config) *CatalogInitializer {
+	return &CatalogInitializer{
+		cfg:   cfg,
+		views: newViewRNDCs(cfg),
+		update: update.NewClient(
+			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
+			cfg.TSIG.Name,
+			cfg.TSIG.Secret,
+			cfg.TSIG.Algorithm,
+		),
+	}
+}
+
+// InitCatalogs creates the catalog zone named by name (a catalog name or
+// zone), or every configured catalog zone if name is empty. Catalog zones
+// that named already serves are left as they are, apart from adding a
+// missing version record, so running it again is safe.
+func (i *CatalogInitializer) InitCatalogs(name string, changes *[]string) error {
+	catalogs := i.cfg.Catalogs()
+	if name != "" {
+		catalog, err := i.cfg.FindCatalog(name)
+		if err != nil {
+			return &OptionError{Option: "catalog", Err: err}
+		}
+		catalogs = []config.Catalog{catalog}
+	}
+
+	if err := i.cfg.EnsureDirs(); err != nil {
+		return fmt.Errorf("failed to ensure directories: %w", err)
+	}
+
+	for _, catalog := range catalogs {
+		if err := i.initCatalog(catalog, changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initCatalog creates one catalog zone in the first view, the one dnsctl
+// sends its catalog updates to, and checks that named serves it
+func (i *CatalogInitializer) initCatalog(catalog config.Catalog, changes *[]string) error {
+	catalogLock, err := lockCatalog(i.cfg, catalog.Zone, true)
+	if err != nil {
+		return err
+	}
+	defer catalogLock.Release()
+
+	v := i.views[0]
+	zoneFilePath := i.cfg.ZoneFilePathInView(catalog.Zone, v.view)
+	qualify := func(change string) string {
+		return change + ":" + trimDot(catalog.Zone)
+	}
+
+	exists, _, err := v.rndc.ZoneStatus(catalog.Zone)
+	if err != nil {
+		return fmt.Errorf("failed to check catalog zone %s: %w", catalog.Zone, err)
+	}
+	if exists {
+		*changes = append(*changes, qualify("catalog_zone_already_exists"))
+		return i.ensureVersion(catalog, changes)
+	}
+
+	data := CatalogZoneFileData(catalog.Zone, catalog.SchemaVersion, catalog.TTL)
+	if err := WriteZoneFile(zoneFilePath, data, i.cfg.Zones.FileOwner, i.cfg.Zones.FileGroup); err != nil {
+		return fmt.Errorf("failed to write catalog zone file: %w", err)
+	}
+	*changes = append(*changes, qualify("catalog_zone_file_created"))
+
+	if err := v.rndc.AddZone(catalog.Zone, i.buildCatalogZoneConfig(zoneFilePath)); err != nil {
+		_ = RemoveZoneFile(zoneFilePath)
+		return fmt.Errorf("failed to add catalog zone via RNDC: %w", err)
+	}
+	*changes = append(*changes, qualify("catalog_zone_added"))
+
+	// A catalog zone named does not answer for is of no use; take it out
+	// again so the next run starts afresh
+	if err := i.verify(catalog); err != nil {
+		_ = v.rndc.DelZone(catalog.Zone, true)
+		_ = RemoveZoneFile(zoneFilePath)
+		return err
+	}
+	return nil
+}
+
+// ensureVersion adds the version record to an existing catalog zone that
+// lacks it. A version other than the configured one is an error: changing
+// the schema of a live catalog is not something to do in passing.
+func (i *CatalogInitializer) ensureVersion(catalog config.Catalog, changes *[]string) error {
+	version, err := catalogVersion(i.update, catalog.Zone)
+	if err != nil {
+		return err
+	}
+	want := strconv.Itoa(catalog.SchemaVersion)
+	switch version {
+	case want:
+		return nil
+	case "":
+	default:
+		return fmt.Errorf("catalog zone %s has schema version %s, config expects %s", catalog.Zone, version, want)
+	}
+
+	owner := "version." + catalog.Zone
+	msg := new(dns.Msg)
+	msg.SetUpdate(catalog.Zone)
+	msg.NameNotUsed([]dns.RR{&dns.RR_Header{Name: owner}})
+	msg.Insert([]dns.RR{&dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   owner,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    catalog.TTL,
+		},
+		Txt: []string{want},
+	}})
+	if _, err := i.update.Update(msg); err != nil {
+		return fmt.Errorf("failed to add version to %s: %w", catalog.Zone, err)
+	}
+	*changes = append(*changes, "catalog_version_added:"+trimDot(catalog.Zone))
+	return nil
+}
+
+// verify checks that named answers for a new catalog zone with its SOA and
+// the configured version
+func (i *CatalogInitializer) verify(catalog config.Catalog) error {
+	if _, err := querySOA(i.update, catalog.Zone); err != nil {
+		return fmt.Errorf("catalog zone %s was added but does not answer: %w", catalog.Zone, err)
+	}
+	version, err := catalogVersion(i.update, catalog.Zone)
+	if err != nil {
+		return err
+	}
+	if want := strconv.Itoa(catalog.SchemaVersion); version != want {
+		return fmt.Errorf("catalog zone %s was added but serves version %q, expected %q", catalog.Zone, version, want)
+	}
+	return nil
+}
+
+// catalogVersion returns the version TXT value of a catalog zone, or "" if
+// it has none
+func catalogVersion(client *update.Client, catalogZone string) (string, error) {
+	owner := "version." + catalogZone
+	response, err := client.Query(owner, dns.TypeTXT)
+	if err != nil {
+		return "", fmt.Errorf("failed to query %s: %w", owner, err)
+	}
+	for _, rr := range response.Answer {
+		if txt, ok := rr.(*dns.TXT); ok {
+			return strings.Join(txt.Txt, ""), nil
+		}
+	}
+	return "", nil
+}
+
+// buildCatalogZoneConfig builds the RNDC addzone configuration stanza of a
+// catalog zone. Only the TSIG key dnsctl signs its updates with may change
+// it; catalog zones are never signed.
+func (i *CatalogInitializer) buildCatalogZoneConfig(zoneFilePath string) string {
+	var config strings.Builder
+
+	config.WriteString("{\n")
+	config.WriteString("type primary;\n")
+	config.WriteString(fmt.Sprintf("file \"%s\";\n", zoneFilePath))
+	config.WriteString("notify yes;\n")
+	config.WriteString(fmt.Sprintf("update-policy { grant %s zonesub ANY; };\n", dns.Fqdn(i.cfg.TSIG.Name)))
+	config.WriteString("};")
+
+	return config.String()
+}
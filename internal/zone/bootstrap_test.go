@@ -0,0 +1,208 @@
+package zone
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// TestInitCatalogs tests creating a catalog zone from scratch
+func TestInitCatalogs(t *testing.T) {
+	// The server stands in for named once the zone has been added
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	initializer := &CatalogInitializer{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := initializer.InitCatalogs("", &changes); err != nil {
+		t.Fatalf("InitCatalogs() error = %v", err)
+	}
+
+	wantChanges := []string{
+		"catalog_zone_file_created:catalog.example",
+		"catalog_zone_added:catalog.example",
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes = %v, want %v", changes, wantChanges)
+	}
+	if !reflect.DeepEqual(calls, []string{"addzone catalog.example."}) {
+		t.Errorf("rndc calls = %v", calls)
+	}
+	if !rndc.zones["catalog.example."] {
+		t.Error("catalog zone was not added")
+	}
+
+	content, err := os.ReadFile(initializer.cfg.ZoneFilePathInView("catalog.example.", ""))
+	if err != nil {
+		t.Fatalf("catalog zone file: %v", err)
+	}
+	parser := dns.NewZoneParser(strings.NewReader(string(content)), "", "")
+	found := map[string]string{}
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		found[dns.TypeToString[rr.Header().Rrtype]+" "+rr.Header().Name] = strings.TrimPrefix(rr.String(), rr.Header().String())
+		if rr.Header().Ttl != initializer.cfg.Catalog.TTL {
+			t.Errorf("%s TTL = %d, want %d", rr.Header().Name, rr.Header().Ttl, initializer.cfg.Catalog.TTL)
+		}
+	}
+	if err := parser.Err(); err != nil {
+		t.Fatalf("catalog zone file does not parse: %v", err)
+	}
+	if !strings.HasPrefix(found["SOA catalog.example."], "invalid. invalid. ") {
+		t.Errorf("SOA = %q, want invalid. invalid.", found["SOA catalog.example."])
+	}
+	if found["NS catalog.example."] != "invalid." {
+		t.Errorf("NS = %q, want invalid.", found["NS catalog.example."])
+	}
+	if found["TXT version.catalog.example."] != `"2"` {
+		t.Errorf("version = %q, want \"2\"", found["TXT version.catalog.example."])
+	}
+}
+
+// TestInitCatalogsExisting tests that an existing catalog zone is left alone
+func TestInitCatalogsExisting(t *testing.T) {
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	initializer := &CatalogInitializer{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+	rndc.zones["catalog.example."] = true
+
+	var changes []string
+	if err := initializer.InitCatalogs("default", &changes); err != nil {
+		t.Fatalf("InitCatalogs() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(changes, []string{"catalog_zone_already_exists:catalog.example"}) {
+		t.Errorf("changes = %v", changes)
+	}
+	if len(calls) != 0 || len(server.Updates()) != 0 {
+		t.Errorf("existing catalog was changed: rndc %v, %d updates", calls, len(server.Updates()))
+	}
+	if ZoneFileExists(initializer.cfg.ZoneFilePathInView("catalog.example.", "")) {
+		t.Error("zone file written for an existing catalog")
+	}
+}
+
+// TestInitCatalogsVersion tests the version record of an existing catalog zone
+func TestInitCatalogsVersion(t *testing.T) {
+	soa := catalogRecords("1")[:2]
+
+	t.Run("missing version is added", func(t *testing.T) {
+		server := dnstest.NewServer(t, soa...)
+		var calls []string
+		rndc := newFakeRNDC("", &calls)
+		initializer := &CatalogInitializer{
+			cfg:    viewTestConfig(t),
+			views:  []viewRNDC{{view: "", rndc: rndc}},
+			update: update.NewClient(server.Addr, "", "", ""),
+		}
+		rndc.zones["catalog.example."] = true
+
+		var changes []string
+		if err := initializer.InitCatalogs("", &changes); err != nil {
+			t.Fatalf("InitCatalogs() error = %v", err)
+		}
+		if changes[len(changes)-1] != "catalog_version_added:catalog.example" {
+			t.Errorf("changes = %v", changes)
+		}
+		updates := server.Updates()
+		if len(updates) != 1 || !strings.Contains(updates[0].Ns[0].String(), `"2"`) {
+			t.Errorf("updates = %v, want one adding version 2", updates)
+		}
+	})
+
+	t.Run("other version is refused", func(t *testing.T) {
+		server := dnstest.NewServer(t, append(soa, `version.catalog.example. 60 IN TXT "1"`)...)
+		var calls []string
+		rndc := newFakeRNDC("", &calls)
+		initializer := &CatalogInitializer{
+			cfg:    viewTestConfig(t),
+			views:  []viewRNDC{{view: "", rndc: rndc}},
+			update: update.NewClient(server.Addr, "", "", ""),
+		}
+		rndc.zones["catalog.example."] = true
+
+		var changes []string
+		err := initializer.InitCatalogs("", &changes)
+		if err == nil || !strings.Contains(err.Error(), "schema version 1") {
+			t.Errorf("InitCatalogs() error = %v, want a version mismatch", err)
+		}
+		if len(server.Updates()) != 0 {
+			t.Error("version of a live catalog was changed")
+		}
+	})
+}
+
+// TestInitCatalogsRollback tests that a catalog zone named does not answer
+// for is removed again
+func TestInitCatalogsRollback(t *testing.T) {
+	server := dnstest.NewServer(t)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	initializer := &CatalogInitializer{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := initializer.InitCatalogs("", &changes); err == nil {
+		t.Fatal("InitCatalogs() error = nil, want a verification failure")
+	}
+
+	want := []string{"addzone catalog.example.", "delzone catalog.example."}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("rndc calls = %v, want %v", calls, want)
+	}
+	if rndc.zones["catalog.example."] {
+		t.Error("catalog zone left in named")
+	}
+	if ZoneFileExists(initializer.cfg.ZoneFilePathInView("catalog.example.", "")) {
+		t.Error("catalog zone file left behind")
+	}
+}
+
+// TestInitCatalogsUnknown tests that an unknown catalog is an option error
+func TestInitCatalogsUnknown(t *testing.T) {
+	initializer := &CatalogInitializer{cfg: viewTestConfig(t)}
+
+	var changes []string
+	err := initializer.InitCatalogs("nonexistent", &changes)
+	if _, ok := err.(*OptionError); !ok {
+		t.Errorf("InitCatalogs() error = %v, want *OptionError", err)
+	}
+}
+
+// TestBuildCatalogZoneConfig tests the addzone stanza of a catalog zone
+func TestBuildCatalogZoneConfig(t *testing.T) {
+	cfg := viewTestConfig(t)
+	cfg.TSIG.Name = "dnsctl-updater"
+	initializer := &CatalogInitializer{cfg: cfg}
+	got := initializer.buildCatalogZoneConfig("/var/lib/dnsctl/zones/catalog.example.zone")
+
+	for _, want := range []string{
+		"type primary;",
+		`file "/var/lib/dnsctl/zones/catalog.example.zone";`,
+		"update-policy { grant dnsctl-updater. zonesub ANY; };",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("buildCatalogZoneConfig() = %q, missing %q", got, want)
+		}
+	}
+	if strings.Contains(got, "dnssec-policy") {
+		t.Errorf("buildCatalogZoneConfig() = %q, catalog zones are not signed", got)
+	}
+}
@@ -0,0 +1,417 @@
+package zone
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// CatalogMember is a member zone recorded in the catalog zone (RFC 9432)
+type CatalogMember struct {
+	Zone       string `json:"zone"`
+	Catalog    string `json:"catalog,omitempty"` // Catalog zone the member is in
+	Label      string `json:"label"`
+	LabelValid bool   `json:"label_valid"` // Label equals SHA1WireLabel(Zone) or was chosen freely
+
+	// Kind of a freely chosen label (random, uuid or custom)
+	LabelKind string `json:"label_kind,omitempty"`
+}
+
+// ParseCatalogMembers decodes the member PTR records at <label>.zones.<catalog>
+// from the records of a catalog zone. Other records (SOA, NS, version and
+// member properties) are ignored.
+func ParseCatalogMembers(catalogZone string, rrs []dns.RR) []CatalogMember {
+	suffix := ".zones." + dns.CanonicalName(catalogZone)
+
+	// Freely chosen labels are recorded as label.ext.<label> properties
+	labelKinds := make(map[string]string)
+	for _, rr := range rrs {
+		if txt, ok := rr.(*dns.TXT); ok {
+			name := strings.TrimSuffix(dns.CanonicalName(txt.Hdr.Name), suffix)
+			if label, found := strings.CutPrefix(name, labelProperty+"."); found && !strings.Contains(label, ".") {
+				labelKinds[label] = strings.Join(txt.Txt, "")
+			}
+		}
+	}
+
+	var members []CatalogMember
+	for _, rr := range rrs {
+		ptr, ok := rr.(*dns.PTR)
+		if !ok {
+			continue
+		}
+
+		owner := dns.CanonicalName(ptr.Hdr.Name)
+		if !strings.HasSuffix(owner, suffix) {
+			continue
+		}
+
+		// Member PTRs sit exactly one label below zones.<catalog>; deeper
+		// names such as coo.<label>.zones.<catalog> are properties
+		label := strings.TrimSuffix(owner, suffix)
+		if label == "" || strings.Contains(label, ".") {
+			continue
+		}
+
+		member := dns.CanonicalName(ptr.Ptr)
+		members = append(members, CatalogMember{
+			Zone:       member,
+			Label:      label,
+			LabelValid: label == SHA1WireLabel(member) || labelKinds[label] != "",
+			LabelKind:  labelKinds[label],
+		})
+	}
+
+	return members
+}
+
+// ListOptions controls filtering, sorting and pagination of zone list
+type ListOptions struct {
+	Catalog string // Catalog name or zone; empty lists every catalog
+	Filter  string // Glob pattern matched against the zone name (path.Match syntax)
+	Sort    string // "name" (default) or "label"
+	Offset  int    // Number of matching zones to skip
+	Limit   int    // Maximum number of zones to return (0 means no limit)
+}
+
+// ListResult is one page of catalog members
+type ListResult struct {
+	Zones  []CatalogMember `json:"zones"`
+	Count  int             `json:"count"`  // Zones in this page
+	Total  int             `json:"total"`  // Zones matching the filter
+	Offset int             `json:"offset"` // Offset of this page
+	Limit  int             `json:"limit"`  // Requested page size
+}
+
+// Lister enumerates member zones from the catalog zone
+type Lister struct {
+	cfg    *config.Config
+	update *update.Client
+}
+
+// NewLister creates a new zone lister
+func NewLister(cfg *config.Config) *Lister {
+	return &Lister{
+		cfg: cfg,
+		update: update.NewClient(
+			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
+			cfg.TSIG.Name,
+			cfg.TSIG.Secret,
+			cfg.TSIG.Algorithm,
+		),
+	}
+}
+
+// CatalogMembers transfers every catalog zone and returns all of their
+// members
+func (l *Lister) CatalogMembers() ([]CatalogMember, error) {
+	var members []CatalogMember
+	for _, catalog := range l.cfg.Catalogs() {
+		found, err := l.catalogMembers(catalog.Zone)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, found...)
+	}
+	return members, nil
+}
+
+// catalogMembers transfers one catalog zone and returns its members
+func (l *Lister) catalogMembers(catalogZone string) ([]CatalogMember, error) {
+	rrs, err := l.update.Transfer(catalogZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer catalog zone %s: %w", catalogZone, err)
+	}
+
+	members := ParseCatalogMembers(catalogZone, rrs)
+	for i := range members {
+		members[i].Catalog = catalogZone
+	}
+	return members, nil
+}
+
+// ListZones lists catalog member zones (spec 11.6)
+func (l *Lister) ListZones(opts ListOptions) (*ListResult, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var members []CatalogMember
+	var err error
+	if opts.Catalog != "" {
+		catalog, findErr := l.cfg.FindCatalog(opts.Catalog)
+		if findErr != nil {
+			return nil, &OptionError{Option: "catalog", Err: findErr}
+		}
+		members, err = l.catalogMembers(catalog.Zone)
+	} else {
+		members, err = l.CatalogMembers()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return PageMembers(members, opts), nil
+}
+
+// validate checks list options before any network traffic
+func (o ListOptions) validate() error {
+	if o.Filter != "" {
+		if _, err := path.Match(o.Filter, ""); err != nil {
+			return &OptionError{Option: "filter", Err: err}
+		}
+	}
+	if o.Sort != "" && o.Sort != "name" && o.Sort != "label" {
+		return &OptionError{Option: "sort", Err: fmt.Errorf("must be 'name' or 'label', got %q", o.Sort)}
+	}
+	if o.Offset < 0 {
+		return &OptionError{Option: "offset", Err: fmt.Errorf("must be non-negative")}
+	}
+	if o.Limit < 0 {
+		return &OptionError{Option: "limit", Err: fmt.Errorf("must be non-negative")}
+	}
+	return nil
+}
+
+// PageMembers filters, sorts and paginates catalog members
+func PageMembers(members []CatalogMember, opts ListOptions) *ListResult {
+	matched := make([]CatalogMember, 0, len(members))
+	for _, m := range members {
+		if opts.Filter == "" || matchZone(opts.Filter, m.Zone) {
+			matched = append(matched, m)
+		}
+	}
+
+	switch opts.Sort {
+	case "label":
+		sort.Slice(matched, func(i, j int) bool {
+			if matched[i].Label != matched[j].Label {
+				return matched[i].Label < matched[j].Label
+			}
+			return matched[i].Zone < matched[j].Zone
+		})
+	default:
+		sort.Slice(matched, func(i, j int) bool {
+			if matched[i].Zone != matched[j].Zone {
+				return matched[i].Zone < matched[j].Zone
+			}
+			return matched[i].Label < matched[j].Label
+		})
+	}
+
+	result := &ListResult{
+		Zones:  []CatalogMember{},
+		Total:  len(matched),
+		Offset: opts.Offset,
+		Limit:  opts.Limit,
+	}
+
+	if opts.Offset < len(matched) {
+		page := matched[opts.Offset:]
+		if opts.Limit > 0 && len(page) > opts.Limit {
+			page = page[:opts.Limit]
+		}
+		result.Zones = page
+	}
+	result.Count = len(result.Zones)
+
+	return result
+}
+
+// matchZone matches a glob pattern against a zone name. Patterns without a
+// trailing dot match the name without its trailing dot.
+func matchZone(pattern, zone string) bool {
+	if !strings.HasSuffix(pattern, ".") {
+		zone = strings.TrimSuffix(zone, ".")
+	}
+	ok, _ := path.Match(strings.ToLower(pattern), zone)
+	return ok
+}
+
+// catalogEntry is a member label with every PTR and property below it
+type catalogEntry struct {
+	label       string
+	zones       []string // PTR targets, sorted
+	properties  []string // Owner names of member properties
+	propertyRRs []dns.RR // Member property records
+	labelKind   string   // Kind of a freely chosen label, from the label.ext property
+}
+
+// catalogEntries groups the member PTRs and properties of a catalog zone by
+// member label, in label order
+func catalogEntries(catalogZone string, rrs []dns.RR) []catalogEntry {
+	suffix := ".zones." + dns.CanonicalName(catalogZone)
+	byLabel := make(map[string]*catalogEntry)
+	entry := func(label string) *catalogEntry {
+		if byLabel[label] == nil {
+			byLabel[label] = &catalogEntry{label: label}
+		}
+		return byLabel[label]
+	}
+
+	for _, rr := range rrs {
+		owner := dns.CanonicalName(rr.Header().Name)
+		if !strings.HasSuffix(owner, suffix) {
+			continue
+		}
+		name := strings.TrimSuffix(owner, suffix)
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			// A property such as group.<label>.zones.<catalog>
+			e := entry(name[i+1:])
+			if !contains(e.properties, owner) {
+				e.properties = append(e.properties, owner)
+			}
+			e.propertyRRs = append(e.propertyRRs, rr)
+			if txt, ok := rr.(*dns.TXT); ok && name[:i] == labelProperty {
+				e.labelKind = strings.Join(txt.Txt, "")
+			}
+			continue
+		}
+		if ptr, ok := rr.(*dns.PTR); ok && name != "" {
+			e := entry(name)
+			if member := dns.CanonicalName(ptr.Ptr); !contains(e.zones, member) {
+				e.zones = append(e.zones, member)
+			}
+		}
+	}
+
+	var entries []catalogEntry
+	for _, e := range byLabel {
+		// Properties without a member PTR are left alone
+		if len(e.zones) == 0 {
+			continue
+		}
+		sort.Strings(e.zones)
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].label < entries[j].label })
+
+	return entries
+}
+
+// catalogMembership is a catalog a zone is a member of
+type catalogMembership struct {
+	catalog config.Catalog
+	entries []catalogEntry // Every entry of the catalog
+	current []catalogEntry // Entries with a PTR to the zone
+}
+
+// transferEntries transfers a catalog zone and returns its entries
+func transferEntries(client *update.Client, catalogZone string) ([]catalogEntry, error) {
+	rrs, err := client.Transfer(catalogZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer catalog zone %s: %w", catalogZone, err)
+	}
+	return catalogEntries(catalogZone, rrs), nil
+}
+
+// findMemberships transfers every catalog zone and returns the ones the
+// zone is a member of, in config order
+func findMemberships(client *update.Client, cfg *config.Config, zone string) ([]catalogMembership, error) {
+	var memberships []catalogMembership
+	for _, catalog := range cfg.Catalogs() {
+		entries, err := transferEntries(client, catalog.Zone)
+		if err != nil {
+			return nil, err
+		}
+		if current := memberEntries(entries, zone); len(current) > 0 {
+			memberships = append(memberships, catalogMembership{catalog: catalog, entries: entries, current: current})
+		}
+	}
+	return memberships, nil
+}
+
+// lockCatalog acquires a catalog zone's lock. Member changes share it;
+// whole-catalog maintenance such as reconcile takes it exclusively.
+func lockCatalog(cfg *config.Config, catalogZone string, exclusive bool) (*lock.Lock, error) {
+	catalogLock := lock.NewReadOnly(cfg.CatalogLockFilePath(catalogZone))
+	if exclusive {
+		catalogLock = lock.New(cfg.CatalogLockFilePath(catalogZone))
+	}
+	if err := catalogLock.Acquire(); err != nil {
+		return nil, fmt.Errorf("failed to acquire catalog lock for %s: %w", catalogZone, err)
+	}
+	return catalogLock, nil
+}
+
+// memberEntries returns the entries with a PTR to zone
+func memberEntries(entries []catalogEntry, zone string) []catalogEntry {
+	var found []catalogEntry
+	for _, e := range entries {
+		if contains(e.zones, dns.CanonicalName(zone)) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// lookupMemberLabel returns the catalog label of a zone, or "" if the zone
+// is not a member. The sha1-wire label is queried first; only a zone with a
+// freely chosen label needs a transfer of the catalog.
+func lookupMemberLabel(client *update.Client, catalogZone, zone string) (string, error) {
+	label := SHA1WireLabel(zone)
+	response, err := client.Query(memberOwner(catalogZone, label), dns.TypePTR)
+	if err != nil {
+		return "", fmt.Errorf("failed to query catalog: %w", err)
+	}
+	for _, rr := range response.Answer {
+		if ptr, ok := rr.(*dns.PTR); ok && dns.CanonicalName(ptr.Ptr) == dns.CanonicalName(zone) {
+			return label, nil
+		}
+	}
+
+	rrs, err := client.Transfer(catalogZone)
+	if err != nil {
+		return "", fmt.Errorf("failed to transfer catalog zone: %w", err)
+	}
+	if found := memberEntries(catalogEntries(catalogZone, rrs), zone); len(found) > 0 {
+		return found[0].label, nil
+	}
+	return "", nil
+}
+
+// memberOwner returns the owner name of the member PTR at label
+func memberOwner(catalogZone, label string) string {
+	return fmt.Sprintf("%s.zones.%s", label, dns.Fqdn(catalogZone))
+}
+
+// memberPTR returns the catalog PTR for zone at label
+func memberPTR(catalogZone, label, zone string, ttl uint32) *dns.PTR {
+	return &dns.PTR{
+		Hdr: dns.RR_Header{
+			Name:   memberOwner(catalogZone, label),
+			Rrtype: dns.TypePTR,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Ptr: dns.Fqdn(zone),
+	}
+}
+
+// removeMember adds the removal of an entry's PTRs and properties to an update
+func removeMember(msg *dns.Msg, catalogZone string, entry catalogEntry) {
+	msg.RemoveRRset([]dns.RR{&dns.RR_Header{
+		Name:   memberOwner(catalogZone, entry.label),
+		Rrtype: dns.TypePTR,
+		Class:  dns.ClassANY,
+	}})
+	for _, owner := range entry.properties {
+		msg.RemoveName([]dns.RR{&dns.RR_Header{Name: owner}})
+	}
+}
+
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+package zone
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// catalogRRs builds catalog zone records from zone file lines
+func catalogRRs(t *testing.T, lines ...string) []dns.RR {
+	t.Helper()
+	var rrs []dns.RR
+	for _, line := range lines {
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			t.Fatalf("dns.NewRR(%q) error = %v", line, err)
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+// TestParseCatalogMembers tests decoding of member PTR records
+func TestParseCatalogMembers(t *testing.T) {
+	exampleLabel := SHA1WireLabel("example.com.")
+	orgLabel := SHA1WireLabel("example.org.")
+
+	rrs := catalogRRs(t,
+		"catalog.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+		"catalog.example. 60 IN NS invalid.",
+		`version.catalog.example. 60 IN TXT "2"`,
+		exampleLabel+".zones.catalog.example. 60 IN PTR example.com.",
+		orgLabel+".ZONES.Catalog.Example. 60 IN PTR Example.ORG.",
+		"custom.zones.catalog.example. 60 IN PTR example.net.",
+		"chosen.zones.catalog.example. 60 IN PTR example.info.",
+		`label.ext.chosen.zones.catalog.example. 60 IN TXT "uuid"`,
+		"coo."+exampleLabel+".zones.catalog.example. 60 IN PTR other-catalog.example.",
+		`group.`+exampleLabel+`.zones.catalog.example. 60 IN TXT "blue"`,
+		"zones.catalog.example. 60 IN PTR stray.example.",
+		"x.zones.other.example. 60 IN PTR foreign.example.",
+	)
+
+	members := ParseCatalogMembers("catalog.example.", rrs)
+
+	want := []CatalogMember{
+		{Zone: "example.com.", Label: exampleLabel, LabelValid: true},
+		{Zone: "example.org.", Label: orgLabel, LabelValid: true},
+		{Zone: "example.net.", Label: "custom", LabelValid: false},
+		{Zone: "example.info.", Label: "chosen", LabelValid: true, LabelKind: "uuid"},
+	}
+
+	if len(members) != len(want) {
+		t.Fatalf("ParseCatalogMembers() = %v, want %v", members, want)
+	}
+	for i := range want {
+		if members[i] != want[i] {
+			t.Errorf("member[%d] = %+v, want %+v", i, members[i], want[i])
+		}
+	}
+}
+
+// TestPageMembers tests filtering, sorting and pagination
+func TestPageMembers(t *testing.T) {
+	members := []CatalogMember{
+		{Zone: "c.example.com.", Label: "1"},
+		{Zone: "a.example.com.", Label: "3"},
+		{Zone: "example.org.", Label: "2"},
+		{Zone: "b.example.com.", Label: "4"},
+	}
+
+	tests := []struct {
+		name      string
+		opts      ListOptions
+		wantZones []string
+		wantTotal int
+	}{
+		{
+			name:      "all sorted by name",
+			opts:      ListOptions{},
+			wantZones: []string{"a.example.com.", "b.example.com.", "c.example.com.", "example.org."},
+			wantTotal: 4,
+		},
+		{
+			name:      "sorted by label",
+			opts:      ListOptions{Sort: "label"},
+			wantZones: []string{"c.example.com.", "example.org.", "a.example.com.", "b.example.com."},
+			wantTotal: 4,
+		},
+		{
+			name:      "glob filter",
+			opts:      ListOptions{Filter: "*.example.com"},
+			wantZones: []string{"a.example.com.", "b.example.com.", "c.example.com."},
+			wantTotal: 3,
+		},
+		{
+			name:      "glob filter with trailing dot",
+			opts:      ListOptions{Filter: "*.ORG."},
+			wantZones: []string{"example.org."},
+			wantTotal: 1,
+		},
+		{
+			name:      "limit and offset",
+			opts:      ListOptions{Offset: 1, Limit: 2},
+			wantZones: []string{"b.example.com.", "c.example.com."},
+			wantTotal: 4,
+		},
+		{
+			name:      "offset past end",
+			opts:      ListOptions{Offset: 10, Limit: 2},
+			wantZones: []string{},
+			wantTotal: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PageMembers(members, tt.opts)
+			if got.Total != tt.wantTotal {
+				t.Errorf("Total = %d, want %d", got.Total, tt.wantTotal)
+			}
+			if got.Count != len(tt.wantZones) {
+				t.Errorf("Count = %d, want %d", got.Count, len(tt.wantZones))
+			}
+			if len(got.Zones) != len(tt.wantZones) {
+				t.Fatalf("Zones = %v, want %v", got.Zones, tt.wantZones)
+			}
+			for i, z := range tt.wantZones {
+				if got.Zones[i].Zone != z {
+					t.Errorf("Zones[%d] = %q, want %q", i, got.Zones[i].Zone, z)
+				}
+			}
+		})
+	}
+}
+
+// TestListOptionsValidate tests rejection of invalid list options
+func TestListOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		wantErr bool
+	}{
+		{"defaults", ListOptions{}, false},
+		{"valid filter and sort", ListOptions{Filter: "*.example.com", Sort: "label", Limit: 10}, false},
+		{"malformed glob", ListOptions{Filter: "[example"}, true},
+		{"unknown sort", ListOptions{Sort: "serial"}, true},
+		{"negative offset", ListOptions{Offset: -1}, true},
+		{"negative limit", ListOptions{Limit: -5}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var optErr *OptionError
+			if tt.wantErr && !errors.As(err, &optErr) {
+				t.Errorf("validate() error = %T, want *OptionError", err)
+			}
+		})
+	}
+}
+
+// TestCatalogEntries tests grouping catalog records by member label
+func TestCatalogEntries(t *testing.T) {
+	var rrs []dns.RR
+	for _, record := range []string{
+		"catalog.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+		"version.catalog.example. 60 IN TXT \"2\"",
+		"l1.zones.catalog.example. 60 IN PTR b.example.",
+		"l1.zones.catalog.example. 60 IN PTR a.example.",
+		"coo.l1.zones.catalog.example. 60 IN PTR other.catalog.",
+		"ext.foo.l1.zones.catalog.example. 60 IN TXT \"x\"",
+		"group.l2.zones.catalog.example. 60 IN TXT \"no member\"",
+		"l3.zones.catalog.example. 60 IN PTR c.example.",
+		"label.ext.l3.zones.catalog.example. 60 IN TXT \"uuid\"",
+	} {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rrs = append(rrs, rr)
+	}
+
+	got := catalogEntries("catalog.example.", rrs)
+	if len(got) != 2 {
+		t.Fatalf("catalogEntries() = %+v, want entries l1 and l3", got)
+	}
+
+	l1 := got[0]
+	if l1.label != "l1" || !reflect.DeepEqual(l1.zones, []string{"a.example.", "b.example."}) {
+		t.Errorf("entry = %+v, want l1 with a.example. and b.example.", l1)
+	}
+	wantProperties := []string{"coo.l1.zones.catalog.example.", "ext.foo.l1.zones.catalog.example."}
+	if !reflect.DeepEqual(l1.properties, wantProperties) || len(l1.propertyRRs) != 2 {
+		t.Errorf("properties = %v (%d records), want %v", l1.properties, len(l1.propertyRRs), wantProperties)
+	}
+	if l1.labelKind != "" {
+		t.Errorf("labelKind = %q, want none", l1.labelKind)
+	}
+
+	if l3 := got[1]; l3.label != "l3" || l3.labelKind != "uuid" {
+		t.Errorf("entry = %+v, want l3 with label kind uuid", l3)
+	}
+}
+
+// TestListZonesCatalogs tests listing the members of every catalog or of
+// one named catalog
+func TestListZonesCatalogs(t *testing.T) {
+	server := dnstest.NewServer(t, append(catalogRecords("1", "a.example."),
+		"customers.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+		SHA1WireLabel("b.example.")+".zones.customers.example. 60 IN PTR b.example.",
+	)...)
+
+	cfg := viewTestConfig(t)
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.example."}}
+	lister := &Lister{cfg: cfg, update: update.NewClient(server.Addr, "", "", "")}
+
+	all, err := lister.ListZones(ListOptions{})
+	if err != nil {
+		t.Fatalf("ListZones() error = %v", err)
+	}
+	if all.Total != 2 || all.Zones[0].Catalog != "catalog.example." || all.Zones[1].Catalog != "customers.example." {
+		t.Errorf("ListZones() = %+v, want a.example. and b.example. with their catalogs", all.Zones)
+	}
+
+	one, err := lister.ListZones(ListOptions{Catalog: "customers"})
+	if err != nil {
+		t.Fatalf("ListZones(customers) error = %v", err)
+	}
+	if one.Total != 1 || one.Zones[0].Zone != "b.example." {
+		t.Errorf("ListZones(customers) = %+v, want only b.example.", one.Zones)
+	}
+
+	var optErr *OptionError
+	if _, err := lister.ListZones(ListOptions{Catalog: "unknown"}); !errors.As(err, &optErr) {
+		t.Errorf("ListZones(unknown) error = %v, want *OptionError", err)
+	}
+}
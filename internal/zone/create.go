@@ -5,24 +5,75 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/dlukt/dnsctl/internal/bind"
 	"github.com/dlukt/dnsctl/internal/config"
-	"github.com/dlukt/dnsctl/internal/lock"
 	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
 )
 
 // Creator handles zone creation operations
 type Creator struct {
-	cfg       *config.Config
-	rndc      *bind.RNDCClient
-	update    *update.Client
+	cfg    *config.Config
+	views  []viewRNDC
+	update *update.Client
+}
+
+// CreateOptions controls how a zone is created
+type CreateOptions struct {
+	// Catalog to add a new member to, by name or zone. Empty selects it by
+	// the catalog.rules of the config. An existing member stays in its
+	// catalog; naming another one is refused.
+	Catalog string
+
+	// Catalog member label: sha1-wire, random, uuid or a literal label.
+	// Empty keeps the label of an existing member and uses sha1-wire for a
+	// new one. A different label for an existing member moves it, which
+	// makes the secondaries reset the zone.
+	Label string
+
+	// Schema v2 member properties: the group secondaries select a template
+	// by, and custom properties kept below the ext label
+	Group      string
+	Properties map[string]string
+
+	// dnssec-policy of a new zone: a policy defined in named.conf, one of
+	// named's built-in policies, or "none". Empty uses zones.dnssec_policy.
+	DNSSECPolicy string
+
+	// Delegate the zone from its closest enclosing zone that is a catalog
+	// member, as Delegator.Delegate does
+	Delegate bool
+}
+
+// propertyChange returns the member properties requested for the zone
+func (o CreateOptions) propertyChange() PropertyChange {
+	return PropertyChange{Group: o.Group, Set: o.Properties}
+}
+
+// validate checks the options for zone against the catalog schema version.
+// Like the member properties, a freely chosen label requires schema v2,
+// since it is recorded with the label.ext property.
+func (o CreateOptions) validate(zone string, schemaVersion int) error {
+	if err := o.propertyChange().validate(schemaVersion); err != nil {
+		return err
+	}
+	if schemaVersion >= 2 {
+		return nil
+	}
+	_, kind, err := ResolveMemberLabel(o.Label, zone)
+	if err != nil {
+		return err
+	}
+	if kind != "" {
+		return &OptionError{Option: "label", Err: fmt.Errorf("freely chosen member labels require catalog.schema_version 2")}
+	}
+	return nil
 }
 
 // NewCreator creates a new zone creator
 func NewCreator(cfg *config.Config) *Creator {
 	return &Creator{
-		cfg: cfg,
-		rndc: bind.NewRNDCClient(cfg.Bind.RNDCPath, cfg.Bind.RNDCConf, cfg.Bind.View),
+		cfg:   cfg,
+		views: newViewRNDCs(cfg),
 		update: update.NewClient(
 			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
 			cfg.TSIG.Name,
@@ -33,74 +84,137 @@ func NewCreator(cfg *config.Config) *Creator {
 }
 
 // CreateZone creates a new authoritative primary zone (spec 11.1)
-func (c *Creator) CreateZone(zoneInput string, changes *[]string) error {
+func (c *Creator) CreateZone(zoneInput string, opts CreateOptions, changes *[]string) error {
 	// Step 1: Normalize and validate zone
 	zone, err := NormalizeZone(zoneInput)
 	if err != nil {
 		return fmt.Errorf("invalid zone name: %w", err)
 	}
+	catalog, err := c.cfg.SelectCatalog(zone, opts.Catalog)
+	if err != nil {
+		return &OptionError{Option: "catalog", Err: err}
+	}
+	if err := opts.validate(zone, catalog.SchemaVersion); err != nil {
+		return err
+	}
+	policy := c.cfg.Zones.DNSSECPolicy
+	if opts.DNSSECPolicy != "" {
+		if err := ValidateDNSSECPolicy(c.cfg, opts.DNSSECPolicy); err != nil {
+			return err
+		}
+		policy = opts.DNSSECPolicy
+	}
 
-	// Step 2: Acquire zone lock
-	zoneLock := lock.New(c.cfg.LockFilePath(zone))
-	if err := zoneLock.Acquire(); err != nil {
-		return fmt.Errorf("failed to acquire zone lock: %w", err)
+	locked := []string{zone}
+	var parent string
+	if opts.Delegate {
+		if parent, err = managedParent(c.update, c.cfg, zone); err != nil {
+			return err
+		}
+		if parent == "" {
+			return fmt.Errorf("%s: %w", zone, ErrNoParent)
+		}
+		locked = append(locked, parent)
+	}
+
+	// Step 2: Acquire zone lock, and the parent's when delegating
+	release, err := lockZones(c.cfg, locked...)
+	if err != nil {
+		return err
 	}
-	defer zoneLock.Release()
+	defer release()
 
 	// Step 3: Ensure zones directory exists
 	if err := c.cfg.EnsureDirs(); err != nil {
 		return fmt.Errorf("failed to ensure directories: %w", err)
 	}
 
+	// Steps 4-8: Provision the zone in each view, rolling back the views
+	// added by this run if a later step fails
+	var added []viewRNDC
+	rollback := func() {
+		for _, v := range added {
+			_ = v.rndc.DelZone(zone, true)
+			_ = RemoveZoneFile(c.cfg.ZoneFilePathInView(zone, v.view))
+		}
+	}
+	for _, v := range c.views {
+		created, err := c.createInView(zone, v, policy, changes)
+		if err != nil {
+			rollback()
+			return err
+		}
+		if created {
+			added = append(added, v)
+		}
+	}
+
+	// Step 9: Add to catalog zone (once, whatever the number of views)
+	if err := c.ensureCatalogMembership(zone, catalog, opts, changes); err != nil {
+		rollback()
+		return fmt.Errorf("failed to update catalog zone: %w", err)
+	}
+
+	// Step 10: Delegate from the parent. The zone is complete without it,
+	// so a failure leaves it in place for zone delegate to retry.
+	if opts.Delegate {
+		if err := syncDelegation(c.update, parent, zone, changes); err != nil {
+			return fmt.Errorf("zone created, but not delegated: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createInView adds the zone to one view unless it already exists there.
+// It reports whether the zone was added.
+func (c *Creator) createInView(zone string, v viewRNDC, policy string, changes *[]string) (bool, error) {
 	// Step 4: Determine zone file path
-	zoneFilePath := c.cfg.ZoneFilePath(zone)
+	zoneFilePath := c.cfg.ZoneFilePathInView(zone, v.view)
 
 	// Step 5: Check if zone already exists
-	exists, _, err := c.rndc.ZoneStatus(zone)
+	exists, _, err := v.rndc.ZoneStatus(zone)
 	if err == nil && exists {
-		// Zone exists, ensure catalog membership
-		*changes = append(*changes, "zone_already_exists")
-		return c.ensureCatalogMembership(zone, changes)
+		*changes = append(*changes, viewChange("zone_already_exists", v.view))
+		return false, nil
 	}
 
 	// Step 6: Create stub zone file
 	zoneData := DefaultZoneFileData(zone)
 	if err := WriteZoneFile(zoneFilePath, zoneData, c.cfg.Zones.FileOwner, c.cfg.Zones.FileGroup); err != nil {
-		return fmt.Errorf("failed to write zone file: %w", err)
+		return false, fmt.Errorf("failed to write zone file: %w", err)
 	}
-	*changes = append(*changes, "zone_file_created")
+	*changes = append(*changes, viewChange("zone_file_created", v.view))
 
 	// Step 7: Build RNDC addzone config stanza
-	zoneConfig := c.buildZoneConfig(zoneFilePath)
+	zoneConfig := c.buildZoneConfig(zoneFilePath, policy)
 
 	// Step 8: Execute rndc addzone
-	if err := c.rndc.AddZone(zone, zoneConfig); err != nil {
+	if err := v.rndc.AddZone(zone, zoneConfig); err != nil {
 		// Clean up zone file on failure
 		_ = RemoveZoneFile(zoneFilePath)
-		return fmt.Errorf("failed to add zone via RNDC: %w", err)
+		return false, fmt.Errorf("failed to add zone via RNDC: %w", err)
 	}
-	*changes = append(*changes, "zone_added")
+	*changes = append(*changes, viewChange("zone_added", v.view))
 
-	// Step 9: Add to catalog zone
-	if err := c.ensureCatalogMembership(zone, changes); err != nil {
-		// Attempt to roll back
-		_ = c.rndc.DelZone(zone, true)
-		_ = RemoveZoneFile(zoneFilePath)
-		return fmt.Errorf("failed to update catalog zone: %w", err)
-	}
-
-	return nil
+	return true, nil
 }
 
-// buildZoneConfig builds the RNDC addzone configuration stanza (spec 11.1, step 7)
-func (c *Creator) buildZoneConfig(zoneFilePath string) string {
+// buildZoneConfig builds the RNDC addzone configuration stanza (spec 11.1, step 7).
+// Signed zones use inline signing as zones.inline_signing says.
+func (c *Creator) buildZoneConfig(zoneFilePath, policy string) string {
 	var config strings.Builder
 
+	config.WriteString("{\n")
 	config.WriteString("type primary;\n")
 	config.WriteString(fmt.Sprintf("file \"%s\";\n", zoneFilePath))
 	config.WriteString(fmt.Sprintf("notify %s;\n", boolToYesNo(c.cfg.Zones.DefaultNotify)))
-	config.WriteString(fmt.Sprintf("dnssec-policy %s;\n", c.cfg.Zones.DNSSECPolicy))
-	config.WriteString("inline-signing yes;\n")
+	if policy != "" {
+		config.WriteString(fmt.Sprintf("dnssec-policy %s;\n", policy))
+		if signingPolicy(policy) {
+			config.WriteString(fmt.Sprintf("inline-signing %s;\n", boolToYesNo(c.cfg.Zones.InlineSigning)))
+		}
+	}
 
 	// Add update permissions based on mode
 	if c.cfg.Zones.UpdateMode == "allow-update" {
@@ -110,32 +224,147 @@ func (c *Creator) buildZoneConfig(zoneFilePath string) string {
 		config.WriteString(fmt.Sprintf("update-policy { grant %s %s; };\n",
 			c.cfg.Zones.TSIGKeyName, c.cfg.Zones.UpdatePolicyGrant))
 	}
+	config.WriteString("};")
 
 	return config.String()
 }
 
-// ensureCatalogMembership ensures the zone is in the catalog zone (spec 11.3)
-func (c *Creator) ensureCatalogMembership(zone string, changes *[]string) error {
-	// Compute catalog member label
-	label := SHA1WireLabel(zone)
-
-	// Build the catalog update message
-	updateMsg, err := update.BuildPTRUpdate(
-		c.cfg.Catalog.Zone,
-		zone,
-		label,
-		60, // Catalog TTL
-	)
+// ensureCatalogMembership ensures the zone is in its catalog zone at the
+// requested label (spec 11.3), with the requested properties. A zone that is
+// already a member stays in the catalog it is in. A label that already
+// points to a different member is refused with *LabelConflictError. The
+// update's prerequisites make it fail if the catalog changed since it was
+// read.
+func (c *Creator) ensureCatalogMembership(zone string, catalog config.Catalog, opts CreateOptions, changes *[]string) error {
+	props := opts.propertyChange()
+
+	memberships, err := findMemberships(c.update, c.cfg, zone)
+	if err != nil {
+		return err
+	}
+	var entries, current []catalogEntry
+	for _, ms := range memberships {
+		if ms.catalog.Zone == catalog.Zone {
+			entries, current = ms.entries, ms.current
+		}
+	}
+	if current == nil && len(memberships) > 0 {
+		if opts.Catalog != "" {
+			return &OptionError{Option: "catalog", Err: fmt.Errorf("%s is a member of catalog %s; use zone move-catalog",
+				zone, memberships[0].catalog.Name)}
+		}
+		catalog, entries, current = memberships[0].catalog, memberships[0].entries, memberships[0].current
+		if err := opts.validate(zone, catalog.SchemaVersion); err != nil {
+			return err
+		}
+	}
+	if current == nil {
+		if entries, err = transferEntries(c.update, catalog.Zone); err != nil {
+			return err
+		}
+	}
+	catalogZone := catalog.Zone
+
+	catalogLock, err := lockCatalog(c.cfg, catalogZone, false)
+	if err != nil {
+		return err
+	}
+	defer catalogLock.Release()
+
+	// An existing member keeps its label unless another one is requested
+	if opts.Label == "" && len(current) > 0 {
+		return c.updateMemberProperties(zone, catalog, current[0].label, props, changes)
+	}
+
+	label, kind, err := ResolveMemberLabel(opts.Label, zone)
 	if err != nil {
-		return fmt.Errorf("failed to build catalog update: %w", err)
+		return err
+	}
+	if len(current) == 1 && current[0].label == label {
+		return c.updateMemberProperties(zone, catalog, label, props, changes)
+	}
+
+	// Refuse to take over a label that points to another member
+	for _, e := range entries {
+		if e.label != label {
+			continue
+		}
+		for _, member := range e.zones {
+			if member != zone {
+				return &LabelConflictError{Label: label, Zone: zone, Existing: member}
+			}
+		}
 	}
 
+	msg := new(dns.Msg)
+	msg.SetUpdate(catalogZone)
+	owner := dns.CanonicalName(memberOwner(catalogZone, label))
+	msg.NameNotUsed([]dns.RR{&dns.RR_Header{Name: owner}})
+
+	// Move the member: drop its old labels, carrying their properties over
+	// to the new label unless they are being changed
+	var insert []dns.RR
+	for _, e := range current {
+		oldOwner := dns.CanonicalName(memberOwner(catalogZone, e.label))
+		msg.Used([]dns.RR{memberPTR(catalogZone, e.label, zone, catalog.TTL)})
+		removeMember(msg, catalogZone, e)
+		for _, rr := range e.propertyRRs {
+			name := dns.CanonicalName(rr.Header().Name)
+			property := strings.TrimSuffix(name, "."+oldOwner)
+			if property == labelProperty || props.changedProperty(property) {
+				continue
+			}
+			moved := dns.Copy(rr)
+			moved.Header().Name = strings.TrimSuffix(name, oldOwner) + owner
+			insert = append(insert, moved)
+		}
+	}
+
+	insert = append([]dns.RR{memberPTR(catalogZone, label, zone, catalog.TTL)}, insert...)
+	if kind != "" {
+		insert = append(insert, &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   labelProperty + "." + owner,
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassINET,
+				Ttl:    catalog.TTL,
+			},
+			Txt: []string{kind},
+		})
+	}
+	msg.Insert(insert)
+	applyProperties(msg, catalogZone, label, props, catalog.TTL)
+
 	// Send the update
-	if _, err := c.update.Update(updateMsg); err != nil {
+	if _, err := c.update.Update(msg); err != nil {
 		return fmt.Errorf("failed to send catalog update: %w", err)
 	}
 
 	*changes = append(*changes, "catalog_updated")
+	if len(current) > 0 {
+		*changes = append(*changes, "catalog_member_reset")
+	}
+	*changes = append(*changes, propertyChanges(props)...)
+	return nil
+}
+
+// updateMemberProperties applies the requested properties to a zone that is
+// already a member at label
+func (c *Creator) updateMemberProperties(zone string, catalog config.Catalog, label string, props PropertyChange, changes *[]string) error {
+	*changes = append(*changes, "catalog_already_member")
+	if props.Empty() {
+		return nil
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(catalog.Zone)
+	msg.Used([]dns.RR{memberPTR(catalog.Zone, label, zone, catalog.TTL)})
+	applyProperties(msg, catalog.Zone, label, props, catalog.TTL)
+	if _, err := c.update.Update(msg); err != nil {
+		return fmt.Errorf("failed to send catalog update: %w", err)
+	}
+
+	*changes = append(*changes, propertyChanges(props)...)
 	return nil
 }
 
@@ -0,0 +1,455 @@
+package zone
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// TestCreateZoneLabelConflict tests that a label pointing to another member
+// is refused and the new zone rolled back
+func TestCreateZoneLabelConflict(t *testing.T) {
+	server := dnstest.NewServer(t, append(catalogRecords("1"),
+		"taken.zones.catalog.example. 60 IN PTR other.example.",
+	)...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	err := creator.CreateZone("example.com", CreateOptions{Label: "taken"}, &changes)
+	var conflict *LabelConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("CreateZone() error = %v, want *LabelConflictError", err)
+	}
+	if conflict.Existing != "other.example." || conflict.Zone != "example.com." {
+		t.Errorf("conflict = %+v", conflict)
+	}
+	if rndc.zones["example.com."] {
+		t.Error("zone left in named after the conflict")
+	}
+	if n := len(server.Updates()); n != 0 {
+		t.Errorf("sent %d updates, want none", n)
+	}
+}
+
+// TestCreateZoneCustomLabel tests that a freely chosen label is recorded
+func TestCreateZoneCustomLabel(t *testing.T) {
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := creator.CreateZone("example.com", CreateOptions{Label: "uuid"}, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+
+	updates := server.Updates()
+	if len(updates) != 1 {
+		t.Fatalf("sent %d updates, want 1", len(updates))
+	}
+	u := updates[0]
+
+	// The owner must be unused, and the PTR and label marker are added
+	if len(u.Answer) != 1 || u.Answer[0].Header().Class != dns.ClassNONE {
+		t.Errorf("prerequisites = %v, want the member owner to be unused", u.Answer)
+	}
+	if len(u.Ns) != 2 {
+		t.Fatalf("update section = %v, want PTR and label marker", u.Ns)
+	}
+	ptr, ok := u.Ns[0].(*dns.PTR)
+	if !ok || ptr.Ptr != "example.com." || strings.HasPrefix(ptr.Hdr.Name, SHA1WireLabel("example.com.")) {
+		t.Errorf("PTR = %v, want example.com. at a uuid label", u.Ns[0])
+	}
+	txt, ok := u.Ns[1].(*dns.TXT)
+	if !ok || txt.Hdr.Name != "label.ext."+ptr.Hdr.Name || txt.Txt[0] != LabelUUID {
+		t.Errorf("label marker = %v", u.Ns[1])
+	}
+}
+
+// TestCreateZoneCustomLabelSchemaV1 tests that a freely chosen label, which
+// needs the label.ext property, is refused for a schema v1 catalog
+func TestCreateZoneCustomLabelSchemaV1(t *testing.T) {
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+	creator.cfg.Catalog.SchemaVersion = 1
+
+	for _, label := range []string{"uuid", "chosen"} {
+		var changes []string
+		err := creator.CreateZone("example.com", CreateOptions{Label: label}, &changes)
+		var optionErr *OptionError
+		if !errors.As(err, &optionErr) || optionErr.Option != "label" {
+			t.Errorf("CreateZone(label %s) error = %v, want *OptionError for label", label, err)
+		}
+	}
+	if rndc.zones["example.com."] || len(server.Updates()) != 0 {
+		t.Fatal("zone created with a freely chosen label in a schema v1 catalog")
+	}
+
+	var changes []string
+	if err := creator.CreateZone("example.com", CreateOptions{Label: "sha1-wire"}, &changes); err != nil {
+		t.Errorf("CreateZone(label sha1-wire) error = %v", err)
+	}
+}
+
+// TestCreateZoneExistingMember tests that an existing member keeps its label
+// unless a new one is requested, and is moved with its properties otherwise
+func TestCreateZoneExistingMember(t *testing.T) {
+	server := dnstest.NewServer(t, append(catalogRecords("1"),
+		"old.zones.catalog.example. 60 IN PTR example.com.",
+		`label.ext.old.zones.catalog.example. 60 IN TXT "custom"`,
+		`group.old.zones.catalog.example. 60 IN TXT "blue"`,
+	)...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+	rndc.zones["example.com."] = true
+
+	var changes []string
+	if err := creator.CreateZone("example.com", CreateOptions{}, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+	if changes[len(changes)-1] != "catalog_already_member" || len(server.Updates()) != 0 {
+		t.Errorf("changes = %v, updates = %d, want the member left alone", changes, len(server.Updates()))
+	}
+
+	changes = nil
+	if err := creator.CreateZone("example.com", CreateOptions{Label: "sha1-wire"}, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+	if got := strings.Join(changes, " "); !strings.Contains(got, "catalog_member_reset") {
+		t.Errorf("changes = %v, want catalog_member_reset", changes)
+	}
+
+	updates := server.Updates()
+	if len(updates) != 1 {
+		t.Fatalf("sent %d updates, want 1", len(updates))
+	}
+	u := updates[0]
+
+	// Prerequisites: new owner unused, old PTR still in place
+	if len(u.Answer) != 2 {
+		t.Errorf("prerequisites = %v, want 2", u.Answer)
+	}
+
+	newOwner := SHA1WireLabel("example.com.") + ".zones.catalog.example."
+	var removed, added []string
+	for _, rr := range u.Ns {
+		if rr.Header().Class == dns.ClassINET {
+			added = append(added, rr.Header().Name)
+		} else {
+			removed = append(removed, rr.Header().Name)
+		}
+	}
+	sort.Strings(removed)
+	wantRemoved := "group.old.zones.catalog.example. label.ext.old.zones.catalog.example. old.zones.catalog.example."
+	if got := strings.Join(removed, " "); got != wantRemoved {
+		t.Errorf("removed = %s, want %s", got, wantRemoved)
+	}
+	// The group property moves, the label marker does not
+	wantAdded := newOwner + " group." + newOwner
+	if got := strings.Join(added, " "); got != wantAdded {
+		t.Errorf("added = %s, want %s", got, wantAdded)
+	}
+}
+
+// TestCreateZoneRelabelMixedCaseCatalog tests that moving a member of a
+// catalog configured in mixed case carries its properties to the new label
+func TestCreateZoneRelabelMixedCaseCatalog(t *testing.T) {
+	server := dnstest.NewServer(t, append(catalogRecords("1"),
+		"old.zones.catalog.example. 60 IN PTR example.com.",
+		`label.ext.old.zones.catalog.example. 60 IN TXT "custom"`,
+		`group.old.zones.catalog.example. 60 IN TXT "blue"`,
+	)...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+	creator.cfg.Catalog.Zone = "Catalog.Example."
+	rndc.zones["example.com."] = true
+
+	var changes []string
+	if err := creator.CreateZone("example.com", CreateOptions{Label: "sha1-wire"}, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+
+	updates := server.Updates()
+	if len(updates) != 1 {
+		t.Fatalf("sent %d updates, want 1", len(updates))
+	}
+	newOwner := SHA1WireLabel("example.com.") + ".zones.catalog.example."
+	var added []string
+	for _, rr := range updates[0].Ns {
+		if rr.Header().Class == dns.ClassINET {
+			added = append(added, strings.ToLower(rr.Header().Name))
+		}
+	}
+	wantAdded := newOwner + " group." + newOwner
+	if got := strings.Join(added, " "); got != wantAdded {
+		t.Errorf("added = %s, want %s", got, wantAdded)
+	}
+}
+
+// TestDeleteZoneCustomLabel tests that a member is removed at its actual label
+func TestDeleteZoneCustomLabel(t *testing.T) {
+	server := dnstest.NewServer(t, append(catalogRecords("1"),
+		"chosen.zones.catalog.example. 60 IN PTR example.com.",
+		`label.ext.chosen.zones.catalog.example. 60 IN TXT "random"`,
+	)...)
+
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	rndc.zones["example.com."] = true
+	deleter := &Deleter{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := deleter.DeleteZone("example.com", &changes); err != nil {
+		t.Fatalf("DeleteZone() error = %v", err)
+	}
+
+	updates := server.Updates()
+	if len(updates) != 1 {
+		t.Fatalf("sent %d updates, want 1", len(updates))
+	}
+	var removed []string
+	for _, rr := range updates[0].Ns {
+		removed = append(removed, rr.Header().Name)
+	}
+	want := "chosen.zones.catalog.example. label.ext.chosen.zones.catalog.example."
+	if got := strings.Join(removed, " "); got != want {
+		t.Errorf("removed = %s, want %s", got, want)
+	}
+}
+
+// TestCreateZoneProperties tests that a new member gets its group and custom
+// properties in the same update as its PTR
+func TestCreateZoneProperties(t *testing.T) {
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	opts := CreateOptions{Group: "customers", Properties: map[string]string{"tier": "gold"}}
+	var changes []string
+	if err := creator.CreateZone("example.com", opts, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+	if got := strings.Join(changes, " "); !strings.Contains(got, "catalog_group_set:customers") {
+		t.Errorf("changes = %v, want catalog_group_set:customers", changes)
+	}
+
+	updates := server.Updates()
+	if len(updates) != 1 {
+		t.Fatalf("sent %d updates, want 1", len(updates))
+	}
+	owner := SHA1WireLabel("example.com.") + ".zones.catalog.example."
+	values := make(map[string]string)
+	for _, rr := range updates[0].Ns {
+		if txt, ok := rr.(*dns.TXT); ok && rr.Header().Class == dns.ClassINET {
+			values[txt.Hdr.Name] = txt.Txt[0]
+		}
+	}
+	if values["group."+owner] != "customers" || values["tier.ext."+owner] != "gold" {
+		t.Errorf("properties = %v, want group and tier.ext", values)
+	}
+
+	// Schema v1 catalogs have no member properties
+	creator.cfg.Catalog.SchemaVersion = 1
+	var optErr *OptionError
+	if err := creator.CreateZone("example.net", opts, &changes); !errors.As(err, &optErr) {
+		t.Errorf("CreateZone() on schema v1 error = %v, want *OptionError", err)
+	}
+}
+
+// TestCreateZoneCatalogRules tests that new members go to the catalog the
+// rules or --catalog select, with that catalog's TTL
+func TestCreateZoneCatalogRules(t *testing.T) {
+	server := dnstest.NewServer(t, append(catalogRecords("1"),
+		"customers.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+	)...)
+	cfg := viewTestConfig(t)
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.example.", TTL: 300}}
+	cfg.Catalog.Rules = []config.CatalogRule{{Suffix: "customers.example.net", Catalog: "customers"}}
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    cfg,
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	for _, create := range []struct{ zone, catalog string }{
+		{"a.customers.example.net", ""},
+		{"example.com", "customers"},
+		{"example.org", ""},
+	} {
+		if err := creator.CreateZone(create.zone, CreateOptions{Catalog: create.catalog}, &changes); err != nil {
+			t.Fatalf("CreateZone(%s) error = %v", create.zone, err)
+		}
+	}
+
+	updates := server.Updates()
+	if len(updates) != 3 {
+		t.Fatalf("sent %d updates, want 3", len(updates))
+	}
+	for i, want := range []struct {
+		catalog string
+		ttl     uint32
+	}{{"customers.example.", 300}, {"customers.example.", 300}, {"catalog.example.", 60}} {
+		u := updates[i]
+		if u.Question[0].Name != want.catalog || u.Ns[0].Header().Ttl != want.ttl {
+			t.Errorf("update %d to %s with TTL %d, want %s with TTL %d",
+				i, u.Question[0].Name, u.Ns[0].Header().Ttl, want.catalog, want.ttl)
+		}
+	}
+}
+
+// TestCreateZoneMemberOfOtherCatalog tests that an existing member stays in
+// its catalog unless another catalog is named explicitly
+func TestCreateZoneMemberOfOtherCatalog(t *testing.T) {
+	label := SHA1WireLabel("a.customers.example.net.")
+	server := dnstest.NewServer(t, append(catalogRecords("1"),
+		label+".zones.catalog.example. 60 IN PTR a.customers.example.net.",
+		"customers.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+	)...)
+	cfg := viewTestConfig(t)
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.example.", TTL: 300}}
+	cfg.Catalog.Rules = []config.CatalogRule{{Suffix: "customers.example.net", Catalog: "customers"}}
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    cfg,
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := creator.CreateZone("a.customers.example.net", CreateOptions{}, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+	if changes[len(changes)-1] != "catalog_already_member" {
+		t.Errorf("changes = %v, want catalog_already_member", changes)
+	}
+
+	var optErr *OptionError
+	err := creator.CreateZone("a.customers.example.net", CreateOptions{Catalog: "customers"}, &changes)
+	if !errors.As(err, &optErr) || !strings.Contains(err.Error(), "move-catalog") {
+		t.Errorf("CreateZone(--catalog customers) error = %v, want *OptionError pointing to move-catalog", err)
+	}
+	if n := len(server.Updates()); n != 0 {
+		t.Errorf("sent %d updates, want none", n)
+	}
+}
+
+// TestDeleteZoneOtherCatalog tests that a member is removed from the catalog
+// it is in
+func TestDeleteZoneOtherCatalog(t *testing.T) {
+	label := SHA1WireLabel("example.com.")
+	server := dnstest.NewServer(t, append(catalogRecords("1"),
+		label+".zones.customers.example. 300 IN PTR example.com.",
+		"customers.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+	)...)
+	cfg := viewTestConfig(t)
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.example.", TTL: 300}}
+	cfg.Catalog.Rules = []config.CatalogRule{{Suffix: "customers.example.net", Catalog: "customers"}}
+
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	rndc.zones["example.com."] = true
+	deleter := &Deleter{
+		cfg:    cfg,
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := deleter.DeleteZone("example.com", &changes); err != nil {
+		t.Fatalf("DeleteZone() error = %v", err)
+	}
+	updates := server.Updates()
+	if len(updates) != 1 || updates[0].Question[0].Name != "customers.example." {
+		t.Errorf("updates = %v, want one to customers.example.", updates)
+	}
+}
+
+// TestCreateZoneDNSSECPolicy tests that --dnssec-policy overrides
+// zones.dnssec_policy and an undefined policy is refused before named is
+// touched
+func TestCreateZoneDNSSECPolicy(t *testing.T) {
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+	creator.cfg.Bind.NamedConf = filepath.Join(t.TempDir(), "named.conf")
+	if err := os.WriteFile(creator.cfg.Bind.NamedConf, []byte(`dnssec-policy standard { };`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []string
+	if err := creator.CreateZone("example.com", CreateOptions{DNSSECPolicy: "none"}, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+	got := rndc.configs["example.com."]
+	if !strings.Contains(got, "dnssec-policy none;") || strings.Contains(got, "inline-signing") {
+		t.Errorf("zone config = %q, want dnssec-policy none without inline-signing", got)
+	}
+
+	if err := creator.CreateZone("example.org", CreateOptions{DNSSECPolicy: "standard"}, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+	if got := rndc.configs["example.org."]; !strings.Contains(got, "dnssec-policy standard;") {
+		t.Errorf("zone config = %q, want dnssec-policy standard", got)
+	}
+
+	var optErr *OptionError
+	err := creator.CreateZone("example.net", CreateOptions{DNSSECPolicy: "fast"}, &changes)
+	if !errors.As(err, &optErr) || optErr.Option != "dnssec-policy" {
+		t.Errorf("CreateZone() error = %v, want dnssec-policy OptionError", err)
+	}
+	if rndc.zones["example.net."] {
+		t.Error("zone with an undefined policy was added")
+	}
+}
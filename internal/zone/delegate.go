@@ -0,0 +1,334 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// ErrNoParent means no enclosing zone of the zone is managed by dnsctl
+var ErrNoParent = errors.New("no managed parent zone")
+
+// Delegator maintains the delegations of zones in their managed parents
+type Delegator struct {
+	cfg    *config.Config
+	update *update.Client
+}
+
+// NewDelegator creates a new delegator
+func NewDelegator(cfg *config.Config) *Delegator {
+	return &Delegator{
+		cfg: cfg,
+		update: update.NewClient(
+			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
+			cfg.TSIG.Name,
+			cfg.TSIG.Secret,
+			cfg.TSIG.Algorithm,
+		),
+	}
+}
+
+// Delegate creates or refreshes the delegation of a zone in its closest
+// enclosing zone that is a catalog member: the NS records, glue for
+// nameservers below the zone, and DS records following the zone's CDS
+// records. Run after a KSK rollover, it brings the parent's DS records in
+// line with the new key.
+func (d *Delegator) Delegate(zoneInput string, changes *[]string) error {
+	zone, err := NormalizeZone(zoneInput)
+	if err != nil {
+		return fmt.Errorf("invalid zone name: %w", err)
+	}
+	parent, err := managedParent(d.update, d.cfg, zone)
+	if err != nil {
+		return err
+	}
+	if parent == "" {
+		return fmt.Errorf("%s: %w", zone, ErrNoParent)
+	}
+
+	release, err := lockZones(d.cfg, zone, parent)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return syncDelegation(d.update, parent, zone, changes)
+}
+
+// managedParent returns the closest enclosing zone of zone that is a member
+// of one of the catalogs, or "" if there is none
+func managedParent(client *update.Client, cfg *config.Config, zone string) (string, error) {
+	members := make(map[string]bool)
+	for _, catalog := range cfg.Catalogs() {
+		entries, err := transferEntries(client, catalog.Zone)
+		if err != nil {
+			return "", err
+		}
+		for _, e := range entries {
+			for _, member := range e.zones {
+				members[member] = true
+			}
+		}
+	}
+
+	labels := dns.SplitDomainName(zone)
+	for i := 1; i < len(labels); i++ {
+		if ancestor := dns.Fqdn(strings.Join(labels[i:], ".")); members[ancestor] {
+			return ancestor, nil
+		}
+	}
+	return "", nil
+}
+
+// lockZones acquires the locks of several zones in name order, so that two
+// operations on a parent and its child always take the locks in the same
+// order. It returns a function releasing them.
+func lockZones(cfg *config.Config, zones ...string) (func(), error) {
+	sorted := append([]string(nil), zones...)
+	sort.Strings(sorted)
+
+	var held []*lock.Lock
+	release := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			_ = held[i].Release()
+		}
+	}
+	for _, zone := range sorted {
+		zoneLock := lock.New(cfg.LockFilePath(zone))
+		if err := zoneLock.Acquire(); err != nil {
+			release()
+			return nil, fmt.Errorf("failed to acquire zone lock for %s: %w", zone, err)
+		}
+		held = append(held, zoneLock)
+	}
+	return release, nil
+}
+
+// syncDelegation transfers the child and parent zones and updates the
+// delegation in the parent to match the child
+func syncDelegation(client *update.Client, parent, child string, changes *[]string) error {
+	childRRs, err := client.Transfer(child)
+	if err != nil {
+		return fmt.Errorf("failed to transfer %s: %w", child, err)
+	}
+	parentRRs, err := client.Transfer(parent)
+	if err != nil {
+		return fmt.Errorf("failed to transfer %s: %w", parent, err)
+	}
+
+	msg, delegationChanges, err := delegationUpdate(parent, child, childRRs, parentRRs)
+	if err != nil {
+		return err
+	}
+	if msg != nil {
+		if _, err := client.Update(msg); err != nil {
+			return fmt.Errorf("failed to update delegation in %s: %w", parent, err)
+		}
+	}
+	*changes = append(*changes, delegationChanges...)
+	return nil
+}
+
+// removeDelegation removes the NS, DS and glue records of child from parent
+func removeDelegation(client *update.Client, parent, child string, changes *[]string) error {
+	parentRRs, err := client.Transfer(parent)
+	if err != nil {
+		return fmt.Errorf("failed to transfer %s: %w", parent, err)
+	}
+
+	current := delegationRecords(child, parentRRs)
+	if len(current) == 0 {
+		*changes = append(*changes, "delegation_not_found:"+parent)
+		return nil
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(parent)
+	msg.Remove(copyRRs(current))
+	if _, err := client.Update(msg); err != nil {
+		return fmt.Errorf("failed to remove delegation from %s: %w", parent, err)
+	}
+	*changes = append(*changes, "delegation_removed:"+parent)
+	return nil
+}
+
+// delegationUpdate returns the update that makes the delegation of child in
+// parent match the child zone, or nil if it already does, with the changes
+// it makes. The parent gets the child's apex NS records and the addresses of
+// the nameservers below the child as glue. A nameserver below the child
+// without an address is reported as glue_missing. The DS records follow the
+// child's CDS records; a CDS with algorithm 0 removes them (RFC 8078) and a
+// child without CDS records keeps the DS records the parent has. The CDS
+// records come from the primary itself, so they are taken as they are.
+func delegationUpdate(parent, child string, childRRs, parentRRs []dns.RR) (*dns.Msg, []string, error) {
+	var nameservers, cds []dns.RR
+	for _, rr := range childRRs {
+		if dns.CanonicalName(rr.Header().Name) != child {
+			continue
+		}
+		switch rr.Header().Rrtype {
+		case dns.TypeNS:
+			nameservers = append(nameservers, rr)
+		case dns.TypeCDS:
+			cds = append(cds, rr)
+		}
+	}
+	if len(nameservers) == 0 {
+		return nil, nil, fmt.Errorf("%s has no NS records to delegate to", child)
+	}
+
+	var changes []string
+	want := append([]dns.RR(nil), nameservers...)
+	for _, rr := range nameservers {
+		target := dns.CanonicalName(rr.(*dns.NS).Ns)
+		if !dns.IsSubDomain(child, target) {
+			continue
+		}
+		glue := 0
+		for _, addr := range childRRs {
+			rrtype := addr.Header().Rrtype
+			if dns.CanonicalName(addr.Header().Name) == target && (rrtype == dns.TypeA || rrtype == dns.TypeAAAA) {
+				want = append(want, addr)
+				glue++
+			}
+		}
+		if glue == 0 {
+			changes = append(changes, "glue_missing:"+target)
+		}
+	}
+
+	current := delegationRecords(child, parentRRs)
+	wantDS := cdsToDS(cds)
+	if len(cds) == 0 {
+		for _, rr := range current {
+			if rr.Header().Rrtype == dns.TypeDS {
+				wantDS = append(wantDS, rr)
+			}
+		}
+	}
+	want = append(want, wantDS...)
+
+	remove := missingRRs(current, want)
+	insert := missingRRs(want, current)
+	if len(remove) == 0 && len(insert) == 0 {
+		return nil, append(changes, "delegation_unchanged:"+parent), nil
+	}
+
+	hadNS, dsChanged := false, false
+	for _, rr := range current {
+		hadNS = hadNS || rr.Header().Rrtype == dns.TypeNS
+	}
+	for _, rr := range append(remove, insert...) {
+		dsChanged = dsChanged || rr.Header().Rrtype == dns.TypeDS
+	}
+	switch {
+	case !hadNS:
+		changes = append(changes, "delegation_added:"+parent)
+	case !onlyDS(remove, insert):
+		changes = append(changes, "delegation_updated:"+parent)
+	}
+	if dsChanged {
+		if len(wantDS) == 0 {
+			changes = append(changes, "ds_removed:"+parent)
+		} else {
+			changes = append(changes, "ds_synced:"+parent)
+		}
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(parent)
+	if len(remove) > 0 {
+		msg.Remove(copyRRs(remove))
+	}
+	if len(insert) > 0 {
+		msg.Insert(copyRRs(insert))
+	}
+	return msg, changes, nil
+}
+
+// delegationRecords returns the records of a parent zone that delegate
+// child: NS and DS records at the child's name and addresses at or below it
+func delegationRecords(child string, parentRRs []dns.RR) []dns.RR {
+	var records []dns.RR
+	for _, rr := range parentRRs {
+		name := dns.CanonicalName(rr.Header().Name)
+		switch rr.Header().Rrtype {
+		case dns.TypeNS, dns.TypeDS:
+			if name == child {
+				records = append(records, rr)
+			}
+		case dns.TypeA, dns.TypeAAAA:
+			if dns.IsSubDomain(child, name) {
+				records = append(records, rr)
+			}
+		}
+	}
+	return records
+}
+
+// cdsToDS returns the DS records a child's CDS records ask for: none if
+// they ask for the removal of the DS records
+func cdsToDS(cds []dns.RR) []dns.RR {
+	var ds []dns.RR
+	for _, rr := range cds {
+		record := rr.(*dns.CDS)
+		if record.Algorithm == 0 {
+			return nil
+		}
+		d := record.DS
+		d.Hdr.Rrtype = dns.TypeDS
+		ds = append(ds, &d)
+	}
+	return ds
+}
+
+// missingRRs returns the records of a that are not in b, comparing names
+// and rdata case-insensitively along with the TTL
+func missingRRs(a, b []dns.RR) []dns.RR {
+	have := make(map[string]bool)
+	for _, rr := range b {
+		have[rrKey(rr)] = true
+	}
+	var missing []dns.RR
+	for _, rr := range a {
+		if !have[rrKey(rr)] {
+			missing = append(missing, rr)
+		}
+	}
+	return missing
+}
+
+// rrKey identifies a record by its presentation format in lower case
+func rrKey(rr dns.RR) string {
+	key := dns.Copy(rr)
+	key.Header().Class = dns.ClassINET
+	return strings.ToLower(key.String())
+}
+
+// onlyDS reports whether the changed records are all DS records
+func onlyDS(rrsets ...[]dns.RR) bool {
+	for _, rrs := range rrsets {
+		for _, rr := range rrs {
+			if rr.Header().Rrtype != dns.TypeDS {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// copyRRs returns copies of records, since building an update message
+// changes their headers
+func copyRRs(rrs []dns.RR) []dns.RR {
+	copies := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		copies[i] = dns.Copy(rr)
+	}
+	return copies
+}
@@ -0,0 +1,292 @@
+package zone
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// Records of the child zone dev.example.com. and its delegation
+const (
+	devNS     = "dev.example.com. 3600 IN NS ns1.dev.example.com."
+	devNSOut  = "dev.example.com. 3600 IN NS ns.example.net."
+	devGlue   = "ns1.dev.example.com. 3600 IN A 192.0.2.53"
+	devDS     = "dev.example.com. 3600 IN DS 12345 13 2 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF"
+	devCDS    = "dev.example.com. 3600 IN CDS 54321 13 2 FEDCBA9876543210FEDCBA9876543210FEDCBA9876543210FEDCBA9876543210"
+	devNewDS  = "dev.example.com. 3600 IN DS 54321 13 2 FEDCBA9876543210FEDCBA9876543210FEDCBA9876543210FEDCBA9876543210"
+	devCDSDel = "dev.example.com. 3600 IN CDS 0 0 0 00"
+)
+
+// updateRecords returns the records an update deletes and adds, in
+// presentation format with the class of deletions dropped
+func updateRecords(msg *dns.Msg) (removed, added []string) {
+	for _, rr := range msg.Ns {
+		if rr.Header().Class == dns.ClassNONE {
+			rr = dns.Copy(rr)
+			rr.Header().Class = dns.ClassINET
+			rr.Header().Ttl = 0
+			removed = append(removed, rr.String())
+			continue
+		}
+		added = append(added, rr.String())
+	}
+	sort.Strings(removed)
+	sort.Strings(added)
+	return removed, added
+}
+
+// withoutTTL returns a record in presentation format with a TTL of 0, as
+// deletions carry it
+func withoutTTL(t *testing.T, record string) string {
+	rr := catalogRRs(t, record)[0]
+	rr.Header().Ttl = 0
+	return rr.String()
+}
+
+// TestDelegationUpdate tests the update that brings the delegation in the
+// parent in line with the child zone
+func TestDelegationUpdate(t *testing.T) {
+	tests := []struct {
+		name        string
+		child       []string
+		parent      []string
+		wantRemoved []string
+		wantAdded   []string
+		wantChanges []string
+	}{
+		{
+			name:        "new delegation with glue",
+			child:       []string{devNS, devNSOut, devGlue, "www.dev.example.com. 3600 IN A 192.0.2.80"},
+			wantAdded:   []string{devNS, devNSOut, devGlue},
+			wantChanges: []string{"delegation_added:example.com."},
+		},
+		{
+			name:        "nameserver without address",
+			child:       []string{devNS},
+			wantAdded:   []string{devNS},
+			wantChanges: []string{"glue_missing:ns1.dev.example.com.", "delegation_added:example.com."},
+		},
+		{
+			name:        "unchanged",
+			child:       []string{devNS, devGlue},
+			parent:      []string{devNS, devGlue, devDS},
+			wantChanges: []string{"delegation_unchanged:example.com."},
+		},
+		{
+			name:        "nameserver replaced",
+			child:       []string{devNSOut},
+			parent:      []string{devNS, devGlue, devDS},
+			wantRemoved: []string{devNS, devGlue},
+			wantAdded:   []string{devNSOut},
+			wantChanges: []string{"delegation_updated:example.com."},
+		},
+		{
+			name:        "DS follows CDS",
+			child:       []string{devNSOut, devCDS},
+			parent:      []string{devNSOut, devDS},
+			wantRemoved: []string{devDS},
+			wantAdded:   []string{devNewDS},
+			wantChanges: []string{"ds_synced:example.com."},
+		},
+		{
+			name:        "CDS delete",
+			child:       []string{devNSOut, devCDSDel},
+			parent:      []string{devNSOut, devDS},
+			wantRemoved: []string{devDS},
+			wantChanges: []string{"ds_removed:example.com."},
+		},
+		{
+			name:        "new delegation with DS",
+			child:       []string{devNSOut, devCDS},
+			wantAdded:   []string{devNSOut, devNewDS},
+			wantChanges: []string{"delegation_added:example.com.", "ds_synced:example.com."},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, changes, err := delegationUpdate("example.com.", "dev.example.com.",
+				catalogRRs(t, tt.child...), catalogRRs(t, tt.parent...))
+			if err != nil {
+				t.Fatalf("delegationUpdate() error = %v", err)
+			}
+			if strings.Join(changes, " ") != strings.Join(tt.wantChanges, " ") {
+				t.Errorf("changes = %v, want %v", changes, tt.wantChanges)
+			}
+			if len(tt.wantRemoved)+len(tt.wantAdded) == 0 {
+				if msg != nil {
+					t.Errorf("update = %v, want none", msg)
+				}
+				return
+			}
+			if msg == nil {
+				t.Fatal("no update")
+			}
+			if msg.Question[0].Name != "example.com." {
+				t.Errorf("update for %s, want example.com.", msg.Question[0].Name)
+			}
+
+			removed, added := updateRecords(msg)
+			var wantRemoved, wantAdded []string
+			for _, record := range tt.wantRemoved {
+				wantRemoved = append(wantRemoved, withoutTTL(t, record))
+			}
+			for _, record := range tt.wantAdded {
+				wantAdded = append(wantAdded, catalogRRs(t, record)[0].String())
+			}
+			sort.Strings(wantRemoved)
+			sort.Strings(wantAdded)
+			if strings.Join(removed, "\n") != strings.Join(wantRemoved, "\n") {
+				t.Errorf("removed = %v, want %v", removed, wantRemoved)
+			}
+			if strings.Join(added, "\n") != strings.Join(wantAdded, "\n") {
+				t.Errorf("added = %v, want %v", added, wantAdded)
+			}
+		})
+	}
+
+	_, _, err := delegationUpdate("example.com.", "dev.example.com.", nil, nil)
+	if err == nil {
+		t.Error("delegationUpdate() without NS records succeeded")
+	}
+}
+
+// TestCreateZoneDelegate tests that --delegate adds the delegation to the
+// managed parent after creating the zone
+func TestCreateZoneDelegate(t *testing.T) {
+	server := dnstest.NewServer(t, append(catalogRecords("1"),
+		SHA1WireLabel("example.com.")+".zones.catalog.example. 60 IN PTR example.com.",
+		zoneSOA("example.com.", "1"),
+		"example.com. 3600 IN NS ns1.example.com.",
+		zoneSOA("dev.example.com.", "1"),
+		devNS,
+		devGlue,
+	)...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := creator.CreateZone("dev.example.com", CreateOptions{Delegate: true}, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+	if !rndc.zones["dev.example.com."] {
+		t.Error("zone not added")
+	}
+	if last := changes[len(changes)-1]; last != "delegation_added:example.com." {
+		t.Errorf("changes = %v, want delegation_added:example.com. last", changes)
+	}
+
+	updates := server.Updates()
+	if len(updates) != 2 {
+		t.Fatalf("sent %d updates, want catalog and delegation", len(updates))
+	}
+	delegation := updates[1]
+	if delegation.Question[0].Name != "example.com." {
+		t.Errorf("delegation sent to %s, want example.com.", delegation.Question[0].Name)
+	}
+	_, added := updateRecords(delegation)
+	want := []string{catalogRRs(t, devNS)[0].String(), catalogRRs(t, devGlue)[0].String()}
+	sort.Strings(want)
+	if strings.Join(added, "\n") != strings.Join(want, "\n") {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+}
+
+// TestCreateZoneDelegateNoParent tests that --delegate without a managed
+// parent is refused before the zone is created
+func TestCreateZoneDelegateNoParent(t *testing.T) {
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	creator := &Creator{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	err := creator.CreateZone("dev.example.com", CreateOptions{Delegate: true}, &changes)
+	if !errors.Is(err, ErrNoParent) {
+		t.Fatalf("CreateZone() error = %v, want ErrNoParent", err)
+	}
+	if len(rndc.zones) != 0 || len(server.Updates()) != 0 {
+		t.Errorf("zone created without a parent: zones %v, %d updates", rndc.zones, len(server.Updates()))
+	}
+}
+
+// TestDeleteZoneDelegation tests that deleting a zone removes its NS, DS and
+// glue records from the managed parent
+func TestDeleteZoneDelegation(t *testing.T) {
+	server := dnstest.NewServer(t, append(catalogRecords("1", "example.com.", "dev.example.com."),
+		zoneSOA("example.com.", "1"),
+		"example.com. 3600 IN NS ns1.example.com.",
+		"ns1.example.com. 3600 IN A 192.0.2.1",
+		devNS,
+		devGlue,
+		devDS,
+	)...)
+
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	rndc.zones["dev.example.com."] = true
+	deleter := &Deleter{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := deleter.DeleteZone("dev.example.com", &changes); err != nil {
+		t.Fatalf("DeleteZone() error = %v", err)
+	}
+	if changes[0] != "delegation_removed:example.com." {
+		t.Errorf("changes = %v, want delegation_removed:example.com. first", changes)
+	}
+
+	updates := server.Updates()
+	if len(updates) != 2 {
+		t.Fatalf("sent %d updates, want delegation and catalog", len(updates))
+	}
+	if updates[0].Question[0].Name != "example.com." {
+		t.Errorf("delegation removed from %s, want example.com.", updates[0].Question[0].Name)
+	}
+	removed, added := updateRecords(updates[0])
+	want := []string{withoutTTL(t, devNS), withoutTTL(t, devGlue), withoutTTL(t, devDS)}
+	sort.Strings(want)
+	if strings.Join(removed, "\n") != strings.Join(want, "\n") || len(added) != 0 {
+		t.Errorf("removed = %v, added = %v, want %v removed", removed, added, want)
+	}
+}
+
+// TestLockZones tests that a lock that cannot be taken releases the ones
+// already held
+func TestLockZones(t *testing.T) {
+	cfg := viewTestConfig(t)
+
+	held := lock.New(cfg.LockFilePath("z.example."))
+	if err := held.Acquire(); err != nil {
+		t.Fatal(err)
+	}
+	defer held.Release()
+
+	if _, err := lockZones(cfg, "z.example.", "a.example."); !errors.Is(err, lock.ErrLocked) {
+		t.Fatalf("lockZones() error = %v, want ErrLocked", err)
+	}
+
+	release, err := lockZones(cfg, "a.example.")
+	if err != nil {
+		t.Fatalf("a.example. still locked: %v", err)
+	}
+	release()
+}
@@ -1,26 +1,27 @@
 package zone
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/dlukt/dnsctl/internal/bind"
 	"github.com/dlukt/dnsctl/internal/config"
-	"github.com/dlukt/dnsctl/internal/lock"
 	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
 )
 
 // Deleter handles zone deletion operations
 type Deleter struct {
-	cfg       *config.Config
-	rndc      *bind.RNDCClient
-	update    *update.Client
+	cfg    *config.Config
+	views  []viewRNDC
+	update *update.Client
 }
 
 // NewDeleter creates a new zone deleter
 func NewDeleter(cfg *config.Config) *Deleter {
 	return &Deleter{
-		cfg: cfg,
-		rndc: bind.NewRNDCClient(cfg.Bind.RNDCPath, cfg.Bind.RNDCConf, cfg.Bind.View),
+		cfg:   cfg,
+		views: newViewRNDCs(cfg),
 		update: update.NewClient(
 			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
 			cfg.TSIG.Name,
@@ -30,7 +31,8 @@ func NewDeleter(cfg *config.Config) *Deleter {
 	}
 }
 
-// DeleteZone removes a zone (spec 11.4)
+// DeleteZone removes a zone (spec 11.4), and its delegation if its parent
+// zone is a catalog member
 func (d *Deleter) DeleteZone(zoneInput string, changes *[]string) error {
 	// Step 1: Normalize zone
 	zone, err := NormalizeZone(zoneInput)
@@ -38,52 +40,105 @@ func (d *Deleter) DeleteZone(zoneInput string, changes *[]string) error {
 		return fmt.Errorf("invalid zone name: %w", err)
 	}
 
-	// Step 2: Acquire zone lock
-	zoneLock := lock.New(d.cfg.LockFilePath(zone))
-	if err := zoneLock.Acquire(); err != nil {
-		return fmt.Errorf("failed to acquire zone lock: %w", err)
+	parent, err := managedParent(d.update, d.cfg, zone)
+	if err != nil {
+		return err
+	}
+	locked := []string{zone}
+	if parent != "" {
+		locked = append(locked, parent)
+	}
+
+	// Step 2: Acquire zone lock, and the lock of a managed parent
+	release, err := lockZones(d.cfg, locked...)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Remove the delegation from a managed parent before the zone goes
+	if parent != "" {
+		if err := removeDelegation(d.update, parent, zone, changes); err != nil {
+			return err
+		}
 	}
-	defer zoneLock.Release()
 
 	// Step 3: Remove from catalog zone (spec 11.4, step 3)
 	if err := d.removeFromCatalog(zone, changes); err != nil {
 		return fmt.Errorf("failed to remove from catalog: %w", err)
 	}
 
-	// Step 4: Delete zone from BIND (spec 11.4, step 4)
-	if err := d.rndc.DelZone(zone, true); err != nil {
-		return fmt.Errorf("failed to delete zone via RNDC: %w", err)
+	// Steps 4-5: Delete the zone from each view. With several views a view
+	// that lacks the zone is skipped; the zone must exist in at least one.
+	var notFound error
+	deleted := 0
+	for _, v := range d.views {
+		if err := v.rndc.DelZone(zone, true); err != nil {
+			if errors.Is(err, bind.ErrZoneNotFound) && len(d.views) > 1 {
+				notFound = err
+				*changes = append(*changes, viewChange("zone_not_in_view", v.view))
+				continue
+			}
+			return fmt.Errorf("failed to delete zone via RNDC: %w", err)
+		}
+		deleted++
+		*changes = append(*changes, viewChange("zone_deleted", v.view))
+
+		// Step 5: Remove zone file (best-effort, spec 11.4, step 5)
+		if err := RemoveZoneFile(d.cfg.ZoneFilePathInView(zone, v.view)); err != nil {
+			// Log warning but don't fail - this is best-effort
+			*changes = append(*changes, viewChange("zone_file_cleanup_failed", v.view))
+		} else {
+			*changes = append(*changes, viewChange("zone_file_removed", v.view))
+		}
 	}
-	*changes = append(*changes, "zone_deleted")
-
-	// Step 5: Remove zone file (best-effort, spec 11.4, step 5)
-	zoneFilePath := d.cfg.ZoneFilePath(zone)
-	if err := RemoveZoneFile(zoneFilePath); err != nil {
-		// Log warning but don't fail - this is best-effort
-		*changes = append(*changes, "zone_file_cleanup_failed")
-	} else {
-		*changes = append(*changes, "zone_file_removed")
+	if deleted == 0 && notFound != nil {
+		return fmt.Errorf("failed to delete zone via RNDC: %w", notFound)
 	}
 
 	return nil
 }
 
-// removeFromCatalog removes the zone from the catalog zone (spec 11.4, step 3)
+// removeFromCatalog removes the zone from every catalog zone it is a member
+// of (spec 11.4, step 3), with its properties, at whatever label it is a
+// member
 func (d *Deleter) removeFromCatalog(zone string, changes *[]string) error {
-	// Compute catalog member label
-	label := SHA1WireLabel(zone)
+	memberships, err := findMemberships(d.update, d.cfg, zone)
+	if err != nil {
+		return err
+	}
+	if len(memberships) == 0 {
+		*changes = append(*changes, "catalog_not_member")
+		return nil
+	}
 
-	// Build the catalog delete message
-	updateMsg, err := update.BuildPTRDelete(d.cfg.Catalog.Zone, label)
+	for _, ms := range memberships {
+		if err := d.removeMembership(ms); err != nil {
+			return err
+		}
+		*changes = append(*changes, "catalog_updated")
+	}
+	return nil
+}
+
+// removeMembership removes the zone's entries from one catalog zone
+func (d *Deleter) removeMembership(ms catalogMembership) error {
+	catalogLock, err := lockCatalog(d.cfg, ms.catalog.Zone, false)
 	if err != nil {
-		return fmt.Errorf("failed to build catalog delete: %w", err)
+		return err
+	}
+	defer catalogLock.Release()
+
+	// Build the catalog delete message
+	updateMsg := new(dns.Msg)
+	updateMsg.SetUpdate(ms.catalog.Zone)
+	for _, e := range ms.current {
+		removeMember(updateMsg, ms.catalog.Zone, e)
 	}
 
 	// Send the update
 	if _, err := d.update.Update(updateMsg); err != nil {
-		return fmt.Errorf("failed to send catalog delete: %w", err)
+		return fmt.Errorf("failed to send catalog delete to %s: %w", ms.catalog.Zone, err)
 	}
-
-	*changes = append(*changes, "catalog_updated")
 	return nil
 }
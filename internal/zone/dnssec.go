@@ -0,0 +1,215 @@
+package zone
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/miekg/dns"
+)
+
+// Built-in dnssec-policy names with a special meaning
+const (
+	policyNone     = "none"     // Not signed
+	policyInsecure = "insecure" // Signed until the parent DS is gone, then unsigned
+)
+
+// signingPolicy reports whether a dnssec-policy has named sign the zone
+func signingPolicy(policy string) bool {
+	return policy != "" && policy != policyNone
+}
+
+// unsigningPolicy reports whether a dnssec-policy makes named unsign the zone
+func unsigningPolicy(policy string) bool {
+	return policy == policyNone || policy == policyInsecure
+}
+
+// ValidateDNSSECPolicy checks that a dnssec-policy is one of named's
+// built-in policies or is defined in bind.named_conf. An unknown policy is
+// returned as *OptionError.
+func ValidateDNSSECPolicy(cfg *config.Config, policy string) error {
+	for _, builtin := range bind.BuiltinDNSSECPolicies {
+		if policy == builtin {
+			return nil
+		}
+	}
+
+	conf, err := bind.ReadNamedConf(cfg.Bind.NamedConf)
+	if err != nil {
+		return fmt.Errorf("cannot check dnssec-policy %q: %w", policy, err)
+	}
+	for _, name := range conf.DNSSECPolicies() {
+		if name == policy {
+			return nil
+		}
+	}
+	return &OptionError{Option: "dnssec-policy", Err: fmt.Errorf("policy %q is not defined in %s", policy, cfg.Bind.NamedConf)}
+}
+
+// DNSSECPolicySetter changes the dnssec-policy of existing zones
+type DNSSECPolicySetter struct {
+	cfg   *config.Config
+	views []viewRNDC
+
+	// Timeout for the parent DS lookup
+	resolverTimeout time.Duration
+}
+
+// NewDNSSECPolicySetter creates a new dnssec-policy setter
+func NewDNSSECPolicySetter(cfg *config.Config) *DNSSECPolicySetter {
+	return &DNSSECPolicySetter{
+		cfg:             cfg,
+		views:           newViewRNDCs(cfg),
+		resolverTimeout: 5 * time.Second,
+	}
+}
+
+// policyView is the configuration of a zone in one view
+type policyView struct {
+	v        viewRNDC
+	showzone string
+	current  string
+}
+
+// SetDNSSECPolicy changes the dnssec-policy of a zone in every view with
+// rndc modzone, keeping the rest of its configuration. A zone that gets a
+// signing policy and has no inline-signing option gets zones.inline_signing.
+// If a view fails, the views already changed are restored.
+//
+// The returned warnings say when the change unsigns a zone whose parent
+// has a DS record for it: with policy none validation fails until the DS is
+// removed, with insecure named waits for the DS to go.
+func (s *DNSSECPolicySetter) SetDNSSECPolicy(zoneInput, policy string, changes *[]string) ([]string, error) {
+	zone, err := NormalizeZone(zoneInput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone name: %w", err)
+	}
+	if err := ValidateDNSSECPolicy(s.cfg, policy); err != nil {
+		return nil, err
+	}
+
+	zoneLock := lock.New(s.cfg.LockFilePath(zone))
+	if err := zoneLock.Acquire(); err != nil {
+		return nil, fmt.Errorf("failed to acquire zone lock: %w", err)
+	}
+	defer zoneLock.Release()
+
+	var views []policyView
+	signed := false
+	for _, v := range s.views {
+		showzone, err := v.rndc.ShowZone(zone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to show zone %s: %w", zone, err)
+		}
+		current := bind.ZoneOption(showzone, "dnssec-policy")
+		signed = signed || signingPolicy(current)
+		views = append(views, policyView{v: v, showzone: showzone, current: current})
+	}
+
+	var warnings []string
+	if signed && unsigningPolicy(policy) {
+		warnings = s.unsignWarnings(zone, policy)
+	}
+
+	var modified []policyView
+	rollback := func() {
+		for _, pv := range modified {
+			if original, err := bind.ZoneConfigBlock(pv.showzone); err == nil {
+				_ = pv.v.rndc.ModZone(zone, original)
+			}
+		}
+	}
+	for _, pv := range views {
+		if pv.current == policy {
+			*changes = append(*changes, viewChange("dnssec_policy_unchanged", pv.v.view))
+			continue
+		}
+
+		zoneConfig, err := s.buildPolicyConfig(pv.showzone, policy)
+		if err == nil {
+			err = pv.v.rndc.ModZone(zone, zoneConfig)
+		}
+		if err != nil {
+			rollback()
+			return warnings, fmt.Errorf("failed to set dnssec-policy via RNDC: %w", err)
+		}
+		modified = append(modified, pv)
+		*changes = append(*changes, viewChange("dnssec_policy_set:"+policy, pv.v.view))
+	}
+
+	return warnings, nil
+}
+
+// buildPolicyConfig returns the modzone configuration of a zone with the
+// dnssec-policy replaced
+func (s *DNSSECPolicySetter) buildPolicyConfig(showzone, policy string) (string, error) {
+	if signingPolicy(policy) && bind.ZoneOption(showzone, "inline-signing") == "" {
+		withSigning, err := bind.SetZoneOption(showzone, "inline-signing", boolToYesNo(s.cfg.Zones.InlineSigning))
+		if err != nil {
+			return "", err
+		}
+		showzone = withSigning
+	}
+	return bind.SetZoneOption(showzone, "dnssec-policy", policy)
+}
+
+// unsignWarnings returns the warnings for unsigning a zone: none if its
+// parent has no DS record for it
+func (s *DNSSECPolicySetter) unsignWarnings(zone, policy string) []string {
+	hasDS, err := s.parentHasDS(zone)
+	if err != nil {
+		return []string{fmt.Sprintf("could not check the parent of %s for DS records: %v", zone, err)}
+	}
+	if !hasDS {
+		return nil
+	}
+	if policy == policyNone {
+		return []string{fmt.Sprintf("%s has a DS record in its parent; with dnssec-policy none it fails validation "+
+			"until the DS is removed (dnssec-policy insecure unsigns it safely)", zone)}
+	}
+	return []string{fmt.Sprintf("%s has a DS record in its parent; named keeps it signed until the DS is removed", zone)}
+}
+
+// parentHasDS asks the resolver whether the parent zone has a DS record
+// for zone
+func (s *DNSSECPolicySetter) parentHasDS(zone string) (bool, error) {
+	addr, err := s.cfg.ResolverAddr()
+	if err != nil {
+		return false, err
+	}
+	response, err := QueryResolver(addr, zone, dns.TypeDS, s.resolverTimeout)
+	if err != nil {
+		return false, err
+	}
+	for _, rr := range response.Answer {
+		if rr.Header().Rrtype == dns.TypeDS {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// QueryResolver sends a recursive query with the DO bit to a resolver, such
+// as the one config.ResolverAddr returns, over TCP if the UDP answer is
+// truncated. NXDOMAIN is returned as an answer, other failures as errors.
+func QueryResolver(addr, name string, qtype uint16, timeout time.Duration) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.SetEdns0(dns.DefaultMsgSize, true)
+
+	client := &dns.Client{Net: "udp", Timeout: timeout}
+	response, _, err := client.Exchange(msg, addr)
+	if err == nil && response.Truncated {
+		client.Net = "tcp"
+		response, _, err = client.Exchange(msg, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query %s for %s %s: %w", addr, name, dns.TypeToString[qtype], err)
+	}
+	if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+		return nil, fmt.Errorf("query for %s %s failed: %s", name, dns.TypeToString[qtype], dns.RcodeToString[response.Rcode])
+	}
+	return response, nil
+}
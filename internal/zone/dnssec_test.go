@@ -0,0 +1,159 @@
+package zone
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlukt/dnsctl/internal/dnstest"
+)
+
+// TestValidateDNSSECPolicy tests accepting built-in policies and those
+// defined in named.conf
+func TestValidateDNSSECPolicy(t *testing.T) {
+	cfg := viewTestConfig(t)
+	cfg.Bind.NamedConf = filepath.Join(t.TempDir(), "named.conf")
+	conf := `dnssec-policy "standard" { keys { csk lifetime unlimited algorithm 13; }; };
+zone "example.org" { type primary; dnssec-policy fast; };`
+	if err := os.WriteFile(cfg.Bind.NamedConf, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, policy := range []string{"default", "insecure", "none", "standard"} {
+		if err := ValidateDNSSECPolicy(cfg, policy); err != nil {
+			t.Errorf("ValidateDNSSECPolicy(%q) error = %v", policy, err)
+		}
+	}
+
+	var optErr *OptionError
+	if err := ValidateDNSSECPolicy(cfg, "fast"); !errors.As(err, &optErr) {
+		t.Errorf("ValidateDNSSECPolicy() of an undefined policy error = %v, want OptionError", err)
+	}
+
+	cfg.Bind.NamedConf = filepath.Join(t.TempDir(), "missing.conf")
+	if err := ValidateDNSSECPolicy(cfg, "standard"); err == nil || errors.As(err, &optErr) {
+		t.Errorf("ValidateDNSSECPolicy() without named.conf error = %v, want a read error", err)
+	}
+}
+
+// signedZoneConfig is the addzone configuration of a signed example.com.
+const signedZoneConfig = `{ type primary; file "example.com.zone"; dnssec-policy "default"; inline-signing yes; };`
+
+// TestSetDNSSECPolicy tests changing the policy in every view and the
+// warning for unsigning a zone with a DS record in its parent
+func TestSetDNSSECPolicy(t *testing.T) {
+	cfg := viewTestConfig(t, "internal", "external")
+	cfg.Resolver = dnstest.NewServer(t,
+		"example.com. 3600 IN DS 12345 13 2 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF",
+	).Addr
+	var calls []string
+	internal := newFakeRNDC("internal", &calls)
+	external := newFakeRNDC("external", &calls)
+	for _, f := range []*fakeRNDC{internal, external} {
+		f.zones["example.com."] = true
+		f.configs["example.com."] = signedZoneConfig
+	}
+	setter := &DNSSECPolicySetter{
+		cfg:             cfg,
+		views:           []viewRNDC{{"internal", internal}, {"external", external}},
+		resolverTimeout: time.Second,
+	}
+
+	var changes []string
+	warnings, err := setter.SetDNSSECPolicy("example.com", "insecure", &changes)
+	if err != nil {
+		t.Fatalf("SetDNSSECPolicy() error = %v", err)
+	}
+	want := `{ type primary; file "example.com.zone"; dnssec-policy insecure; inline-signing yes; };`
+	for _, f := range []*fakeRNDC{internal, external} {
+		if got := f.configs["example.com."]; got != want {
+			t.Errorf("%s config = %q, want %q", f.view, got, want)
+		}
+	}
+	if got := strings.Join(changes, " "); got != "dnssec_policy_set:insecure:internal dnssec_policy_set:insecure:external" {
+		t.Errorf("changes = %v", changes)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "DS record") {
+		t.Errorf("warnings = %v, want a DS warning", warnings)
+	}
+
+	// Setting the same policy again changes nothing
+	changes = nil
+	if _, err := setter.SetDNSSECPolicy("example.com", "insecure", &changes); err != nil {
+		t.Fatalf("SetDNSSECPolicy() error = %v", err)
+	}
+	if got := strings.Join(changes, " "); got != "dnssec_policy_unchanged:internal dnssec_policy_unchanged:external" {
+		t.Errorf("changes = %v", changes)
+	}
+}
+
+// TestSetDNSSECPolicyInlineSigning tests that signing a zone without an
+// inline-signing option adds zones.inline_signing, and that unsigning a
+// zone without a parent DS gives no warning
+func TestSetDNSSECPolicyInlineSigning(t *testing.T) {
+	cfg := viewTestConfig(t, "internal", "external")
+	cfg.Resolver = dnstest.NewServer(t).Addr
+	var calls []string
+	internal := newFakeRNDC("internal", &calls)
+	external := newFakeRNDC("external", &calls)
+	for _, f := range []*fakeRNDC{internal, external} {
+		f.zones["example.com."] = true
+		f.configs["example.com."] = signedZoneConfig
+	}
+	setter := &DNSSECPolicySetter{
+		cfg:             cfg,
+		views:           []viewRNDC{{"internal", internal}, {"external", external}},
+		resolverTimeout: time.Second,
+	}
+	cfg.Zones.InlineSigning = false
+	internal.configs["example.com."] = `{ type primary; file "example.com.zone"; dnssec-policy none; };`
+
+	var changes []string
+	if _, err := setter.SetDNSSECPolicy("example.com", "default", &changes); err != nil {
+		t.Fatalf("SetDNSSECPolicy() error = %v", err)
+	}
+	want := `{ type primary; file "example.com.zone"; dnssec-policy default; inline-signing no; };`
+	if got := internal.configs["example.com."]; got != want {
+		t.Errorf("config = %q, want %q", got, want)
+	}
+
+	warnings, err := setter.SetDNSSECPolicy("example.com", "none", &changes)
+	if err != nil {
+		t.Fatalf("SetDNSSECPolicy() error = %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("warnings = %v, want none without a parent DS", warnings)
+	}
+}
+
+// TestSetDNSSECPolicyRollback tests that a failing view restores the views
+// already changed
+func TestSetDNSSECPolicyRollback(t *testing.T) {
+	cfg := viewTestConfig(t, "internal", "external")
+	cfg.Resolver = dnstest.NewServer(t).Addr
+	var calls []string
+	internal := newFakeRNDC("internal", &calls)
+	external := newFakeRNDC("external", &calls)
+	for _, f := range []*fakeRNDC{internal, external} {
+		f.zones["example.com."] = true
+		f.configs["example.com."] = signedZoneConfig
+	}
+	setter := &DNSSECPolicySetter{
+		cfg:             cfg,
+		views:           []viewRNDC{{"internal", internal}, {"external", external}},
+		resolverTimeout: time.Second,
+	}
+	original := internal.configs["example.com."]
+	external.modErr = errors.New("modzone failed")
+
+	var changes []string
+	if _, err := setter.SetDNSSECPolicy("example.com", "none", &changes); err == nil {
+		t.Fatal("SetDNSSECPolicy() error = nil, want modzone failure")
+	}
+	if got := internal.configs["example.com."]; got != original {
+		t.Errorf("internal config after rollback = %q, want %q", got, original)
+	}
+}
@@ -0,0 +1,48 @@
+package zone
+
+import "fmt"
+
+// NameError reports a zone or owner name that failed validation
+type NameError struct {
+	Name string // Input as given by the caller
+	Err  error  // Underlying validation failure
+}
+
+// Error returns the underlying validation message
+func (e *NameError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying validation failure
+func (e *NameError) Unwrap() error {
+	return e.Err
+}
+
+// OptionError reports an invalid option passed to a zone operation
+type OptionError struct {
+	Option string // Name of the offending option
+	Err    error  // Underlying validation failure
+}
+
+// Error returns the underlying validation message
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Option, e.Err)
+}
+
+// Unwrap returns the underlying validation failure
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// LabelConflictError reports a catalog member label that already points to
+// a different member zone
+type LabelConflictError struct {
+	Label    string // Member label
+	Zone     string // Zone that was to be added at the label
+	Existing string // Zone the label already points to
+}
+
+// Error describes the conflicting label
+func (e *LabelConflictError) Error() string {
+	return fmt.Sprintf("catalog label %s already points to %s, not %s", e.Label, e.Existing, e.Zone)
+}
@@ -77,6 +77,32 @@ func DefaultZoneFileData(zone string) *ZoneFileData {
 	}
 }
 
+// CatalogZoneFileData returns the data for a new catalog zone file: the SOA
+// and NS records RFC 9432 requires, which point to invalid. since nobody
+// resolves in a catalog zone, and the schema version record
+func CatalogZoneFileData(zone string, schemaVersion int, ttl uint32) *ZoneFileData {
+	now := time.Now()
+	serial := uint32(now.Year()*1000000 + int(now.Month())*10000 + now.Day()*100)
+
+	return &ZoneFileData{
+		Zone:    zone,
+		TTL:     ttl,
+		NS:      "invalid.",
+		Email:   "invalid.",
+		Serial:  serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minimum: ttl,
+		NSRecords: []string{
+			"@ IN NS invalid.",
+		},
+		Defaults: []string{
+			fmt.Sprintf("version IN TXT \"%d\"", schemaVersion),
+		},
+	}
+}
+
 // GenerateZoneFile generates a zone file from data
 func GenerateZoneFile(data *ZoneFileData) (string, error) {
 	tmpl, err := template.New("zonefile").Parse(zoneFileTemplate)
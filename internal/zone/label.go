@@ -0,0 +1,80 @@
+package zone
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Member label kinds accepted by ResolveMemberLabel
+const (
+	LabelSHA1Wire = "sha1-wire" // Label derived from the zone name (the default)
+	LabelRandom   = "random"    // 32 random hex digits
+	LabelUUID     = "uuid"      // Random (version 4) UUID
+)
+
+// labelProperty is the custom property recording that a member's label was
+// chosen freely rather than derived with sha1-wire:
+// label.ext.<label>.zones.<catalog> TXT "<kind>"
+const labelProperty = "label.ext"
+
+// ResolveMemberLabel returns the catalog member label for a zone from a label
+// spec: sha1-wire, random, uuid or a literal label. It also returns the kind
+// recorded for freely chosen labels, which is empty for sha1-wire labels.
+// Invalid literal labels are returned as *OptionError.
+func ResolveMemberLabel(spec, zone string) (label, kind string, err error) {
+	switch strings.ToLower(spec) {
+	case "", LabelSHA1Wire:
+		return SHA1WireLabel(zone), "", nil
+	case LabelRandom:
+		buf, err := randomBytes(16)
+		if err != nil {
+			return "", "", err
+		}
+		return hex.EncodeToString(buf), LabelRandom, nil
+	case LabelUUID:
+		buf, err := randomBytes(16)
+		if err != nil {
+			return "", "", err
+		}
+		buf[6] = buf[6]&0x0f | 0x40 // Version 4
+		buf[8] = buf[8]&0x3f | 0x80 // RFC 4122 variant
+		return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:]), LabelUUID, nil
+	}
+
+	label = strings.ToLower(spec)
+	if err := validateMemberLabel(label); err != nil {
+		return "", "", &OptionError{Option: "label", Err: err}
+	}
+	if label == SHA1WireLabel(zone) {
+		return label, "", nil
+	}
+	return label, "custom", nil
+}
+
+// validateMemberLabel checks that a literal member label is a single DNS
+// label of letters, digits and hyphens
+func validateMemberLabel(label string) error {
+	if len(label) == 0 || len(label) > maxLabelLength {
+		return fmt.Errorf("must be 1 to %d characters, got %d", maxLabelLength, len(label))
+	}
+	for _, ch := range label {
+		if !isDNSLabelChar(ch) {
+			return fmt.Errorf("invalid character '%c' in label %q", ch, label)
+		}
+	}
+	if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+		return fmt.Errorf("label %q cannot start or end with hyphen", label)
+	}
+	return nil
+}
+
+// randomBytes returns n bytes from the system's secure random source
+func randomBytes(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate label: %w", err)
+	}
+	return buf, nil
+}
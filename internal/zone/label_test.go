@@ -1,6 +1,8 @@
 package zone
 
 import (
+	"errors"
+	"regexp"
 	"testing"
 )
 
@@ -271,3 +273,50 @@ func BenchmarkSHA1WireLabel(b *testing.B) {
 		})
 	}
 }
+
+// TestResolveMemberLabel tests the catalog member label specs
+func TestResolveMemberLabel(t *testing.T) {
+	sha1Label := SHA1WireLabel("example.com.")
+
+	tests := []struct {
+		spec     string
+		pattern  string // Regular expression the label must match
+		wantKind string
+	}{
+		{"", "^" + sha1Label + "$", ""},
+		{"sha1-wire", "^" + sha1Label + "$", ""},
+		{"random", "^[0-9a-f]{32}$", LabelRandom},
+		{"UUID", "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", LabelUUID},
+		{"Member-1", "^member-1$", "custom"},
+		{sha1Label, "^" + sha1Label + "$", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			label, kind, err := ResolveMemberLabel(tt.spec, "example.com.")
+			if err != nil {
+				t.Fatalf("ResolveMemberLabel() error = %v", err)
+			}
+			if !regexp.MustCompile(tt.pattern).MatchString(label) {
+				t.Errorf("label = %q, want match for %s", label, tt.pattern)
+			}
+			if kind != tt.wantKind {
+				t.Errorf("kind = %q, want %q", kind, tt.wantKind)
+			}
+		})
+	}
+
+	// Generated labels differ on every call
+	first, _, _ := ResolveMemberLabel(LabelRandom, "example.com.")
+	second, _, _ := ResolveMemberLabel(LabelRandom, "example.com.")
+	if first == second {
+		t.Errorf("random labels repeat: %q", first)
+	}
+
+	for _, spec := range []string{"-bad", "two.labels", "under_score", "x23456789012345678901234567890123456789012345678901234567890abcd"} {
+		var optErr *OptionError
+		if _, _, err := ResolveMemberLabel(spec, "example.com."); !errors.As(err, &optErr) {
+			t.Errorf("ResolveMemberLabel(%q) error = %v, want *OptionError", spec, err)
+		}
+	}
+}
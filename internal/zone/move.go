@@ -0,0 +1,276 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// cooProperty is the RFC 9432 change of ownership property, which tells
+// secondaries that a member may move to the catalog it points to:
+// coo.<label>.zones.<catalog> PTR <new catalog>
+const cooProperty = "coo"
+
+// ErrSeveralCatalogs means a zone is a member of more than one catalog, a
+// conflict catalog reconcile has to resolve first
+var ErrSeveralCatalogs = errors.New("zone is a member of several catalogs")
+
+// MoveOptions controls how a zone is moved between catalogs
+type MoveOptions struct {
+	// How long to wait for the secondaries to load each catalog change
+	Timeout time.Duration
+}
+
+// CatalogMover moves member zones between catalog zones
+type CatalogMover struct {
+	cfg    *config.Config
+	update *update.Client
+
+	// Per-query timeout for secondaries and interval between their polls
+	secondaryTimeout time.Duration
+	pollInterval     time.Duration
+}
+
+// NewCatalogMover creates a new catalog mover
+func NewCatalogMover(cfg *config.Config) *CatalogMover {
+	return &CatalogMover{
+		cfg: cfg,
+		update: update.NewClient(
+			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
+			cfg.TSIG.Name,
+			cfg.TSIG.Secret,
+			cfg.TSIG.Algorithm,
+		),
+		secondaryTimeout: 5 * time.Second,
+		pollInterval:     2 * time.Second,
+	}
+}
+
+// MoveCatalog moves a member zone to another catalog without making the
+// secondaries drop it (RFC 9432, section 5.6):
+//
+//  1. the coo property of the member in the source catalog is pointed at
+//     the target catalog,
+//  2. the member is added to the target catalog under the same label, with
+//     its properties,
+//  3. once every secondary has loaded both changes, the member is removed
+//     from the source catalog.
+//
+// Each step waits for the secondaries to load it. A run that times out
+// leaves the steps done so far in place; running it again resumes.
+func (m *CatalogMover) MoveCatalog(zoneInput, targetName string, opts MoveOptions, changes *[]string) error {
+	zone, err := NormalizeZone(zoneInput)
+	if err != nil {
+		return fmt.Errorf("invalid zone name: %w", err)
+	}
+	target, err := m.cfg.FindCatalog(targetName)
+	if err != nil {
+		return &OptionError{Option: "catalog", Err: err}
+	}
+	if len(m.cfg.Secondaries) == 0 {
+		// Without secondaries to watch the migration cannot be observed
+		return ErrNoSecondaries
+	}
+
+	zoneLock := lock.New(m.cfg.LockFilePath(zone))
+	if err := zoneLock.Acquire(); err != nil {
+		return fmt.Errorf("failed to acquire zone lock: %w", err)
+	}
+	defer zoneLock.Release()
+
+	// Find the catalogs the zone is a member of
+	memberships, err := findMemberships(m.update, m.cfg, zone)
+	if err != nil {
+		return err
+	}
+	var source *catalogMembership
+	var targetEntry *catalogEntry
+	for i, ms := range memberships {
+		if ms.catalog.Zone == target.Zone {
+			targetEntry = &ms.current[0]
+			continue
+		}
+		if source != nil {
+			return fmt.Errorf("%s: %w: %s and %s; run catalog reconcile first",
+				zone, ErrSeveralCatalogs, source.catalog.Zone, ms.catalog.Zone)
+		}
+		source = &memberships[i]
+	}
+
+	if source == nil {
+		if targetEntry != nil {
+			*changes = append(*changes, "catalog_already_member")
+			return nil
+		}
+		return fmt.Errorf("%s: %w", zone, ErrNotMember)
+	}
+	entry := source.current[0]
+
+	// Step 1: Point coo at the target catalog
+	if !hasCOO(source.catalog.Zone, entry, target.Zone) {
+		if err := m.setCOO(source.catalog, entry, zone, target.Zone); err != nil {
+			return err
+		}
+		*changes = append(*changes, "catalog_coo_set:"+trimDot(target.Zone))
+	}
+	if err := m.waitForSecondaries(source.catalog.Zone, opts.Timeout); err != nil {
+		return err
+	}
+
+	// Step 2: Add the member to the target catalog
+	if targetEntry == nil {
+		if err := m.addToTarget(target, source.catalog.Zone, entry, zone); err != nil {
+			return err
+		}
+		*changes = append(*changes, "catalog_member_added:"+trimDot(target.Zone))
+	}
+	if err := m.waitForSecondaries(target.Zone, opts.Timeout); err != nil {
+		return err
+	}
+
+	// Step 3: Drop the member from the source catalog
+	catalogLock, err := lockCatalog(m.cfg, source.catalog.Zone, false)
+	if err != nil {
+		return err
+	}
+	defer catalogLock.Release()
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(source.catalog.Zone)
+	msg.Used([]dns.RR{memberPTR(source.catalog.Zone, entry.label, zone, source.catalog.TTL)})
+	removeMember(msg, source.catalog.Zone, entry)
+	if _, err := m.update.Update(msg); err != nil {
+		return fmt.Errorf("failed to remove member from %s: %w", source.catalog.Zone, err)
+	}
+	*changes = append(*changes, "catalog_member_removed:"+trimDot(source.catalog.Zone))
+
+	return nil
+}
+
+// hasCOO reports whether an entry's coo property points to the target
+func hasCOO(catalogZone string, entry catalogEntry, target string) bool {
+	for _, value := range entryProperties(catalogZone, entry)[cooProperty] {
+		if dns.CanonicalName(value) == dns.CanonicalName(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// setCOO replaces the coo property of a member, provided it is still a
+// member at the same label
+func (m *CatalogMover) setCOO(source config.Catalog, entry catalogEntry, zone, target string) error {
+	catalogLock, err := lockCatalog(m.cfg, source.Zone, false)
+	if err != nil {
+		return err
+	}
+	defer catalogLock.Release()
+
+	coo := &dns.PTR{
+		Hdr: dns.RR_Header{
+			Name:   cooProperty + "." + memberOwner(source.Zone, entry.label),
+			Rrtype: dns.TypePTR,
+			Class:  dns.ClassINET,
+			Ttl:    source.TTL,
+		},
+		Ptr: dns.Fqdn(target),
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(source.Zone)
+	msg.Used([]dns.RR{memberPTR(source.Zone, entry.label, zone, source.TTL)})
+	msg.RemoveRRset([]dns.RR{coo})
+	msg.Insert([]dns.RR{coo})
+	if _, err := m.update.Update(msg); err != nil {
+		return fmt.Errorf("failed to set coo in %s: %w", source.Zone, err)
+	}
+	return nil
+}
+
+// addToTarget adds the member to the target catalog under its label in the
+// source catalog, so the secondaries keep the zone's data, and copies its
+// properties other than coo. Properties the target's schema version does
+// not support are dropped.
+func (m *CatalogMover) addToTarget(target config.Catalog, source string, entry catalogEntry, zone string) error {
+	catalogLock, err := lockCatalog(m.cfg, target.Zone, false)
+	if err != nil {
+		return err
+	}
+	defer catalogLock.Release()
+
+	targetEntries, err := transferEntries(m.update, target.Zone)
+	if err != nil {
+		return err
+	}
+	for _, e := range targetEntries {
+		if e.label == entry.label {
+			return &LabelConflictError{Label: entry.label, Zone: zone, Existing: e.zones[0]}
+		}
+	}
+
+	owner := memberOwner(target.Zone, entry.label)
+	sourceOwner := memberOwner(source, entry.label)
+	insert := []dns.RR{memberPTR(target.Zone, entry.label, zone, target.TTL)}
+	for _, rr := range entry.propertyRRs {
+		name := dns.CanonicalName(rr.Header().Name)
+		property := strings.TrimSuffix(name, "."+dns.CanonicalName(sourceOwner))
+		if property == cooProperty || (target.SchemaVersion < 2 && property != labelProperty) {
+			continue
+		}
+		moved := dns.Copy(rr)
+		moved.Header().Name = property + "." + owner
+		moved.Header().Ttl = target.TTL
+		insert = append(insert, moved)
+	}
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(target.Zone)
+	msg.NameNotUsed([]dns.RR{&dns.RR_Header{Name: owner}})
+	msg.Insert(insert)
+	if _, err := m.update.Update(msg); err != nil {
+		return fmt.Errorf("failed to add member to %s: %w", target.Zone, err)
+	}
+	return nil
+}
+
+// waitForSecondaries waits until every secondary serves the catalog zone
+// with the primary's current serial
+func (m *CatalogMover) waitForSecondaries(catalogZone string, timeout time.Duration) error {
+	soa, err := querySOA(m.update, catalogZone)
+	if err != nil {
+		return fmt.Errorf("failed to query serial of %s: %w", catalogZone, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		pending := m.pendingSecondary(catalogZone, soa.Serial)
+		if pending == "" {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("secondary %s has not loaded %s serial %d within %s; run move-catalog again to resume",
+				pending, catalogZone, soa.Serial, timeout)
+		}
+		time.Sleep(m.pollInterval)
+	}
+}
+
+// pendingSecondary returns the first secondary whose copy of the catalog
+// zone is behind serial, or "" if all have caught up
+func (m *CatalogMover) pendingSecondary(catalogZone string, serial uint32) string {
+	for _, addr := range m.cfg.SecondaryAddrs() {
+		client := update.NewClient(addr, "", "", "")
+		client.SetTimeout(m.secondaryTimeout)
+		soa, err := querySOA(client, catalogZone)
+		if err != nil || SerialBehind(soa.Serial, serial) {
+			return addr
+		}
+	}
+	return ""
+}
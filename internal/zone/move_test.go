@@ -0,0 +1,195 @@
+package zone
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/miekg/dns"
+)
+
+// TestMoveCatalog tests the three updates of a move between catalogs
+func TestMoveCatalog(t *testing.T) {
+	label := SHA1WireLabel("example.com.")
+	primary := dnstest.NewServer(t, append(catalogRecords("10"),
+		label+".zones.catalog.example. 60 IN PTR example.com.",
+		"group."+label+".zones.catalog.example. 60 IN TXT \"blue\"",
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)...)
+	secondary := dnstest.NewServer(t,
+		"catalog.example. 60 IN SOA invalid. invalid. 10 3600 600 86400 60",
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.example."}}
+	cfg.Secondaries = []string{secondary.Addr}
+	mover := NewCatalogMover(cfg)
+	mover.pollInterval = 10 * time.Millisecond
+
+	var changes []string
+	if err := mover.MoveCatalog("example.com", "customers", MoveOptions{Timeout: time.Second}, &changes); err != nil {
+		t.Fatalf("MoveCatalog() error = %v", err)
+	}
+	want := "catalog_coo_set:customers.example catalog_member_added:customers.example catalog_member_removed:catalog.example"
+	if got := strings.Join(changes, " "); got != want {
+		t.Errorf("changes = %s, want %s", got, want)
+	}
+
+	updates := primary.Updates()
+	if len(updates) != 3 {
+		t.Fatalf("sent %d updates, want 3", len(updates))
+	}
+
+	// coo in the source catalog points to the target
+	coo, ok := updates[0].Ns[1].(*dns.PTR)
+	if updates[0].Question[0].Name != "catalog.example." || !ok ||
+		coo.Hdr.Name != "coo."+label+".zones.catalog.example." || coo.Ptr != "customers.example." {
+		t.Errorf("coo update = %v", updates[0])
+	}
+
+	// The member keeps its label and properties in the target catalog
+	var added []string
+	for _, rr := range updates[1].Ns {
+		added = append(added, rr.Header().Name)
+	}
+	wantAdded := label + ".zones.customers.example. group." + label + ".zones.customers.example."
+	if updates[1].Question[0].Name != "customers.example." || strings.Join(added, " ") != wantAdded {
+		t.Errorf("target update adds %v, want %s", added, wantAdded)
+	}
+
+	// The source entry is removed last
+	if updates[2].Question[0].Name != "catalog.example." || updates[2].Ns[0].Header().Class != dns.ClassANY {
+		t.Errorf("source removal = %v", updates[2])
+	}
+}
+
+// TestMoveCatalogWaitsForSecondaries tests that the member stays in the
+// source catalog while a secondary has not loaded the coo change
+func TestMoveCatalogWaitsForSecondaries(t *testing.T) {
+	label := SHA1WireLabel("example.com.")
+	primary := dnstest.NewServer(t, append(catalogRecords("10"),
+		label+".zones.catalog.example. 60 IN PTR example.com.",
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)...)
+	secondary := dnstest.NewServer(t,
+		"catalog.example. 60 IN SOA invalid. invalid. 9 3600 600 86400 60",
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.example."}}
+	cfg.Secondaries = []string{secondary.Addr}
+	mover := NewCatalogMover(cfg)
+	mover.pollInterval = 10 * time.Millisecond
+
+	var changes []string
+	err := mover.MoveCatalog("example.com", "customers.example.", MoveOptions{Timeout: 50 * time.Millisecond}, &changes)
+	if err == nil || !strings.Contains(err.Error(), "run move-catalog again") {
+		t.Fatalf("MoveCatalog() error = %v, want a timeout", err)
+	}
+	if n := len(primary.Updates()); n != 1 {
+		t.Errorf("sent %d updates, want only the coo update", n)
+	}
+}
+
+// TestMoveCatalogResume tests that a move whose first steps are done only
+// removes the source entry
+func TestMoveCatalogResume(t *testing.T) {
+	label := SHA1WireLabel("example.com.")
+	primary := dnstest.NewServer(t, append(catalogRecords("10"),
+		label+".zones.catalog.example. 60 IN PTR example.com.",
+		"coo."+label+".zones.catalog.example. 60 IN PTR customers.example.",
+		label+".zones.customers.example. 60 IN PTR example.com.",
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)...)
+	secondary := dnstest.NewServer(t,
+		"catalog.example. 60 IN SOA invalid. invalid. 10 3600 600 86400 60",
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.example."}}
+	cfg.Secondaries = []string{secondary.Addr}
+	mover := NewCatalogMover(cfg)
+	mover.pollInterval = 10 * time.Millisecond
+
+	var changes []string
+	if err := mover.MoveCatalog("example.com", "customers", MoveOptions{Timeout: time.Second}, &changes); err != nil {
+		t.Fatalf("MoveCatalog() error = %v", err)
+	}
+	if got := strings.Join(changes, " "); got != "catalog_member_removed:catalog.example" {
+		t.Errorf("changes = %s, want only the removal", got)
+	}
+	if n := len(primary.Updates()); n != 1 {
+		t.Errorf("sent %d updates, want 1", n)
+	}
+}
+
+// TestMoveCatalogErrors tests moves that are refused before any update
+func TestMoveCatalogErrors(t *testing.T) {
+	primary := dnstest.NewServer(t, append(catalogRecords("10"),
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)...)
+	secondary := dnstest.NewServer(t,
+		"catalog.example. 60 IN SOA invalid. invalid. 10 3600 600 86400 60",
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.example."}}
+	cfg.Secondaries = []string{secondary.Addr}
+	mover := NewCatalogMover(cfg)
+	mover.pollInterval = 10 * time.Millisecond
+
+	var changes []string
+	var optErr *OptionError
+	if err := mover.MoveCatalog("example.com", "unknown", MoveOptions{}, &changes); !errors.As(err, &optErr) {
+		t.Errorf("unknown catalog: error = %v, want *OptionError", err)
+	}
+	if err := mover.MoveCatalog("example.com", "customers", MoveOptions{}, &changes); !errors.Is(err, ErrNotMember) {
+		t.Errorf("non-member: error = %v, want ErrNotMember", err)
+	}
+	cfg.Secondaries = nil
+	if err := mover.MoveCatalog("example.com", "customers", MoveOptions{}, &changes); !errors.Is(err, ErrNoSecondaries) {
+		t.Errorf("no secondaries: error = %v, want ErrNoSecondaries", err)
+	}
+	if n := len(primary.Updates()); n != 0 {
+		t.Errorf("sent %d updates, want none", n)
+	}
+}
+
+// TestMoveCatalogSeveralCatalogs tests that a zone that is a member of two
+// catalogs besides the target is refused as a conflict
+func TestMoveCatalogSeveralCatalogs(t *testing.T) {
+	label := SHA1WireLabel("example.com.")
+	primary := dnstest.NewServer(t, append(catalogRecords("10"),
+		label+".zones.catalog.example. 60 IN PTR example.com.",
+		"legacy.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+		label+".zones.legacy.example. 60 IN PTR example.com.",
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)...)
+	secondary := dnstest.NewServer(t,
+		"catalog.example. 60 IN SOA invalid. invalid. 10 3600 600 86400 60",
+		"customers.example. 60 IN SOA invalid. invalid. 20 3600 600 86400 60",
+	)
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	cfg.Catalog.Catalogs = []config.NamedCatalog{{Name: "customers", Zone: "customers.example."}}
+	cfg.Secondaries = []string{secondary.Addr}
+	mover := NewCatalogMover(cfg)
+	mover.pollInterval = 10 * time.Millisecond
+	cfg.Catalog.Catalogs = append(cfg.Catalog.Catalogs, config.NamedCatalog{Name: "legacy", Zone: "legacy.example."})
+
+	var changes []string
+	err := mover.MoveCatalog("example.com", "customers", MoveOptions{}, &changes)
+	if !errors.Is(err, ErrSeveralCatalogs) {
+		t.Fatalf("MoveCatalog() error = %v, want ErrSeveralCatalogs", err)
+	}
+	if n := len(primary.Updates()); n != 0 {
+		t.Errorf("sent %d updates, want none", n)
+	}
+}
@@ -17,7 +17,17 @@ const (
 )
 
 // NormalizeZone normalizes a zone name to ASCII FQDN with trailing dot (spec 10.1)
+// Validation failures are returned as *NameError.
 func NormalizeZone(input string) (string, error) {
+	zone, err := normalizeZone(input)
+	if err != nil {
+		return "", &NameError{Name: input, Err: err}
+	}
+	return zone, nil
+}
+
+// normalizeZone implements NormalizeZone without wrapping errors
+func normalizeZone(input string) (string, error) {
 	// Trim whitespace
 	input = strings.TrimSpace(input)
 
@@ -80,7 +90,17 @@ func NormalizeZone(input string) (string, error) {
 }
 
 // NormalizeOwner normalizes an owner name relative to a zone (spec 10.2)
+// Validation failures are returned as *NameError.
 func NormalizeOwner(input, zone string) (string, error) {
+	owner, err := normalizeOwner(input, zone)
+	if err != nil {
+		return "", &NameError{Name: input, Err: err}
+	}
+	return owner, nil
+}
+
+// normalizeOwner implements NormalizeOwner without wrapping errors
+func normalizeOwner(input, zone string) (string, error) {
 	input = strings.TrimSpace(input)
 
 	// "@" means zone apex
@@ -1,6 +1,7 @@
 package zone
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -555,3 +556,23 @@ func TestIsWithinZone(t *testing.T) {
 		})
 	}
 }
+
+// TestNormalizeNameError tests that validation failures are typed
+func TestNormalizeNameError(t *testing.T) {
+	_, err := NormalizeZone("bad..example.com")
+	var nameErr *NameError
+	if !errors.As(err, &nameErr) {
+		t.Fatalf("NormalizeZone error = %T, want *NameError", err)
+	}
+	if nameErr.Name != "bad..example.com" {
+		t.Errorf("NameError.Name = %q, want %q", nameErr.Name, "bad..example.com")
+	}
+
+	_, err = NormalizeOwner("www.example.org.", "example.com.")
+	if !errors.As(err, &nameErr) {
+		t.Fatalf("NormalizeOwner error = %T, want *NameError", err)
+	}
+	if !strings.Contains(err.Error(), "owner") {
+		t.Errorf("NormalizeOwner error = %v, expected to contain %q", err, "owner")
+	}
+}
@@ -0,0 +1,288 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// Propagation states of a zone on a secondary
+const (
+	PropagationInSync     = "in_sync"    // Serial equals the primary's
+	PropagationLagging    = "lagging"    // Serial is behind the primary's
+	PropagationMissing    = "missing"    // Zone is in the catalog but not served
+	PropagationUnexpected = "unexpected" // Zone is served but not in the catalog
+	PropagationAbsent     = "absent"     // Zone is neither in the catalog nor served
+	PropagationError      = "error"      // Secondary could not be queried
+)
+
+// SecondarySerial is the propagation state of one zone on one secondary
+type SecondarySerial struct {
+	Server string `json:"server"`
+	Serial uint32 `json:"serial,omitempty"`
+	State  string `json:"state"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ZonePropagation is the propagation state of one zone on all secondaries
+type ZonePropagation struct {
+	Zone          string            `json:"zone"`
+	InCatalog     bool              `json:"in_catalog"`
+	PrimarySerial uint32            `json:"primary_serial,omitempty"`
+	Secondaries   []SecondarySerial `json:"secondaries"`
+}
+
+// Propagation is the result of a propagation check
+type Propagation struct {
+	Catalogs []ZonePropagation `json:"catalogs"` // The catalog zones themselves
+	Zones    []ZonePropagation `json:"zones"`
+	Diverged bool              `json:"diverged"` // Any zone lagging, missing or unexpected
+
+	// Problems that did not prevent the check, e.g. a secondary whose copy
+	// of the catalog could not be transferred
+	Warnings []string `json:"-"`
+}
+
+// Failed reports whether any secondary could not be queried
+func (p *Propagation) Failed() bool {
+	for _, zp := range append(append([]ZonePropagation{}, p.Catalogs...), p.Zones...) {
+		for _, s := range zp.Secondaries {
+			if s.State == PropagationError {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PropagationChecker compares the zones served by the configured secondaries
+// with the primary
+type PropagationChecker struct {
+	cfg    *config.Config
+	update *update.Client
+	lister *Lister
+
+	// Per-query timeout for secondaries
+	secondaryTimeout time.Duration
+}
+
+// NewPropagationChecker creates a new propagation checker
+func NewPropagationChecker(cfg *config.Config) *PropagationChecker {
+	return &PropagationChecker{
+		cfg: cfg,
+		update: update.NewClient(
+			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
+			cfg.TSIG.Name,
+			cfg.TSIG.Secret,
+			cfg.TSIG.Algorithm,
+		),
+		lister:           NewLister(cfg),
+		secondaryTimeout: 5 * time.Second,
+	}
+}
+
+// ErrNoSecondaries means no secondaries are configured to check
+var ErrNoSecondaries = errors.New("no secondaries configured")
+
+// CheckZone checks the propagation of one zone and of the catalog zones
+func (p *PropagationChecker) CheckZone(zoneInput string) (*Propagation, error) {
+	zone, err := NormalizeZone(zoneInput)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone name: %w", err)
+	}
+	if len(p.cfg.Secondaries) == 0 {
+		return nil, ErrNoSecondaries
+	}
+
+	result := &Propagation{}
+	if err := p.checkCatalog(result); err != nil {
+		return nil, err
+	}
+
+	inCatalog := false
+	for _, catalog := range p.cfg.Catalogs() {
+		label, err := lookupMemberLabel(p.update, catalog.Zone, zone)
+		if err != nil {
+			return nil, err
+		}
+		inCatalog = inCatalog || label != ""
+	}
+
+	zp, err := p.checkZone(zone, inCatalog)
+	if err != nil {
+		return nil, err
+	}
+	result.Zones = []ZonePropagation{*zp}
+	result.Diverged = result.Diverged || diverged(zp)
+
+	return result, nil
+}
+
+// CheckAll checks the propagation of the catalog zones and of every member.
+// Zones in a secondary's copy of a catalog that the primary's catalogs no
+// longer list are reported as unexpected.
+func (p *PropagationChecker) CheckAll() (*Propagation, error) {
+	if len(p.cfg.Secondaries) == 0 {
+		return nil, ErrNoSecondaries
+	}
+
+	result := &Propagation{Zones: []ZonePropagation{}}
+	if err := p.checkCatalog(result); err != nil {
+		return nil, err
+	}
+
+	members, err := p.lister.CatalogMembers()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Zone < members[j].Zone })
+
+	inCatalog := make(map[string]bool, len(members))
+	for _, member := range members {
+		inCatalog[member.Zone] = true
+
+		zp, err := p.checkZone(member.Zone, true)
+		if err != nil {
+			// A member the primary does not serve is reported, not fatal
+			result.Warnings = append(result.Warnings, err.Error())
+			continue
+		}
+		result.Zones = append(result.Zones, *zp)
+		result.Diverged = result.Diverged || diverged(zp)
+	}
+
+	for _, zone := range p.unexpectedZones(inCatalog, result) {
+		zp, err := p.checkZone(zone, false)
+		if err != nil {
+			result.Warnings = append(result.Warnings, err.Error())
+			continue
+		}
+		result.Zones = append(result.Zones, *zp)
+		result.Diverged = result.Diverged || diverged(zp)
+	}
+
+	return result, nil
+}
+
+// checkCatalog checks that every secondary serves the current catalog zones
+func (p *PropagationChecker) checkCatalog(result *Propagation) error {
+	for _, catalog := range p.cfg.Catalogs() {
+		zp, err := p.checkZone(catalog.Zone, true)
+		if err != nil {
+			return err
+		}
+		result.Catalogs = append(result.Catalogs, *zp)
+		result.Diverged = result.Diverged || diverged(zp)
+	}
+	return nil
+}
+
+// checkZone compares the zone's serial on each secondary with the primary.
+// inCatalog says whether the secondaries are expected to serve the zone.
+func (p *PropagationChecker) checkZone(zone string, inCatalog bool) (*ZonePropagation, error) {
+	zp := &ZonePropagation{Zone: zone, InCatalog: inCatalog}
+
+	if inCatalog {
+		soa, err := querySOA(p.update, zone)
+		if err != nil {
+			return nil, fmt.Errorf("primary does not serve %s: %w", zone, err)
+		}
+		zp.PrimarySerial = soa.Serial
+	}
+
+	for _, addr := range p.cfg.SecondaryAddrs() {
+		secondary := SecondarySerial{Server: addr}
+		serial, served, err := p.querySecondary(addr, zone)
+		switch {
+		case err != nil:
+			secondary.State = PropagationError
+			secondary.Error = err.Error()
+		case served && !inCatalog:
+			secondary.Serial = serial
+			secondary.State = PropagationUnexpected
+		case !served && inCatalog:
+			secondary.State = PropagationMissing
+		case !served:
+			secondary.State = PropagationAbsent
+		case SerialBehind(serial, zp.PrimarySerial):
+			secondary.Serial = serial
+			secondary.State = PropagationLagging
+		default:
+			secondary.Serial = serial
+			secondary.State = PropagationInSync
+		}
+		zp.Secondaries = append(zp.Secondaries, secondary)
+	}
+
+	return zp, nil
+}
+
+// querySecondary queries a secondary for a zone's SOA serial. A secondary
+// that refuses the query or has no SOA for the zone does not serve it.
+func (p *PropagationChecker) querySecondary(addr, zone string) (uint32, bool, error) {
+	client := update.NewClient(addr, "", "", "")
+	client.SetTimeout(p.secondaryTimeout)
+
+	response, err := client.Query(zone, dns.TypeSOA)
+	if err != nil {
+		var rcodeErr *update.RcodeError
+		if errors.As(err, &rcodeErr) && (rcodeErr.Rcode == dns.RcodeRefused || rcodeErr.Rcode == dns.RcodeNotAuth) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	for _, rr := range response.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && dns.CanonicalName(soa.Hdr.Name) == dns.CanonicalName(zone) {
+			return soa.Serial, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// unexpectedZones returns the members of the secondaries' copies of the
+// catalogs that are not in the primary's catalogs
+func (p *PropagationChecker) unexpectedZones(inCatalog map[string]bool, result *Propagation) []string {
+	seen := make(map[string]bool)
+	var zones []string
+
+	for _, addr := range p.cfg.SecondaryAddrs() {
+		client := update.NewClient(addr, p.cfg.TSIG.Name, p.cfg.TSIG.Secret, p.cfg.TSIG.Algorithm)
+		client.SetTimeout(p.secondaryTimeout)
+
+		for _, catalog := range p.cfg.Catalogs() {
+			rrs, err := client.Transfer(catalog.Zone)
+			if err != nil {
+				result.Warnings = append(result.Warnings,
+					fmt.Sprintf("secondary %s: cannot transfer catalog %s to look for unexpected zones: %v", addr, catalog.Zone, err))
+				continue
+			}
+			for _, member := range ParseCatalogMembers(catalog.Zone, rrs) {
+				if !inCatalog[member.Zone] && !seen[member.Zone] {
+					seen[member.Zone] = true
+					zones = append(zones, member.Zone)
+				}
+			}
+		}
+	}
+
+	sort.Strings(zones)
+	return zones
+}
+
+// diverged reports whether any secondary's copy of the zone differs from
+// what the primary's catalog expects
+func diverged(zp *ZonePropagation) bool {
+	for _, s := range zp.Secondaries {
+		switch s.State {
+		case PropagationLagging, PropagationMissing, PropagationUnexpected:
+			return true
+		}
+	}
+	return false
+}
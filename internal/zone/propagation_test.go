@@ -0,0 +1,197 @@
+package zone
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/dnstest"
+)
+
+// catalogRecords returns the records of catalog.example. with the given
+// serial and members
+func catalogRecords(serial string, members ...string) []string {
+	records := []string{
+		"catalog.example. 60 IN SOA invalid. invalid. " + serial + " 3600 600 86400 60",
+		"catalog.example. 60 IN NS invalid.",
+		"version.catalog.example. 60 IN TXT \"2\"",
+	}
+	for _, member := range members {
+		records = append(records, SHA1WireLabel(member)+".zones.catalog.example. 60 IN PTR "+member)
+	}
+	return records
+}
+
+// zoneSOA returns an SOA record for zone with the given serial
+func zoneSOA(zone, serial string) string {
+	return zone + " 3600 IN SOA ns1." + zone + " hostmaster." + zone + " " + serial + " 7200 900 1209600 300"
+}
+
+// secondaryState returns the state reported for server
+func secondaryState(t *testing.T, zp ZonePropagation, server string) SecondarySerial {
+	t.Helper()
+	for _, s := range zp.Secondaries {
+		if s.Server == server {
+			return s
+		}
+	}
+	t.Fatalf("no state for secondary %s in %+v", server, zp)
+	return SecondarySerial{}
+}
+
+// TestCheckAll tests the bulk propagation check
+func TestCheckAll(t *testing.T) {
+	primary := dnstest.NewServer(t, append(catalogRecords("10", "a.example.", "b.example."),
+		zoneSOA("a.example.", "5"),
+		zoneSOA("b.example.", "5"),
+	)...)
+	inSync := dnstest.NewServer(t, append(catalogRecords("10", "a.example.", "b.example."),
+		zoneSOA("a.example.", "5"),
+		zoneSOA("b.example.", "5"),
+	)...).Addr
+	// Still has c.example., which was removed from the catalog, lags on
+	// a.example. and has not picked up b.example. or the new catalog serial
+	stale := dnstest.NewServer(t, append(catalogRecords("9", "a.example.", "c.example."),
+		zoneSOA("a.example.", "4"),
+		zoneSOA("c.example.", "1"),
+	)...).Addr
+
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	cfg.Secondaries = []string{inSync, stale}
+	checker := NewPropagationChecker(cfg)
+	result, err := checker.CheckAll()
+	if err != nil {
+		t.Fatalf("CheckAll() error = %v", err)
+	}
+
+	if !result.Diverged {
+		t.Error("Diverged = false, want true")
+	}
+	if result.Failed() {
+		t.Error("Failed() = true, want false")
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("Warnings = %q, want none", result.Warnings)
+	}
+
+	if len(result.Catalogs) != 1 || result.Catalogs[0].Zone != "catalog.example." || result.Catalogs[0].PrimarySerial != 10 {
+		t.Fatalf("Catalogs = %+v", result.Catalogs)
+	}
+	if s := secondaryState(t, result.Catalogs[0], inSync); s.State != PropagationInSync {
+		t.Errorf("catalog on in-sync secondary = %+v", s)
+	}
+	if s := secondaryState(t, result.Catalogs[0], stale); s.State != PropagationLagging || s.Serial != 9 {
+		t.Errorf("catalog on stale secondary = %+v, want lagging at 9", s)
+	}
+
+	zones := make(map[string]ZonePropagation)
+	for _, zp := range result.Zones {
+		zones[zp.Zone] = zp
+	}
+	if len(zones) != 3 {
+		t.Fatalf("Zones = %+v, want a, b and c", result.Zones)
+	}
+
+	want := []struct {
+		zone, server, state string
+	}{
+		{"a.example.", inSync, PropagationInSync},
+		{"a.example.", stale, PropagationLagging},
+		{"b.example.", inSync, PropagationInSync},
+		{"b.example.", stale, PropagationMissing},
+		{"c.example.", inSync, PropagationAbsent},
+		{"c.example.", stale, PropagationUnexpected},
+	}
+	for _, w := range want {
+		if s := secondaryState(t, zones[w.zone], w.server); s.State != w.state {
+			t.Errorf("%s on %s = %+v, want %s", w.zone, w.server, s, w.state)
+		}
+	}
+	if zones["c.example."].InCatalog {
+		t.Error("c.example. reported in catalog")
+	}
+}
+
+// TestCheckZone tests the single-zone propagation check
+func TestCheckZone(t *testing.T) {
+	primary := dnstest.NewServer(t, append(catalogRecords("10", "a.example."),
+		zoneSOA("a.example.", "5"),
+	)...)
+	secondary := dnstest.NewServer(t, append(catalogRecords("10", "a.example."),
+		zoneSOA("a.example.", "5"),
+	)...).Addr
+
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	cfg.Secondaries = []string{secondary}
+	checker := NewPropagationChecker(cfg)
+	result, err := checker.CheckZone("A.Example")
+	if err != nil {
+		t.Fatalf("CheckZone() error = %v", err)
+	}
+	if result.Diverged || result.Failed() {
+		t.Errorf("Diverged = %v, Failed() = %v, want neither", result.Diverged, result.Failed())
+	}
+	if len(result.Zones) != 1 || result.Zones[0].Zone != "a.example." || !result.Zones[0].InCatalog {
+		t.Fatalf("Zones = %+v", result.Zones)
+	}
+	if s := result.Zones[0].Secondaries[0]; s.State != PropagationInSync || s.Serial != 5 {
+		t.Errorf("secondary = %+v, want in sync at 5", s)
+	}
+
+	// A zone the primary does not have is absent everywhere
+	result, err = checker.CheckZone("gone.example.")
+	if err != nil {
+		t.Fatalf("CheckZone() error = %v", err)
+	}
+	if result.Diverged || result.Zones[0].Secondaries[0].State != PropagationAbsent {
+		t.Errorf("gone.example. = %+v, want absent", result.Zones[0])
+	}
+}
+
+// TestCheckZoneUnreachableSecondary tests that a secondary that cannot be
+// queried is reported as an error rather than as divergence
+func TestCheckZoneUnreachableSecondary(t *testing.T) {
+	primary := dnstest.NewServer(t, append(catalogRecords("10", "a.example."),
+		zoneSOA("a.example.", "5"),
+	)...)
+
+	// Nothing listens on a port that was just released
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := conn.LocalAddr().String()
+	conn.Close()
+
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	cfg.Secondaries = []string{unreachable}
+	checker := NewPropagationChecker(cfg)
+	result, err := checker.CheckZone("a.example.")
+	if err != nil {
+		t.Fatalf("CheckZone() error = %v", err)
+	}
+	if result.Diverged {
+		t.Error("Diverged = true, want false")
+	}
+	if !result.Failed() {
+		t.Error("Failed() = false, want true")
+	}
+	if s := result.Zones[0].Secondaries[0]; s.State != PropagationError || s.Error == "" {
+		t.Errorf("secondary = %+v, want an error", s)
+	}
+}
+
+// TestCheckNoSecondaries tests that a check without secondaries is refused
+func TestCheckNoSecondaries(t *testing.T) {
+	checker := NewPropagationChecker(viewTestConfig(t))
+
+	if _, err := checker.CheckZone("example.com."); !errors.Is(err, ErrNoSecondaries) {
+		t.Errorf("CheckZone() error = %v, want ErrNoSecondaries", err)
+	}
+	if _, err := checker.CheckAll(); !errors.Is(err, ErrNoSecondaries) {
+		t.Errorf("CheckAll() error = %v, want ErrNoSecondaries", err)
+	}
+}
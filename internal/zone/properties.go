@@ -0,0 +1,283 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// groupProperty is the RFC 9432 group property, which secondaries such as
+// BIND use to select the template a member zone is configured with:
+// group.<label>.zones.<catalog> TXT "<group>"
+const groupProperty = "group"
+
+// PropertyChange is a change to the schema v2 properties of a catalog member
+type PropertyChange struct {
+	Group      string            // New group; empty leaves the group as is
+	ClearGroup bool              // Remove the group property
+	Set        map[string]string // Custom properties to set, by key
+	Remove     []string          // Custom properties to remove, by key
+}
+
+// Empty reports whether the change does nothing
+func (p PropertyChange) Empty() bool {
+	return p.Group == "" && !p.ClearGroup && len(p.Set) == 0 && len(p.Remove) == 0
+}
+
+// ParseProperties parses key=value pairs into custom member properties.
+// Invalid pairs are returned as *OptionError.
+func ParseProperties(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	properties := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, &OptionError{Option: "property", Err: fmt.Errorf("expected key=value, got %q", pair)}
+		}
+		key = strings.ToLower(key)
+		if _, dup := properties[key]; dup {
+			return nil, &OptionError{Option: "property", Err: fmt.Errorf("key %q given more than once", key)}
+		}
+		properties[key] = value
+	}
+	return properties, nil
+}
+
+// validate checks a property change against the catalog schema version
+func (p PropertyChange) validate(schemaVersion int) error {
+	if p.Empty() {
+		return nil
+	}
+	if schemaVersion < 2 {
+		return &OptionError{Option: "property", Err: fmt.Errorf("member properties require catalog.schema_version 2")}
+	}
+	if p.Group != "" && p.ClearGroup {
+		return &OptionError{Option: "catalog-group", Err: fmt.Errorf("cannot set and clear the group at once")}
+	}
+	if p.Group != "" {
+		if err := validatePropertyValue(p.Group); err != nil {
+			return &OptionError{Option: "catalog-group", Err: err}
+		}
+	}
+	for key, value := range p.Set {
+		if err := validatePropertyKey(key); err != nil {
+			return &OptionError{Option: "property", Err: err}
+		}
+		if err := validatePropertyValue(value); err != nil {
+			return &OptionError{Option: "property", Err: fmt.Errorf("%s: %w", key, err)}
+		}
+	}
+	for _, key := range p.Remove {
+		if err := validatePropertyKey(key); err != nil {
+			return &OptionError{Option: "remove-property", Err: err}
+		}
+		if _, set := p.Set[key]; set {
+			return &OptionError{Option: "remove-property", Err: fmt.Errorf("cannot set and remove %q at once", key)}
+		}
+	}
+	return nil
+}
+
+// validatePropertyKey checks that a custom property key is a single DNS
+// label that does not clash with the properties dnsctl maintains itself
+func validatePropertyKey(key string) error {
+	if err := validateMemberLabel(key); err != nil {
+		return fmt.Errorf("property key: %w", err)
+	}
+	if key+".ext" == labelProperty {
+		return fmt.Errorf("property key %q is reserved", key)
+	}
+	return nil
+}
+
+// validatePropertyValue checks that a property value fits one TXT string
+func validatePropertyValue(value string) error {
+	if value == "" {
+		return fmt.Errorf("value must not be empty")
+	}
+	if len(value) > 255 {
+		return fmt.Errorf("value must be at most 255 bytes, got %d", len(value))
+	}
+	return nil
+}
+
+// extProperty returns the property name of a custom property key, which
+// BIND keeps below the ext label: <key>.ext.<label>.zones.<catalog>
+func extProperty(key string) string {
+	return key + ".ext"
+}
+
+// propertyTXT returns a member property TXT record
+func propertyTXT(catalogZone, label, name, value string, ttl uint32) *dns.TXT {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   name + "." + memberOwner(catalogZone, label),
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Txt: []string{value},
+	}
+}
+
+// applyProperties adds a property change for the member at label to an
+// update: each property set replaces its RRset, each one removed is deleted
+func applyProperties(msg *dns.Msg, catalogZone, label string, change PropertyChange, ttl uint32) {
+	replace := func(name, value string) {
+		rr := propertyTXT(catalogZone, label, name, value, ttl)
+		msg.RemoveRRset([]dns.RR{rr})
+		msg.Insert([]dns.RR{rr})
+	}
+	remove := func(name string) {
+		msg.RemoveName([]dns.RR{&dns.RR_Header{Name: name + "." + memberOwner(catalogZone, label)}})
+	}
+
+	if change.Group != "" {
+		replace(groupProperty, change.Group)
+	}
+	if change.ClearGroup {
+		remove(groupProperty)
+	}
+	keys := make([]string, 0, len(change.Set))
+	for key := range change.Set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		replace(extProperty(key), change.Set[key])
+	}
+	for _, key := range change.Remove {
+		remove(extProperty(key))
+	}
+}
+
+// changedProperty reports whether a property change sets or removes the
+// property owned by name below a member label
+func (p PropertyChange) changedProperty(name string) bool {
+	if name == groupProperty {
+		return p.Group != "" || p.ClearGroup
+	}
+	key, found := strings.CutSuffix(name, ".ext")
+	if !found {
+		return false
+	}
+	_, set := p.Set[key]
+	return set || contains(p.Remove, key)
+}
+
+// propertyChanges returns the change records for a property change
+func propertyChanges(change PropertyChange) []string {
+	var changes []string
+	if change.Group != "" {
+		changes = append(changes, "catalog_group_set:"+change.Group)
+	}
+	if change.ClearGroup {
+		changes = append(changes, "catalog_group_removed")
+	}
+	keys := make([]string, 0, len(change.Set))
+	for key := range change.Set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		changes = append(changes, "catalog_property_set:"+key)
+	}
+	for _, key := range change.Remove {
+		changes = append(changes, "catalog_property_removed:"+key)
+	}
+	return changes
+}
+
+// PropertySetter changes the properties of existing catalog members
+type PropertySetter struct {
+	cfg    *config.Config
+	update *update.Client
+}
+
+// NewPropertySetter creates a new catalog property setter
+func NewPropertySetter(cfg *config.Config) *PropertySetter {
+	return &PropertySetter{
+		cfg: cfg,
+		update: update.NewClient(
+			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
+			cfg.TSIG.Name,
+			cfg.TSIG.Secret,
+			cfg.TSIG.Algorithm,
+		),
+	}
+}
+
+// ErrNotMember means the zone is not a member of the catalog zone
+var ErrNotMember = errors.New("zone is not a catalog member")
+
+// SetProperties applies a property change to a catalog member under its
+// zone lock. The update is made conditional on the member PTR, so a member
+// removed or moved concurrently is not given stray properties.
+func (s *PropertySetter) SetProperties(zoneInput string, change PropertyChange, changes *[]string) error {
+	zone, err := NormalizeZone(zoneInput)
+	if err != nil {
+		return fmt.Errorf("invalid zone name: %w", err)
+	}
+	if change.Empty() {
+		return &OptionError{Option: "property", Err: fmt.Errorf("nothing to change")}
+	}
+
+	zoneLock := lock.New(s.cfg.LockFilePath(zone))
+	if err := zoneLock.Acquire(); err != nil {
+		return fmt.Errorf("failed to acquire zone lock: %w", err)
+	}
+	defer zoneLock.Release()
+
+	memberships, err := findMemberships(s.update, s.cfg, zone)
+	if err != nil {
+		return err
+	}
+	if len(memberships) == 0 {
+		return fmt.Errorf("%s: %w", zone, ErrNotMember)
+	}
+	catalog, label := memberships[0].catalog, memberships[0].current[0].label
+	if err := change.validate(catalog.SchemaVersion); err != nil {
+		return err
+	}
+
+	catalogLock, err := lockCatalog(s.cfg, catalog.Zone, false)
+	if err != nil {
+		return err
+	}
+	defer catalogLock.Release()
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(catalog.Zone)
+	msg.Used([]dns.RR{memberPTR(catalog.Zone, label, zone, catalog.TTL)})
+	applyProperties(msg, catalog.Zone, label, change, catalog.TTL)
+
+	if _, err := s.update.Update(msg); err != nil {
+		return fmt.Errorf("failed to send catalog update: %w", err)
+	}
+
+	*changes = append(*changes, propertyChanges(change)...)
+	return nil
+}
+
+// entryProperties returns the properties of a catalog entry keyed by their
+// name below the member label (e.g. "group", "coo", "tier.ext")
+func entryProperties(catalogZone string, entry catalogEntry) map[string][]string {
+	if len(entry.propertyRRs) == 0 {
+		return nil
+	}
+	owner := "." + memberOwner(catalogZone, entry.label)
+	properties := make(map[string][]string)
+	for _, rr := range entry.propertyRRs {
+		name := strings.TrimSuffix(dns.CanonicalName(rr.Header().Name), dns.CanonicalName(owner))
+		properties[name] = append(properties[name], propertyValue(rr))
+	}
+	return properties
+}
@@ -0,0 +1,130 @@
+package zone
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// TestParseProperties tests parsing key=value member properties
+func TestParseProperties(t *testing.T) {
+	got, err := ParseProperties([]string{"Tier=gold", "note=a=b"})
+	if err != nil {
+		t.Fatalf("ParseProperties() error = %v", err)
+	}
+	want := map[string]string{"tier": "gold", "note": "a=b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseProperties() = %v, want %v", got, want)
+	}
+
+	for _, pairs := range [][]string{{"novalue"}, {"a=1", "A=2"}} {
+		var optErr *OptionError
+		if _, err := ParseProperties(pairs); !errors.As(err, &optErr) {
+			t.Errorf("ParseProperties(%q) error = %v, want *OptionError", pairs, err)
+		}
+	}
+}
+
+// TestPropertyChangeValidate tests property validation and the schema
+// version requirement
+func TestPropertyChangeValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  PropertyChange
+		schema  int
+		wantErr bool
+	}{
+		{"empty on v1", PropertyChange{}, 1, false},
+		{"group", PropertyChange{Group: "customers"}, 2, false},
+		{"group on v1", PropertyChange{Group: "customers"}, 1, true},
+		{"set and clear group", PropertyChange{Group: "a", ClearGroup: true}, 2, true},
+		{"property", PropertyChange{Set: map[string]string{"tier": "gold"}}, 2, false},
+		{"bad key", PropertyChange{Set: map[string]string{"a.b": "x"}}, 2, true},
+		{"reserved key", PropertyChange{Set: map[string]string{"label": "x"}}, 2, true},
+		{"empty value", PropertyChange{Set: map[string]string{"tier": ""}}, 2, true},
+		{"long value", PropertyChange{Set: map[string]string{"tier": strings.Repeat("x", 256)}}, 2, true},
+		{"set and remove", PropertyChange{Set: map[string]string{"tier": "x"}, Remove: []string{"tier"}}, 2, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.change.validate(tt.schema)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var optErr *OptionError
+			if err != nil && !errors.As(err, &optErr) {
+				t.Errorf("validate() error = %v, want *OptionError", err)
+			}
+		})
+	}
+}
+
+// TestSetProperties tests the update sent to change member properties
+func TestSetProperties(t *testing.T) {
+	server := dnstest.NewServer(t, append(catalogRecords("1", "example.com."),
+		"group."+SHA1WireLabel("example.com.")+".zones.catalog.example. 60 IN TXT \"old\"",
+	)...)
+	setter := &PropertySetter{
+		cfg:    viewTestConfig(t),
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	change := PropertyChange{Group: "customers", Set: map[string]string{"tier": "gold"}, Remove: []string{"old"}}
+	if err := setter.SetProperties("example.com", change, &changes); err != nil {
+		t.Fatalf("SetProperties() error = %v", err)
+	}
+	wantChanges := []string{"catalog_group_set:customers", "catalog_property_set:tier", "catalog_property_removed:old"}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes = %v, want %v", changes, wantChanges)
+	}
+
+	updates := server.Updates()
+	if len(updates) != 1 {
+		t.Fatalf("sent %d updates, want 1", len(updates))
+	}
+	u := updates[0]
+	owner := SHA1WireLabel("example.com.") + ".zones.catalog.example."
+
+	// The member PTR must still be in place
+	if len(u.Answer) != 1 || u.Answer[0].Header().Name != owner || u.Answer[0].Header().Class != dns.ClassINET {
+		t.Errorf("prerequisites = %v, want the member PTR", u.Answer)
+	}
+
+	var got []string
+	for _, rr := range u.Ns {
+		got = append(got, dns.ClassToString[rr.Header().Class]+" "+rr.Header().Name)
+	}
+	want := []string{
+		"ANY group." + owner, "IN group." + owner,
+		"ANY tier.ext." + owner, "IN tier.ext." + owner,
+		"ANY old.ext." + owner,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("update = %v, want %v", got, want)
+	}
+}
+
+// TestSetPropertiesNotMember tests that a zone outside the catalog is refused
+func TestSetPropertiesNotMember(t *testing.T) {
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+	setter := &PropertySetter{
+		cfg:    viewTestConfig(t),
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	err := setter.SetProperties("example.com", PropertyChange{Group: "customers"}, &changes)
+	if !errors.Is(err, ErrNotMember) {
+		t.Errorf("SetProperties() error = %v, want ErrNotMember", err)
+	}
+	if n := len(server.Updates()); n != 0 {
+		t.Errorf("sent %d updates, want none", n)
+	}
+}
@@ -0,0 +1,429 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/lock"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// Kinds of catalog inconsistency found by Reconcile
+const (
+	IssueOrphanPTR     = "orphan_ptr"     // Catalog member named does not serve
+	IssueMissingPTR    = "missing_ptr"    // Zone named serves that the catalog lacks
+	IssueLabelMismatch = "label_mismatch" // Member label is not its sha1-wire label
+	IssueDuplicatePTR  = "duplicate_ptr"  // Several PTRs at one member label
+)
+
+// CatalogIssue is one inconsistency between the catalog, named and zones.dir
+type CatalogIssue struct {
+	Kind    string `json:"kind"`
+	Catalog string `json:"catalog"`
+	Zone    string `json:"zone"`
+	Label   string `json:"label,omitempty"`
+	Detail  string `json:"detail"`
+	Fixed   bool   `json:"fixed"`
+}
+
+// ReconcileResult lists the inconsistencies found and, with apply, fixed
+type ReconcileResult struct {
+	Issues  []CatalogIssue `json:"issues"`
+	Applied bool           `json:"applied"`
+}
+
+// Reconciler compares the catalog zone with the zones named serves and the
+// zone files under zones.dir
+type Reconciler struct {
+	cfg    *config.Config
+	views  []viewRNDC
+	update *update.Client
+}
+
+// NewReconciler creates a new catalog reconciler
+func NewReconciler(cfg *config.Config) *Reconciler {
+	return &Reconciler{
+		cfg:   cfg,
+		views: newViewRNDCs(cfg),
+		update: update.NewClient(
+			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
+			cfg.TSIG.Name,
+			cfg.TSIG.Secret,
+			cfg.TSIG.Algorithm,
+		),
+	}
+}
+
+// Reconcile finds inconsistencies in every catalog zone. With apply each
+// one is fixed under the zone lock of the member it concerns, holding every
+// catalog lock exclusively, and every fix is appended to changes; otherwise
+// the fixes that would be made are appended. Fixing stops at the first
+// error.
+func (r *Reconciler) Reconcile(apply bool, changes *[]string) (*ReconcileResult, error) {
+	result := &ReconcileResult{Issues: []CatalogIssue{}, Applied: apply}
+	catalogs := r.cfg.Catalogs()
+
+	if apply {
+		for _, catalog := range catalogs {
+			catalogLock, err := lockCatalog(r.cfg, catalog.Zone, true)
+			if err != nil {
+				return nil, err
+			}
+			defer catalogLock.Release()
+		}
+	}
+
+	members := make(map[string]bool)
+	for _, catalog := range catalogs {
+		if err := r.reconcileCatalog(catalog, apply, changes, result, members); err != nil {
+			return result, err
+		}
+	}
+
+	issues, err := r.missingMembers(members, apply, changes)
+	result.Issues = append(result.Issues, issues...)
+	return result, err
+}
+
+// AddMissing finds the zones with a zone file that named serves but no
+// catalog has, the missing_ptr issues of Reconcile, leaving the catalogs
+// alone otherwise. With apply each one is added to the catalog the rules
+// select under its zone lock, holding every catalog lock shared.
+func (r *Reconciler) AddMissing(apply bool, changes *[]string) ([]CatalogIssue, error) {
+	members := make(map[string]bool)
+	for _, catalog := range r.cfg.Catalogs() {
+		if apply {
+			catalogLock, err := lockCatalog(r.cfg, catalog.Zone, false)
+			if err != nil {
+				return nil, err
+			}
+			defer catalogLock.Release()
+		}
+
+		entries, err := transferEntries(r.update, catalog.Zone)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			for _, z := range entry.zones {
+				members[z] = true
+			}
+		}
+	}
+
+	return r.missingMembers(members, apply, changes)
+}
+
+// missingMembers finds the zones with a zone file that named serves but
+// that are not in members; they are added to the catalog the rules select.
+// The catalog zones themselves, which have zone files too, are never added.
+func (r *Reconciler) missingMembers(members map[string]bool, apply bool, changes *[]string) ([]CatalogIssue, error) {
+	candidates, err := r.zoneFileZones()
+	if err != nil {
+		return nil, err
+	}
+	catalogs := r.cfg.Catalogs()
+	isCatalog := make(map[string]bool, len(catalogs))
+	for _, catalog := range catalogs {
+		isCatalog[dns.CanonicalName(catalog.Zone)] = true
+	}
+
+	issues := []CatalogIssue{}
+	for _, z := range candidates {
+		if members[z] || isCatalog[z] {
+			continue
+		}
+		served, err := r.served(z)
+		if err != nil {
+			return issues, err
+		}
+		if !served {
+			continue
+		}
+		catalog, err := r.cfg.SelectCatalog(z, "")
+		if err != nil {
+			return issues, err
+		}
+		issue := CatalogIssue{
+			Kind:    IssueMissingPTR,
+			Catalog: catalog.Zone,
+			Zone:    z,
+			Label:   SHA1WireLabel(z),
+			Detail:  "named serves this zone but no catalog has it",
+		}
+		if err := r.fix(&issue, apply, changes, "catalog_ptr_added:"+trimDot(z), func() error {
+			return r.addMissing(catalog, z)
+		}); err != nil {
+			return issues, err
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues, nil
+}
+
+// reconcileCatalog finds the duplicate, orphan and mislabelled members of
+// one catalog zone and records its members
+func (r *Reconciler) reconcileCatalog(catalog config.Catalog, apply bool, changes *[]string, result *ReconcileResult, members map[string]bool) error {
+	entries, err := transferEntries(r.update, catalog.Zone)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		// Duplicates: keep one PTR and drop the rest
+		keep, served, err := r.keepPTR(entry)
+		if err != nil {
+			return err
+		}
+		for _, z := range entry.zones {
+			if z == keep {
+				continue
+			}
+			issue := CatalogIssue{
+				Kind:    IssueDuplicatePTR,
+				Catalog: catalog.Zone,
+				Zone:    z,
+				Label:   entry.label,
+				Detail:  fmt.Sprintf("label %s also points to %s", entry.label, keep),
+			}
+			if err := r.fix(&issue, apply, changes, "catalog_duplicate_removed:"+trimDot(z), func() error {
+				return r.removePTR(catalog, entry.label, z)
+			}); err != nil {
+				return err
+			}
+			result.Issues = append(result.Issues, issue)
+		}
+
+		if !served {
+			issue := CatalogIssue{
+				Kind:    IssueOrphanPTR,
+				Catalog: catalog.Zone,
+				Zone:    keep,
+				Label:   entry.label,
+				Detail:  "named does not serve this zone",
+			}
+			if err := r.fix(&issue, apply, changes, "catalog_ptr_removed:"+trimDot(keep), func() error {
+				return r.removeOrphan(catalog, keep, entry)
+			}); err != nil {
+				return err
+			}
+			result.Issues = append(result.Issues, issue)
+			continue
+		}
+
+		// Freely chosen labels are recorded with the label.ext property
+		if want := SHA1WireLabel(keep); entry.label != want && entry.labelKind == "" {
+			issue := CatalogIssue{
+				Kind:    IssueLabelMismatch,
+				Catalog: catalog.Zone,
+				Zone:    keep,
+				Label:   entry.label,
+				Detail:  fmt.Sprintf("sha1-wire label is %s", want),
+			}
+			if err := r.fix(&issue, apply, changes, "catalog_label_fixed:"+trimDot(keep), func() error {
+				return r.relabel(catalog, keep, entry, entries)
+			}); err != nil {
+				return err
+			}
+			result.Issues = append(result.Issues, issue)
+		}
+		members[keep] = true
+	}
+
+	return nil
+}
+
+// keepPTR picks the PTR to keep of a member label: one to a zone named
+// serves if there is any, preferring the zone whose sha1-wire label is the
+// label, or else the first. It reports whether named serves the zone kept.
+func (r *Reconciler) keepPTR(entry catalogEntry) (string, bool, error) {
+	keep, keepServed := "", false
+	for _, z := range entry.zones {
+		served, err := r.served(z)
+		if err != nil {
+			return "", false, err
+		}
+		switch {
+		case keep == "", served && !keepServed:
+			keep, keepServed = z, served
+		case served == keepServed && SHA1WireLabel(z) == entry.label:
+			keep = z
+		}
+	}
+	return keep, keepServed, nil
+}
+
+// fix records the change for an issue and, with apply, runs the fix first
+func (r *Reconciler) fix(issue *CatalogIssue, apply bool, changes *[]string, change string, fn func() error) error {
+	if apply {
+		if err := fn(); err != nil {
+			return fmt.Errorf("failed to fix %s for %s: %w", issue.Kind, issue.Zone, err)
+		}
+		issue.Fixed = true
+	}
+	*changes = append(*changes, change)
+	return nil
+}
+
+// removePTR removes one PTR at a member label, leaving any others in place
+func (r *Reconciler) removePTR(catalog config.Catalog, label, zone string) error {
+	return r.withZoneLock(zone, func() error {
+		msg := new(dns.Msg)
+		msg.SetUpdate(catalog.Zone)
+		msg.Remove([]dns.RR{memberPTR(catalog.Zone, label, zone, catalog.TTL)})
+		_, err := r.update.Update(msg)
+		return err
+	})
+}
+
+// removeOrphan removes a member that named does not serve, with its
+// properties. The zone is checked again under its lock, so a zone created
+// concurrently keeps its catalog entry.
+func (r *Reconciler) removeOrphan(catalog config.Catalog, zone string, entry catalogEntry) error {
+	return r.withZoneLock(zone, func() error {
+		served, err := r.served(zone)
+		if err != nil {
+			return err
+		}
+		if served {
+			return nil
+		}
+
+		msg := new(dns.Msg)
+		msg.SetUpdate(catalog.Zone)
+		removeMember(msg, catalog.Zone, entry)
+		_, err = r.update.Update(msg)
+		return err
+	})
+}
+
+// relabel moves a member from its entry's label to its sha1-wire label in
+// one update, carrying its properties over to the new label. The
+// prerequisite that the new owner is unused keeps it from overwriting
+// another member; that member, found in entries, is reported with
+// *LabelConflictError.
+func (r *Reconciler) relabel(catalog config.Catalog, zone string, entry catalogEntry, entries []catalogEntry) error {
+	return r.withZoneLock(zone, func() error {
+		label := SHA1WireLabel(zone)
+		oldOwner := dns.CanonicalName(memberOwner(catalog.Zone, entry.label))
+		owner := memberOwner(catalog.Zone, label)
+
+		msg := new(dns.Msg)
+		msg.SetUpdate(catalog.Zone)
+		msg.NameNotUsed([]dns.RR{&dns.RR_Header{Name: owner}})
+		msg.Remove([]dns.RR{memberPTR(catalog.Zone, entry.label, zone, catalog.TTL)})
+
+		moved := []dns.RR{memberPTR(catalog.Zone, label, zone, catalog.TTL)}
+		for _, rr := range entry.propertyRRs {
+			property := dns.Copy(rr)
+			property.Header().Name = strings.TrimSuffix(dns.CanonicalName(rr.Header().Name), oldOwner) + owner
+			moved = append(moved, property)
+		}
+		for _, name := range entry.properties {
+			msg.RemoveName([]dns.RR{&dns.RR_Header{Name: name}})
+		}
+		msg.Insert(moved)
+
+		_, err := r.update.Update(msg)
+		var rcodeErr *update.RcodeError
+		if errors.As(err, &rcodeErr) && rcodeErr.PrerequisiteFailed() {
+			existing := "another zone"
+			for _, e := range entries {
+				if e.label == label {
+					existing = e.zones[0]
+				}
+			}
+			return &LabelConflictError{Label: label, Zone: zone, Existing: existing}
+		}
+		return err
+	})
+}
+
+// addMissing adds the catalog PTR of a zone named serves. The prerequisite
+// that the owner is unused keeps it from overwriting another member.
+func (r *Reconciler) addMissing(catalog config.Catalog, zone string) error {
+	return r.withZoneLock(zone, func() error {
+		ptr := memberPTR(catalog.Zone, SHA1WireLabel(zone), zone, catalog.TTL)
+		msg := new(dns.Msg)
+		msg.SetUpdate(catalog.Zone)
+		msg.NameNotUsed([]dns.RR{&dns.RR_Header{Name: ptr.Hdr.Name}})
+		msg.Insert([]dns.RR{ptr})
+		_, err := r.update.Update(msg)
+		return err
+	})
+}
+
+// withZoneLock runs fn holding the zone lock
+func (r *Reconciler) withZoneLock(zone string, fn func() error) error {
+	zoneLock := lock.New(r.cfg.LockFilePath(zone))
+	if err := zoneLock.Acquire(); err != nil {
+		return fmt.Errorf("failed to acquire zone lock: %w", err)
+	}
+	defer zoneLock.Release()
+
+	return fn()
+}
+
+// served reports whether named serves the zone in any view
+func (r *Reconciler) served(zone string) (bool, error) {
+	for _, v := range r.views {
+		exists, _, err := v.rndc.ZoneStatus(zone)
+		if err != nil {
+			if errors.Is(err, bind.ErrZoneNotFound) {
+				continue
+			}
+			return false, fmt.Errorf("failed to check zone status: %w", err)
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// zoneFileZones returns the zones with a zone file in the zone file
+// directory of any view, sorted
+func (r *Reconciler) zoneFileZones() ([]string, error) {
+	suffix := "." + r.cfg.Zones.FileExtension
+	seen := make(map[string]bool)
+	var zones []string
+
+	for _, v := range r.views {
+		dir := filepath.Dir(r.cfg.ZoneFilePathInView("zone", v.view))
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), suffix) {
+				continue
+			}
+			name, err := NormalizeZone(strings.TrimSuffix(entry.Name(), suffix))
+			if err != nil || seen[name] {
+				continue
+			}
+			seen[name] = true
+			zones = append(zones, name)
+		}
+	}
+
+	sort.Strings(zones)
+	return zones, nil
+}
+
+// trimDot strips the trailing dot of a zone name for change records
+func trimDot(zone string) string {
+	return strings.TrimSuffix(zone, ".")
+}
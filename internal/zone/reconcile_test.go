@@ -0,0 +1,353 @@
+package zone
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/dlukt/dnsctl/pkg/update"
+	"github.com/miekg/dns"
+)
+
+// reconcileTestRecords is a catalog with one of each kind of
+// inconsistency
+var reconcileTestRecords = append(catalogRecords("10", "a.example.", "orphan.example.", "dup.example."),
+	"group."+SHA1WireLabel("orphan.example.")+".zones.catalog.example. 60 IN TXT \"old\"",
+	"custom.zones.catalog.example. 60 IN PTR wrong.example.",
+	"group.custom.zones.catalog.example. 60 IN TXT \"blue\"",
+	SHA1WireLabel("dup.example.")+".zones.catalog.example. 60 IN PTR other.example.",
+)
+
+// reconcileTestServed are the zones named serves next to
+// reconcileTestRecords
+var reconcileTestServed = []string{"a.example.", "wrong.example.", "dup.example.", "other.example.", "missing.example.", "catalog.example."}
+
+// touchFiles creates empty files with the given names in dir
+func touchFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// issueZones returns the zones per issue kind
+func issueZones(issues []CatalogIssue) map[string][]string {
+	zones := make(map[string][]string)
+	for _, issue := range issues {
+		zones[issue.Kind] = append(zones[issue.Kind], issue.Zone)
+	}
+	for kind := range zones {
+		sort.Strings(zones[kind])
+	}
+	return zones
+}
+
+// TestReconcileDryRun tests that a dry run reports every kind of issue
+// without sending updates
+func TestReconcileDryRun(t *testing.T) {
+	server := dnstest.NewServer(t, reconcileTestRecords...)
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = server.HostPort()
+	touchFiles(t, cfg.Zones.Dir, "a.example.zone", "other.example.zone", "missing.example.zone", "stale.example.zone", "catalog.example.zone")
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	for _, zone := range reconcileTestServed {
+		rndc.zones[zone] = true
+	}
+	reconciler := NewReconciler(cfg)
+	reconciler.views = []viewRNDC{{view: "", rndc: rndc}}
+
+	var changes []string
+	result, err := reconciler.Reconcile(false, &changes)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	want := map[string][]string{
+		IssueDuplicatePTR:  {"other.example."},
+		IssueOrphanPTR:     {"orphan.example."},
+		IssueLabelMismatch: {"wrong.example."},
+		IssueMissingPTR:    {"missing.example.", "other.example."},
+	}
+	if got := issueZones(result.Issues); !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %v, want %v", got, want)
+	}
+	for _, issue := range result.Issues {
+		if issue.Fixed {
+			t.Errorf("issue %+v fixed in a dry run", issue)
+		}
+	}
+	if result.Applied {
+		t.Error("Applied = true in a dry run")
+	}
+	if len(changes) != 5 {
+		t.Errorf("changes = %q, want 5 planned fixes", changes)
+	}
+	if updates := server.Updates(); len(updates) != 0 {
+		t.Errorf("dry run sent %d updates", len(updates))
+	}
+}
+
+// TestReconcileApply tests the updates sent to fix each kind of issue
+func TestReconcileApply(t *testing.T) {
+	server := dnstest.NewServer(t, reconcileTestRecords...)
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = server.HostPort()
+	touchFiles(t, cfg.Zones.Dir, "a.example.zone", "other.example.zone", "missing.example.zone", "stale.example.zone", "catalog.example.zone")
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	for _, zone := range reconcileTestServed {
+		rndc.zones[zone] = true
+	}
+	reconciler := NewReconciler(cfg)
+	reconciler.views = []viewRNDC{{view: "", rndc: rndc}}
+
+	var changes []string
+	result, err := reconciler.Reconcile(true, &changes)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	for _, issue := range result.Issues {
+		if !issue.Fixed {
+			t.Errorf("issue %+v not fixed", issue)
+		}
+	}
+
+	updates := server.Updates()
+	if len(updates) != 5 {
+		t.Fatalf("sent %d updates, want 5", len(updates))
+	}
+
+	// Every update is to the catalog zone
+	for _, u := range updates {
+		if u.Question[0].Name != "catalog.example." {
+			t.Errorf("update for zone %s, want catalog.example.", u.Question[0].Name)
+		}
+	}
+
+	// Find the update that removes the orphan: it deletes the PTR RRset and
+	// the group property
+	orphanOwner := SHA1WireLabel("orphan.example.") + ".zones.catalog.example."
+	found := false
+	for _, u := range updates {
+		if len(u.Ns) == 2 && u.Ns[0].Header().Name == orphanOwner && u.Ns[1].Header().Name == "group."+orphanOwner {
+			found = true
+			if u.Ns[1].Header().Class != dns.ClassANY || u.Ns[1].Header().Rrtype != dns.TypeANY {
+				t.Errorf("property removal = %v, want a delete of all RRsets", u.Ns[1])
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no update removes the orphan and its properties: %v", updates)
+	}
+
+	// The relabel adds the sha1-wire PTR and removes the custom one at
+	// once, moving the group property along, if the new owner is unused
+	newOwner := SHA1WireLabel("wrong.example.") + ".zones.catalog.example."
+	relabels := 0
+	for _, u := range updates {
+		var added, removed []string
+		for _, rr := range u.Ns {
+			switch rr.Header().Class {
+			case dns.ClassINET:
+				added = append(added, rr.String())
+			case dns.ClassNONE, dns.ClassANY:
+				removed = append(removed, rr.Header().Name)
+			}
+		}
+		if len(added) == 0 || !strings.Contains(added[0], "wrong.example.") {
+			continue
+		}
+		relabels++
+		if len(u.Answer) != 1 || u.Answer[0].Header().Name != newOwner || u.Answer[0].Header().Class != dns.ClassNONE {
+			t.Errorf("relabel prerequisites = %v, want %s unused", u.Answer, newOwner)
+		}
+		wantAdded := []string{
+			newOwner + "\t60\tIN\tPTR\twrong.example.",
+			"group." + newOwner + "\t60\tIN\tTXT\t\"blue\"",
+		}
+		if !reflect.DeepEqual(added, wantAdded) {
+			t.Errorf("relabel adds %q, want %q", added, wantAdded)
+		}
+		wantRemoved := []string{"custom.zones.catalog.example.", "group.custom.zones.catalog.example."}
+		if !reflect.DeepEqual(removed, wantRemoved) {
+			t.Errorf("relabel removes %v, want %v", removed, wantRemoved)
+		}
+	}
+	if relabels != 1 {
+		t.Errorf("%d relabel updates, want 1", relabels)
+	}
+
+	// Missing members are added only if the owner is unused
+	added := 0
+	for _, u := range updates {
+		if len(u.Answer) == 1 && len(u.Ns) == 1 && u.Ns[0].Header().Class == dns.ClassINET {
+			added++
+		}
+	}
+	if added != 2 {
+		t.Errorf("%d guarded member additions, want 2", added)
+	}
+}
+
+// TestReconcileRelabelConflict tests that a relabel whose new owner is taken
+// reports the zone holding it instead of overwriting it
+func TestReconcileRelabelConflict(t *testing.T) {
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+	server.SetUpdateRcode(dns.RcodeYXDomain)
+
+	var calls []string
+	reconciler := &Reconciler{
+		cfg:    viewTestConfig(t),
+		update: update.NewClient(server.Addr, "", "", ""),
+		views:  []viewRNDC{{view: "", rndc: newFakeRNDC("", &calls)}},
+	}
+	catalog := reconciler.cfg.Catalogs()[0]
+	label := SHA1WireLabel("wrong.example.")
+	entries := []catalogEntry{
+		{label: "custom", zones: []string{"wrong.example."}},
+		{label: label, zones: []string{"other.example."}},
+	}
+
+	err := reconciler.relabel(catalog, "wrong.example.", entries[0], entries)
+	var conflict *LabelConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("relabel() error = %v, want *LabelConflictError", err)
+	}
+	if conflict.Label != label || conflict.Existing != "other.example." {
+		t.Errorf("conflict = %+v, want %s held by other.example.", conflict, label)
+	}
+}
+
+// TestReconcileKeepsServedDuplicate tests that of several PTRs at one label
+// the one to a zone named serves is kept with the label's properties, even
+// if it is not the first and the label is another zone's sha1-wire label
+func TestReconcileKeepsServedDuplicate(t *testing.T) {
+	owner := SHA1WireLabel("gone.example.") + ".zones.catalog.example."
+	server := dnstest.NewServer(t, append(catalogRecords("1"),
+		owner+" 60 IN PTR gone.example.",
+		owner+" 60 IN PTR kept.example.",
+		"group."+owner+" 60 IN TXT \"blue\"",
+	)...)
+
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	rndc.zones["kept.example."] = true
+	reconciler := &Reconciler{
+		cfg:    viewTestConfig(t),
+		views:  []viewRNDC{{view: "", rndc: rndc}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	result, err := reconciler.Reconcile(true, &changes)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	want := map[string][]string{
+		IssueDuplicatePTR:  {"gone.example."},
+		IssueLabelMismatch: {"kept.example."},
+	}
+	if got := issueZones(result.Issues); !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %v, want %v", got, want)
+	}
+
+	// Only the PTR to gone.example. is deleted; the group property moves
+	// with kept.example. to its sha1-wire label
+	updates := server.Updates()
+	if len(updates) != 2 {
+		t.Fatalf("sent %d updates, want duplicate removal and relabel", len(updates))
+	}
+	if ns := updates[0].Ns; len(ns) != 1 || ns[0].Header().Class != dns.ClassNONE || ns[0].(*dns.PTR).Ptr != "gone.example." {
+		t.Errorf("duplicate removal = %v, want the PTR to gone.example. only", ns)
+	}
+	group := "group." + SHA1WireLabel("kept.example.") + ".zones.catalog.example."
+	moved := false
+	for _, rr := range updates[1].Ns {
+		moved = moved || rr.Header().Name == group && rr.Header().Class == dns.ClassINET
+	}
+	if !moved {
+		t.Errorf("relabel = %v, want the group property at %s", updates[1].Ns, group)
+	}
+}
+
+// TestReconcileAddMissing tests that AddMissing only adds the zones named
+// serves that no catalog has, counting every PTR as a member
+func TestReconcileAddMissing(t *testing.T) {
+	server := dnstest.NewServer(t, reconcileTestRecords...)
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = server.HostPort()
+	touchFiles(t, cfg.Zones.Dir, "a.example.zone", "other.example.zone", "missing.example.zone", "stale.example.zone", "catalog.example.zone")
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	for _, zone := range reconcileTestServed {
+		rndc.zones[zone] = true
+	}
+	reconciler := NewReconciler(cfg)
+	reconciler.views = []viewRNDC{{view: "", rndc: rndc}}
+
+	var changes []string
+	issues, err := reconciler.AddMissing(false, &changes)
+	if err != nil {
+		t.Fatalf("AddMissing() error = %v", err)
+	}
+	want := map[string][]string{IssueMissingPTR: {"missing.example."}}
+	if got := issueZones(issues); !reflect.DeepEqual(got, want) {
+		t.Errorf("issues = %v, want %v", got, want)
+	}
+	if len(server.Updates()) != 0 {
+		t.Errorf("dry run sent %d updates", len(server.Updates()))
+	}
+
+	changes = nil
+	if _, err := reconciler.AddMissing(true, &changes); err != nil {
+		t.Fatalf("AddMissing() error = %v", err)
+	}
+	if got := strings.Join(changes, " "); got != "catalog_ptr_added:missing.example" {
+		t.Errorf("changes = %s, want catalog_ptr_added:missing.example", got)
+	}
+	updates := server.Updates()
+	if len(updates) != 1 || len(updates[0].Answer) != 1 || updates[0].Answer[0].Header().Class != dns.ClassNONE {
+		t.Errorf("updates = %v, want one guarded member addition", updates)
+	}
+}
+
+// TestZoneFileZones tests discovering zones from the zone file names in the
+// directories of every view
+func TestZoneFileZones(t *testing.T) {
+	cfg := viewTestConfig(t, "internal", "external")
+	files := map[string][]string{
+		"internal": {"example.com.zone", "example.org.zone", "notes.txt"},
+		"external": {"example.com.zone", "example.net.zone", "example.com.zone.tmp"},
+	}
+	for view, names := range files {
+		touchFiles(t, filepath.Join(cfg.Zones.Dir, view), names...)
+	}
+
+	var calls []string
+	reconciler := &Reconciler{
+		cfg: cfg,
+		views: []viewRNDC{
+			{view: "internal", rndc: newFakeRNDC("internal", &calls)},
+			{view: "external", rndc: newFakeRNDC("external", &calls)},
+		},
+	}
+	zones, err := reconciler.zoneFileZones()
+	if err != nil {
+		t.Fatalf("zoneFileZones() error = %v", err)
+	}
+	want := []string{"example.com.", "example.net.", "example.org."}
+	if !reflect.DeepEqual(zones, want) {
+		t.Errorf("zoneFileZones() = %v, want %v", zones, want)
+	}
+}
@@ -1,7 +1,10 @@
 package zone
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/dlukt/dnsctl/internal/bind"
 	"github.com/dlukt/dnsctl/internal/config"
@@ -11,35 +14,88 @@ import (
 
 // Status represents the status of a zone (spec 11.5)
 type Status struct {
-	Zone           string `json:"zone"`
-	Exists         bool   `json:"exists"`
-	Loaded         bool   `json:"loaded"`
-	IsPrimary      bool   `json:"is_primary"`
-	InCatalog      bool   `json:"in_catalog"`
-	CatalogLabel   string `json:"catalog_label,omitempty"`
-	ZoneFilePath   string `json:"zone_file_path,omitempty"`
-	SOASerial      uint32 `json:"soa_serial,omitempty"`
-	DNSSECEnabled  bool   `json:"dnssec_enabled"`
+	Zone          string `json:"zone"`
+	Exists        bool   `json:"exists"`
+	Loaded        bool   `json:"loaded"`
+	IsPrimary     bool   `json:"is_primary"`
+	InCatalog     bool   `json:"in_catalog"`
+	Catalog       string `json:"catalog,omitempty"`
+	CatalogLabel  string `json:"catalog_label,omitempty"`
+	ZoneFilePath  string `json:"zone_file_path,omitempty"`
+	SOASerial     uint32 `json:"soa_serial,omitempty"`
+	DNSSECEnabled bool   `json:"dnssec_enabled"`
+
+	// SOA record served by the primary
+	SOA *SOARecord `json:"soa,omitempty"`
+
+	// Member properties from the catalog zone, keyed by their name below
+	// the member label (e.g. "group", "coo", "tier.ext")
+	CatalogProperties map[string][]string `json:"catalog_properties,omitempty"`
+
+	// SOA serial of the zone on each configured secondary
+	Secondaries []SecondaryStatus `json:"secondaries,omitempty"`
+
+	// Parsed rndc zonestatus of the zone in the first view
+	ZoneState *bind.ZoneState `json:"zonestatus,omitempty"`
+
+	// Per-view state, set when bind.views lists several views
+	Views []ViewStatus `json:"views,omitempty"`
+}
+
+// ViewStatus is the state of a zone in one view
+type ViewStatus struct {
+	View         string `json:"view"`
+	Exists       bool   `json:"exists"`
+	Loaded       bool   `json:"loaded"`
+	IsPrimary    bool   `json:"is_primary"`
+	ZoneFilePath string `json:"zone_file_path"`
+
+	ZoneState *bind.ZoneState `json:"zonestatus,omitempty"`
+}
+
+// SOARecord holds the fields of a zone's SOA record
+type SOARecord struct {
+	MName   string `json:"mname"`
+	RName   string `json:"rname"`
+	Serial  uint32 `json:"serial"`
+	Refresh uint32 `json:"refresh"`
+	Retry   uint32 `json:"retry"`
+	Expire  uint32 `json:"expire"`
+	Minimum uint32 `json:"minimum"`
+	TTL     uint32 `json:"ttl"`
+}
+
+// SecondaryStatus is the state of a zone on one secondary server
+type SecondaryStatus struct {
+	Server  string `json:"server"`
+	Serial  uint32 `json:"serial,omitempty"`
+	Lagging bool   `json:"lagging"`         // Serial is behind the primary's
+	Error   string `json:"error,omitempty"` // Query failed or zone not served
 }
 
 // StatusChecker handles zone status queries
 type StatusChecker struct {
-	cfg       *config.Config
-	rndc      *bind.RNDCClient
-	update    *update.Client
+	cfg    *config.Config
+	views  []viewRNDC
+	update *update.Client
+
+	// Per-query timeout for secondaries, so an unreachable secondary does
+	// not stall the status
+	secondaryTimeout time.Duration
 }
 
 // NewStatusChecker creates a new zone status checker
 func NewStatusChecker(cfg *config.Config) *StatusChecker {
 	return &StatusChecker{
-		cfg: cfg,
-		rndc: bind.NewRNDCClient(cfg.Bind.RNDCPath, cfg.Bind.RNDCConf, cfg.Bind.View),
+		cfg:   cfg,
+		views: newViewRNDCs(cfg),
 		update: update.NewClient(
 			fmt.Sprintf("%s:%d", cfg.Bind.DNSAddr, cfg.Bind.DNSPort),
 			cfg.TSIG.Name,
 			cfg.TSIG.Secret,
 			cfg.TSIG.Algorithm,
 		),
+		secondaryTimeout: 5 * time.Second,
 	}
 }
 
@@ -53,49 +109,182 @@ func (s *StatusChecker) ZoneStatus(zoneInput string) (*Status, error) {
 
 	status := &Status{
 		Zone:         zone,
-		ZoneFilePath: s.cfg.ZoneFilePath(zone),
+		ZoneFilePath: s.cfg.ZoneFilePathInView(zone, s.views[0].view),
+		Exists:       true,
+		Loaded:       true,
+		IsPrimary:    true,
 	}
 
-	// Check if zone exists in BIND
-	exists, loaded, err := s.rndc.ZoneStatus(zone)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check zone status: %w", err)
+	// Check the zone in each view; the zone-level flags hold only if they
+	// hold in every view
+	for _, v := range s.views {
+		vs, err := s.viewStatus(zone, v)
+		if err != nil {
+			return nil, err
+		}
+		status.Exists = status.Exists && vs.Exists
+		status.Loaded = status.Loaded && vs.Loaded
+		status.IsPrimary = status.IsPrimary && vs.IsPrimary
+		if status.ZoneState == nil {
+			status.ZoneState = vs.ZoneState
+		}
+		if len(s.cfg.Bind.Views) > 0 {
+			status.Views = append(status.Views, *vs)
+		}
 	}
-	status.Exists = exists
-	status.Loaded = loaded
 
-	// Check if it's a primary zone
-	if exists {
-		isPrimary, err := s.rndc.IsZonePrimary(zone)
-		if err == nil {
-			status.IsPrimary = isPrimary
+	// Check catalog membership; a zone that is not a member reports the
+	// catalog and sha1-wire label it would get. A catalog that cannot be
+	// transferred fails the status, since membership is then unknown.
+	status.CatalogLabel = SHA1WireLabel(zone)
+	if catalog, err := s.cfg.SelectCatalog(zone, ""); err == nil {
+		status.Catalog = catalog.Zone
+	}
+	for _, catalog := range s.cfg.Catalogs() {
+		rrs, err := s.update.Transfer(catalog.Zone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transfer catalog zone %s: %w", catalog.Zone, err)
+		}
+		if found := memberEntries(catalogEntries(catalog.Zone, rrs), zone); len(found) > 0 {
+			status.InCatalog = true
+			status.Catalog = catalog.Zone
+			status.CatalogLabel = found[0].label
+			status.CatalogProperties = entryProperties(catalog.Zone, found[0])
+			break
 		}
 	}
 
-	// Check catalog membership
-	label := SHA1WireLabel(zone)
-	status.CatalogLabel = label
+	// zonestatus reports whether the zone is signed; without it the zone
+	// is signed if it publishes DNSKEY records
+	if status.ZoneState != nil {
+		status.DNSSECEnabled = status.ZoneState.Secure
+	} else if status.Loaded {
+		if response, err := s.update.Query(zone, dns.TypeDNSKEY); err == nil {
+			for _, rr := range response.Answer {
+				if rr.Header().Rrtype == dns.TypeDNSKEY {
+					status.DNSSECEnabled = true
+				}
+			}
+		}
+	}
 
-	catalogOwner := fmt.Sprintf("%s.zones.%s", label, s.cfg.Catalog.Zone)
+	// Query the SOA record if zone is loaded
+	if status.Loaded {
+		if soa, err := querySOA(s.update, zone); err == nil {
+			status.SOASerial = soa.Serial
+			status.SOA = &SOARecord{
+				MName:   soa.Ns,
+				RName:   soa.Mbox,
+				Serial:  soa.Serial,
+				Refresh: soa.Refresh,
+				Retry:   soa.Retry,
+				Expire:  soa.Expire,
+				Minimum: soa.Minttl,
+				TTL:     soa.Hdr.Ttl,
+			}
+		}
+	}
 
-	// Query the catalog zone for the PTR record
-	response, err := s.update.Query(catalogOwner, 12) // Type PTR
-	if err == nil && response != nil && len(response.Answer) > 0 {
-		status.InCatalog = true
+	// Compare each secondary's serial against the primary's
+	for _, addr := range s.cfg.SecondaryAddrs() {
+		status.Secondaries = append(status.Secondaries, s.secondaryStatus(zone, addr, status.SOA))
 	}
 
-	// DNSSEC is always enabled for zones created by dnsctl
-	status.DNSSECEnabled = true
+	return status, nil
+}
 
-	// Query SOA serial if zone is loaded
-	if loaded {
-		response, err := s.update.Query(zone, 6) // Type SOA
-		if err == nil && response != nil && len(response.Answer) > 0 {
-			if soa, ok := response.Answer[0].(*dns.SOA); ok {
-				status.SOASerial = soa.Serial
-			}
+// Lagging returns the secondaries that are behind the primary or could not
+// report a serial
+func (s *Status) Lagging() []SecondaryStatus {
+	var lagging []SecondaryStatus
+	for _, secondary := range s.Secondaries {
+		if secondary.Lagging || secondary.Error != "" {
+			lagging = append(lagging, secondary)
 		}
 	}
+	return lagging
+}
 
-	return status, nil
+// propertyValue returns the value of a catalog property record
+func propertyValue(rr dns.RR) string {
+	switch rr := rr.(type) {
+	case *dns.PTR:
+		return rr.Ptr
+	case *dns.TXT:
+		return strings.Join(rr.Txt, "")
+	default:
+		return strings.TrimPrefix(rr.String(), rr.Header().String())
+	}
+}
+
+// secondaryStatus queries a secondary for the zone's SOA and compares its
+// serial with the primary's
+func (s *StatusChecker) secondaryStatus(zone, addr string, primary *SOARecord) SecondaryStatus {
+	secondary := SecondaryStatus{Server: addr}
+
+	client := update.NewClient(addr, "", "", "")
+	client.SetTimeout(s.secondaryTimeout)
+	soa, err := querySOA(client, zone)
+	if err != nil {
+		secondary.Error = err.Error()
+		return secondary
+	}
+
+	secondary.Serial = soa.Serial
+	if primary != nil {
+		secondary.Lagging = SerialBehind(soa.Serial, primary.Serial)
+	}
+	return secondary
+}
+
+// querySOA queries a server for a zone's SOA record
+func querySOA(client *update.Client, zone string) (*dns.SOA, error) {
+	response, err := client.Query(zone, dns.TypeSOA)
+	if err != nil {
+		return nil, err
+	}
+	for _, rr := range response.Answer {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa, nil
+		}
+	}
+	return nil, fmt.Errorf("no SOA record for %s", zone)
+}
+
+// SerialBehind reports whether serial a is behind serial b using RFC 1982
+// serial number arithmetic
+func SerialBehind(a, b uint32) bool {
+	return a != b && int32(b-a) > 0
+}
+
+// viewStatus returns the state of a zone in one view
+func (s *StatusChecker) viewStatus(zone string, v viewRNDC) (*ViewStatus, error) {
+	vs := &ViewStatus{
+		View:         v.view,
+		ZoneFilePath: s.cfg.ZoneFilePathInView(zone, v.view),
+	}
+
+	// Check if zone exists in BIND
+	state, err := v.rndc.ZoneState(zone)
+	if err != nil {
+		if errors.Is(err, bind.ErrZoneNotFound) {
+			return vs, nil
+		}
+		return nil, fmt.Errorf("failed to check zone status: %w", err)
+	}
+	vs.Exists = true
+	vs.Loaded = state.Loaded
+	vs.ZoneState = state
+
+	// Check if it's a primary zone, from zonestatus if it reports the type
+	switch state.Type {
+	case "primary", "master":
+		vs.IsPrimary = true
+	case "":
+		if isPrimary, err := v.rndc.IsZonePrimary(zone); err == nil {
+			vs.IsPrimary = isPrimary
+		}
+	}
+
+	return vs, nil
 }
@@ -0,0 +1,174 @@
+package zone
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/dnstest"
+)
+
+// TestZoneStatus tests the SOA, catalog properties and secondary serials in
+// the zone status
+func TestZoneStatus(t *testing.T) {
+	label := SHA1WireLabel("example.com.")
+	owner := label + ".zones.catalog.example."
+	primary := dnstest.NewServer(t,
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024010105 7200 900 1209600 300",
+		"catalog.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+		owner+" 60 IN PTR example.com.",
+		"group."+owner+" 60 IN TXT \"customers\"",
+		"coo."+owner+" 60 IN PTR old.catalog.example.",
+		"tier.ext."+owner+" 60 IN TXT \"gold\"",
+	)
+	inSync := dnstest.NewServer(t,
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024010105 7200 900 1209600 300",
+	).Addr
+	behind := dnstest.NewServer(t,
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 7200 900 1209600 300",
+	).Addr
+	missing := dnstest.NewServer(t).Addr
+
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	cfg.Secondaries = []string{inSync, behind, missing}
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	rndc.zones["example.com."] = true
+	checker := NewStatusChecker(cfg)
+	checker.views = []viewRNDC{{view: "", rndc: rndc}}
+
+	status, err := checker.ZoneStatus("example.com")
+	if err != nil {
+		t.Fatalf("ZoneStatus() error = %v", err)
+	}
+
+	if !status.Exists || !status.Loaded || !status.InCatalog {
+		t.Errorf("exists/loaded/in_catalog = %v/%v/%v, want all true", status.Exists, status.Loaded, status.InCatalog)
+	}
+
+	wantSOA := SOARecord{
+		MName: "ns1.example.com.", RName: "hostmaster.example.com.", Serial: 2024010105,
+		Refresh: 7200, Retry: 900, Expire: 1209600, Minimum: 300, TTL: 3600,
+	}
+	if status.SOA == nil || *status.SOA != wantSOA {
+		t.Errorf("SOA = %+v, want %+v", status.SOA, wantSOA)
+	}
+	if status.SOASerial != 2024010105 {
+		t.Errorf("SOASerial = %d, want 2024010105", status.SOASerial)
+	}
+
+	if status.Catalog != "catalog.example." {
+		t.Errorf("Catalog = %q, want catalog.example.", status.Catalog)
+	}
+	if got := status.CatalogProperties["group"]; len(got) != 1 || got[0] != "customers" {
+		t.Errorf("group property = %q, want [customers]", got)
+	}
+	if got := status.CatalogProperties["coo"]; len(got) != 1 || got[0] != "old.catalog.example." {
+		t.Errorf("coo property = %q, want [old.catalog.example.]", got)
+	}
+	if got := status.CatalogProperties["tier.ext"]; len(got) != 1 || got[0] != "gold" {
+		t.Errorf("tier.ext property = %q, want [gold]", got)
+	}
+
+	if len(status.Secondaries) != 3 {
+		t.Fatalf("Secondaries = %+v, want 3 entries", status.Secondaries)
+	}
+	if s := status.Secondaries[0]; s.Server != inSync || s.Serial != 2024010105 || s.Lagging || s.Error != "" {
+		t.Errorf("in-sync secondary = %+v", s)
+	}
+	if s := status.Secondaries[1]; s.Serial != 2024010101 || !s.Lagging {
+		t.Errorf("lagging secondary = %+v, want lagging", s)
+	}
+	if s := status.Secondaries[2]; s.Error == "" {
+		t.Errorf("secondary without the zone = %+v, want an error", s)
+	}
+
+	lagging := status.Lagging()
+	if len(lagging) != 2 || lagging[0].Server != behind || lagging[1].Server != missing {
+		t.Errorf("Lagging() = %+v, want the behind and missing secondaries", lagging)
+	}
+
+	// The status marshals to valid JSON with the new fields
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("status is not valid JSON: %v", err)
+	}
+	for _, key := range []string{"soa", "catalog_properties", "secondaries", "zonestatus"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("JSON status has no %q key: %s", key, data)
+		}
+	}
+}
+
+// TestZoneStatusNotInCatalog tests a zone without a catalog entry
+func TestZoneStatusNotInCatalog(t *testing.T) {
+	primary := dnstest.NewServer(t, append(catalogRecords("1"),
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 900 1209600 300",
+	)...)
+
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	rndc.zones["example.com."] = true
+	checker := NewStatusChecker(cfg)
+	checker.views = []viewRNDC{{view: "", rndc: rndc}}
+
+	status, err := checker.ZoneStatus("example.com.")
+	if err != nil {
+		t.Fatalf("ZoneStatus() error = %v", err)
+	}
+	if status.InCatalog || status.CatalogProperties != nil {
+		t.Errorf("in_catalog = %v, properties = %v, want neither", status.InCatalog, status.CatalogProperties)
+	}
+	if status.Secondaries != nil {
+		t.Errorf("Secondaries = %+v, want none without configured secondaries", status.Secondaries)
+	}
+}
+
+// TestZoneStatusCatalogTransferFails tests that a catalog that cannot be
+// transferred is an error, not a zone outside the catalog
+func TestZoneStatusCatalogTransferFails(t *testing.T) {
+	primary := dnstest.NewServer(t,
+		"example.com. 3600 IN SOA ns1.example.com. hostmaster.example.com. 1 7200 900 1209600 300",
+	)
+
+	cfg := viewTestConfig(t)
+	cfg.Bind.DNSAddr, cfg.Bind.DNSPort = primary.HostPort()
+	var calls []string
+	rndc := newFakeRNDC("", &calls)
+	rndc.zones["example.com."] = true
+	checker := NewStatusChecker(cfg)
+	checker.views = []viewRNDC{{view: "", rndc: rndc}}
+
+	status, err := checker.ZoneStatus("example.com.")
+	if err == nil || !strings.Contains(err.Error(), "catalog.example.") {
+		t.Fatalf("ZoneStatus() = %+v, %v, want an error naming the catalog", status, err)
+	}
+}
+
+// TestSerialBehind tests RFC 1982 serial comparison
+func TestSerialBehind(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{5, 5, false},
+		{4294967295, 1, true}, // b wrapped around
+		{1, 4294967295, false},
+		{2024010101, 2024010105, true},
+	}
+
+	for _, tt := range tests {
+		if got := SerialBehind(tt.a, tt.b); got != tt.want {
+			t.Errorf("SerialBehind(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package zone
+
+import (
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/config"
+)
+
+// viewRNDC is an rndc client bound to one of the views zones are provisioned into
+type viewRNDC struct {
+	view string
+	rndc bind.RNDC
+}
+
+// newViewRNDCs returns an rndc client for each configured view, in config order
+func newViewRNDCs(cfg *config.Config) []viewRNDC {
+	var clients []viewRNDC
+	for _, view := range cfg.ZoneViews() {
+		clients = append(clients, viewRNDC{
+			view: view,
+			rndc: bind.NewRNDC(cfg.Bind.RNDCClient, cfg.Bind.RNDCPath, cfg.Bind.RNDCConf, view),
+		})
+	}
+	return clients
+}
+
+// viewChange qualifies a change with the view it applies to, e.g. "zone_added:internal"
+func viewChange(change, view string) string {
+	if view == "" {
+		return change
+	}
+	return change + ":" + view
+}
@@ -0,0 +1,251 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dlukt/dnsctl/internal/bind"
+	"github.com/dlukt/dnsctl/internal/config"
+	"github.com/dlukt/dnsctl/internal/dnstest"
+	"github.com/dlukt/dnsctl/pkg/update"
+)
+
+// fakeRNDC is an in-memory bind.RNDC for one view
+type fakeRNDC struct {
+	zones   map[string]bool
+	configs map[string]string
+	addErr  error
+	modErr  error
+	calls   *[]string
+	view    string
+	primary bool
+}
+
+func newFakeRNDC(view string, calls *[]string) *fakeRNDC {
+	return &fakeRNDC{zones: map[string]bool{}, configs: map[string]string{}, view: view, calls: calls, primary: true}
+}
+
+func (f *fakeRNDC) record(call string) {
+	*f.calls = append(*f.calls, viewChange(call, f.view))
+}
+
+func (f *fakeRNDC) AddZone(zone, zoneConfig string) error {
+	f.record("addzone " + zone)
+	if f.addErr != nil {
+		return f.addErr
+	}
+	f.zones[zone] = true
+	f.configs[zone] = zoneConfig
+	return nil
+}
+
+func (f *fakeRNDC) ModZone(zone, zoneConfig string) error {
+	f.record("modzone " + zone)
+	if !f.zones[zone] {
+		return fmt.Errorf("%w: %s", bind.ErrZoneNotFound, zone)
+	}
+	if f.modErr != nil {
+		return f.modErr
+	}
+	f.configs[zone] = zoneConfig
+	return nil
+}
+
+func (f *fakeRNDC) DelZone(zone string, clean bool) error {
+	f.record("delzone " + zone)
+	if !f.zones[zone] {
+		return fmt.Errorf("%w: %s", bind.ErrZoneNotFound, zone)
+	}
+	delete(f.zones, zone)
+	return nil
+}
+
+func (f *fakeRNDC) ZoneStatus(zone string) (bool, bool, error) {
+	return f.zones[zone], f.zones[zone], nil
+}
+
+func (f *fakeRNDC) ZoneState(zone string) (*bind.ZoneState, error) {
+	if !f.zones[zone] {
+		return nil, fmt.Errorf("%w: %s", bind.ErrZoneNotFound, zone)
+	}
+	return &bind.ZoneState{Name: zone, Type: "primary", Loaded: true, Serial: 1}, nil
+}
+
+func (f *fakeRNDC) ShowZone(zone string) (string, error) {
+	if !f.zones[zone] {
+		return "", bind.ErrZoneNotFound
+	}
+	if zoneConfig, ok := f.configs[zone]; ok {
+		return fmt.Sprintf("zone %q %s", zone, zoneConfig), nil
+	}
+	return fmt.Sprintf("zone %q { type primary; };", zone), nil
+}
+
+func (f *fakeRNDC) IsZonePrimary(zone string) (bool, error) { return f.primary, nil }
+func (f *fakeRNDC) Reload(zone string) error                { return nil }
+func (f *fakeRNDC) Reconfig() error                         { return nil }
+func (f *fakeRNDC) Status() (string, error)                 { return "", nil }
+
+func (f *fakeRNDC) DNSSECStatus(zone string) (*bind.DNSSECStatus, error) {
+	if !f.zones[zone] {
+		return nil, fmt.Errorf("%w: %s", bind.ErrZoneNotFound, zone)
+	}
+	return &bind.DNSSECStatus{Policy: "default", Keys: []bind.DNSSECKey{}}, nil
+}
+
+func (f *fakeRNDC) DNSSECRollover(zone string, key uint16) (string, error) { return "", nil }
+func (f *fakeRNDC) DNSSECCheckDS(zone, state string, key *uint16) (string, error) {
+	return "", nil
+}
+
+// viewTestConfig returns a config for two views rooted in a temp dir
+func viewTestConfig(t *testing.T, views ...string) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Zones.Dir = filepath.Join(dir, "zones")
+	cfg.Locking.Dir = filepath.Join(dir, "locks")
+	cfg.Catalog.Zone = "catalog.example."
+	cfg.Bind.Views = views
+	return cfg
+}
+
+// TestCreateZoneViews tests provisioning a zone into several views with one catalog entry
+func TestCreateZoneViews(t *testing.T) {
+	cfg := viewTestConfig(t, "internal", "external")
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+
+	var calls []string
+	internal := newFakeRNDC("internal", &calls)
+	external := newFakeRNDC("external", &calls)
+	external.zones["example.com."] = true
+
+	creator := &Creator{
+		cfg:    cfg,
+		views:  []viewRNDC{{"internal", internal}, {"external", external}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := creator.CreateZone("example.com", CreateOptions{}, &changes); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+
+	wantChanges := []string{
+		"zone_file_created:internal",
+		"zone_added:internal",
+		"zone_already_exists:external",
+		"catalog_updated",
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes = %v, want %v", changes, wantChanges)
+	}
+	if !ZoneFileExists(filepath.Join(cfg.Zones.Dir, "internal", "example.com.zone")) {
+		t.Error("zone file not created in the internal view directory")
+	}
+	if n := len(server.Updates()); n != 1 {
+		t.Errorf("catalog updates = %d, want 1", n)
+	}
+}
+
+// TestCreateZoneViewsRollback tests that views added by a failed create are removed again
+func TestCreateZoneViewsRollback(t *testing.T) {
+	cfg := viewTestConfig(t, "internal", "external")
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+
+	var calls []string
+	internal := newFakeRNDC("internal", &calls)
+	external := newFakeRNDC("external", &calls)
+	external.addErr = errors.New("addzone failed")
+
+	creator := &Creator{
+		cfg:    cfg,
+		views:  []viewRNDC{{"internal", internal}, {"external", external}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := creator.CreateZone("example.com", CreateOptions{}, &changes); err == nil {
+		t.Fatal("CreateZone() error = nil, want addzone failure")
+	}
+
+	wantCalls := []string{
+		"addzone example.com.:internal",
+		"addzone example.com.:external",
+		"delzone example.com.:internal",
+	}
+	if !reflect.DeepEqual(calls, wantCalls) {
+		t.Errorf("rndc calls = %v, want %v", calls, wantCalls)
+	}
+	if internal.zones["example.com."] {
+		t.Error("zone left in the internal view after rollback")
+	}
+	if ZoneFileExists(filepath.Join(cfg.Zones.Dir, "internal", "example.com.zone")) {
+		t.Error("zone file left in the internal view after rollback")
+	}
+}
+
+// TestDeleteZoneViews tests deleting a zone that exists in only some views
+func TestDeleteZoneViews(t *testing.T) {
+	cfg := viewTestConfig(t, "internal", "external")
+	server := dnstest.NewServer(t, catalogRecords("1")...)
+
+	var calls []string
+	internal := newFakeRNDC("internal", &calls)
+	external := newFakeRNDC("external", &calls)
+	internal.zones["example.com."] = true
+
+	deleter := &Deleter{
+		cfg:    cfg,
+		views:  []viewRNDC{{"internal", internal}, {"external", external}},
+		update: update.NewClient(server.Addr, "", "", ""),
+	}
+
+	var changes []string
+	if err := deleter.DeleteZone("example.com", &changes); err != nil {
+		t.Fatalf("DeleteZone() error = %v", err)
+	}
+	if got := strings.Join(changes, " "); !strings.Contains(got, "zone_deleted:internal") ||
+		!strings.Contains(got, "zone_not_in_view:external") {
+		t.Errorf("changes = %v", changes)
+	}
+
+	// Missing from every view is an error
+	changes = nil
+	if err := deleter.DeleteZone("example.com", &changes); !errors.Is(err, bind.ErrZoneNotFound) {
+		t.Errorf("DeleteZone() of absent zone error = %v, want ErrZoneNotFound", err)
+	}
+}
+
+// TestBuildZoneConfig tests that the addzone configuration is a braced block
+func TestBuildZoneConfig(t *testing.T) {
+	creator := &Creator{cfg: config.DefaultConfig()}
+	got := creator.buildZoneConfig("/var/lib/dnsctl/zones/example.com.zone", "default")
+
+	if !strings.HasPrefix(got, "{") || !strings.HasSuffix(got, "};") {
+		t.Errorf("buildZoneConfig() = %q, want a braced block", got)
+	}
+	if !strings.Contains(got, `file "/var/lib/dnsctl/zones/example.com.zone";`) {
+		t.Errorf("buildZoneConfig() = %q, missing file statement", got)
+	}
+	if !strings.Contains(got, "dnssec-policy default;") || !strings.Contains(got, "inline-signing yes;") {
+		t.Errorf("buildZoneConfig() = %q, missing signing statements", got)
+	}
+
+	// inline-signing follows zones.inline_signing
+	creator.cfg.Zones.InlineSigning = false
+	if got := creator.buildZoneConfig("/z", "default"); !strings.Contains(got, "inline-signing no;") {
+		t.Errorf("buildZoneConfig() = %q, want inline-signing no", got)
+	}
+
+	// An unsigned zone has no inline-signing
+	got = creator.buildZoneConfig("/z", "none")
+	if !strings.Contains(got, "dnssec-policy none;") || strings.Contains(got, "inline-signing") {
+		t.Errorf("buildZoneConfig() = %q, want dnssec-policy none without inline-signing", got)
+	}
+}
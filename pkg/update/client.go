@@ -10,23 +10,23 @@ import (
 
 // Client provides RFC2136 dynamic update functionality with TSIG authentication
 type Client struct {
-	server    string // DNS server address (e.g., "127.0.0.1:53")
-	tsigName  string // TSIG key name
-	tsigSecret string // TSIG key secret
+	server        string // DNS server address (e.g., "127.0.0.1:53")
+	tsigName      string // TSIG key name
+	tsigSecret    string // TSIG key secret
 	tsigAlgorithm string // TSIG algorithm (e.g., "hmac-sha256")
-	useTCP    bool   // Use TCP instead of UDP
-	timeout   time.Duration
+	useTCP        bool   // Use TCP instead of UDP
+	timeout       time.Duration
 }
 
 // NewClient creates a new RFC2136 update client
 func NewClient(server, tsigName, tsigSecret, tsigAlgorithm string) *Client {
 	return &Client{
-		server:    server,
-		tsigName:  tsigName,
-		tsigSecret: tsigSecret,
+		server:        server,
+		tsigName:      tsigName,
+		tsigSecret:    tsigSecret,
 		tsigAlgorithm: tsigAlgorithm,
-		useTCP:    true, // Default to TCP as per spec
-		timeout:   30 * time.Second,
+		useTCP:        true, // Default to TCP as per spec
+		timeout:       30 * time.Second,
 	}
 }
 
@@ -50,9 +50,7 @@ func (c *Client) send(msg *dns.Msg) (*dns.Msg, error) {
 	}
 
 	// Sign the message with TSIG
-	if c.tsigName != "" && c.tsigSecret != "" {
-		msg.SetTsig(c.tsigName, c.tsigAlgorithm, 300, time.Now().Unix())
-	}
+	client.TsigSecret = c.sign(msg)
 
 	// Send the update
 	response, _, err := client.Exchange(msg, c.server)
@@ -61,17 +59,28 @@ func (c *Client) send(msg *dns.Msg) (*dns.Msg, error) {
 	}
 
 	if response == nil {
-		return nil, fmt.Errorf("no response from DNS server")
+		return nil, ErrNoResponse
 	}
 
 	if response.Rcode != dns.RcodeSuccess {
-		return nil, fmt.Errorf("DNS update failed with rcode: %s (%d)",
-			dns.RcodeToString[response.Rcode], response.Rcode)
+		return nil, &RcodeError{Op: "update", Rcode: response.Rcode}
 	}
 
 	return response, nil
 }
 
+// sign adds a TSIG record to msg if a key is configured and returns the
+// secret map the dns client needs to sign and verify the exchange
+func (c *Client) sign(msg *dns.Msg) map[string]string {
+	if c.tsigName == "" || c.tsigSecret == "" {
+		return nil
+	}
+
+	keyName := dns.CanonicalName(c.tsigName)
+	msg.SetTsig(keyName, c.tsigAlgorithm, 300, time.Now().Unix())
+	return map[string]string{keyName: c.tsigSecret}
+}
+
 // Update sends an RFC2136 update message
 func (c *Client) Update(update *dns.Msg) (*dns.Msg, error) {
 	return c.send(update)
@@ -156,22 +165,59 @@ func (c *Client) Query(name string, rrType uint16) (*dns.Msg, error) {
 	}
 
 	response, _, err := client.Exchange(msg, c.server)
+	if err == nil && response != nil && response.Truncated {
+		// Large answers such as DNSKEY RRsets need TCP
+		client.Net = "tcp"
+		response, _, err = client.Exchange(msg, c.server)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("DNS query failed: %w", err)
 	}
 
 	if response == nil {
-		return nil, fmt.Errorf("no response from DNS server")
+		return nil, ErrNoResponse
 	}
 
 	if response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
-		return nil, fmt.Errorf("DNS query failed with rcode: %s",
-			dns.RcodeToString[response.Rcode])
+		return nil, &RcodeError{Op: "query", Rcode: response.Rcode}
 	}
 
 	return response, nil
 }
 
+// Transfer performs a TSIG-signed AXFR of a zone and returns all records,
+// including the leading and trailing SOA
+func (c *Client) Transfer(zone string) ([]dns.RR, error) {
+	msg := new(dns.Msg)
+	msg.SetAxfr(dns.Fqdn(zone))
+
+	transfer := &dns.Transfer{
+		DialTimeout:  c.timeout,
+		ReadTimeout:  c.timeout,
+		WriteTimeout: c.timeout,
+	}
+	transfer.TsigSecret = c.sign(msg)
+
+	envelopes, err := transfer.In(msg, c.server)
+	if err != nil {
+		return nil, fmt.Errorf("zone transfer failed: %w", err)
+	}
+
+	var rrs []dns.RR
+	for env := range envelopes {
+		if env.Error != nil {
+			return nil, fmt.Errorf("zone transfer failed: %w", env.Error)
+		}
+		rrs = append(rrs, env.RR...)
+	}
+
+	if len(rrs) == 0 {
+		return nil, ErrNoResponse
+	}
+
+	return rrs, nil
+}
+
 // BuildPTRUpdate creates an update message for adding a PTR record to a catalog zone
 // This implements the idempotent catalog update from spec 10.4
 func BuildPTRUpdate(catalogZone, memberZone, label string, ttl uint32) (*dns.Msg, error) {
@@ -226,3 +272,21 @@ func BuildPTRDelete(catalogZone, label string) (*dns.Msg, error) {
 
 	return update, nil
 }
+
+// BuildNoopUpdate creates an update message with only a prerequisite (the
+// zone's SOA RRset exists) and no changes. A NOERROR response proves the
+// zone is dynamically updatable with the client's TSIG key.
+func BuildNoopUpdate(zone string) *dns.Msg {
+	update := new(dns.Msg)
+	update.SetUpdate(dns.Fqdn(zone))
+
+	update.RRsetUsed([]dns.RR{
+		&dns.RR_Header{
+			Name:   dns.Fqdn(zone),
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassANY,
+		},
+	})
+
+	return update
+}
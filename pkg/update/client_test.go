@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dlukt/dnsctl/internal/dnstest"
 	"github.com/miekg/dns"
 )
 
@@ -298,3 +299,113 @@ func TestPTRUpdateIdempotency(t *testing.T) {
 		t.Error("BuildPTRUpdate() should include insert")
 	}
 }
+
+// TestRcodeError tests rcode error messages and prerequisite classification
+func TestRcodeError(t *testing.T) {
+	tests := []struct {
+		op         string
+		rcode      int
+		wantMsg    string
+		wantPrereq bool
+	}{
+		{"update", dns.RcodeRefused, "DNS update failed with rcode: REFUSED (5)", false},
+		{"update", dns.RcodeNotAuth, "DNS update failed with rcode: NOTAUTH (9)", false},
+		{"update", dns.RcodeYXRrset, "DNS update failed with rcode: YXRRSET (7)", true},
+		{"update", dns.RcodeNXRrset, "DNS update failed with rcode: NXRRSET (8)", true},
+		{"update", dns.RcodeNameError, "DNS update failed with rcode: NXDOMAIN (3)", true},
+		{"query", dns.RcodeServerFailure, "DNS query failed with rcode: SERVFAIL", false},
+		{"query", dns.RcodeNameError, "DNS query failed with rcode: NXDOMAIN", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op+"_"+dns.RcodeToString[tt.rcode], func(t *testing.T) {
+			err := &RcodeError{Op: tt.op, Rcode: tt.rcode}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.wantMsg)
+			}
+			if err.PrerequisiteFailed() != tt.wantPrereq {
+				t.Errorf("PrerequisiteFailed() = %v, want %v", err.PrerequisiteFailed(), tt.wantPrereq)
+			}
+		})
+	}
+}
+
+// testTSIGSecret is a base64 TSIG secret used by the in-process test server
+const testTSIGSecret = "c2VjcmV0LWtleS1mb3ItZG5zY3RsLXRlc3Rz"
+
+// TestTransfer tests a TSIG-signed AXFR against an in-process server
+func TestTransfer(t *testing.T) {
+	records := []string{
+		"catalog.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+		"catalog.example. 60 IN NS invalid.",
+		"abc.zones.catalog.example. 60 IN PTR example.com.",
+		"catalog.example. 60 IN SOA invalid. invalid. 1 3600 600 86400 60",
+	}
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.IsTsig() == nil || w.TsigStatus() != nil {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeRefused)
+			_ = w.WriteMsg(m)
+			return
+		}
+
+		var rrs []dns.RR
+		for _, line := range records {
+			rr, _ := dns.NewRR(line)
+			rrs = append(rrs, rr)
+		}
+
+		ch := make(chan *dns.Envelope, 1)
+		ch <- &dns.Envelope{RR: rrs}
+		close(ch)
+
+		tr := new(dns.Transfer)
+		tr.TsigSecret = map[string]string{"dnsctl-test.": testTSIGSecret}
+		_ = tr.Out(w, r, ch)
+		w.Hijack()
+	})
+	addr := dnstest.Serve(t, handler, map[string]string{"dnsctl-test.": testTSIGSecret})
+
+	t.Run("signed transfer", func(t *testing.T) {
+		client := NewClient(addr, "dnsctl-test.", testTSIGSecret, dns.HmacSHA256)
+		client.SetTimeout(2 * time.Second)
+
+		rrs, err := client.Transfer("catalog.example.")
+		if err != nil {
+			t.Fatalf("Transfer() error = %v", err)
+		}
+		if len(rrs) != len(records) {
+			t.Errorf("Transfer() returned %d records, want %d", len(rrs), len(records))
+		}
+	})
+
+	t.Run("unsigned transfer refused", func(t *testing.T) {
+		client := NewClient(addr, "", "", "")
+		client.SetTimeout(2 * time.Second)
+
+		if _, err := client.Transfer("catalog.example."); err == nil {
+			t.Error("Transfer() without TSIG should fail")
+		}
+	})
+}
+
+// TestBuildNoopUpdate tests that the no-op update carries only a prerequisite
+func TestBuildNoopUpdate(t *testing.T) {
+	msg := BuildNoopUpdate("catalog.example.")
+
+	if msg.Opcode != dns.OpcodeUpdate {
+		t.Errorf("Opcode = %d, want %d", msg.Opcode, dns.OpcodeUpdate)
+	}
+	if len(msg.Ns) != 0 {
+		t.Errorf("update section has %d records, want 0", len(msg.Ns))
+	}
+	if len(msg.Answer) != 1 {
+		t.Fatalf("prerequisite section has %d records, want 1", len(msg.Answer))
+	}
+
+	prereq := msg.Answer[0].Header()
+	if prereq.Name != "catalog.example." || prereq.Rrtype != dns.TypeSOA || prereq.Class != dns.ClassANY {
+		t.Errorf("prerequisite = %s, want SOA RRset-exists for catalog.example.", msg.Answer[0])
+	}
+}
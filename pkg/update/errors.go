@@ -0,0 +1,37 @@
+package update
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// ErrNoResponse means the DNS server did not return a response
+var ErrNoResponse = errors.New("no response from DNS server")
+
+// RcodeError reports a DNS response with an unexpected rcode
+type RcodeError struct {
+	Op    string // "update" or "query"
+	Rcode int    // Response code returned by the server
+}
+
+// Error describes the failed operation and rcode
+func (e *RcodeError) Error() string {
+	if e.Op == "query" {
+		return fmt.Sprintf("DNS query failed with rcode: %s", dns.RcodeToString[e.Rcode])
+	}
+	return fmt.Sprintf("DNS update failed with rcode: %s (%d)", dns.RcodeToString[e.Rcode], e.Rcode)
+}
+
+// PrerequisiteFailed reports whether the server rejected an update because
+// an RFC2136 prerequisite was not satisfied (YXDOMAIN, YXRRSET, NXDOMAIN, NXRRSET)
+func (e *RcodeError) PrerequisiteFailed() bool {
+	switch e.Rcode {
+	case dns.RcodeYXDomain, dns.RcodeYXRrset, dns.RcodeNXRrset:
+		return true
+	case dns.RcodeNameError:
+		return e.Op == "update"
+	}
+	return false
+}